@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/Adi-ty/chess/internal/engine"
+)
+
+const (
+	Inaccuracy = "inaccuracy"
+	Mistake    = "mistake"
+	Blunder    = "blunder"
+)
+
+// Drops in winning chances, on a scale from -1 to 1, from which a move is
+// classified.
+const (
+	inaccuracyThreshold = 0.1
+	mistakeThreshold    = 0.2
+	blunderThreshold    = 0.3
+)
+
+// eval is the evaluation of a position from White's point of view. Mate is
+// 0 with mated set when the position is checkmate.
+type eval struct {
+	CP    *int
+	Mate  *int
+	mated bool
+	// chances are White's winning chances, from -1 to 1.
+	chances float64
+}
+
+// whiteEval converts an engine score for the side to move to White's point
+// of view.
+func whiteEval(score engine.Score, whiteToMove bool) eval {
+	sign := 1
+	if !whiteToMove {
+		sign = -1
+	}
+	if score.Mate != 0 {
+		mate := score.Mate * sign
+		return eval{Mate: &mate, chances: mateChances(mate)}
+	}
+	cp := score.CP * sign
+	return eval{CP: &cp, chances: winningChances(cp)}
+}
+
+// checkmateEval is the evaluation of a position where the side to move is
+// mated.
+func checkmateEval(whiteToMove bool) eval {
+	mate := 0
+	chances := 1.0
+	if whiteToMove {
+		chances = -1
+	}
+	return eval{Mate: &mate, mated: true, chances: chances}
+}
+
+func drawEval() eval {
+	cp := 0
+	return eval{CP: &cp}
+}
+
+// winningChances maps centipawns to winning chances with the logistic curve
+// fitted by Lichess to its games.
+func winningChances(cp int) float64 {
+	cp = max(-1000, min(1000, cp))
+	return 2/(1+math.Exp(-0.00368208*float64(cp))) - 1
+}
+
+// mateChances treats a mate as a large advantage that grows as the mate gets
+// closer.
+func mateChances(mate int) float64 {
+	cp := (21 - min(10, abs(mate))) * 100
+	if mate < 0 {
+		cp = -cp
+	}
+	return winningChances(cp)
+}
+
+// classify names a move by how much it lowered the mover's winning chances.
+func classify(drop float64) string {
+	switch {
+	case drop >= blunderThreshold:
+		return Blunder
+	case drop >= mistakeThreshold:
+		return Mistake
+	case drop >= inaccuracyThreshold:
+		return Inaccuracy
+	}
+	return ""
+}
+
+// moveAccuracy scores a move from 0 to 100 by the drop of the mover's win
+// percentage, following the formula used by Lichess.
+func moveAccuracy(drop float64) float64 {
+	winDrop := max(0, drop) * 50
+	accuracy := 103.1668*math.Exp(-0.04354*winDrop) - 3.1669
+	return max(0, min(100, accuracy))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/engine"
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/notnil/chess"
+	"github.com/redis/go-redis/v9"
+)
+
+// Service queues finished games for analysis and runs the analyses taken
+// from the queue by the analysis worker.
+type Service struct {
+	analysisStore store.AnalysisStore
+	gameStore     store.GameStore
+	redisClient   *redis.Client
+	engine        engine.Engine
+	limits        engine.Limits
+}
+
+func NewService(analysisStore store.AnalysisStore, gameStore store.GameStore, redisClient *redis.Client, eng engine.Engine, limits engine.Limits) *Service {
+	return &Service{
+		analysisStore: analysisStore,
+		gameStore:     gameStore,
+		redisClient:   redisClient,
+		engine:        eng,
+		limits:        limits,
+	}
+}
+
+// Request queues a game played from fen, or from the standard position when
+// fen is empty, for analysis unless it was queued before.
+func (s *Service) Request(ctx context.Context, gameID string, fen string, moves []string) error {
+	created, err := s.analysisStore.CreateAnalysis(ctx, gameID)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return nil
+	}
+	return queue.EnqueueAnalysis(s.redisClient, queue.AnalysisPayload{GameID: gameID, FEN: fen, Moves: moves})
+}
+
+// RequeueStale queues again the analyses left running since before
+// startedBefore by a worker that died, rebuilding them from the stored game.
+func (s *Service) RequeueStale(ctx context.Context, startedBefore time.Time) error {
+	gameIDs, err := s.analysisStore.ResetStaleAnalyses(ctx, startedBefore)
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		game, err := s.gameStore.GetGameByID(ctx, gameID)
+		if err != nil {
+			s.fail(ctx, gameID, fmt.Errorf("load game: %w", err))
+			continue
+		}
+		if game == nil {
+			s.fail(ctx, gameID, errors.New("game not found"))
+			continue
+		}
+		stored, err := s.gameStore.GetMovesByGameID(ctx, gameID)
+		if err != nil {
+			s.fail(ctx, gameID, fmt.Errorf("load moves: %w", err))
+			continue
+		}
+		moves := make([]string, 0, len(stored))
+		for _, m := range stored {
+			moves = append(moves, m.Move)
+		}
+		if err := queue.EnqueueAnalysis(s.redisClient, queue.AnalysisPayload{GameID: gameID, FEN: game.InitialFEN, Moves: moves}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail records that the game's analysis could not be queued again.
+func (s *Service) fail(ctx context.Context, gameID string, err error) {
+	if updateErr := s.analysisStore.UpdateAnalysisStatus(ctx, gameID, store.AnalysisFailed, err.Error()); updateErr != nil {
+		log.Printf("Failed to record analysis failure of game %s: %v", gameID, updateErr)
+	}
+}
+
+func (s *Service) Get(ctx context.Context, gameID string) (*store.Analysis, error) {
+	return s.analysisStore.GetAnalysis(ctx, gameID)
+}
+
+// Analyze evaluates every position of the game and stores the result. A
+// failure is recorded on the analysis as well as returned.
+func (s *Service) Analyze(ctx context.Context, payload queue.AnalysisPayload) error {
+	if err := s.analysisStore.UpdateAnalysisStatus(ctx, payload.GameID, store.AnalysisRunning, ""); err != nil {
+		return err
+	}
+
+	analysis, err := s.analyze(ctx, payload)
+	if err != nil {
+		if updateErr := s.analysisStore.UpdateAnalysisStatus(ctx, payload.GameID, store.AnalysisFailed, err.Error()); updateErr != nil {
+			return fmt.Errorf("%w (recording failure: %v)", err, updateErr)
+		}
+		return err
+	}
+	return s.analysisStore.SaveAnalysis(ctx, analysis)
+}
+
+func (s *Service) analyze(ctx context.Context, payload queue.AnalysisPayload) (*store.Analysis, error) {
+	var opts []func(*chess.Game)
+	if payload.FEN != "" {
+		fen, err := chess.FEN(payload.FEN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid starting position: %w", err)
+		}
+		opts = append(opts, fen)
+	}
+	game := chess.NewGame(opts...)
+	for _, m := range payload.Moves {
+		mv, err := chess.UCINotation{}.Decode(game.Position(), m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid move %s: %w", m, err)
+		}
+		if err := game.Move(mv); err != nil {
+			return nil, fmt.Errorf("illegal move %s: %w", m, err)
+		}
+	}
+	positions := game.Positions()
+	moves := game.Moves()
+
+	// evals[i] and best[i] describe positions[i], before moves[i].
+	evals := make([]eval, len(positions))
+	best := make([]engine.Result, len(positions))
+	depth := 0
+	for i, pos := range positions {
+		whiteToMove := pos.Turn() == chess.White
+		switch pos.Status() {
+		case chess.Checkmate:
+			evals[i] = checkmateEval(whiteToMove)
+			continue
+		case chess.Stalemate:
+			evals[i] = drawEval()
+			continue
+		}
+
+		result, err := s.engine.Search(ctx, engine.Position{FEN: payload.FEN, Moves: payload.Moves[:i]}, s.limits)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate ply %d: %w", i, err)
+		}
+		evals[i] = whiteEval(result.Score, whiteToMove)
+		best[i] = result
+		depth = max(depth, result.Depth)
+	}
+
+	analysis := &store.Analysis{
+		GameID: payload.GameID,
+		Depth:  depth,
+		Moves:  make([]store.MoveAnalysis, 0, len(moves)),
+	}
+	var accuracy [2]float64
+	var counted [2]int
+	for i, mv := range moves {
+		after := evals[i+1]
+		record := store.MoveAnalysis{
+			Ply:      i + 1,
+			Move:     payload.Moves[i],
+			SAN:      chess.AlgebraicNotation{}.Encode(positions[i], mv),
+			EvalCP:   after.CP,
+			EvalMate: after.Mate,
+			BestMove: best[i].BestMove,
+			BestLine: best[i].PV,
+		}
+
+		side := 0
+		drop := evals[i].chances - after.chances
+		if positions[i].Turn() == chess.Black {
+			side = 1
+			drop = -drop
+		}
+		if record.Move != record.BestMove && !after.mated {
+			record.Classification = classify(drop)
+		}
+		accuracy[side] += moveAccuracy(drop)
+		counted[side]++
+
+		analysis.Moves = append(analysis.Moves, record)
+	}
+
+	if counted[0] > 0 {
+		white := accuracy[0] / float64(counted[0])
+		analysis.WhiteAccuracy = &white
+	}
+	if counted[1] > 0 {
+		black := accuracy[1] / float64(counted[1])
+		analysis.BlackAccuracy = &black
+	}
+	return analysis, nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultDeadMoveLimit is how many dead-lettered moves are listed when the
+// request does not say.
+const defaultDeadMoveLimit = 100
+
+// AdminHandler serves the operator endpoints, open to the configured admin
+// users only.
+type AdminHandler struct {
+	logger      *log.Logger
+	redisClient *redis.Client
+	admins      map[string]bool
+}
+
+func NewAdminHandler(logger *log.Logger, redisClient *redis.Client, adminUserIDs []string) *AdminHandler {
+	admins := make(map[string]bool, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		admins[id] = true
+	}
+	return &AdminHandler{
+		logger:      logger,
+		redisClient: redisClient,
+		admins:      admins,
+	}
+}
+
+// HandleListDeadMoves lists the moves the worker gave up writing, oldest
+// first, up to the optional limit query parameter.
+func (h *AdminHandler) HandleListDeadMoves(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	limit := int64(defaultDeadMoveLimit)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	moves, err := queue.ListDeadMoves(r.Context(), h.redisClient, limit)
+	if err != nil {
+		h.logger.Printf("Failed to list dead-lettered moves: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list dead-lettered moves")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"moves": moves})
+}
+
+// HandleReplayDeadMove puts a dead-lettered move back on the move queue.
+func (h *AdminHandler) HandleReplayDeadMove(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	err := queue.ReplayDeadMove(r.Context(), h.redisClient, r.PathValue("id"))
+	switch {
+	case errors.Is(err, queue.ErrDeadMoveNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		h.logger.Printf("Failed to replay dead-lettered move %s: %v", r.PathValue("id"), err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to replay move")
+	default:
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}
+}
+
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return false
+	}
+	if !h.admins[userCtx.UserID] {
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+	return true
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/rating"
 	"github.com/Adi-ty/chess/internal/store"
 )
 
@@ -17,6 +18,7 @@ type AuthHandler struct {
 	googleOAuth *auth.GoogleOAuth
 	jwtService  *auth.JWTService
 	userStore   store.UserStore
+	ratings     *rating.Service
 }
 
 func NewAuthHandler(
@@ -24,12 +26,14 @@ func NewAuthHandler(
 	googleOAuth *auth.GoogleOAuth,
 	jwtService *auth.JWTService,
 	userStore store.UserStore,
+	ratings *rating.Service,
 ) *AuthHandler {
 	return &AuthHandler{
 		logger:      logger,
 		googleOAuth: googleOAuth,
 		jwtService:  jwtService,
 		userStore:   userStore,
+		ratings:     ratings,
 	}
 }
 
@@ -138,8 +142,16 @@ func (h *AuthHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ratings, err := h.ratings.Ratings(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Printf("Failed to get ratings: %v", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(struct {
+		*store.User
+		Ratings []store.Rating `json:"ratings"`
+	}{User: user, Ratings: ratings})
 }
 
 func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
@@ -160,4 +172,3 @@ func generateState() string {
 	rand.Read(b)
 	return base64.URLEncoding.EncodeToString(b)
 }
-
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/challenge"
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+
+	// streamKeepAlive is how often an empty line is written to idle streams
+	// so proxies and clients do not time them out.
+	streamKeepAlive = 10 * time.Second
+
+	maxBotNameLength = 100
+)
+
+type BotHandler struct {
+	logger     *log.Logger
+	userStore  store.UserStore
+	tokens     *auth.APITokenService
+	gm         *gamemanager.GameManager
+	challenges *challenge.Service
+}
+
+func NewBotHandler(
+	logger *log.Logger,
+	userStore store.UserStore,
+	tokens *auth.APITokenService,
+	gm *gamemanager.GameManager,
+	challenges *challenge.Service,
+) *BotHandler {
+	return &BotHandler{
+		logger:     logger,
+		userStore:  userStore,
+		tokens:     tokens,
+		gm:         gm,
+		challenges: challenges,
+	}
+}
+
+type createBotRequest struct {
+	DisplayName string `json:"display_name"`
+}
+
+// HandleCreateBot creates a bot account owned by the logged-in user and
+// returns its API token. The token is only shown once.
+func (h *BotHandler) HandleCreateBot(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req createBotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	if req.DisplayName == "" || len(req.DisplayName) > maxBotNameLength {
+		writeJSONError(w, http.StatusBadRequest, "invalid display name")
+		return
+	}
+
+	owner, err := h.userStore.GetUserByID(r.Context(), userCtx.UserID)
+	if err != nil {
+		h.logger.Printf("Failed to get user: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create bot")
+		return
+	}
+	if owner.Provider == store.ProviderBot {
+		writeJSONError(w, http.StatusForbidden, "bots cannot create bots")
+		return
+	}
+
+	bot, err := h.userStore.CreateBotUser(r.Context(), owner.ID, req.DisplayName)
+	if err != nil {
+		h.logger.Printf("Failed to create bot: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create bot")
+		return
+	}
+
+	token, err := h.tokens.Issue(r.Context(), bot.ID)
+	if err != nil {
+		h.logger.Printf("Failed to issue bot token: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"bot": bot, "token": token})
+}
+
+func (h *BotHandler) HandleListBots(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	bots, err := h.userStore.GetBotsByOwner(r.Context(), userCtx.UserID)
+	if err != nil {
+		h.logger.Printf("Failed to list bots: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list bots")
+		return
+	}
+	if bots == nil {
+		bots = []store.User{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"bots": bots})
+}
+
+// HandleRegenerateToken revokes a bot's tokens and issues a new one.
+func (h *BotHandler) HandleRegenerateToken(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	bots, err := h.userStore.GetBotsByOwner(r.Context(), userCtx.UserID)
+	if err != nil {
+		h.logger.Printf("Failed to list bots: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+
+	botID := r.PathValue("id")
+	owned := false
+	for _, bot := range bots {
+		owned = owned || bot.ID == botID
+	}
+	if !owned {
+		writeJSONError(w, http.StatusNotFound, "bot not found")
+		return
+	}
+
+	token, err := h.tokens.Issue(r.Context(), botID)
+	if err != nil {
+		h.logger.Printf("Failed to issue bot token: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
+// HandleStreamEvents streams the bot's incoming challenges, game starts and
+// game ends as NDJSON. Games already in progress are announced first.
+func (h *BotHandler) HandleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	events, stop := h.gm.Listen(userCtx.UserID)
+	defer stop()
+
+	stream := newNDJSONStream(w)
+	for _, gameID := range h.gm.ActiveGames(userCtx.UserID) {
+		if snapshot, err := h.gm.GameSnapshot(gameID); err == nil {
+			stream.writeEvent(gamemanager.UserEvent{GameID: gameID, Message: snapshot})
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := stream.writeEvent(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := stream.writeLine(nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// HandleStreamGame streams a game as NDJSON: the current state first, then
+// every event of the game until it ends.
+func (h *BotHandler) HandleStreamGame(w http.ResponseWriter, r *http.Request) {
+	gameID := r.PathValue("gameID")
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Follow before taking the snapshot so no move is missed. Moves already
+	// in the snapshot can be recognised by their ply.
+	events, err := h.gm.Follow(ctx, gameID)
+	if err != nil {
+		h.logger.Printf("Failed to follow game %s: %v", gameID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to stream game")
+		return
+	}
+
+	snapshot, err := h.gm.GameSnapshot(gameID)
+	if err != nil {
+		writePlayError(h.logger, w, err)
+		return
+	}
+
+	stream := newNDJSONStream(w)
+	if err := stream.writeJSON(snapshot); err != nil {
+		return
+	}
+	if snapshot.Status != string(gamemanager.GameStatusInProgress) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := stream.writeLine(payload); err != nil {
+				return
+			}
+			var event struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(payload, &event) == nil && event.Type == gamemanager.GAME_OVER {
+				return
+			}
+		case <-keepAlive.C:
+			if err := stream.writeLine(nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *BotHandler) HandleMove(w http.ResponseWriter, r *http.Request) {
+	h.play(w, r, gamemanager.MOVE, r.PathValue("move"))
+}
+
+func (h *BotHandler) HandleResign(w http.ResponseWriter, r *http.Request) {
+	h.play(w, r, gamemanager.RESIGN, "")
+}
+
+func (h *BotHandler) HandleClaimVictory(w http.ResponseWriter, r *http.Request) {
+	h.play(w, r, gamemanager.CLAIM_VICTORY, "")
+}
+
+func (h *BotHandler) HandleClaimDraw(w http.ResponseWriter, r *http.Request) {
+	h.play(w, r, gamemanager.CLAIM_DRAW, "")
+}
+
+type chatRequest struct {
+	Text string `json:"text"`
+}
+
+func (h *BotHandler) HandleChat(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.gm.Chat(userCtx.UserID, r.PathValue("gameID"), req.Text); err != nil {
+		writePlayError(h.logger, w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (h *BotHandler) HandleAcceptChallenge(w http.ResponseWriter, r *http.Request) {
+	h.respondChallenge(w, r, h.challenges.Accept)
+}
+
+func (h *BotHandler) HandleDeclineChallenge(w http.ResponseWriter, r *http.Request) {
+	h.respondChallenge(w, r, h.challenges.Decline)
+}
+
+func (h *BotHandler) respondChallenge(w http.ResponseWriter, r *http.Request, respond func(ctx context.Context, code string, userID string) (*challenge.Challenge, error)) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	c, err := respond(r.Context(), r.PathValue("code"), userCtx.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrChallengeNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, challenge.ErrNotParticipant):
+			writeJSONError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, store.ErrChallengeUnavailable):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			h.logger.Printf("Failed to answer challenge: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to answer challenge")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *BotHandler) play(w http.ResponseWriter, r *http.Request, action string, move string) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if err := h.gm.Play(userCtx.UserID, r.PathValue("gameID"), action, move); err != nil {
+		writePlayError(h.logger, w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// writePlayError maps the errors of GameManager.Play and Chat to HTTP
+// statuses.
+func writePlayError(logger *log.Logger, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gamemanager.ErrGameNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, gamemanager.ErrNotInGame):
+		writeJSONError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, gamemanager.ErrGameNotOnServer):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, gamemanager.ErrChatRateLimited):
+		writeJSONError(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, gamemanager.ErrGameEnded),
+		errors.Is(err, gamemanager.ErrNotYourTurn),
+		errors.Is(err, gamemanager.ErrInvalidMove),
+		errors.Is(err, gamemanager.ErrEmptyMove),
+		errors.Is(err, gamemanager.ErrTimeExpired),
+		errors.Is(err, gamemanager.ErrOpponentConnected),
+		errors.Is(err, gamemanager.ErrClaimTooEarly),
+		errors.Is(err, gamemanager.ErrNotCorrespondence),
+		errors.Is(err, gamemanager.ErrConditionalOnYourTurn),
+		errors.Is(err, gamemanager.ErrTooManyConditionals),
+		errors.Is(err, gamemanager.ErrInvalidConditional),
+		errors.Is(err, gamemanager.ErrEmptyChat),
+		errors.Is(err, gamemanager.ErrChatTooLong):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.Printf("Play request failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "request failed")
+	}
+}
+
+// ndjsonStream writes newline-delimited JSON and flushes after every line.
+type ndjsonStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newNDJSONStream(w http.ResponseWriter) *ndjsonStream {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	s := &ndjsonStream{w: w, rc: http.NewResponseController(w)}
+	s.rc.Flush()
+	return s
+}
+
+// writeLine writes one line; an empty line keeps the stream alive.
+func (s *ndjsonStream) writeLine(line []byte) error {
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *ndjsonStream) writeJSON(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.writeLine(line)
+}
+
+// writeEvent writes a user event with its game ID added to the message.
+func (s *ndjsonStream) writeEvent(event gamemanager.UserEvent) error {
+	raw, err := json.Marshal(event.Message)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	if event.GameID != "" {
+		fields["game_id"] = event.GameID
+	}
+	return s.writeJSON(fields)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/challenge"
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+type ChallengeHandler struct {
+	logger     *log.Logger
+	challenges *challenge.Service
+}
+
+func NewChallengeHandler(logger *log.Logger, challenges *challenge.Service) *ChallengeHandler {
+	return &ChallengeHandler{
+		logger:     logger,
+		challenges: challenges,
+	}
+}
+
+func (h *ChallengeHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req challenge.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	c, err := h.challenges.Create(r.Context(), userCtx.UserID, req)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func (h *ChallengeHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	challenges, err := h.challenges.List(r.Context(), userCtx.UserID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"challenges": challenges})
+}
+
+func (h *ChallengeHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	c, err := h.challenges.Get(r.Context(), r.PathValue("code"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *ChallengeHandler) HandleAccept(w http.ResponseWriter, r *http.Request) {
+	h.handleAction(w, r, h.challenges.Accept)
+}
+
+func (h *ChallengeHandler) HandleDecline(w http.ResponseWriter, r *http.Request) {
+	h.handleAction(w, r, h.challenges.Decline)
+}
+
+func (h *ChallengeHandler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	h.handleAction(w, r, h.challenges.Cancel)
+}
+
+func (h *ChallengeHandler) handleAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, code string, userID string) (*challenge.Challenge, error)) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	c, err := action(r.Context(), r.PathValue("code"), userCtx.UserID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *ChallengeHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrChallengeNotFound), errors.Is(err, store.ErrUserNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrChallengeUnavailable):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, challenge.ErrNotParticipant):
+		writeJSONError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, challenge.ErrChallengeSelf),
+		errors.Is(err, challenge.ErrInvalidExpiry),
+		errors.Is(err, gamemanager.ErrInvalidTimeControl),
+		errors.Is(err, matchmaking.ErrInvalidColor),
+		errors.Is(err, variant.ErrUnknownVariant),
+		errors.Is(err, variant.ErrInvalidFEN),
+		errors.Is(err, variant.ErrIllegalPosition):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.logger.Printf("Challenge request failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "challenge request failed")
+	}
+}
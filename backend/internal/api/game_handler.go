@@ -0,0 +1,398 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/analysis"
+	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/pgn"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
+	"github.com/google/uuid"
+)
+
+const (
+	pgnContentType = "application/x-chess-pgn"
+
+	defaultGamesLimit = 20
+	maxGamesLimit     = 100
+)
+
+type GameHandler struct {
+	logger    *log.Logger
+	gameStore store.GameStore
+	userStore store.UserStore
+	pgns      *pgn.Service
+	analyses  *analysis.Service
+	gm        *gamemanager.GameManager
+}
+
+func NewGameHandler(logger *log.Logger, gameStore store.GameStore, userStore store.UserStore, pgns *pgn.Service, analyses *analysis.Service, gm *gamemanager.GameManager) *GameHandler {
+	return &GameHandler{
+		logger:    logger,
+		gameStore: gameStore,
+		userStore: userStore,
+		pgns:      pgns,
+		analyses:  analyses,
+		gm:        gm,
+	}
+}
+
+type GamePlayer struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+type GameMove struct {
+	Ply       int       `json:"ply"`
+	UserID    string    `json:"user_id"`
+	UCI       string    `json:"uci"`
+	SAN       string    `json:"san"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GameDetail struct {
+	*store.Game
+	White GamePlayer `json:"white"`
+	Black GamePlayer `json:"black"`
+	Moves []GameMove `json:"moves"`
+	FEN   string     `json:"fen"`
+}
+
+func (h *GameHandler) HandleListUserGames(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	if _, err := uuid.Parse(userID); err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	filter, err := parseGameFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Fetch one extra game to know whether there is another page.
+	limit := filter.Limit
+	filter.Limit++
+	games, err := h.gameStore.ListGamesByUserID(r.Context(), userID, filter)
+	if err != nil {
+		h.logger.Printf("Failed to list games: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list games")
+		return
+	}
+
+	hasMore := len(games) > limit
+	if hasMore {
+		games = games[:limit]
+	}
+	if games == nil {
+		games = []store.Game{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"games":    games,
+		"limit":    limit,
+		"offset":   filter.Offset,
+		"has_more": hasMore,
+	})
+}
+
+func (h *GameHandler) HandleGetGame(w http.ResponseWriter, r *http.Request) {
+	gameID := r.PathValue("id")
+	if _, err := uuid.Parse(gameID); err != nil {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+
+	game, err := h.gameStore.GetGameByID(r.Context(), gameID)
+	if err != nil {
+		h.logger.Printf("Failed to get game: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get game")
+		return
+	}
+	if game == nil {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+
+	moves, err := h.gameStore.GetMovesByGameID(r.Context(), gameID)
+	if err != nil {
+		h.logger.Printf("Failed to get moves: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get moves")
+		return
+	}
+
+	board, err := variant.NewBoard(variant.Variant(game.Variant), game.InitialFEN)
+	if err != nil {
+		h.logger.Printf("Failed to set up board of game %s: %v", gameID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get game")
+		return
+	}
+	detail := GameDetail{
+		Game:  game,
+		White: h.player(r, game.WhiteUserID),
+		Black: h.player(r, game.BlackUserID),
+		Moves: make([]GameMove, 0, len(moves)),
+	}
+	for _, m := range moves {
+		mv, err := board.Move(m.Move)
+		if err != nil {
+			h.logger.Printf("Failed to replay move %s of game %s: %v", m.Move, gameID, err)
+			break
+		}
+
+		sec, frac := math.Modf(m.CreatedAt)
+		detail.Moves = append(detail.Moves, GameMove{
+			Ply:       m.MoveNumber,
+			UserID:    m.UserID,
+			UCI:       m.Move,
+			SAN:       mv.SAN,
+			CreatedAt: time.Unix(int64(sec), int64(frac*1e9)).UTC(),
+		})
+	}
+	detail.FEN = board.FEN()
+
+	writeJSON(w, http.StatusOK, detail)
+}
+
+type moveRequest struct {
+	Move string `json:"move"`
+}
+
+// HandleMove plays the authenticated user's move, given in UCI, so games
+// such as correspondence ones can be played without a websocket connection.
+func (h *GameHandler) HandleMove(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req moveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.gm.Play(userCtx.UserID, r.PathValue("id"), gamemanager.MOVE, req.Move); err != nil {
+		writePlayError(h.logger, w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+type conditionalMovesRequest struct {
+	Lines [][]string `json:"lines"`
+}
+
+// HandleGetConditionalMoves returns the authenticated user's conditional
+// move lines in a correspondence game.
+func (h *GameHandler) HandleGetConditionalMoves(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	lines, err := h.gm.ConditionalMoves(r.PathValue("id"), userCtx.UserID)
+	if err != nil {
+		writePlayError(h.logger, w, err)
+		return
+	}
+	if lines == nil {
+		lines = [][]string{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lines": lines})
+}
+
+// HandleSetConditionalMoves replaces the authenticated user's conditional
+// move lines in a correspondence game. Each line alternates the opponent's
+// moves and the user's replies in UCI; no lines clears them.
+func (h *GameHandler) HandleSetConditionalMoves(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req conditionalMovesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	lines, err := h.gm.SetConditionalMoves(r.PathValue("id"), userCtx.UserID, req.Lines)
+	if err != nil {
+		writePlayError(h.logger, w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lines": lines})
+}
+
+// HandleListCorrespondence lists the authenticated user's correspondence
+// games in progress, the most urgent first.
+func (h *GameHandler) HandleListCorrespondence(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	games, err := h.gameStore.ListCorrespondenceGames(r.Context(), userCtx.UserID)
+	if err != nil {
+		h.logger.Printf("Failed to list correspondence games: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list games")
+		return
+	}
+	if games == nil {
+		games = []store.Game{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"games": games})
+}
+
+// player returns the public profile of a game's player. A deleted account
+// is reported with its ID only.
+func (h *GameHandler) player(r *http.Request, userID string) GamePlayer {
+	user, err := h.userStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return GamePlayer{ID: userID}
+	}
+	return GamePlayer{ID: user.ID, DisplayName: user.DisplayName, AvatarURL: user.AvatarURL}
+}
+
+func parseGameFilter(r *http.Request) (store.GameFilter, error) {
+	q := r.URL.Query()
+	filter := store.GameFilter{
+		Result:       q.Get("result"),
+		Color:        q.Get("color"),
+		TimeControl:  q.Get("time_control"),
+		TimeCategory: q.Get("category"),
+		OpponentID:   q.Get("opponent"),
+		Limit:        defaultGamesLimit,
+	}
+
+	switch filter.Result {
+	case "", "win", "loss", "draw":
+	default:
+		return filter, errors.New("invalid result")
+	}
+	switch filter.Color {
+	case "", "white", "black":
+	default:
+		return filter, errors.New("invalid color")
+	}
+	if filter.OpponentID != "" {
+		if _, err := uuid.Parse(filter.OpponentID); err != nil {
+			return filter, errors.New("invalid opponent")
+		}
+	}
+
+	var err error
+	if filter.From, err = parseDate(q.Get("from")); err != nil {
+		return filter, errors.New("invalid from")
+	}
+	if filter.To, err = parseDate(q.Get("to")); err != nil {
+		return filter, errors.New("invalid to")
+	}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return filter, errors.New("invalid limit")
+		}
+		filter.Limit = min(n, maxGamesLimit)
+	}
+	if o := q.Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			return filter, errors.New("invalid offset")
+		}
+		filter.Offset = n
+	}
+
+	return filter, nil
+}
+
+// parseDate accepts an RFC 3339 timestamp or a plain date.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+func (h *GameHandler) HandleGetPGN(w http.ResponseWriter, r *http.Request) {
+	gameID := r.PathValue("id")
+	if _, err := uuid.Parse(gameID); err != nil {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+
+	text, err := h.pgns.GamePGN(r.Context(), gameID)
+	if err != nil {
+		if errors.Is(err, store.ErrGameNotFound) {
+			writeJSONError(w, http.StatusNotFound, "game not found")
+			return
+		}
+		h.logger.Printf("Failed to build PGN for game %s: %v", gameID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get pgn")
+		return
+	}
+
+	w.Header().Set("Content-Type", pgnContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", gameID+".pgn"))
+	w.Write([]byte(text))
+}
+
+// HandleGetAnalysis returns the engine analysis of a game. Its status tells
+// whether the analysis is still pending or running.
+func (h *GameHandler) HandleGetAnalysis(w http.ResponseWriter, r *http.Request) {
+	gameID := r.PathValue("id")
+	if _, err := uuid.Parse(gameID); err != nil {
+		writeJSONError(w, http.StatusNotFound, "analysis not found")
+		return
+	}
+
+	a, err := h.analyses.Get(r.Context(), gameID)
+	if err != nil {
+		if errors.Is(err, store.ErrAnalysisNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.logger.Printf("Failed to get analysis for game %s: %v", gameID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get analysis")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a)
+}
+
+// HandleExportUserPGN streams all of a user's finished games as one PGN file.
+// Once streaming has started an error can only be logged.
+func (h *GameHandler) HandleExportUserPGN(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	w.Header().Set("Content-Type", pgnContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", userID+".pgn"))
+
+	if err := h.pgns.ExportUserGames(r.Context(), userID, w); err != nil {
+		h.logger.Printf("Failed to export games of user %s: %v", userID, err)
+	}
+}
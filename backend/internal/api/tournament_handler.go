@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/tournament"
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+type TournamentHandler struct {
+	logger      *log.Logger
+	tournaments *tournament.Service
+}
+
+func NewTournamentHandler(logger *log.Logger, tournaments *tournament.Service) *TournamentHandler {
+	return &TournamentHandler{
+		logger:      logger,
+		tournaments: tournaments,
+	}
+}
+
+func (h *TournamentHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req tournament.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	t, err := h.tournaments.Create(r.Context(), userCtx.UserID, req)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// HandleList lists tournaments, filtered by the optional status query
+// parameter.
+func (h *TournamentHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	tournaments, err := h.tournaments.List(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if tournaments == nil {
+		tournaments = []store.Tournament{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tournaments": tournaments})
+}
+
+func (h *TournamentHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	details, err := h.tournaments.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, details)
+}
+
+// HandleGetBracket returns the schedule and pairings of every round, or the
+// knockout bracket.
+func (h *TournamentHandler) HandleGetBracket(w http.ResponseWriter, r *http.Request) {
+	bracket, err := h.tournaments.Bracket(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bracket)
+}
+
+func (h *TournamentHandler) HandleJoin(w http.ResponseWriter, r *http.Request) {
+	h.handleAction(w, r, h.tournaments.Join)
+}
+
+func (h *TournamentHandler) HandleWithdraw(w http.ResponseWriter, r *http.Request) {
+	h.handleAction(w, r, h.tournaments.Withdraw)
+}
+
+func (h *TournamentHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	h.handleAction(w, r, h.tournaments.Start)
+}
+
+func (h *TournamentHandler) HandleBerserk(w http.ResponseWriter, r *http.Request) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if err := h.tournaments.Berserk(r.Context(), r.PathValue("id"), userCtx.UserID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (h *TournamentHandler) handleAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, id string, userID string) (*tournament.Details, error)) {
+	userCtx := auth.GetUserFromContext(r.Context())
+	if userCtx == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	details, err := action(r.Context(), r.PathValue("id"), userCtx.UserID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, details)
+}
+
+func (h *TournamentHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrTournamentNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, tournament.ErrNotCreator):
+		writeJSONError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, tournament.ErrAlreadyStarted),
+		errors.Is(err, tournament.ErrNotEnoughPlayers),
+		errors.Is(err, tournament.ErrRegistrationEnded),
+		errors.Is(err, tournament.ErrTournamentFull),
+		errors.Is(err, tournament.ErrTournamentOver),
+		errors.Is(err, tournament.ErrNotPlaying),
+		errors.Is(err, gamemanager.ErrBerserkTooLate),
+		errors.Is(err, gamemanager.ErrAlreadyBerserk),
+		errors.Is(err, gamemanager.ErrGameEnded),
+		errors.Is(err, gamemanager.ErrGameNotOnServer):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, tournament.ErrInvalidName),
+		errors.Is(err, tournament.ErrUnknownFormat),
+		errors.Is(err, tournament.ErrUntimed),
+		errors.Is(err, tournament.ErrInvalidRounds),
+		errors.Is(err, tournament.ErrInvalidDuration),
+		errors.Is(err, tournament.ErrBerserkNotAllowed),
+		errors.Is(err, tournament.ErrInvalidSchedule),
+		errors.Is(err, tournament.ErrInvalidMatchGames),
+		errors.Is(err, tournament.ErrNoBracket),
+		errors.Is(err, gamemanager.ErrInvalidTimeControl),
+		errors.Is(err, variant.ErrUnknownVariant):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.logger.Printf("Tournament request failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "tournament request failed")
+	}
+}
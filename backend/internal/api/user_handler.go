@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/rating"
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+type UserHandler struct {
+	logger    *log.Logger
+	userStore store.UserStore
+	ratings   *rating.Service
+}
+
+func NewUserHandler(logger *log.Logger, userStore store.UserStore, ratings *rating.Service) *UserHandler {
+	return &UserHandler{
+		logger:    logger,
+		userStore: userStore,
+		ratings:   ratings,
+	}
+}
+
+type UserProfile struct {
+	ID          string         `json:"id"`
+	DisplayName string         `json:"display_name"`
+	AvatarURL   string         `json:"avatar_url,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Ratings     []store.Rating `json:"ratings"`
+}
+
+func (h *UserHandler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userStore.GetUserByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		h.logger.Printf("Failed to get user: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get user")
+		return
+	}
+
+	ratings, err := h.ratings.Ratings(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Printf("Failed to get ratings: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get ratings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UserProfile{
+		ID:          user.ID,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+		Ratings:     ratings,
+	})
+}
+
+func (h *UserHandler) HandleGetRatingHistory(w http.ResponseWriter, r *http.Request) {
+	limit := defaultHistoryLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	history, err := h.ratings.History(r.Context(), r.PathValue("id"), r.URL.Query().Get("category"), limit)
+	if err != nil {
+		h.logger.Printf("Failed to get rating history: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get rating history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"history": history})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
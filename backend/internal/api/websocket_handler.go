@@ -61,3 +61,30 @@ func (h *WebSocketHandler) WsHandler(w http.ResponseWriter, r *http.Request) {
 	h.gamemanager.AddUser(conn, userID)
 }
 
+// WatchHandler upgrades a spectator connection for a game. Spectating does
+// not require authentication; a valid token only attaches the user ID.
+func (h *WebSocketHandler) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	gameID := r.PathValue("gameID")
+
+	tokenString := r.URL.Query().Get("token")
+	if tokenString == "" {
+		if cookie, err := r.Cookie("auth_token"); err == nil {
+			tokenString = cookie.Value
+		}
+	}
+
+	var userID string
+	if tokenString != "" {
+		if claims, err := h.jwtService.ValidateToken(tokenString); err == nil {
+			userID = claims.UserID
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Printf("Upgrade error: %v", err)
+		return
+	}
+
+	go h.gamemanager.AddSpectator(conn, userID, gameID)
+}
@@ -1,29 +1,48 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/Adi-ty/chess/internal/analysis"
 	"github.com/Adi-ty/chess/internal/api"
 	"github.com/Adi-ty/chess/internal/auth"
+	"github.com/Adi-ty/chess/internal/challenge"
 	"github.com/Adi-ty/chess/internal/config"
+	"github.com/Adi-ty/chess/internal/engine"
 	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/Adi-ty/chess/internal/moderation"
+	"github.com/Adi-ty/chess/internal/pgn"
+	"github.com/Adi-ty/chess/internal/rating"
 	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/tournament"
+	"github.com/Adi-ty/chess/internal/variant"
 	"github.com/Adi-ty/chess/internal/worker"
 	"github.com/Adi-ty/chess/migrations"
 	"github.com/redis/go-redis/v9"
 )
 
 type Application struct {
-	Logger           *log.Logger
-	Config           *config.Config
-	AuthHandler      *api.AuthHandler
-	WebSocketHandler *api.WebSocketHandler
-	JWTService       *auth.JWTService
-	DB               *sql.DB
-	redisClient      *redis.Client
-	worker           *worker.Worker
+	Logger            *log.Logger
+	Config            *config.Config
+	AuthHandler       *api.AuthHandler
+	UserHandler       *api.UserHandler
+	ChallengeHandler  *api.ChallengeHandler
+	TournamentHandler *api.TournamentHandler
+	GameHandler       *api.GameHandler
+	BotHandler        *api.BotHandler
+	WebSocketHandler  *api.WebSocketHandler
+	AdminHandler      *api.AdminHandler
+	JWTService        *auth.JWTService
+	APITokens         *auth.APITokenService
+	DB                *sql.DB
+	redisClient       *redis.Client
+	worker            *worker.Worker
+	analysisWorker    *worker.AnalysisWorker
 }
 
 func NewApplication() (*Application, error) {
@@ -49,11 +68,100 @@ func NewApplication() (*Application, error) {
 	// Stores
 	userStore := store.NewPostgresUserStore(pgDB)
 	gameStore := store.NewPostgresGameStore(pgDB)
+	ratingStore := store.NewPostgresRatingStore(pgDB)
+	challengeStore := store.NewPostgresChallengeStore(pgDB)
+	tokenStore := store.NewPostgresTokenStore(pgDB)
+	analysisStore := store.NewPostgresAnalysisStore(pgDB)
+	chatStore := store.NewPostgresChatStore(pgDB)
+	tournamentStore := store.NewPostgresTournamentStore(pgDB)
 
 	// Services
-	gm := gamemanager.NewGameManager(gameStore, redisDB)
+	ratingService := rating.NewService(ratingStore)
+	pgnService := pgn.NewService(gameStore, userStore, cfg.FrontendURL)
+
+	// Analysis gets its own engine so reviews never slow down bot games.
+	analysisEngine, err := engine.New(cfg.EnginePath, 1)
+	if err != nil {
+		return nil, fmt.Errorf("start analysis engine: %w", err)
+	}
+	analysisService := analysis.NewService(analysisStore, gameStore, redisDB, analysisEngine, engine.Limits{
+		Depth:    cfg.AnalysisDepth,
+		MoveTime: cfg.AnalysisMoveTime,
+	})
+
+	var matchmaker matchmaking.Matchmaker
+	if cfg.Matchmaker == "memory" {
+		matchmaker = matchmaking.NewMemoryMatchmaker()
+	} else {
+		matchmaker = matchmaking.NewRedisMatchmaker(redisDB)
+	}
+	go matchmaker.Run(context.Background())
+
+	gm := gamemanager.NewGameManager(gameStore, redisDB, matchmaker, ratingService)
+	gm.OnGameEnd(func(result gamemanager.GameResult) {
+		err := ratingService.RecordGame(context.Background(), rating.Game{
+			ID:          result.GameID,
+			WhiteUserID: result.WhiteUserID,
+			BlackUserID: result.BlackUserID,
+			Category:    result.RatingCategory(),
+			Outcome:     result.Outcome,
+			Leaver:      result.Leaver,
+			Rated:       result.Rated,
+			Plies:       result.Plies,
+		})
+		if err != nil {
+			logger.Printf("Failed to update ratings for game %s: %v", result.GameID, err)
+		}
+	})
+	gm.OnGameEnd(func(result gamemanager.GameResult) {
+		if err := pgnService.Save(context.Background(), result.PGN); err != nil {
+			logger.Printf("Failed to store PGN for game %s: %v", result.GameID, err)
+		}
+	})
+	gm.OnGameEnd(func(result gamemanager.GameResult) {
+		// The engine only knows the standard rules.
+		if result.Status != gamemanager.GameStatusCompleted || len(result.Moves) == 0 || result.Variant != variant.Standard {
+			return
+		}
+		if err := analysisService.Request(context.Background(), result.GameID, result.InitialFEN, result.Moves); err != nil {
+			logger.Printf("Failed to queue analysis for game %s: %v", result.GameID, err)
+		}
+	})
+	tournamentService := tournament.NewService(tournamentStore, ratingService, gm, redisDB)
+	gm.OnGameEnd(tournamentService.HandleGameEnd)
+
+	for category, grace := range cfg.DisconnectGrace {
+		gm.SetDisconnectGrace(gamemanager.TimeCategory(category), grace)
+	}
+	gm.SetUsers(userStore)
+	gm.SetChat(chatStore, moderation.NewWordFilter(append(moderation.DefaultWords, cfg.ChatBlockedWords...)))
+	if cfg.ClusterMode {
+		gm.EnableCluster(cfg.NodeID)
+	}
+
+	bots, err := setUpBots(cfg, userStore)
+	if err != nil {
+		return nil, err
+	}
+	gm.SetBots(bots)
+
+	// Every game end hook is registered by now: recovered and adopted games
+	// may end as soon as they start.
+	if err := gm.RecoverGames(context.Background()); err != nil {
+		return nil, err
+	}
+	if cfg.ClusterMode {
+		go gm.RunCluster(context.Background())
+	}
+	go gm.ConsumeMatches()
+	go gm.RunDeadlines(context.Background())
+	go gm.RunCleanup(context.Background())
+	go tournamentService.Run(context.Background())
+
+	challengeService := challenge.NewService(challengeStore, userStore, gm, cfg.FrontendURL)
 
 	jwtService := auth.NewJWTService(cfg.JWTSecret)
+	apiTokenService := auth.NewAPITokenService(tokenStore)
 	googleOauth := auth.NewGoogleOAuth(&auth.GoogleConfig{
 		ClientID:     cfg.GoogleClientID,
 		ClientSecret: cfg.GoogleClientSecret,
@@ -61,24 +169,65 @@ func NewApplication() (*Application, error) {
 	})
 
 	// Handlers
-	authHandler := api.NewAuthHandler(logger, googleOauth, jwtService, userStore)
+	authHandler := api.NewAuthHandler(logger, googleOauth, jwtService, userStore, ratingService)
+	userHandler := api.NewUserHandler(logger, userStore, ratingService)
+	challengeHandler := api.NewChallengeHandler(logger, challengeService)
+	tournamentHandler := api.NewTournamentHandler(logger, tournamentService)
+	gameHandler := api.NewGameHandler(logger, gameStore, userStore, pgnService, analysisService, gm)
+	botHandler := api.NewBotHandler(logger, userStore, apiTokenService, gm, challengeService)
 	websocketHandler := api.NewWebSocketHandler(logger, gm, jwtService)
+	adminHandler := api.NewAdminHandler(logger, redisDB, cfg.AdminUserIDs)
 
 	// Start worker go-routine
-	wk := worker.NewWorker(redisDB, gameStore)
+	wk := worker.NewWorker(redisDB, gameStore, cfg.NodeID)
 	go wk.Start()
 
+	analysisWorker := worker.NewAnalysisWorker(redisDB, analysisService)
+	go analysisWorker.Start()
+
 	app := &Application{
-		Logger:           logger,
-		Config:           cfg,
-		AuthHandler:      authHandler,
-		WebSocketHandler: websocketHandler,
-		JWTService:       jwtService,
-		DB:               pgDB,
-		redisClient:      redisDB,
-		worker:           wk,
+		Logger:            logger,
+		Config:            cfg,
+		AuthHandler:       authHandler,
+		UserHandler:       userHandler,
+		ChallengeHandler:  challengeHandler,
+		TournamentHandler: tournamentHandler,
+		GameHandler:       gameHandler,
+		BotHandler:        botHandler,
+		WebSocketHandler:  websocketHandler,
+		AdminHandler:      adminHandler,
+		JWTService:        jwtService,
+		APITokens:         apiTokenService,
+		DB:                pgDB,
+		redisClient:       redisDB,
+		worker:            wk,
+		analysisWorker:    analysisWorker,
 	}
 
 	return app, nil
 }
 
+// setUpBots starts the engine and makes sure every engine level has a bot
+// account to play under.
+func setUpBots(cfg *config.Config, userStore store.UserStore) (*gamemanager.Bots, error) {
+	eng, err := engine.New(cfg.EnginePath, cfg.EnginePoolSize)
+	if err != nil {
+		return nil, fmt.Errorf("start engine: %w", err)
+	}
+
+	bots := &gamemanager.Bots{Engine: eng, UserIDs: make(map[int]string)}
+	for level := engine.MinLevel; level <= engine.MaxLevel; level++ {
+		user, err := userStore.CreateOrUpdate(context.Background(), &store.User{
+			Email:       fmt.Sprintf("engine-level-%d@bots.local", level),
+			DisplayName: fmt.Sprintf("Engine level %d", level),
+			Provider:    store.ProviderBot,
+			ProviderID:  fmt.Sprintf("engine-level-%d", level),
+		})
+		if err != nil {
+			eng.Close()
+			return nil, fmt.Errorf("create bot account: %w", err)
+		}
+		bots.UserIDs[level] = user.ID
+	}
+	return bots, nil
+}
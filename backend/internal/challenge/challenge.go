@@ -0,0 +1,273 @@
+package challenge
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	mrand "math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+const (
+	DefaultExpiry = 24 * time.Hour
+	MaxExpiry     = 7 * 24 * time.Hour
+
+	codeLength = 8
+	// codeAlphabet leaves out characters that are easily confused when a
+	// code is read out or typed.
+	codeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrChallengeSelf  = errors.New("you cannot challenge yourself")
+	ErrInvalidExpiry  = errors.New("invalid expiry")
+	ErrNotParticipant = errors.New("challenge is not addressed to you")
+)
+
+// Request describes a challenge to be created. DestUserID is empty for an
+// open challenge that anyone with the link can accept. FEN is an optional
+// starting position; games from a custom position are never rated.
+type Request struct {
+	TimeControl *gamemanager.IncomingTimeControl `json:"time_control,omitempty"`
+	Color       string                           `json:"color,omitempty"`
+	Variant     string                           `json:"variant,omitempty"`
+	FEN         string                           `json:"fen,omitempty"`
+	Rated       bool                             `json:"rated"`
+	DestUserID  string                           `json:"dest_user_id,omitempty"`
+	// ExpiresIn is the lifetime of the challenge in seconds.
+	ExpiresIn int `json:"expires_in,omitempty"`
+}
+
+// Challenge is a stored challenge together with its shareable link.
+type Challenge struct {
+	*store.Challenge
+	URL string `json:"url"`
+}
+
+// Notification is pushed over the websocket to the players of a challenge.
+type Notification struct {
+	Type      string     `json:"type"`
+	Challenge *Challenge `json:"challenge"`
+}
+
+type Service struct {
+	challengeStore store.ChallengeStore
+	userStore      store.UserStore
+	gm             *gamemanager.GameManager
+	frontendURL    string
+}
+
+func NewService(challengeStore store.ChallengeStore, userStore store.UserStore, gm *gamemanager.GameManager, frontendURL string) *Service {
+	return &Service{
+		challengeStore: challengeStore,
+		userStore:      userStore,
+		gm:             gm,
+		frontendURL:    strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+func (s *Service) Create(ctx context.Context, challengerID string, req Request) (*Challenge, error) {
+	tc, err := req.TimeControl.ToTimeControl()
+	if err != nil {
+		return nil, err
+	}
+
+	color, err := matchmaking.ParseColorPreference(req.Color)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := variant.Parse(req.Variant)
+	if err != nil {
+		return nil, err
+	}
+
+	var fen string
+	if req.FEN != "" {
+		board, err := variant.NewBoard(v, req.FEN)
+		if err != nil {
+			return nil, err
+		}
+		fen = board.InitialFEN()
+	}
+
+	expiry := DefaultExpiry
+	if req.ExpiresIn != 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+		if expiry <= 0 || expiry > MaxExpiry {
+			return nil, ErrInvalidExpiry
+		}
+	}
+
+	var dest sql.NullString
+	if req.DestUserID != "" {
+		if req.DestUserID == challengerID {
+			return nil, ErrChallengeSelf
+		}
+		if _, err := s.userStore.GetUserByID(ctx, req.DestUserID); err != nil {
+			return nil, err
+		}
+		dest = sql.NullString{String: req.DestUserID, Valid: true}
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.challengeStore.CreateChallenge(ctx, &store.Challenge{
+		Code:         code,
+		ChallengerID: challengerID,
+		DestUserID:   dest,
+		TimeControl:  tc.String(),
+		Variant:      string(v),
+		InitialFEN:   fen,
+		Color:        colorName(color),
+		Rated:        req.Rated && !tc.IsUnlimited() && fen == "",
+		ExpiresAt:    time.Now().Add(expiry),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := s.withURL(stored)
+	if dest.Valid {
+		s.gm.SendToUser(dest.String, Notification{Type: gamemanager.CHALLENGE, Challenge: challenge})
+	}
+	return challenge, nil
+}
+
+func (s *Service) Get(ctx context.Context, code string) (*Challenge, error) {
+	stored, err := s.challengeStore.GetChallengeByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.withURL(stored), nil
+}
+
+func (s *Service) List(ctx context.Context, userID string) ([]Challenge, error) {
+	stored, err := s.challengeStore.ListChallengesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	challenges := make([]Challenge, 0, len(stored))
+	for i := range stored {
+		challenges = append(challenges, *s.withURL(&stored[i]))
+	}
+	return challenges, nil
+}
+
+// Accept claims the challenge for userID and starts the game. Both players
+// receive game_start if they are connected; otherwise they pick the game up
+// when they connect.
+func (s *Service) Accept(ctx context.Context, code string, userID string) (*Challenge, error) {
+	current, err := s.challengeStore.GetChallengeByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if current.DestUserID.Valid && current.DestUserID.String != userID {
+		return nil, ErrNotParticipant
+	}
+	if current.ChallengerID == userID {
+		return nil, ErrChallengeSelf
+	}
+
+	tc, err := gamemanager.ParseTimeControl(current.TimeControl)
+	if err != nil {
+		return nil, err
+	}
+
+	white, black := current.ChallengerID, userID
+	switch matchmaking.ColorPreference(current.Color) {
+	case matchmaking.ColorBlack:
+		white, black = black, white
+	case matchmaking.ColorWhite:
+	default:
+		if mrand.IntN(2) == 0 {
+			white, black = black, white
+		}
+	}
+
+	game, err := gamemanager.StartNewGame(white, black, gamemanager.GameOptions{
+		TimeControl: tc,
+		Rated:       current.Rated,
+		Variant:     variant.Variant(current.Variant),
+		FEN:         current.InitialFEN,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err := s.challengeStore.AcceptChallenge(ctx, code, userID, game.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.gm.StartGame(game); err != nil {
+		if reopenErr := s.challengeStore.ReopenChallenge(ctx, code); reopenErr != nil {
+			log.Printf("Failed to reopen challenge %s: %v", code, reopenErr)
+		}
+		return nil, err
+	}
+
+	challenge := s.withURL(accepted)
+	s.gm.SendToUser(accepted.ChallengerID, Notification{Type: gamemanager.CHALLENGE_ACCEPTED, Challenge: challenge})
+	return challenge, nil
+}
+
+// Decline is used by the addressee of a direct challenge.
+func (s *Service) Decline(ctx context.Context, code string, userID string) (*Challenge, error) {
+	declined, err := s.challengeStore.DeclineChallenge(ctx, code, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := s.withURL(declined)
+	s.gm.SendToUser(declined.ChallengerID, Notification{Type: gamemanager.CHALLENGE_DECLINED, Challenge: challenge})
+	return challenge, nil
+}
+
+// Cancel is used by the challenger to withdraw a challenge.
+func (s *Service) Cancel(ctx context.Context, code string, userID string) (*Challenge, error) {
+	cancelled, err := s.challengeStore.CancelChallenge(ctx, code, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := s.withURL(cancelled)
+	if cancelled.DestUserID.Valid {
+		s.gm.SendToUser(cancelled.DestUserID.String, Notification{Type: gamemanager.CHALLENGE_CANCELLED, Challenge: challenge})
+	}
+	return challenge, nil
+}
+
+func (s *Service) withURL(c *store.Challenge) *Challenge {
+	return &Challenge{Challenge: c, URL: fmt.Sprintf("%s/challenge/%s", s.frontendURL, c.Code)}
+}
+
+func generateCode() (string, error) {
+	b := make([]byte, codeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+func colorName(color matchmaking.ColorPreference) string {
+	if color == matchmaking.ColorRandom {
+		return "random"
+	}
+	return string(color)
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +15,37 @@ type Config struct {
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURI  string
+	// Matchmaker selects the matchmaking backend: "redis" (default) shares
+	// the queues between replicas, "memory" keeps them in process.
+	Matchmaker string
+	// FrontendURL is the base of links handed out to users, such as
+	// challenge links.
+	FrontendURL string
+	// EnginePath is a UCI engine binary for games against the computer. The
+	// built-in engine is used when it is empty.
+	EnginePath string
+	// EnginePoolSize is the number of engine processes started.
+	EnginePoolSize int
+	// AnalysisDepth and AnalysisMoveTime bound the engine search for each
+	// position of a finished game under analysis.
+	AnalysisDepth    int
+	AnalysisMoveTime time.Duration
+	// ChatBlockedWords are masked in chat in addition to the default list.
+	ChatBlockedWords []string
+	// DisconnectGrace overrides, by time category, how long a disconnected
+	// player has to come back before their opponent can claim the game.
+	// It is read from DISCONNECT_GRACE as e.g. "bullet=10s,classical=5m".
+	DisconnectGrace map[string]time.Duration
+	// ClusterMode lets several replicas share games through Redis, each
+	// game being hosted by one of them. It is always on with the Redis
+	// matchmaker, whose matches may pair players of different replicas.
+	// NodeID names this replica; it defaults to the host name, which is the
+	// pod name on Kubernetes.
+	ClusterMode bool
+	NodeID      string
+	// AdminUserIDs may use the /admin endpoints. It is read from
+	// ADMIN_USER_IDS as a comma-separated list.
+	AdminUserIDs []string
 }
 
 func LoadConfig() *Config {
@@ -20,11 +54,73 @@ func LoadConfig() *Config {
 		log.Fatal("Error loading .env file")
 	}
 
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+
+	enginePoolSize, err := strconv.Atoi(os.Getenv("ENGINE_POOL_SIZE"))
+	if err != nil || enginePoolSize <= 0 {
+		enginePoolSize = 2
+	}
+
+	analysisDepth, err := strconv.Atoi(os.Getenv("ANALYSIS_DEPTH"))
+	if err != nil || analysisDepth <= 0 {
+		analysisDepth = 16
+	}
+
+	analysisMoveTime, err := time.ParseDuration(os.Getenv("ANALYSIS_MOVE_TIME"))
+	if err != nil || analysisMoveTime <= 0 {
+		analysisMoveTime = 500 * time.Millisecond
+	}
+
+	var chatBlockedWords []string
+	if words := os.Getenv("CHAT_BLOCKED_WORDS"); words != "" {
+		chatBlockedWords = strings.Split(words, ",")
+	}
+
+	disconnectGrace := make(map[string]time.Duration)
+	if grace := os.Getenv("DISCONNECT_GRACE"); grace != "" {
+		for _, entry := range strings.Split(grace, ",") {
+			category, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				log.Printf("Ignoring invalid disconnect grace %q", entry)
+				continue
+			}
+			disconnectGrace[category] = d
+		}
+	}
+
+	var adminUserIDs []string
+	if ids := os.Getenv("ADMIN_USER_IDS"); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			adminUserIDs = append(adminUserIDs, strings.TrimSpace(id))
+		}
+	}
+
+	matchmaker := os.Getenv("MATCHMAKER")
+
+	nodeID := os.Getenv("NODE_ID")
+	if nodeID == "" {
+		nodeID, _ = os.Hostname()
+	}
+
 	return &Config{
 		JWTSecret:          os.Getenv("JWT_SECRET"),
 		GoogleClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
 		GoogleClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
 		GoogleRedirectURI:  os.Getenv("GOOGLE_REDIRECT_URI"),
+		Matchmaker:         matchmaker,
+		FrontendURL:        frontendURL,
+		EnginePath:         os.Getenv("ENGINE_PATH"),
+		EnginePoolSize:     enginePoolSize,
+		AnalysisDepth:      analysisDepth,
+		AnalysisMoveTime:   analysisMoveTime,
+		ChatBlockedWords:   chatBlockedWords,
+		DisconnectGrace:    disconnectGrace,
+		ClusterMode:        os.Getenv("CLUSTER_MODE") == "true" || matchmaker != "memory",
+		NodeID:             nodeID,
+		AdminUserIDs:       adminUserIDs,
 	}
 }
-
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+const (
+	// maxBasicDepth keeps BasicEngine searches fast; its move generation is
+	// too slow for deeper full-width searches.
+	maxBasicDepth = 3
+
+	mateScore = 100000
+)
+
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   100,
+	chess.Knight: 320,
+	chess.Bishop: 330,
+	chess.Rook:   500,
+	chess.Queen:  900,
+}
+
+// BasicEngine is a small pure-Go alpha-beta engine. It is used when no
+// engine binary is configured and plays at a casual club level at best.
+type BasicEngine struct{}
+
+func NewBasicEngine() *BasicEngine {
+	return &BasicEngine{}
+}
+
+// Search runs an iterative deepening search and returns the best move of the
+// deepest completed iteration.
+func (e *BasicEngine) Search(ctx context.Context, pos Position, limits Limits) (Result, error) {
+	game, err := replay(pos)
+	if err != nil {
+		return Result{}, err
+	}
+	root := game.Position()
+	moves := root.ValidMoves()
+	if len(moves) == 0 {
+		return Result{}, ErrNoMoves
+	}
+
+	depth := maxBasicDepth
+	if limits.Depth > 0 {
+		depth = min(limits.Depth, maxBasicDepth)
+	}
+	moveTime := limits.MoveTime
+	if moveTime == 0 {
+		moveTime = DefaultMoveTime
+	}
+	deadline := time.Now().Add(moveTime)
+
+	// Weaker levels add noise to the root scores so they miss tactics.
+	noise := 0
+	if limits.LimitStrength {
+		noise = (20 - limits.SkillLevel) * 15
+	}
+
+	result := Result{BestMove: chess.UCINotation{}.Encode(root, moves[0])}
+	ordered := orderMoves(moves)
+	for d := 1; d <= depth; d++ {
+		best, bestScore := -1, -mateScore-1
+		completed := true
+		for i, mv := range ordered {
+			if ctx.Err() != nil || (d > 1 && time.Now().After(deadline)) {
+				completed = false
+				break
+			}
+			score := -negamax(root.Update(mv), d-1, -mateScore-1, mateScore+1)
+			if noise > 0 {
+				score += rand.IntN(2*noise+1) - noise
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if !completed {
+			break
+		}
+		result.BestMove = chess.UCINotation{}.Encode(root, ordered[best])
+		result.Score = toScore(bestScore)
+		result.PV = []string{result.BestMove}
+		result.Depth = d
+	}
+
+	if err := ctx.Err(); err != nil && result.Depth == 0 {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+func (e *BasicEngine) Close() error {
+	return nil
+}
+
+func negamax(pos *chess.Position, depth int, alpha, beta int) int {
+	switch pos.Status() {
+	case chess.Checkmate:
+		return -mateScore
+	case chess.Stalemate:
+		return 0
+	}
+	if depth == 0 {
+		return evaluate(pos)
+	}
+
+	for _, mv := range orderMoves(pos.ValidMoves()) {
+		score := -negamax(pos.Update(mv), depth-1, -beta, -alpha)
+		if score >= beta {
+			return beta
+		}
+		alpha = max(alpha, score)
+	}
+	return alpha
+}
+
+// evaluate scores the position from the side to move's point of view by
+// material and a small bonus for central pieces.
+func evaluate(pos *chess.Position) int {
+	score := 0
+	for sq, piece := range pos.Board().SquareMap() {
+		value := pieceValues[piece.Type()] + centrality(sq, piece.Type())
+		if piece.Color() == pos.Turn() {
+			score += value
+		} else {
+			score -= value
+		}
+	}
+	return score
+}
+
+func centrality(sq chess.Square, pt chess.PieceType) int {
+	if pt == chess.King || pt == chess.Rook {
+		return 0
+	}
+	file, rank := int(sq.File()), int(sq.Rank())
+	distance := max(abs(2*file-7), abs(2*rank-7))
+	return (7 - distance) * 2
+}
+
+// orderMoves searches captures and promotions first to improve pruning.
+func orderMoves(moves []*chess.Move) []*chess.Move {
+	ordered := append([]*chess.Move(nil), moves...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return moveWeight(ordered[i]) > moveWeight(ordered[j])
+	})
+	return ordered
+}
+
+func moveWeight(mv *chess.Move) int {
+	weight := 0
+	if mv.HasTag(chess.Capture) {
+		weight += 2
+	}
+	if mv.Promo() != chess.NoPieceType {
+		weight += 3
+	}
+	if mv.HasTag(chess.Check) {
+		weight++
+	}
+	return weight
+}
+
+func toScore(score int) Score {
+	if score >= mateScore-100 {
+		return Score{Mate: 1}
+	}
+	if score <= -mateScore+100 {
+		return Score{Mate: -1}
+	}
+	return Score{CP: score}
+}
+
+func replay(pos Position) (*chess.Game, error) {
+	var opts []func(*chess.Game)
+	if pos.FEN != "" {
+		fen, err := chess.FEN(pos.FEN)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, fen)
+	}
+	game := chess.NewGame(opts...)
+	for _, s := range pos.Moves {
+		mv, err := chess.UCINotation{}.Decode(game.Position(), s)
+		if err != nil {
+			return nil, err
+		}
+		if err := game.Move(mv); err != nil {
+			return nil, err
+		}
+	}
+	return game, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
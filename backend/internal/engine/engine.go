@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoMoves      = errors.New("no legal moves")
+	ErrInvalidLevel = errors.New("invalid engine level")
+)
+
+// Engine searches chess positions. Implementations are safe for concurrent
+// use.
+type Engine interface {
+	Search(ctx context.Context, pos Position, limits Limits) (Result, error)
+	Close() error
+}
+
+// Position is a starting FEN ("" for the standard starting position) and the
+// moves played from it in UCI notation.
+type Position struct {
+	FEN   string
+	Moves []string
+}
+
+// Limits bounds a search. Zero values are ignored; a search without any
+// limit uses DefaultMoveTime.
+type Limits struct {
+	Depth    int
+	MoveTime time.Duration
+
+	WhiteTime      time.Duration
+	BlackTime      time.Duration
+	WhiteIncrement time.Duration
+	BlackIncrement time.Duration
+
+	// SkillLevel weakens the engine when LimitStrength is set: 0 is the
+	// weakest and 20 full strength, as in Stockfish's "Skill Level".
+	SkillLevel    int
+	LimitStrength bool
+}
+
+const DefaultMoveTime = time.Second
+
+// Score is an evaluation from the side to move's point of view. Mate is the
+// number of moves to mate, negative when the side to move is being mated,
+// and zero when CP applies.
+type Score struct {
+	CP   int `json:"cp"`
+	Mate int `json:"mate,omitempty"`
+}
+
+type Result struct {
+	BestMove string
+	Score    Score
+	PV       []string
+	Depth    int
+}
+
+// Level is one of the strength levels offered to players.
+type Level struct {
+	Level      int
+	SkillLevel int
+	Depth      int
+	MoveTime   time.Duration
+}
+
+const (
+	MinLevel = 1
+	MaxLevel = 8
+)
+
+var levels = []Level{
+	{Level: 1, SkillLevel: 0, Depth: 1, MoveTime: 50 * time.Millisecond},
+	{Level: 2, SkillLevel: 3, Depth: 1, MoveTime: 100 * time.Millisecond},
+	{Level: 3, SkillLevel: 6, Depth: 2, MoveTime: 150 * time.Millisecond},
+	{Level: 4, SkillLevel: 9, Depth: 3, MoveTime: 200 * time.Millisecond},
+	{Level: 5, SkillLevel: 11, Depth: 5, MoveTime: 300 * time.Millisecond},
+	{Level: 6, SkillLevel: 14, Depth: 8, MoveTime: 400 * time.Millisecond},
+	{Level: 7, SkillLevel: 17, Depth: 13, MoveTime: 500 * time.Millisecond},
+	{Level: 8, SkillLevel: 20, Depth: 22, MoveTime: time.Second},
+}
+
+func GetLevel(level int) (Level, error) {
+	if level < MinLevel || level > MaxLevel {
+		return Level{}, ErrInvalidLevel
+	}
+	return levels[level-1], nil
+}
+
+// Limits returns the search limits of the level. The move time is capped
+// so a bot with remaining time on its clock never spends more than a
+// fraction of it on one move.
+func (l Level) Limits(remaining time.Duration) Limits {
+	moveTime := l.MoveTime
+	if remaining > 0 {
+		moveTime = min(moveTime, max(remaining/40, 10*time.Millisecond))
+	}
+	return Limits{
+		Depth:         l.Depth,
+		MoveTime:      moveTime,
+		SkillLevel:    l.SkillLevel,
+		LimitStrength: l.SkillLevel < 20,
+	}
+}
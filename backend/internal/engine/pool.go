@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// Pool shares a fixed number of engines between concurrent searches.
+type Pool struct {
+	engines chan Engine
+	all     []Engine
+}
+
+// NewPool starts size engines with newEngine.
+func NewPool(size int, newEngine func() (Engine, error)) (*Pool, error) {
+	p := &Pool{engines: make(chan Engine, size)}
+	for range size {
+		eng, err := newEngine()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.all = append(p.all, eng)
+		p.engines <- eng
+	}
+	return p, nil
+}
+
+// Search waits for a free engine and runs the search on it.
+func (p *Pool) Search(ctx context.Context, pos Position, limits Limits) (Result, error) {
+	select {
+	case eng := <-p.engines:
+		defer func() { p.engines <- eng }()
+		return eng.Search(ctx, pos, limits)
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+func (p *Pool) Close() error {
+	var errs []error
+	for _, eng := range p.all {
+		errs = append(errs, eng.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// New returns a pool of UCI engines running the binary at path, or a
+// BasicEngine if path is empty.
+func New(path string, size int) (Engine, error) {
+	if path == "" {
+		return NewBasicEngine(), nil
+	}
+	return NewPool(max(size, 1), func() (Engine, error) {
+		return NewUCIEngine(path)
+	})
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/notnil/chess"
+	"github.com/notnil/chess/uci"
+)
+
+// UCIEngine drives a local engine binary, such as Stockfish, over the UCI
+// protocol on its stdin and stdout. It runs one search at a time.
+type UCIEngine struct {
+	engine *uci.Engine
+
+	// skill is the last "Skill Level" sent to the engine, or -1 when the
+	// engine plays at full strength.
+	skill int
+
+	mu sync.Mutex
+}
+
+// NewUCIEngine starts the engine binary at path and performs the UCI
+// handshake.
+func NewUCIEngine(path string) (*UCIEngine, error) {
+	eng, err := uci.New(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := eng.Run(uci.CmdUCI, uci.CmdIsReady, uci.CmdUCINewGame); err != nil {
+		eng.Close()
+		return nil, fmt.Errorf("uci handshake with %s: %w", path, err)
+	}
+	return &UCIEngine{engine: eng, skill: -1}, nil
+}
+
+// Search runs a search on the engine. If ctx is cancelled first the search
+// is stopped and ctx's error returned.
+func (e *UCIEngine) Search(ctx context.Context, pos Position, limits Limits) (Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	position, err := uciPosition(pos)
+	if err != nil {
+		return Result{}, err
+	}
+
+	cmds := e.skillCommands(limits)
+	cmds = append(cmds, position, uciGo(limits))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.engine.Run(cmds...)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return Result{}, err
+		}
+	case <-ctx.Done():
+		e.engine.Run(uci.CmdStop)
+		<-done
+		return Result{}, ctx.Err()
+	}
+
+	results := e.engine.SearchResults()
+	if results.BestMove == nil {
+		return Result{}, ErrNoMoves
+	}
+
+	result := Result{
+		BestMove: chess.UCINotation{}.Encode(nil, results.BestMove),
+		Score:    Score{CP: results.Info.Score.CP, Mate: results.Info.Score.Mate},
+		Depth:    results.Info.Depth,
+	}
+	for _, mv := range results.Info.PV {
+		result.PV = append(result.PV, chess.UCINotation{}.Encode(nil, mv))
+	}
+	return result, nil
+}
+
+func (e *UCIEngine) Close() error {
+	return e.engine.Close()
+}
+
+// skillCommands returns the setoption commands needed to switch the engine
+// to the strength requested by limits. It must be called with e.mu held.
+func (e *UCIEngine) skillCommands(limits Limits) []uci.Cmd {
+	skill := -1
+	if limits.LimitStrength {
+		skill = limits.SkillLevel
+	}
+	if skill == e.skill {
+		return nil
+	}
+	e.skill = skill
+
+	if skill < 0 {
+		return []uci.Cmd{uci.CmdSetOption{Name: "Skill Level", Value: "20"}}
+	}
+	return []uci.Cmd{uci.CmdSetOption{Name: "Skill Level", Value: strconv.Itoa(skill)}}
+}
+
+func uciPosition(pos Position) (uci.CmdPosition, error) {
+	cmd := uci.CmdPosition{}
+	if pos.FEN != "" {
+		fen, err := chess.FEN(pos.FEN)
+		if err != nil {
+			return cmd, err
+		}
+		cmd.Position = chess.NewGame(fen).Position()
+	}
+	for _, s := range pos.Moves {
+		mv, err := chess.UCINotation{}.Decode(nil, s)
+		if err != nil {
+			return cmd, err
+		}
+		cmd.Moves = append(cmd.Moves, mv)
+	}
+	return cmd, nil
+}
+
+func uciGo(limits Limits) uci.CmdGo {
+	cmd := uci.CmdGo{
+		Depth:          limits.Depth,
+		MoveTime:       limits.MoveTime,
+		WhiteTime:      limits.WhiteTime,
+		BlackTime:      limits.BlackTime,
+		WhiteIncrement: limits.WhiteIncrement,
+		BlackIncrement: limits.BlackIncrement,
+	}
+	if cmd.Depth == 0 && cmd.MoveTime == 0 && cmd.WhiteTime == 0 && cmd.BlackTime == 0 {
+		cmd.MoveTime = DefaultMoveTime
+	}
+	return cmd
+}
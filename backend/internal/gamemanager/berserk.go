@@ -0,0 +1,65 @@
+package gamemanager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+var (
+	ErrBerserkUntimed = errors.New("only timed games can be played berserk")
+	ErrBerserkTooLate = errors.New("you can only go berserk before your first move")
+	ErrAlreadyBerserk = errors.New("you have already gone berserk")
+)
+
+// Berserk halves userID's remaining time and removes their increment in a
+// game they have not moved in yet. Tournaments reward berserk wins.
+func (gm *GameManager) Berserk(gameID string, userID string) error {
+	err := gm.berserkLocal(gameID, userID)
+	if errors.Is(err, ErrGameNotOnServer) && gm.clustered() {
+		_, err = gm.forward(clusterCommand{GameID: gameID, UserID: userID, Action: BERSERK})
+	}
+	return err
+}
+
+func (gm *GameManager) berserkLocal(gameID string, userID string) error {
+	gm.mu.RLock()
+	game, ok := gm.games[gameID]
+	gm.mu.RUnlock()
+	if !ok {
+		return ErrGameNotOnServer
+	}
+
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	return game.berserk(userID, gm)
+}
+
+// berserk must be called with g.mu held.
+func (g *Game) berserk(userID string, gm *GameManager) error {
+	color, err := g.playerColor(userID)
+	if err != nil {
+		return err
+	}
+	if g.clock == nil {
+		return ErrBerserkUntimed
+	}
+	if g.clock.IsBerserk(color) {
+		return ErrAlreadyBerserk
+	}
+	firstMove := 1
+	if color == chess.Black {
+		firstMove = 2
+	}
+	if g.board.Plies() >= firstMove {
+		return ErrBerserkTooLate
+	}
+
+	now := time.Now()
+	g.clock.Berserk(color)
+	g.armFlagTimer(gm)
+
+	g.publish(gm, OutgoingBerserk{Type: BERSERK, GameID: g.ID, Color: g.colorName(userID), Clock: g.clockSnapshot(now)})
+	return nil
+}
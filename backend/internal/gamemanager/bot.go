@@ -0,0 +1,199 @@
+package gamemanager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/engine"
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/notnil/chess"
+)
+
+var (
+	ErrBotsUnavailable = errors.New("playing against the engine is not available")
+	ErrBotVariant      = errors.New("the engine only plays standard chess")
+	// ErrCustomPositionSeek is returned when a player seeks an opponent from
+	// a custom position, which is only possible in challenges and bot games.
+	ErrCustomPositionSeek = errors.New("games from a custom position must be played against a challenged player or the engine")
+)
+
+const (
+	OpponentBot     = "bot"
+	DefaultBotLevel = 3
+
+	// botSearchGrace is added to a bot's move time before its search is
+	// abandoned and a random move played instead.
+	botSearchGrace = 5 * time.Second
+)
+
+// Bots lets players start games against the engine. UserIDs maps each
+// engine level to the account that plays at that level.
+type Bots struct {
+	Engine  engine.Engine
+	UserIDs map[int]string
+}
+
+// botPlayer is the side of a game played server-side by the engine.
+type botPlayer struct {
+	UserID string
+	Level  engine.Level
+	Engine engine.Engine
+}
+
+// SetBots enables games against the engine.
+func (gm *GameManager) SetBots(bots *Bots) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.bots = bots
+}
+
+// startBotGame starts a casual game between the player and the engine at the
+// requested level, from fen if it is not empty.
+func (gm *GameManager) startBotGame(session *PlayerSession, conn *Conn, tc TimeControl, color matchmaking.ColorPreference, level int, fen string) {
+	gm.mu.RLock()
+	bots := gm.bots
+	gm.mu.RUnlock()
+
+	if bots == nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: ErrBotsUnavailable.Error()})
+		return
+	}
+
+	if level == 0 {
+		level = DefaultBotLevel
+	}
+	lvl, err := engine.GetLevel(level)
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		return
+	}
+	botUserID, ok := bots.UserIDs[level]
+	if !ok {
+		conn.Send(OutgoingError{Type: ERROR, Message: ErrBotsUnavailable.Error()})
+		return
+	}
+
+	white, black := session.UserID, botUserID
+	switch color {
+	case matchmaking.ColorBlack:
+		white, black = black, white
+	case matchmaking.ColorWhite:
+	default:
+		if rand.IntN(2) == 0 {
+			white, black = black, white
+		}
+	}
+
+	if err := gm.matchmaker.Cancel(context.Background(), session.UserID); err != nil {
+		log.Printf("Failed to leave matchmaking for user %s: %v", session.UserID, err)
+	}
+
+	game, err := StartNewGame(white, black, GameOptions{TimeControl: tc, FEN: fen})
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		return
+	}
+	game.bot = &botPlayer{UserID: botUserID, Level: lvl, Engine: bots.Engine}
+	if err := gm.StartGame(game); err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+	}
+}
+
+// restoreBot gives a restored game back to the engine if one of its players
+// is a bot. It must be called with gm.mu held.
+func (gm *GameManager) restoreBot(game *Game) {
+	if gm.bots == nil {
+		return
+	}
+	for level, userID := range gm.bots.UserIDs {
+		if userID != game.WhiteUserID && userID != game.BlackUserID {
+			continue
+		}
+		lvl, err := engine.GetLevel(level)
+		if err != nil {
+			log.Printf("Failed to restore bot of game %s: %v", game.ID, err)
+			return
+		}
+		game.bot = &botPlayer{UserID: userID, Level: lvl, Engine: gm.bots.Engine}
+		return
+	}
+}
+
+// humanPlayers lists the players of the game other than the engine.
+func (g *Game) humanPlayers() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var players []string
+	for _, userID := range []string{g.WhiteUserID, g.BlackUserID} {
+		if !g.isBot(userID) {
+			players = append(players, userID)
+		}
+	}
+	return players
+}
+
+// isBot must be called with g.mu held.
+func (g *Game) isBot(userID string) bool {
+	return g.bot != nil && g.bot.UserID == userID
+}
+
+// maybeBotMove starts the engine search when it is the bot's turn. The move
+// is played through makeMove like any other, unless the position changed in
+// the meantime. It must be called with g.mu held.
+func (g *Game) maybeBotMove(gm *GameManager) {
+	if g.bot == nil || g.status != GameStatusInProgress {
+		return
+	}
+	turn := g.board.Turn()
+	if (turn == chess.White) != (g.bot.UserID == g.WhiteUserID) {
+		return
+	}
+
+	var remaining time.Duration
+	if g.clock != nil {
+		remaining = g.clock.Remaining(turn, time.Now())
+	}
+	limits := g.bot.Level.Limits(remaining)
+	pos := engine.Position{FEN: g.board.InitialFEN(), Moves: g.board.UCIMoves()}
+	eng := g.bot.Engine
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), limits.MoveTime+botSearchGrace)
+		defer cancel()
+
+		result, err := eng.Search(ctx, pos, limits)
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		// The position changed while the engine searched: a takeback
+		// followed by another move leaves as many moves played, but not
+		// the same ones.
+		if g.status != GameStatusInProgress || !slices.Equal(g.board.UCIMoves(), pos.Moves) {
+			return
+		}
+
+		move := result.BestMove
+		if err != nil {
+			log.Printf("Engine search failed for game %s, playing a random move: %v", g.ID, err)
+			move = g.randomMove()
+		}
+		if err := g.makeMove(g.bot.UserID, move, gm); err != nil {
+			log.Printf("Bot move %s rejected in game %s: %v", move, g.ID, err)
+		}
+	}()
+}
+
+// randomMove must be called with g.mu held.
+func (g *Game) randomMove() string {
+	moves := g.board.ValidMoves()
+	if len(moves) == 0 {
+		return ""
+	}
+	return moves[rand.IntN(len(moves))]
+}
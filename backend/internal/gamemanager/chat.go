@@ -0,0 +1,365 @@
+package gamemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/google/uuid"
+)
+
+// Players and spectators chat in separate rooms: players never see the
+// spectators' messages and spectators never see the players'.
+const (
+	ChatRoomPlayers    = "player"
+	ChatRoomSpectators = "spectator"
+)
+
+const (
+	maxChatLength = 140
+
+	// A session may send at most chatRateLimit messages per chatRateWindow.
+	chatRateLimit  = 5
+	chatRateWindow = 10 * time.Second
+)
+
+var (
+	ErrEmptyChat       = errors.New("message cannot be empty")
+	ErrChatTooLong     = errors.New("message is too long")
+	ErrChatRateLimited = errors.New("you are sending messages too fast")
+	ErrChatAnonymous   = errors.New("log in to chat")
+	ErrNotSpectating   = errors.New("you are not watching this game")
+	ErrMuteSelf        = errors.New("you cannot mute yourself")
+	ErrInvalidUserID   = errors.New("invalid user_id")
+)
+
+// ChatFilter screens chat messages before they are sent. It returns the text
+// to send, possibly censored, or an error to reject the message.
+type ChatFilter interface {
+	Filter(text string) (string, error)
+}
+
+// chatLimiter limits how fast one session can chat.
+type chatLimiter struct {
+	mu   sync.Mutex
+	sent []time.Time
+}
+
+// idle reports whether the limiter no longer remembers any message, so it
+// can be dropped.
+func (l *chatLimiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.sent) == 0 || now.Sub(l.sent[len(l.sent)-1]) >= chatRateWindow
+}
+
+func (l *chatLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := l.sent[:0]
+	for _, t := range l.sent {
+		if now.Sub(t) < chatRateWindow {
+			recent = append(recent, t)
+		}
+	}
+	l.sent = recent
+	if len(l.sent) >= chatRateLimit {
+		return false
+	}
+	l.sent = append(l.sent, now)
+	return true
+}
+
+// SetChat stores chat messages and mutes in chatStore and screens messages
+// with filter. Either may be nil; without a store chat is not persisted and
+// mutes only last until restart.
+func (gm *GameManager) SetChat(chatStore store.ChatStore, filter ChatFilter) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.chatStore = chatStore
+	gm.chatFilter = filter
+}
+
+// handleChat posts to the player room of one of the session's games, or to
+// the spectator room of another game the connection watches through
+// handleSpectate, as the spectator registered for it.
+func (gm *GameManager) handleChat(session *PlayerSession, conn *Conn, message IncomingMessage) {
+	gameID, err := gm.sessionGameID(session, message.GameID)
+	if err == nil {
+		err = gm.sendChat(session.UserID, gameID, ChatRoomPlayers, message.Text, &session.chat)
+	} else if message.GameID != "" {
+		gameID = message.GameID
+		err = ErrNotSpectating
+		if spectator := gm.spectatorOn(gameID, conn); spectator != nil {
+			err = gm.spectatorChat(spectator, gameID, message.Text)
+		}
+	}
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, GameID: gameID, Message: err.Error()})
+	}
+}
+
+// spectatorChat posts to the spectator room of the game being watched.
+func (gm *GameManager) spectatorChat(spectator *Spectator, gameID string, text string) error {
+	if spectator.UserID == "" {
+		return ErrChatAnonymous
+	}
+	return gm.sendChat(spectator.UserID, gameID, ChatRoomSpectators, text, &spectator.chat)
+}
+
+// Chat posts a player's message to the player room of a game on behalf of a
+// client without a websocket connection.
+func (gm *GameManager) Chat(userID string, gameID string, text string) error {
+	gm.chatMu.Lock()
+	limiter, ok := gm.apiChatLimits[userID]
+	if !ok {
+		limiter = &chatLimiter{}
+		gm.apiChatLimits[userID] = limiter
+	}
+	gm.chatMu.Unlock()
+
+	return gm.sendChat(userID, gameID, ChatRoomPlayers, text, limiter)
+}
+
+func (gm *GameManager) sendChat(userID string, gameID string, room string, text string, limiter *chatLimiter) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ErrEmptyChat
+	}
+	if utf8.RuneCountInString(text) > maxChatLength {
+		return ErrChatTooLong
+	}
+	if room == ChatRoomPlayers {
+		if err := gm.checkPlayer(userID, gameID); err != nil {
+			return err
+		}
+	}
+	if !limiter.allow(time.Now()) {
+		return ErrChatRateLimited
+	}
+
+	gm.mu.RLock()
+	chatStore, filter := gm.chatStore, gm.chatFilter
+	gm.mu.RUnlock()
+
+	if filter != nil {
+		filtered, err := filter.Filter(text)
+		if err != nil {
+			return err
+		}
+		text = filtered
+	}
+
+	if chatStore != nil {
+		record := &store.ChatMessage{GameID: gameID, UserID: userID, Room: room, Text: text}
+		if err := chatStore.InsertChatMessage(context.Background(), record); err != nil {
+			log.Printf("Failed to store chat message for game %s: %v", gameID, err)
+		}
+	}
+
+	publishGameEvent(gm.redisClient, gameID, OutgoingChat{
+		Type:   CHAT,
+		GameID: gameID,
+		Room:   room,
+		UserID: userID,
+		Text:   text,
+	})
+	return nil
+}
+
+// checkPlayer makes sure userID plays in the in-progress game, wherever it
+// is hosted.
+func (gm *GameManager) checkPlayer(userID string, gameID string) error {
+	gm.mu.RLock()
+	game, local := gm.games[gameID]
+	gm.mu.RUnlock()
+
+	if local {
+		game.mu.RLock()
+		defer game.mu.RUnlock()
+		if userID != game.WhiteUserID && userID != game.BlackUserID {
+			return ErrNotInGame
+		}
+		if game.status != GameStatusInProgress {
+			return ErrGameEnded
+		}
+		return nil
+	}
+
+	dbGame, err := gm.gameStore.GetGameByID(context.Background(), gameID)
+	if err != nil {
+		return err
+	}
+	if dbGame == nil {
+		return ErrGameNotFound
+	}
+	if userID != dbGame.WhiteUserID && userID != dbGame.BlackUserID {
+		return ErrNotInGame
+	}
+	if dbGame.Status != string(GameStatusInProgress) {
+		return ErrGameEnded
+	}
+	return nil
+}
+
+// spectatorOn returns the spectator conn is registered as for gameID, or nil
+// if it does not watch the game.
+func (gm *GameManager) spectatorOn(gameID string, conn *Conn) *Spectator {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+	return gm.spectators[gameID][conn]
+}
+
+func (gm *GameManager) handleMute(session *PlayerSession, conn *Conn, message IncomingMessage, muted bool) {
+	if message.UserID == "" {
+		conn.Send(OutgoingError{Type: ERROR, Message: "user_id is required"})
+		return
+	}
+	if err := gm.SetMuted(session.UserID, message.UserID, muted); err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		return
+	}
+	conn.Send(OutgoingMuted{Type: MUTED, UserID: message.UserID, Muted: muted})
+}
+
+// SetMuted hides, or shows again, mutedUserID's chat messages from userID.
+func (gm *GameManager) SetMuted(userID string, mutedUserID string, muted bool) error {
+	if _, err := uuid.Parse(mutedUserID); err != nil {
+		return ErrInvalidUserID
+	}
+	if userID == mutedUserID {
+		return ErrMuteSelf
+	}
+
+	gm.mu.RLock()
+	chatStore := gm.chatStore
+	gm.mu.RUnlock()
+
+	if chatStore != nil {
+		var err error
+		if muted {
+			err = chatStore.MuteUser(context.Background(), userID, mutedUserID)
+		} else {
+			err = chatStore.UnmuteUser(context.Background(), userID, mutedUserID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	gm.chatMu.Lock()
+	defer gm.chatMu.Unlock()
+	if muted {
+		if gm.mutes[userID] == nil {
+			gm.mutes[userID] = make(map[string]struct{})
+		}
+		gm.mutes[userID][mutedUserID] = struct{}{}
+	} else {
+		delete(gm.mutes[userID], mutedUserID)
+	}
+	return nil
+}
+
+// loadMutes caches the users userID has muted so chat can be filtered while
+// relaying.
+func (gm *GameManager) loadMutes(userID string) {
+	gm.mu.RLock()
+	chatStore := gm.chatStore
+	gm.mu.RUnlock()
+
+	if chatStore == nil || userID == "" {
+		return
+	}
+	ids, err := chatStore.GetMutedUserIDs(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to load mutes of user %s: %v", userID, err)
+		return
+	}
+
+	mutes := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		mutes[id] = struct{}{}
+	}
+	gm.chatMu.Lock()
+	gm.mutes[userID] = mutes
+	gm.chatMu.Unlock()
+}
+
+// evictChat drops the rate limiters of API clients that stopped chatting
+// and, when mutes are stored, the cached mutes of users who are neither
+// connected nor watching a game. It must be called with gm.mu held.
+func (gm *GameManager) evictChat(now time.Time) {
+	present := make(map[string]bool)
+	for userID, session := range gm.sessions {
+		if session.Connected() {
+			present[userID] = true
+		}
+	}
+	for _, spectators := range gm.spectators {
+		for _, spectator := range spectators {
+			present[spectator.UserID] = true
+		}
+	}
+
+	gm.chatMu.Lock()
+	defer gm.chatMu.Unlock()
+	for userID, limiter := range gm.apiChatLimits {
+		if limiter.idle(now) {
+			delete(gm.apiChatLimits, userID)
+		}
+	}
+	// Without a store the cache is the only record of the mutes.
+	if gm.chatStore == nil {
+		return
+	}
+	for userID := range gm.mutes {
+		if !present[userID] {
+			delete(gm.mutes, userID)
+		}
+	}
+}
+
+func (gm *GameManager) isMuted(recipientID string, senderID string) bool {
+	if recipientID == "" {
+		return false
+	}
+	gm.chatMu.Lock()
+	defer gm.chatMu.Unlock()
+	_, muted := gm.mutes[recipientID][senderID]
+	return muted
+}
+
+// parseChat reports whether a game event is a chat message.
+func parseChat(payload []byte) (OutgoingChat, bool) {
+	var chat OutgoingChat
+	if err := json.Unmarshal(payload, &chat); err != nil || chat.Type != CHAT {
+		return OutgoingChat{}, false
+	}
+	return chat, true
+}
+
+// relayChat delivers a chat message to the room it was posted in, skipping
+// users who muted the sender. It must be called with gm.mu held.
+func (gm *GameManager) relayChat(gameID string, chat OutgoingChat, payload json.RawMessage) {
+	if chat.Room == ChatRoomSpectators {
+		for conn, spectator := range gm.spectators[gameID] {
+			if !gm.isMuted(spectator.UserID, chat.UserID) {
+				conn.Send(payload)
+			}
+		}
+		return
+	}
+
+	for _, session := range gm.sessions {
+		if session.InGame(gameID) && !gm.isMuted(session.UserID, chat.UserID) {
+			session.send(payload)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package gamemanager
+
+import (
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// Clock is the server-authoritative chess clock of a timed game. It is not
+// safe for concurrent use; Game guards it with its own mutex.
+type Clock struct {
+	tc TimeControl
+
+	white time.Duration
+	black time.Duration
+
+	turn        chess.Color
+	turnStarted time.Time
+	running     bool
+
+	// berserk marks the sides that halved their time and play without
+	// increment or delay.
+	berserk map[chess.Color]bool
+}
+
+func NewClock(tc TimeControl) *Clock {
+	return &Clock{
+		tc:      tc,
+		white:   tc.Initial,
+		black:   tc.Initial,
+		turn:    chess.White,
+		berserk: make(map[chess.Color]bool),
+	}
+}
+
+func (c *Clock) Start(turn chess.Color, now time.Time) {
+	c.turn = turn
+	c.turnStarted = now
+	c.running = true
+}
+
+func (c *Clock) Stop(now time.Time) {
+	if !c.running {
+		return
+	}
+	c.set(c.turn, c.Remaining(c.turn, now))
+	c.running = false
+}
+
+// Remaining returns the time left for color at now, counting the time
+// already spent on the current move.
+func (c *Clock) Remaining(color chess.Color, now time.Time) time.Duration {
+	remaining := c.get(color)
+	if c.running && color == c.turn {
+		remaining -= now.Sub(c.turnStarted)
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Flagged reports whether the side to move has run out of time.
+func (c *Clock) Flagged(now time.Time) bool {
+	return c.running && c.Remaining(c.turn, now) <= 0
+}
+
+// Press ends the current player's turn: the elapsed time is deducted, the
+// Bronstein delay and Fischer increment are credited and the opponent's
+// clock starts. It returns false if the mover flagged before pressing.
+func (c *Clock) Press(now time.Time) bool {
+	if !c.running {
+		return true
+	}
+
+	elapsed := now.Sub(c.turnStarted)
+	remaining := c.get(c.turn) - elapsed
+	if remaining <= 0 {
+		c.set(c.turn, 0)
+		return false
+	}
+
+	if !c.berserk[c.turn] {
+		remaining += min(elapsed, c.tc.Delay) + c.tc.Increment
+	}
+	c.set(c.turn, remaining)
+
+	c.turn = c.turn.Other()
+	c.turnStarted = now
+	return true
+}
+
+// Berserk halves color's stored time and drops its increment and delay for
+// the rest of the game.
+func (c *Clock) Berserk(color chess.Color) {
+	c.set(color, c.get(color)/2)
+	c.berserk[color] = true
+}
+
+// IsBerserk reports whether color has gone berserk.
+func (c *Clock) IsBerserk(color chess.Color) bool {
+	return c.berserk[color]
+}
+
+// Set overrides the stored time of both sides, e.g. when restoring a game.
+func (c *Clock) Set(white, black time.Duration) {
+	c.white = white
+	c.black = black
+}
+
+// charge takes spent off the stored time of color, which must not be
+// running, leaving them at least floor unless they already had less.
+func (c *Clock) charge(color chess.Color, spent, floor time.Duration) {
+	left := c.get(color)
+	c.set(color, max(left-spent, min(left, floor)))
+}
+
+func (c *Clock) Snapshot(now time.Time) *OutgoingClock {
+	return &OutgoingClock{
+		White: c.Remaining(chess.White, now).Milliseconds(),
+		Black: c.Remaining(chess.Black, now).Milliseconds(),
+	}
+}
+
+func (c *Clock) get(color chess.Color) time.Duration {
+	if color == chess.White {
+		return c.white
+	}
+	return c.black
+}
+
+func (c *Clock) set(color chess.Color, d time.Duration) {
+	if color == chess.White {
+		c.white = d
+	} else {
+		c.black = d
+	}
+}
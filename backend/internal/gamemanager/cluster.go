@@ -0,0 +1,570 @@
+package gamemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/queue"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	leaseKeyPrefix   = "cluster:lease:"
+	epochKeyPrefix   = "cluster:epoch:"
+	nodeStreamPrefix = "cluster:node:"
+	replyKeyPrefix   = "cluster:reply:"
+
+	// leaseTTL is how long a game stays with a node that stopped renewing
+	// its lease, e.g. because it crashed, before another node adopts it.
+	leaseTTL           = 10 * time.Second
+	leaseRenewInterval = 3 * time.Second
+	// leaseMargin is how long before its lease expires, as measured by the
+	// node, that the node stops writing to a game: Redis may expire the key
+	// a little earlier than the node's clock says.
+	leaseMargin = time.Second
+	// epochTTL is how long the count of a game's leases outlives its last
+	// lease.
+	epochTTL = 24 * time.Hour
+	// commandTimeout bounds the wait for the owner of a game to answer a
+	// forwarded command.
+	commandTimeout      = 5 * time.Second
+	replyTTL            = 30 * time.Second
+	commandStreamLength = 1000
+
+	actionGetConditionals = "get_conditional_moves"
+	actionSetConditionals = "set_conditional_moves"
+)
+
+var ErrOwnerUnavailable = errors.New("the server hosting this game is not responding, try again")
+
+// errGameClaimed is returned by adopt when another node claimed the game
+// first.
+var errGameClaimed = errors.New("game claimed by another node")
+
+// A lease is held by a node under a token made of its ID and the game's
+// epoch, which counts the game's leases. The token fences the node's writes
+// to the game: they fail once another node holds the lease.
+
+// claimLeaseScript takes the lease of a game nobody owns under a new epoch
+// and returns its token. It returns the token of the node's current lease,
+// extended, if it already holds it and nil when another node does.
+var claimLeaseScript = redis.NewScript(`
+local lease = redis.call("GET", KEYS[1])
+if lease then
+	if string.sub(lease, 1, #ARGV[1] + 1) ~= ARGV[1] .. "/" then
+		return false
+	end
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return lease
+end
+lease = ARGV[1] .. "/" .. redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], lease, "PX", ARGV[2])
+redis.call("PEXPIRE", KEYS[2], ARGV[3])
+return lease
+`)
+
+// renewLeaseScript extends the node's lease on a game, taking it back if it
+// lapsed without anyone else claiming the game since. It returns 0 when the
+// node lost the game.
+var renewLeaseScript = redis.NewScript(`
+local lease = redis.call("GET", KEYS[1])
+if lease ~= ARGV[1] then
+	if lease or redis.call("GET", KEYS[2]) ~= string.match(ARGV[1], "(%d+)$") then
+		return 0
+	end
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("PEXPIRE", KEYS[2], ARGV[3])
+return 1
+`)
+
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// gameLease is the node's lease on a game it hosts. The zero gameLease,
+// used outside cluster mode, never lapses.
+type gameLease struct {
+	token string
+	// until is when the node stops writing to the game unless the lease
+	// was renewed.
+	until time.Time
+}
+
+func (l gameLease) lapsed(now time.Time) bool {
+	return l.token != "" && !now.Before(l.until)
+}
+
+// leaseOwner returns the ID of the node holding a lease from its token.
+func leaseOwner(token string) string {
+	if i := strings.LastIndex(token, "/"); i >= 0 {
+		return token[:i]
+	}
+	return token
+}
+
+// clusterCommand is a player's action forwarded to the node owning the
+// game. Action is one of the actions of Play, BERSERK or a conditional
+// moves action.
+type clusterCommand struct {
+	ID     string     `json:"id"`
+	GameID string     `json:"game_id"`
+	UserID string     `json:"user_id"`
+	Action string     `json:"action"`
+	Move   string     `json:"move,omitempty"`
+	Lines  [][]string `json:"lines,omitempty"`
+}
+
+type clusterReply struct {
+	Error string     `json:"error,omitempty"`
+	Lines [][]string `json:"lines,omitempty"`
+}
+
+// EnableCluster makes the GameManager one node of a cluster sharing Redis.
+// Each game is owned by the node holding its lease; players' actions
+// arriving at other nodes are forwarded to the owner, and a game whose
+// owner stops renewing its lease is adopted by another node. It must be
+// called before games start, with an ID unique to the process, and
+// RunCluster must run for as long as the node does.
+func (gm *GameManager) EnableCluster(nodeID string) {
+	gm.nodeID = nodeID
+}
+
+// NodeID is the node's ID in the cluster, empty when cluster mode is off.
+func (gm *GameManager) NodeID() string {
+	return gm.nodeID
+}
+
+func (gm *GameManager) clustered() bool {
+	return gm.nodeID != ""
+}
+
+// RunCluster renews the leases of the node's games, publishes which users
+// are connected to it and playing on it, tracks which players of its games
+// are connected to no node, adopts its players' games whose
+// owner is gone and executes the commands forwarded to the node, until ctx
+// is cancelled. The node then hands its games over.
+func (gm *GameManager) RunCluster(ctx context.Context) {
+	// Commands left from an earlier process with the same ID are stale.
+	stream := nodeStreamPrefix + gm.nodeID
+	if err := gm.redisClient.Del(ctx, stream).Err(); err != nil {
+		log.Printf("Failed to clear cluster commands: %v", err)
+	}
+	go gm.consumeCommands(ctx, stream)
+
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			gm.leaveCluster()
+			return
+		case <-ticker.C:
+			gm.renewLeases(ctx)
+			gm.refreshPresence(ctx)
+			gm.trackPresence(gm.localGames())
+			gm.adoptOrphans(ctx)
+		}
+	}
+}
+
+// claimGame takes the lease of a game nobody owns. It returns false when
+// another node owns the game, and always succeeds outside cluster mode.
+func (gm *GameManager) claimGame(ctx context.Context, gameID string) (gameLease, bool, error) {
+	if !gm.clustered() {
+		return gameLease{}, true, nil
+	}
+
+	start := time.Now()
+	keys := []string{leaseKeyPrefix + gameID, epochKeyPrefix + gameID}
+	token, err := claimLeaseScript.Run(ctx, gm.redisClient, keys, gm.nodeID, leaseTTL.Milliseconds(), epochTTL.Milliseconds()).Text()
+	if err == redis.Nil {
+		return gameLease{}, false, nil
+	}
+	if err != nil {
+		return gameLease{}, false, err
+	}
+	return gameLease{token: token, until: start.Add(leaseTTL - leaseMargin)}, true, nil
+}
+
+// releaseGame gives up the node's lease on a game, e.g. once it ended.
+func (gm *GameManager) releaseGame(gameID string, lease gameLease) {
+	if lease.token == "" {
+		return
+	}
+	if err := releaseLeaseScript.Run(context.Background(), gm.redisClient, []string{leaseKeyPrefix + gameID}, lease.token).Err(); err != nil {
+		log.Printf("Failed to release lease of game %s: %v", gameID, err)
+	}
+}
+
+// fence makes a move write fail unless the node still holds the game's
+// lease. It must be called with g.mu held.
+func (g *Game) fence() queue.Fence {
+	if g.lease.token == "" {
+		return queue.Fence{}
+	}
+	return queue.Fence{Key: leaseKeyPrefix + g.ID, Token: g.lease.token}
+}
+
+// renewLeases extends the leases of the node's games. A game whose lease
+// lapsed meanwhile stopped, so its flag timer is armed again.
+func (gm *GameManager) renewLeases(ctx context.Context) {
+	for _, game := range gm.localGames() {
+		game.mu.RLock()
+		lease := game.lease
+		game.mu.RUnlock()
+		if lease.token == "" {
+			// The game started while its lease could not be claimed.
+			gm.claimLease(ctx, game)
+			continue
+		}
+
+		start := time.Now()
+		keys := []string{leaseKeyPrefix + game.ID, epochKeyPrefix + game.ID}
+		owned, err := renewLeaseScript.Run(ctx, gm.redisClient, keys, lease.token, leaseTTL.Milliseconds(), epochTTL.Milliseconds()).Int()
+		if err != nil {
+			log.Printf("Failed to renew lease of game %s: %v", game.ID, err)
+			continue
+		}
+		if owned == 0 {
+			log.Printf("Node %s lost game %s to another node", gm.nodeID, game.ID)
+			gm.evict(game.ID)
+			continue
+		}
+
+		game.mu.Lock()
+		lapsed := game.lease.lapsed(start)
+		game.lease.until = start.Add(leaseTTL - leaseMargin)
+		if lapsed {
+			game.armFlagTimer(gm)
+		}
+		game.mu.Unlock()
+	}
+}
+
+// claimLease claims the lease of a game the node started without one.
+func (gm *GameManager) claimLease(ctx context.Context, game *Game) {
+	lease, claimed, err := gm.claimGame(ctx, game.ID)
+	if err != nil {
+		log.Printf("Failed to claim game %s: %v", game.ID, err)
+		return
+	}
+	if !claimed {
+		log.Printf("Node %s lost game %s to another node", gm.nodeID, game.ID)
+		gm.evict(game.ID)
+		return
+	}
+	game.mu.Lock()
+	game.lease = lease
+	game.mu.Unlock()
+}
+
+// localGames lists the games in progress on this node.
+func (gm *GameManager) localGames() []*Game {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	var games []*Game
+	for _, game := range gm.games {
+		if game.IsActive() {
+			games = append(games, game)
+		}
+	}
+	return games
+}
+
+// evict drops a game the node no longer owns. Its timers and any move in
+// flight find it released and leave it alone; local players keep receiving
+// its events from the new owner over the game channel.
+func (gm *GameManager) evict(gameID string) {
+	gm.mu.Lock()
+	game, ok := gm.games[gameID]
+	delete(gm.games, gameID)
+	gm.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	if game.flagTimer != nil {
+		game.flagTimer.Stop()
+	}
+	if game.status == GameStatusInProgress {
+		game.status = gameStatusReleased
+	}
+}
+
+// leaveCluster hands every game of the node over to the rest of the
+// cluster. The adopters rebuild the games from their move logs, which hold
+// the moves the worker has not written yet.
+func (gm *GameManager) leaveCluster() {
+	for _, game := range gm.localGames() {
+		gm.evict(game.ID)
+		game.mu.RLock()
+		lease := game.lease
+		game.mu.RUnlock()
+		gm.releaseGame(game.ID, lease)
+	}
+}
+
+// adoptOrphans takes over the games of the node's players whose owner is
+// gone, so their clocks keep running without waiting for a command, and
+// forgets those that ended meanwhile.
+func (gm *GameManager) adoptOrphans(ctx context.Context) {
+	gm.mu.RLock()
+	remote := make(map[string]struct{})
+	for _, session := range gm.sessions {
+		for gameID := range session.Games {
+			if _, local := gm.games[gameID]; !local {
+				remote[gameID] = struct{}{}
+			}
+		}
+	}
+	gm.mu.RUnlock()
+
+	for gameID := range remote {
+		err := gm.redisClient.Get(ctx, leaseKeyPrefix+gameID).Err()
+		if err != redis.Nil {
+			if err != nil {
+				log.Printf("Failed to look up owner of game %s: %v", gameID, err)
+			}
+			continue
+		}
+
+		_, err = gm.adopt(ctx, gameID)
+		switch {
+		case errors.Is(err, ErrGameEnded), errors.Is(err, ErrGameNotFound):
+			gm.forgetGame(gameID)
+		case err != nil && !errors.Is(err, errGameClaimed):
+			log.Printf("Failed to adopt game %s: %v", gameID, err)
+		}
+	}
+}
+
+// adopt takes over a game no node hosts, e.g. because its owner is gone: it
+// claims the lease and rebuilds the game from its move log.
+func (gm *GameManager) adopt(ctx context.Context, gameID string) (*Game, error) {
+	dbGame, err := gm.gameStore.GetGameByID(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if dbGame == nil {
+		return nil, ErrGameNotFound
+	}
+	if dbGame.Status != string(GameStatusInProgress) {
+		return nil, ErrGameEnded
+	}
+
+	lease, claimed, err := gm.claimGame(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errGameClaimed
+	}
+	gm.prefetchStoredGame(dbGame)
+	game, err := gm.rebuildGame(ctx, dbGame, lease)
+	if err != nil {
+		gm.releaseGame(gameID, lease)
+		return nil, err
+	}
+
+	gm.mu.Lock()
+	if local, ok := gm.games[gameID]; ok {
+		gm.mu.Unlock()
+		return local, nil
+	}
+	gm.installGame(game)
+	for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+		if session, ok := gm.sessions[userID]; ok {
+			session.send(gm.localGameState(game, userID))
+		}
+	}
+	gm.mu.Unlock()
+	gm.trackPresence([]*Game{game})
+
+	log.Printf("Node %s adopted game %s", gm.nodeID, gameID)
+	return game, nil
+}
+
+// forgetGame drops an ended game hosted elsewhere from the node's sessions.
+func (gm *GameManager) forgetGame(gameID string) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	for _, session := range gm.sessions {
+		delete(session.Games, gameID)
+	}
+	gm.maybeUnsubscribe(gameID)
+}
+
+// forward runs a command on the node owning its game and returns the
+// owner's answer. A game without an owner is adopted and the command run
+// here.
+func (gm *GameManager) forward(cmd clusterCommand) (clusterReply, error) {
+	ctx := context.Background()
+
+	for attempt := 0; ; attempt++ {
+		lease, err := gm.redisClient.Get(ctx, leaseKeyPrefix+cmd.GameID).Result()
+		if err != nil && err != redis.Nil {
+			return clusterReply{}, err
+		}
+		if owner := leaseOwner(lease); err == nil && owner != gm.nodeID {
+			return gm.send(ctx, owner, cmd)
+		}
+
+		_, err = gm.adopt(ctx, cmd.GameID)
+		if errors.Is(err, errGameClaimed) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return clusterReply{}, err
+		}
+		return gm.execute(cmd), nil
+	}
+}
+
+// send delivers a command to another node's stream and waits for its reply.
+func (gm *GameManager) send(ctx context.Context, nodeID string, cmd clusterCommand) (clusterReply, error) {
+	cmd.ID = uuid.New().String()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return clusterReply{}, err
+	}
+
+	err = gm.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: nodeStreamPrefix + nodeID,
+		MaxLen: commandStreamLength,
+		Approx: true,
+		Values: map[string]interface{}{"command": data},
+	}).Err()
+	if err != nil {
+		return clusterReply{}, err
+	}
+
+	result, err := gm.redisClient.BLPop(ctx, commandTimeout, replyKeyPrefix+cmd.ID).Result()
+	if err == redis.Nil {
+		return clusterReply{}, ErrOwnerUnavailable
+	}
+	if err != nil {
+		return clusterReply{}, err
+	}
+
+	var reply clusterReply
+	if err := json.Unmarshal([]byte(result[1]), &reply); err != nil {
+		return clusterReply{}, err
+	}
+	return reply, reply.err()
+}
+
+// consumeCommands executes the commands other nodes forward to this one,
+// in order, until ctx is cancelled.
+func (gm *GameManager) consumeCommands(ctx context.Context, stream string) {
+	lastID := "0"
+	defer gm.redisClient.Del(context.Background(), stream)
+
+	for {
+		streams, err := gm.redisClient.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{stream, lastID},
+			Block:   time.Second,
+		}).Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to read cluster commands: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, message := range streams[0].Messages {
+			lastID = message.ID
+			data, _ := message.Values["command"].(string)
+
+			var cmd clusterCommand
+			if err := json.Unmarshal([]byte(data), &cmd); err != nil {
+				log.Printf("Invalid cluster command %s: %v", message.ID, err)
+				continue
+			}
+			gm.reply(ctx, cmd.ID, gm.execute(cmd))
+		}
+	}
+}
+
+func (gm *GameManager) reply(ctx context.Context, commandID string, reply clusterReply) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		log.Printf("Failed to marshal reply to command %s: %v", commandID, err)
+		return
+	}
+
+	key := replyKeyPrefix + commandID
+	_, err = gm.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, data)
+		pipe.Expire(ctx, key, replyTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to reply to command %s: %v", commandID, err)
+	}
+}
+
+// execute runs a command on a game hosted on this node. It never forwards
+// the command again.
+func (gm *GameManager) execute(cmd clusterCommand) clusterReply {
+	var reply clusterReply
+	var err error
+
+	switch cmd.Action {
+	case BERSERK:
+		err = gm.berserkLocal(cmd.GameID, cmd.UserID)
+	case actionGetConditionals:
+		reply.Lines, err = gm.conditionalMovesLocal(cmd.GameID, cmd.UserID)
+	case actionSetConditionals:
+		reply.Lines, err = gm.setConditionalMovesLocal(cmd.GameID, cmd.UserID, cmd.Lines)
+	default:
+		err = gm.playLocal(cmd.UserID, cmd.GameID, cmd.Action, cmd.Move)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return reply
+}
+
+// remoteErrors are the errors a command can fail with, recognised again
+// from their message so callers on the forwarding node can tell them apart.
+var remoteErrors = []error{
+	ErrGameEnded, ErrNotYourTurn, ErrInvalidMove, ErrNotInGame, ErrEmptyMove, ErrTimeExpired,
+	ErrGameNotFound, ErrGameNotOnServer, ErrOwnerUnavailable, ErrUnknownAction,
+	ErrNoDrawOffer, ErrDrawAlreadyOffered, ErrNoTakebackRequest, ErrTakebackAlreadyAsked, ErrNothingToTakeBack,
+	ErrCannotAnswerOwnOffer, ErrTooManyDrawOffers, ErrTooManyTakebackAsks,
+	ErrOpponentConnected, ErrClaimTooEarly,
+	ErrNotCorrespondence, ErrConditionalOnYourTurn, ErrTooManyConditionals, ErrInvalidConditional,
+	ErrBerserkUntimed, ErrBerserkTooLate, ErrAlreadyBerserk,
+}
+
+func (r clusterReply) err() error {
+	if r.Error == "" {
+		return nil
+	}
+	for _, err := range remoteErrors {
+		if err.Error() == r.Error {
+			return err
+		}
+	}
+	return errors.New(r.Error)
+}
@@ -0,0 +1,185 @@
+package gamemanager_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/Adi-ty/chess/internal/store/storetest"
+	"github.com/Adi-ty/chess/internal/variant"
+	"github.com/Adi-ty/chess/internal/worker"
+	"github.com/redis/go-redis/v9"
+)
+
+// clusterTestDB is the Redis database the cluster test writes to; it should
+// not be one a server uses.
+const clusterTestDB = 15
+
+// line is played in every game: the first handover plies before a node
+// leaves, the rest after.
+var line = []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "g8f6", "d2d3", "f8c5", "c2c3", "d7d6"}
+
+const handover = 4
+
+type node struct {
+	gm     *gamemanager.GameManager
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func startNode(nodeID string, rdb *redis.Client, gameStore *storetest.MemoryGameStore) *node {
+	gm := gamemanager.NewGameManager(gameStore, rdb, matchmaking.NewMemoryMatchmaker(), nil)
+	gm.EnableCluster(nodeID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &node{gm: gm, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(n.done)
+		gm.RunCluster(ctx)
+	}()
+	return n
+}
+
+func (n *node) stop() {
+	n.cancel()
+	<-n.done
+}
+
+type clusterGame struct {
+	id    string
+	white string
+	black string
+}
+
+// player is the user to move after ply half-moves.
+func (g clusterGame) player(ply int) string {
+	if ply%2 == 0 {
+		return g.white
+	}
+	return g.black
+}
+
+// TestCluster runs several nodes against one Redis, given by REDIS_ADDR,
+// and checks that moves sent to any node reach the game's owner and that
+// the games of a node that leaves are adopted by the others with every move
+// intact, though the move worker has written none of them yet. It is
+// skipped when Redis is unreachable.
+func TestCluster(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DB: clusterTestDB})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis is unreachable at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+
+	gameStore := storetest.NewMemoryGameStore()
+	run := fmt.Sprintf("test-%d-%d", os.Getpid(), time.Now().UnixNano())
+
+	nodes := make([]*node, 3)
+	for i := range nodes {
+		nodes[i] = startNode(fmt.Sprintf("%s-%d", run, i), rdb, gameStore)
+	}
+	t.Cleanup(func() {
+		for _, n := range nodes[1:] {
+			n.stop()
+		}
+	})
+	// Let every node clear its command stream before commands arrive.
+	time.Sleep(500 * time.Millisecond)
+
+	games := make([]clusterGame, 6)
+	for i := range games {
+		g := clusterGame{white: fmt.Sprintf("white-%d", i), black: fmt.Sprintf("black-%d", i)}
+		game, err := gamemanager.StartNewGame(g.white, g.black, gamemanager.GameOptions{
+			TimeControl: gamemanager.TimeControl{Initial: 10 * time.Minute},
+		})
+		if err != nil {
+			t.Fatalf("create game: %v", err)
+		}
+		if err := nodes[i%len(nodes)].gm.StartGame(game); err != nil {
+			t.Fatalf("start game: %v", err)
+		}
+		g.id = game.ID
+		games[i] = g
+	}
+
+	// Every move is sent to a different node than the previous one, so
+	// most are forwarded to the owner.
+	for ply := 0; ply < handover; ply++ {
+		for i, g := range games {
+			n := nodes[(i+ply+1)%len(nodes)]
+			if err := n.gm.Play(g.player(ply), g.id, gamemanager.MOVE, line[ply]); err != nil {
+				t.Errorf("game %d move %s on %s: %v", i, line[ply], n.gm.NodeID(), err)
+			}
+		}
+	}
+
+	// Errors come back from the owner as the same values.
+	g := games[0]
+	err := nodes[1].gm.Play(g.player(handover+1), g.id, gamemanager.MOVE, line[handover])
+	if !errors.Is(err, gamemanager.ErrNotYourTurn) {
+		t.Errorf("out-of-turn move on a remote game returned %v, want %v", err, gamemanager.ErrNotYourTurn)
+	}
+
+	// The node leaves while its moves are still queued.
+	nodes[0].stop()
+	alive := nodes[1:]
+
+	for ply := handover; ply < len(line); ply++ {
+		for i, g := range games {
+			n := alive[(i+ply)%len(alive)]
+			if err := n.gm.Play(g.player(ply), g.id, gamemanager.MOVE, line[ply]); err != nil {
+				t.Errorf("game %d move %s on %s after handover: %v", i, line[ply], n.gm.NodeID(), err)
+			}
+		}
+	}
+
+	board, err := variant.Replay(variant.Standard, "", line)
+	if err != nil {
+		t.Fatalf("invalid line: %v", err)
+	}
+	for i, g := range games {
+		for _, n := range alive {
+			state, err := n.gm.GameState(g.id, g.white)
+			switch {
+			case err != nil:
+				t.Errorf("game %d state on %s: %v", i, n.gm.NodeID(), err)
+			case state.Ply != len(line) || state.FEN != board.FEN():
+				t.Errorf("game %d on %s is at ply %d (%s), want %d (%s)", i, n.gm.NodeID(), state.Ply, state.FEN, len(line), board.FEN())
+			}
+		}
+	}
+
+	go worker.NewWorker(rdb, gameStore, run).Start()
+	if !waitForMoves(gameStore, games, len(line)) {
+		t.Errorf("moves were not written in time")
+	}
+}
+
+// waitForMoves waits for the move worker to write plies moves of every
+// game.
+func waitForMoves(gameStore *storetest.MemoryGameStore, games []clusterGame, plies int) bool {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		done := true
+		for _, g := range games {
+			if gameStore.MoveCount(g.id) < plies {
+				done = false
+				break
+			}
+		}
+		if done {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package gamemanager
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sendQueueSize is how many messages may wait for a connection before
+	// it counts as too slow and is closed.
+	sendQueueSize = 256
+	// writeWait bounds each write to a connection.
+	writeWait = 10 * time.Second
+)
+
+// Conn is a websocket connection to this replica. gorilla/websocket allows
+// one writer at a time, while a connection is written to by its own handler,
+// the game listeners and other players' actions, so every message is queued
+// with Send and written by the connection's single writer goroutine.
+type Conn struct {
+	ws        *websocket.Conn
+	send      chan interface{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(ws *websocket.Conn) *Conn {
+	c := &Conn{
+		ws:     ws,
+		send:   make(chan interface{}, sendQueueSize),
+		closed: make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+// Send queues msg for the connection. A connection that lets its queue
+// fill up is closed rather than blocking the sender; messages sent after
+// Close are dropped.
+func (c *Conn) Send(msg interface{}) {
+	if c == nil {
+		return
+	}
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+	select {
+	case c.send <- msg:
+	default:
+		log.Printf("Closing connection %s: too many unsent messages", c.ws.RemoteAddr())
+		c.Close()
+	}
+}
+
+// Close closes the connection once the messages already queued are
+// written.
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	return c.ws.ReadMessage()
+}
+
+func (c *Conn) ReadJSON(v interface{}) error {
+	return c.ws.ReadJSON(v)
+}
+
+func (c *Conn) writeLoop() {
+	defer c.ws.Close()
+
+	for {
+		select {
+		case msg := <-c.send:
+			if !c.write(msg) {
+				c.Close()
+				return
+			}
+		case <-c.closed:
+			c.flush()
+			return
+		}
+	}
+}
+
+// flush writes what is left in the queue of a closing connection.
+func (c *Conn) flush() {
+	for {
+		select {
+		case msg := <-c.send:
+			if !c.write(msg) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (c *Conn) write(msg interface{}) bool {
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := c.ws.WriteJSON(msg); err != nil {
+		log.Printf("Write error: %v", err)
+		return false
+	}
+	return true
+}
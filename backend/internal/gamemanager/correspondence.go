@@ -0,0 +1,107 @@
+package gamemanager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// deadlineCheckInterval is how often RunDeadlines looks for correspondence
+// games whose player to move has run out of time.
+const deadlineCheckInterval = time.Minute
+
+// RunDeadlines ends the correspondence games whose player to move missed
+// their deadline, until ctx is cancelled. Overdue games are looked up in the
+// store, so games no node has loaded are loaded and ended too.
+func (gm *GameManager) RunDeadlines(ctx context.Context) {
+	ticker := time.NewTicker(deadlineCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			gm.enforceDeadlines(ctx, now)
+		}
+	}
+}
+
+func (gm *GameManager) enforceDeadlines(ctx context.Context, now time.Time) {
+	dbGames, err := gm.gameStore.ListOverdueGames(ctx, now)
+	if err != nil {
+		log.Printf("Failed to list overdue games: %v", err)
+		return
+	}
+
+	for i := range dbGames {
+		game, err := gm.loadGame(ctx, dbGames[i].ID)
+		if err != nil {
+			if !errors.Is(err, ErrGameNotOnServer) && !errors.Is(err, ErrGameEnded) {
+				log.Printf("Failed to load overdue game %s: %v", dbGames[i].ID, err)
+			}
+			continue
+		}
+		game.checkDeadline(gm, now)
+	}
+}
+
+func (g *Game) checkDeadline(gm *GameManager, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.status != GameStatusInProgress || !g.overdue(now) {
+		return
+	}
+	log.Printf("Correspondence game %s timed out", g.ID)
+	g.flag(gm, now)
+}
+
+// setDeadline gives the side to move the game's days per move from now and
+// records it. It must be called with g.mu held.
+func (g *Game) setDeadline(gm *GameManager, now time.Time) {
+	g.deadline = now.Add(g.timeControl.MoveTime())
+
+	err := gm.gameStore.UpdateMoveDeadline(context.Background(), g.ID, g.userToMove(), g.deadline)
+	if err != nil {
+		log.Printf("Failed to store deadline of game %s: %v", g.ID, err)
+	}
+}
+
+// overdue reports whether the side to move missed its correspondence
+// deadline. It must be called with g.mu held.
+func (g *Game) overdue(now time.Time) bool {
+	return g.timeControl.IsCorrespondence() && !g.deadline.IsZero() && now.After(g.deadline)
+}
+
+// deadlineSnapshot must be called with g.mu held.
+func (g *Game) deadlineSnapshot() *time.Time {
+	if !g.timeControl.IsCorrespondence() || g.status != GameStatusInProgress || g.deadline.IsZero() {
+		return nil
+	}
+	deadline := g.deadline
+	return &deadline
+}
+
+// notifyTurn tells the player to move in a correspondence game that their
+// opponent played move, on their connection and to their listeners. It must
+// be called with g.mu held.
+func (g *Game) notifyTurn(gm *GameManager, move string) {
+	g.sendToUser(gm, g.userToMove(), OutgoingYourTurn{
+		Type:     YOUR_TURN,
+		GameID:   g.ID,
+		Move:     move,
+		Deadline: g.deadline,
+	})
+}
+
+// userToMove must be called with g.mu held.
+func (g *Game) userToMove() string {
+	if g.board.Turn() == chess.White {
+		return g.WhiteUserID
+	}
+	return g.BlackUserID
+}
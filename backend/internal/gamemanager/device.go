@@ -0,0 +1,41 @@
+package gamemanager
+
+import (
+	"errors"
+)
+
+var ErrInactiveDevice = errors.New("you chose to move from another device")
+
+// canAct reports whether the user may move and act in games from conn.
+func (gm *GameManager) canAct(session *PlayerSession, conn *Conn) bool {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+	return session.canAct(conn)
+}
+
+// setActiveDevice makes conn the only connection the user moves from, or
+// lets every connection move again. Any connection may take over or clear
+// the choice, e.g. when the active device was left behind.
+func (gm *GameManager) setActiveDevice(session *PlayerSession, conn *Conn, active bool) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	if active {
+		session.active = conn
+	} else {
+		session.active = nil
+	}
+	gm.announceActiveDevice(session)
+}
+
+// announceActiveDevice tells every connection of the session whether it may
+// move. It must be called with gm.mu held.
+func (gm *GameManager) announceActiveDevice(session *PlayerSession) {
+	for conn := range session.Conns {
+		conn.Send(session.activeDevice(conn))
+	}
+}
+
+func (s *PlayerSession) activeDevice(conn *Conn) OutgoingActiveDevice {
+	return OutgoingActiveDevice{Type: ACTIVE_DEVICE, Active: s.active == conn, CanMove: s.canAct(conn)}
+}
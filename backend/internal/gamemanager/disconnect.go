@@ -0,0 +1,138 @@
+package gamemanager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// defaultDisconnectGrace gives players of longer games more time to come
+// back before their opponent can claim the game.
+var defaultDisconnectGrace = map[TimeCategory]time.Duration{
+	CategoryBullet:    15 * time.Second,
+	CategoryBlitz:     30 * time.Second,
+	CategoryRapid:     time.Minute,
+	CategoryClassical: 2 * time.Minute,
+	CategoryUnlimited: 3 * time.Minute,
+}
+
+var (
+	ErrOpponentConnected = errors.New("your opponent is still connected")
+	ErrClaimTooEarly     = errors.New("your opponent may still reconnect")
+)
+
+// SetDisconnectGrace overrides how long a player of a time category may be
+// disconnected before their opponent can claim the game. It must be called
+// before games start.
+func (gm *GameManager) SetDisconnectGrace(category TimeCategory, grace time.Duration) {
+	gm.disconnectGrace[category] = grace
+}
+
+func (gm *GameManager) disconnectGraceFor(tc TimeControl) time.Duration {
+	return gm.disconnectGrace[tc.Category()]
+}
+
+// HandleDisconnect starts the grace period in which userID may reconnect
+// and tells their opponent when it ends. Correspondence games carry on
+// without their players. It must be called with gm.mu held.
+func (g *Game) HandleDisconnect(userID string, gm *GameManager) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.status != GameStatusInProgress || g.timeControl.IsCorrespondence() {
+		return
+	}
+
+	now := time.Now()
+	g.disconnected[userID] = now
+	if session, ok := gm.session(userID); ok {
+		session.DisconnectedAt = now
+	}
+
+	grace := gm.disconnectGraceFor(g.timeControl)
+	g.sendToUser(gm, g.opponentOf(userID), OutgoingOpponentDisconnected{
+		Type:    OPPONENT_DISCONNECTED,
+		GameID:  g.ID,
+		Seconds: int(grace / time.Second),
+		ClaimAt: now.Add(grace),
+	})
+
+	time.AfterFunc(grace, func() {
+		g.graceExpired(gm, userID, now)
+	})
+}
+
+// HandleReconnect ends userID's grace period and tells their opponent they
+// are back. It must be called with gm.mu held.
+func (g *Game) HandleReconnect(userID string, gm *GameManager) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, gone := g.disconnected[userID]; !gone || g.status != GameStatusInProgress {
+		return
+	}
+	delete(g.disconnected, userID)
+
+	g.sendToUser(gm, g.opponentOf(userID), OutgoingOpponentReconnected{Type: OPPONENT_RECONNECTED, GameID: g.ID})
+}
+
+// graceExpired settles the game when userID did not come back in time and
+// nobody is left to claim it: the engine claims the win, and a game both
+// players left is drawn once the opponent's grace period is over too, by
+// whichever of the two timers fires last. Otherwise the game waits for the
+// opponent's claim.
+func (g *Game) graceExpired(gm *GameManager, userID string, since time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.status != GameStatusInProgress || !g.disconnected[userID].Equal(since) {
+		return
+	}
+
+	opponent := g.opponentOf(userID)
+	if g.isBot(opponent) {
+		g.leaver = userID
+		g.endGame(gm, GameStatusAbandoned, g.winFor(opponent), MethodDisconnect)
+		return
+	}
+	if opponentSince, gone := g.disconnected[opponent]; gone && time.Since(opponentSince) >= gm.disconnectGraceFor(g.timeControl) {
+		g.endGame(gm, GameStatusAbandoned, chess.Draw.String(), MethodDisconnect)
+	}
+}
+
+// Claim ends the game as a win for the player, or as a draw, once their
+// opponent has been disconnected for longer than the grace period. The
+// opponent is recorded as the leaver of a won claim.
+func (g *Game) Claim(session *PlayerSession, draw bool, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.playerColor(session.UserID); err != nil {
+		return err
+	}
+	opponent := g.opponentOf(session.UserID)
+	since, gone := g.disconnected[opponent]
+	if !gone {
+		return ErrOpponentConnected
+	}
+	if time.Since(since) < gm.disconnectGraceFor(g.timeControl) {
+		return ErrClaimTooEarly
+	}
+
+	if draw {
+		g.endGame(gm, GameStatusAbandoned, chess.Draw.String(), MethodDisconnect)
+		return nil
+	}
+	g.leaver = opponent
+	g.endGame(gm, GameStatusAbandoned, g.winFor(session.UserID), MethodDisconnect)
+	return nil
+}
+
+// winFor is the outcome of a game userID won.
+func (g *Game) winFor(userID string) string {
+	if userID == g.WhiteUserID {
+		return chess.WhiteWon.String()
+	}
+	return chess.BlackWon.String()
+}
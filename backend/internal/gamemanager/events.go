@@ -0,0 +1,212 @@
+package gamemanager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// listenerBuffer is how many events a slow listener may fall behind before
+// events are dropped for it.
+const listenerBuffer = 64
+
+// UserEvent is a message for one user, delivered to listeners registered
+// with Listen. GameID is empty for events not tied to a game.
+type UserEvent struct {
+	GameID  string
+	Message interface{}
+}
+
+// OutgoingGameFinish tells listeners that one of their games ended.
+type OutgoingGameFinish struct {
+	Type    string `json:"type"`
+	GameID  string `json:"game_id"`
+	Outcome string `json:"outcome"`
+	Method  string `json:"method"`
+}
+
+// Listen registers a listener for the messages sent to userID outside a
+// websocket connection, such as challenges and game starts for bot
+// accounts. The returned function unregisters it and closes the channel.
+func (gm *GameManager) Listen(userID string) (<-chan UserEvent, func()) {
+	ch := make(chan UserEvent, listenerBuffer)
+
+	gm.listenersMu.Lock()
+	if gm.listeners[userID] == nil {
+		gm.listeners[userID] = make(map[chan UserEvent]struct{})
+	}
+	gm.listeners[userID][ch] = struct{}{}
+	gm.listenersMu.Unlock()
+
+	return ch, func() {
+		gm.listenersMu.Lock()
+		defer gm.listenersMu.Unlock()
+		if _, ok := gm.listeners[userID][ch]; !ok {
+			return
+		}
+		delete(gm.listeners[userID], ch)
+		if len(gm.listeners[userID]) == 0 {
+			delete(gm.listeners, userID)
+		}
+		close(ch)
+	}
+}
+
+// notifyListeners delivers msg to userID's listeners without blocking. It
+// reports whether there was any listener.
+func (gm *GameManager) notifyListeners(userID string, gameID string, msg interface{}) bool {
+	gm.listenersMu.Lock()
+	defer gm.listenersMu.Unlock()
+
+	for ch := range gm.listeners[userID] {
+		select {
+		case ch <- UserEvent{GameID: gameID, Message: msg}:
+		default:
+			log.Printf("Dropping event for slow listener of user %s", userID)
+		}
+	}
+	return len(gm.listeners[userID]) > 0
+}
+
+var (
+	ErrUnknownAction   = errors.New("unknown action")
+	ErrGameNotOnServer = errors.New("game is not hosted on this server")
+)
+
+// Play performs a player's action in a game. action is one of the MOVE,
+// RESIGN, draw, takeback, claim and premove message types. In cluster mode
+// actions in games hosted on another node are forwarded to it.
+func (gm *GameManager) Play(userID string, gameID string, action string, move string) error {
+	err := gm.playLocal(userID, gameID, action, move)
+	if errors.Is(err, ErrGameNotOnServer) && gm.clustered() {
+		_, err = gm.forward(clusterCommand{GameID: gameID, UserID: userID, Action: action, Move: move})
+	}
+	return err
+}
+
+// playLocal performs a player's action in a game hosted on this replica.
+func (gm *GameManager) playLocal(userID string, gameID string, action string, move string) error {
+	game, err := gm.localGame(gameID)
+	if err != nil {
+		return err
+	}
+	game.mu.RLock()
+	lapsed := game.lease.lapsed(time.Now())
+	game.mu.RUnlock()
+	if lapsed {
+		return ErrOwnerUnavailable
+	}
+
+	session := &PlayerSession{UserID: userID}
+	switch action {
+	case MOVE:
+		return game.MakeMove(session, move, gm)
+	case PREMOVE:
+		return game.Premove(session, move, gm)
+	case CANCEL_PREMOVE:
+		return game.CancelPremove(session, gm)
+	case RESIGN:
+		return game.Resign(session, gm)
+	case OFFER_DRAW:
+		return game.OfferDraw(session, gm)
+	case ACCEPT_DRAW:
+		return game.RespondDraw(session, true, gm)
+	case DECLINE_DRAW:
+		return game.RespondDraw(session, false, gm)
+	case REQUEST_TAKEBACK:
+		return game.RequestTakeback(session, gm)
+	case ACCEPT_TAKEBACK:
+		return game.RespondTakeback(session, true, gm)
+	case DECLINE_TAKEBACK:
+		return game.RespondTakeback(session, false, gm)
+	case CLAIM_VICTORY:
+		return game.Claim(session, false, gm)
+	case CLAIM_DRAW:
+		return game.Claim(session, true, gm)
+	}
+	return ErrUnknownAction
+}
+
+// GameSnapshot describes the current state of a game, like the snapshot sent
+// to spectators.
+func (gm *GameManager) GameSnapshot(gameID string) (OutgoingSpectate, error) {
+	return gm.spectatorSnapshot(gameID)
+}
+
+// localGame returns a game hosted on this replica. A game in progress that
+// no node hosts, e.g. a correspondence game whose players were away while
+// the servers restarted, is loaded from the store; one hosted by another
+// node is ErrGameNotOnServer.
+func (gm *GameManager) localGame(gameID string) (*Game, error) {
+	return gm.loadGame(context.Background(), gameID)
+}
+
+func (gm *GameManager) loadGame(ctx context.Context, gameID string) (*Game, error) {
+	gm.mu.RLock()
+	game, local := gm.games[gameID]
+	gm.mu.RUnlock()
+
+	if local {
+		return game, nil
+	}
+
+	game, err := gm.adopt(ctx, gameID)
+	if errors.Is(err, errGameClaimed) {
+		return nil, ErrGameNotOnServer
+	}
+	return game, err
+}
+
+// Follow streams the raw events published on the game's channel until ctx is
+// cancelled. It works for games hosted on any replica. Spectator chat is
+// left out.
+func (gm *GameManager) Follow(ctx context.Context, gameID string) (<-chan []byte, error) {
+	pubsub := gm.redisClient.Subscribe(ctx, "game:"+gameID)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events := make(chan []byte, listenerBuffer)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				if chat, isChat := parseChat([]byte(msg.Payload)); isChat && chat.Room == ChatRoomSpectators {
+					continue
+				}
+				select {
+				case events <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// ActiveGames returns the IDs of the in-progress games on this replica that
+// userID plays in.
+func (gm *GameManager) ActiveGames(userID string) []string {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	var gameIDs []string
+	for id, game := range gm.games {
+		if (game.WhiteUserID == userID || game.BlackUserID == userID) && game.IsActive() {
+			gameIDs = append(gameIDs, id)
+		}
+	}
+	return gameIDs
+}
@@ -8,10 +8,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Adi-ty/chess/internal/pgn"
 	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/Adi-ty/chess/internal/variant"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 	"github.com/notnil/chess"
+	"github.com/redis/go-redis/v9"
 )
 
 type GameStatus string
@@ -20,14 +22,20 @@ const (
 	GameStatusInProgress GameStatus = "in_progress"
 	GameStatusCompleted  GameStatus = "completed"
 	GameStatusAbandoned  GameStatus = "abandoned"
+
+	// gameStatusReleased is never stored: it marks a game whose lease
+	// another node of the cluster holds, so this copy no longer acts.
+	gameStatusReleased GameStatus = "released"
 )
 
 var (
-	ErrGameEnded   = errors.New("game has already ended")
-	ErrNotYourTurn = errors.New("not your turn")
-	ErrInvalidMove = errors.New("invalid move format")
-	ErrNotInGame   = errors.New("you are not in this game")
-	ErrEmptyMove   = errors.New("move cannot be empty")
+	ErrGameEnded     = errors.New("game has already ended")
+	ErrNotYourTurn   = errors.New("not your turn")
+	ErrInvalidMove   = errors.New("invalid move format")
+	ErrNotInGame     = errors.New("you are not in this game")
+	ErrEmptyMove     = errors.New("move cannot be empty")
+	ErrTimeExpired   = errors.New("your time has run out")
+	ErrAlreadyInGame = errors.New("player is already in an active game")
 )
 
 type Game struct {
@@ -36,36 +44,139 @@ type Game struct {
 	WhiteUserID string
 	BlackUserID string
 
-	board  *chess.Game
+	board  *variant.Board
 	status GameStatus
 
 	moveNumber int
 
+	timeControl TimeControl
+	rated       bool
+	clock       *Clock
+	flagTimer   *time.Timer
+	// moveClocks is the mover's remaining time after each move of a timed
+	// game, for the PGN clock comments.
+	moveClocks []time.Duration
+	// deadline is when the side to move in a correspondence game runs out
+	// of time.
+	deadline time.Time
+
+	drawOfferFrom    string
+	drawOffers       map[string]int
+	takebackFrom     string
+	takebackRequests map[string]int
+
 	startTime time.Time
 	endTime   time.Time
+	// outcome and method are set when the game ends.
+	outcome string
+	method  string
 
+	// disconnected maps the players who lost their connection to when they
+	// did, until they come back.
 	disconnected map[string]time.Time
+	// leaver is the player whose disconnect ended the game.
+	leaver string
+
+	// premoves holds the move each player queued to play as soon as it is
+	// their turn. conditionals holds each correspondence player's lines of
+	// opponent moves and replies to play to them.
+	premoves     map[string]string
+	conditionals map[string][][]string
+
+	bot *botPlayer
+	// exclusive games are not started while a player is in another live
+	// game.
+	exclusive bool
+	// lease is the node's lease on the game in cluster mode.
+	lease gameLease
 
 	mu sync.RWMutex
 }
 
-func StartNewGame(whiteUserID, blackUserID string) *Game {
-	return &Game{
-		ID:           uuid.New().String(),
-		WhiteUserID:  whiteUserID,
-		BlackUserID:  blackUserID,
-		board:        chess.NewGame(),
-		status:       GameStatusInProgress,
-		moveNumber:   0,
-		startTime:    time.Now(),
-		disconnected: make(map[string]time.Time),
+// GameOptions configures a new game. Untimed games are never rated. FEN is
+// the starting position; when empty the variant's own is used. BlackTime,
+// when set, replaces Black's initial time, e.g. for an Armageddon game.
+// Exclusive games, like tournament pairings, only start for players who are
+// not in another live game.
+type GameOptions struct {
+	TimeControl TimeControl
+	Rated       bool
+	Variant     variant.Variant
+	FEN         string
+	BlackTime   time.Duration
+	Exclusive   bool
+}
+
+func StartNewGame(whiteUserID, blackUserID string, opts GameOptions) (*Game, error) {
+	return newGame(uuid.New().String(), whiteUserID, blackUserID, opts)
+}
+
+func newGame(id, whiteUserID, blackUserID string, opts GameOptions) (*Game, error) {
+	board, err := variant.NewBoard(opts.Variant, opts.FEN)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := opts.TimeControl
+	game := &Game{
+		ID:               id,
+		WhiteUserID:      whiteUserID,
+		BlackUserID:      blackUserID,
+		board:            board,
+		status:           GameStatusInProgress,
+		moveNumber:       0,
+		timeControl:      tc,
+		rated:            opts.Rated && tc.Category() != CategoryUnlimited,
+		drawOffers:       make(map[string]int),
+		takebackRequests: make(map[string]int),
+		startTime:        time.Now(),
+		disconnected:     make(map[string]time.Time),
+		premoves:         make(map[string]string),
+		conditionals:     make(map[string][][]string),
+		exclusive:        opts.Exclusive,
+	}
+	if !tc.IsUnlimited() {
+		game.clock = NewClock(tc)
+		if opts.BlackTime > 0 {
+			game.clock.Set(tc.Initial, opts.BlackTime)
+		}
 	}
+	return game, nil
+}
+
+// startClock starts the clock of the side to move and arms the flag timer.
+// A correspondence game gets the deadline for its next move instead, unless
+// it was restored with one. It is a no-op for untimed games.
+func (g *Game) startClock(gm *GameManager) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.status != GameStatusInProgress {
+		return
+	}
+	if g.timeControl.IsCorrespondence() {
+		if g.deadline.IsZero() {
+			g.setDeadline(gm, time.Now())
+		}
+		return
+	}
+	if g.clock == nil {
+		return
+	}
+	g.clock.Start(g.board.Turn(), time.Now())
+	g.armFlagTimer(gm)
 }
 
 func (g *Game) MakeMove(session *PlayerSession, move string, gm *GameManager) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	return g.makeMove(session.UserID, move, gm)
+}
+
+// makeMove validates and plays userID's move. It must be called with g.mu
+// held.
+func (g *Game) makeMove(userID string, move string, gm *GameManager) error {
 	if g.status != GameStatusInProgress {
 		return ErrGameEnded
 	}
@@ -74,133 +185,280 @@ func (g *Game) MakeMove(session *PlayerSession, move string, gm *GameManager) er
 		return ErrEmptyMove
 	}
 
-	if session.UserID != g.WhiteUserID && session.UserID != g.BlackUserID {
+	if userID != g.WhiteUserID && userID != g.BlackUserID {
 		return ErrNotInGame
 	}
 
-	turn := g.board.Position().Turn()
-	if (turn == chess.White && session.UserID != g.WhiteUserID) || (turn == chess.Black && session.UserID != g.BlackUserID) {
+	turn := g.board.Turn()
+	if (turn == chess.White && userID != g.WhiteUserID) || (turn == chess.Black && userID != g.BlackUserID) {
 		return ErrNotYourTurn
 	}
 
-	mv, err := chess.UCINotation{}.Decode(g.board.Position(), move)
+	now := time.Now()
+	// Another node may own the game by now.
+	if g.lease.lapsed(now) {
+		return ErrOwnerUnavailable
+	}
+	if (g.clock != nil && g.clock.Flagged(now)) || g.overdue(now) {
+		g.flag(gm, now)
+		return ErrTimeExpired
+	}
+
+	played, err := g.board.Move(move)
 	if err != nil {
 		return ErrInvalidMove
 	}
+	move = played.UCI
 
-	if err := g.board.Move(mv); err != nil {
-		return ErrInvalidMove
+	payload := queue.MovePayload{
+		GameID:     g.ID,
+		UserID:     userID,
+		MoveNumber: g.moveNumber + 1,
+		Move:       move,
+		CreatedAt:  float64(now.UnixMicro()) / 1e6,
+	}
+	if err := queue.EnqueueMove(gm.redisClient, payload, g.fence()); err != nil {
+		if errors.Is(err, queue.ErrFenced) {
+			g.board.Undo(1)
+			return ErrOwnerUnavailable
+		}
+		log.Printf("Failed to enqueue move: %v", err)
 	}
+	g.moveNumber++
+
+	if g.clock != nil {
+		g.clock.Press(now)
+		g.moveClocks = append(g.moveClocks, g.clock.Remaining(turn, now))
+	}
+	g.clearOffers(userID)
 
 	outcome := g.board.Outcome()
-	if outcome != chess.NoOutcome {
-		g.status = GameStatusCompleted
-		g.endTime = time.Now()
+	if outcome == chess.NoOutcome && g.timeControl.IsCorrespondence() {
+		g.setDeadline(gm, now)
+	}
 
-		err := gm.gameStore.UpdateGameStatus(context.Background(), g.ID, string(GameStatusCompleted), outcome.String(), g.board.Method().String(), g.endTime.Format(time.RFC3339))
-		if err != nil {
-			log.Printf("Failed to update game status in store: %v", err)
-		}
+	g.publish(gm, OutgoingMove{Type: MOVE, GameID: g.ID, Move: move, Ply: g.moveNumber, Clock: g.clockSnapshot(now), Deadline: g.deadlineSnapshot()})
 
-		gameOverMsg := OutgoingGameOver{
-			Type:    GAME_OVER,
-			Outcome: outcome.String(),
-			Method:  g.board.Method().String(),
-		}
+	if outcome != chess.NoOutcome {
+		g.endGame(gm, GameStatusCompleted, outcome.String(), g.board.Method())
+		return nil
+	}
 
-		g.safeSend(gm.sessions[g.WhiteUserID].Conn, gameOverMsg)
-		g.safeSend(gm.sessions[g.BlackUserID].Conn, gameOverMsg)
+	g.armFlagTimer(gm)
+	if g.answer(gm, move) {
 		return nil
 	}
+	if g.timeControl.IsCorrespondence() {
+		g.notifyTurn(gm, move)
+	}
+	g.maybeBotMove(gm)
+	return nil
+}
 
-	g.moveNumber++
-	payload := queue.MovePayload{
-		GameID:     g.ID,
-		UserID:     session.UserID,
-		MoveNumber: g.moveNumber,
-		Move:       move,
-		CreatedAt:  float64(time.Now().Unix()),
+// endGame finishes the game, persists the result and notifies players and
+// spectators. A node whose lease lapsed leaves the game alone: another node
+// may own it by now.
+// It must be called with g.mu held.
+func (g *Game) endGame(gm *GameManager, status GameStatus, outcome string, method string) {
+	if g.lease.lapsed(time.Now()) {
+		log.Printf("Not ending game %s: its lease lapsed", g.ID)
+		return
 	}
-	if err := queue.EnqueueMove(gm.redisClient, payload); err != nil {
-		log.Printf("Failed to enqueue move: %v", err)
+	g.status = status
+	g.endTime = time.Now()
+	g.outcome = outcome
+	g.method = method
+
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
+	}
+	if g.clock != nil {
+		g.clock.Stop(g.endTime)
+	}
+	gm.releaseGame(g.ID, g.lease)
+	gm.markGameOver(g)
+	if err := queue.EndMoves(context.Background(), gm.redisClient, g.ID); err != nil {
+		log.Printf("Failed to expire move numbering of game %s: %v", g.ID, err)
 	}
 
-	moveMsg := OutgoingMove{Type: MOVE, Move: move}
-	jsonData, _ := json.Marshal(moveMsg)
-	gm.redisClient.Publish(context.Background(), "game:"+g.ID, jsonData)
-	// g.safeSend(gm.sessions[g.WhiteUserID].Conn, moveMsg)
-	// g.safeSend(gm.sessions[g.BlackUserID].Conn, moveMsg)
+	err := gm.gameStore.UpdateGameStatus(context.Background(), g.ID, string(status), outcome, method, g.endTime.Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Failed to update game status in store: %v", err)
+	}
 
-	return nil
+	g.publish(gm, OutgoingGameOver{
+		Type:    GAME_OVER,
+		GameID:  g.ID,
+		Outcome: outcome,
+		Method:  method,
+		Clock:   g.clockSnapshot(g.endTime),
+	})
+	for _, userID := range []string{g.WhiteUserID, g.BlackUserID} {
+		gm.notifyListeners(userID, g.ID, OutgoingGameFinish{Type: GAME_FINISH, GameID: g.ID, Outcome: outcome, Method: method})
+	}
+
+	go gm.notifyGameEnd(GameResult{
+		GameID:       g.ID,
+		WhiteUserID:  g.WhiteUserID,
+		BlackUserID:  g.BlackUserID,
+		Status:       status,
+		Outcome:      outcome,
+		Method:       method,
+		TimeCategory: g.timeControl.Category(),
+		Variant:      g.board.Variant(),
+		InitialFEN:   g.board.InitialFEN(),
+		Rated:        g.rated,
+		Leaver:       g.leaver,
+		Plies:        g.board.Plies(),
+		EndedAt:      g.endTime,
+		PGN:          g.pgnRecord(status, outcome, method),
+		Moves:        g.board.UCIMoves(),
+	})
 }
 
-func (g *Game) HandleDisconnect(userID string, gm *GameManager) {
+// pgnRecord describes the game for its PGN. Player names are filled in by
+// the PGN service. It must be called with g.mu held.
+func (g *Game) pgnRecord(status GameStatus, outcome string, method string) pgn.Game {
+	moves := g.board.Moves()
+	withClocks := len(g.moveClocks) == len(moves)
+
+	records := make([]pgn.Move, 0, len(moves))
+	for i, mv := range moves {
+		record := pgn.Move{SAN: mv.SAN}
+		if withClocks {
+			record.Clock = g.moveClocks[i]
+			record.HasClock = true
+		}
+		records = append(records, record)
+	}
+
+	return pgn.Game{
+		ID:          g.ID,
+		WhiteUserID: g.WhiteUserID,
+		BlackUserID: g.BlackUserID,
+		Rated:       g.rated,
+		TimeControl: g.timeControl.String(),
+		Category:    string(g.timeControl.Category()),
+		Variant:     g.board.Variant(),
+		FEN:         g.board.InitialFEN(),
+		Result:      pgn.Result(outcome, g.leaver == g.WhiteUserID, g.leaver == g.BlackUserID),
+		Termination: pgn.Termination(string(status), method),
+		StartedAt:   g.startTime,
+		Moves:       records,
+	}
+}
+
+// armFlagTimer schedules a flag check for when the side to move runs out of
+// time. It must be called with g.mu held.
+func (g *Game) armFlagTimer(gm *GameManager) {
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
+	}
+	if g.clock == nil || g.status != GameStatusInProgress {
+		return
+	}
+
+	remaining := g.clock.Remaining(g.board.Turn(), time.Now())
+	g.flagTimer = time.AfterFunc(remaining, func() {
+		g.checkFlag(gm)
+	})
+}
+
+func (g *Game) checkFlag(gm *GameManager) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	if g.status != GameStatusInProgress {
+	if g.status != GameStatusInProgress || g.clock == nil {
 		return
 	}
-	g.disconnected[userID] = time.Now()
 
-	session, ok := gm.sessions[userID]
-	if ok {
-		session.DisconnectedAt = time.Now()
+	now := time.Now()
+	if !g.clock.Flagged(now) {
+		g.armFlagTimer(gm)
+		return
 	}
+	g.flag(gm, now)
+}
 
-	go func() {
-		time.Sleep(15 * time.Second)
-		g.mu.Lock()
-		defer g.mu.Unlock()
+// flag ends the game on time against the side to move, whether their clock
+// ran out or they missed a correspondence deadline. A flag is scored as a
+// draw when the opponent has no material left to ever deliver mate. It must
+// be called with g.mu held.
+func (g *Game) flag(gm *GameManager, now time.Time) {
+	loser := g.board.Turn()
+	if g.clock != nil {
+		g.clock.Stop(now)
+	}
 
-		session, ok := gm.sessions[userID]
-		if !ok || !session.Disconnected {
-			return
-		}
+	outcome := chess.WhiteWon
+	if loser == chess.White {
+		outcome = chess.BlackWon
+	}
+	if !g.board.HasMatingMaterial(loser.Other()) {
+		outcome = chess.Draw
+	}
+
+	g.endGame(gm, GameStatusCompleted, outcome.String(), MethodTimeout)
+}
 
-		if g.status == GameStatusInProgress {
-			g.status = GameStatusAbandoned
-			g.endTime = time.Now()
-
-			err := gm.gameStore.UpdateGameStatus(context.Background(), g.ID, string(g.status), string(GameStatusAbandoned), "disconnect", g.endTime.Format(time.RFC3339))
-			if err != nil {
-				log.Printf("Failed to update game status in store: %v", err)
-			}
-
-			abandonMsg := OutgoingGameOver{
-				Type:    GAME_OVER,
-				Outcome: "abandoned",
-				Method:  "disconnect",
-			}
-
-			g.safeSend(gm.sessions[g.WhiteUserID].Conn, abandonMsg)
-			g.safeSend(gm.sessions[g.BlackUserID].Conn, abandonMsg)
-
-			if whiteSess, exists := gm.sessions[g.WhiteUserID]; exists {
-				whiteSess.GameID = ""
-			}
-			if blackSess, exists := gm.sessions[g.BlackUserID]; exists {
-				blackSess.GameID = ""
-			}
+func (g *Game) startMessage(color string, now time.Time) OutgoingGameStart {
+	return OutgoingGameStart{
+		Type:        GAME_START,
+		Color:       color,
+		GameID:      g.ID,
+		TimeControl: g.timeControl.String(),
+		Category:    string(g.timeControl.Category()),
+		Variant:     g.board.Variant(),
+		InitialFEN:  g.board.InitialFEN(),
+		Clock:       g.clockSnapshot(now),
+		Deadline:    g.deadlineSnapshot(),
+	}
+}
+
+func (g *Game) clockSnapshot(now time.Time) *OutgoingClock {
+	if g.clock == nil {
+		return nil
+	}
+	return g.clock.Snapshot(now)
+}
+
+// sendToPlayers relays a game channel message to the players' connections.
+// Listeners follow the channel themselves.
+func (g *Game) sendToPlayers(gm *GameManager, msg interface{}) {
+	for _, userID := range []string{g.WhiteUserID, g.BlackUserID} {
+		if session, ok := gm.session(userID); ok {
+			session.send(msg)
 		}
-	}()
+	}
 }
 
-func (g *Game) IsActive() bool {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.status == GameStatusInProgress
+func (g *Game) sendToUser(gm *GameManager, userID string, msg interface{}) {
+	if session, ok := gm.session(userID); ok {
+		session.send(msg)
+	}
+	gm.notifyListeners(userID, g.ID, msg)
 }
 
-func (g *Game) safeSend(conn *websocket.Conn, msg interface{}) {
-	if conn == nil {
+// publish fans msg out to everyone listening on the game's Redis channel
+// (players and spectators on every replica), so it is delivered in order with
+// the moves.
+func (g *Game) publish(gm *GameManager, msg interface{}) {
+	publishGameEvent(gm.redisClient, g.ID, msg)
+}
+
+func publishGameEvent(redisClient *redis.Client, gameID string, msg interface{}) {
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal game event: %v", err)
 		return
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			// Connection was closed, ignore
-		}
-	}()
-	conn.WriteJSON(msg)
+	if err := redisClient.Publish(context.Background(), "game:"+gameID, jsonData).Err(); err != nil {
+		log.Printf("Failed to publish game event: %v", err)
+	}
 }
 
+func (g *Game) IsActive() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.status == GameStatusInProgress
+}
@@ -4,37 +4,107 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"log"
+	"maps"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/Adi-ty/chess/internal/rating"
 	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
 	"github.com/gorilla/websocket"
-	"github.com/notnil/chess"
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	ErrNoActiveGame   = errors.New("you are not in a game")
+	ErrGameIDRequired = errors.New("game_id is required while playing several games")
+)
+
+const (
+	// endedGameRetention is how long an ended game stays in memory, so
+	// late requests about it can still be answered.
+	endedGameRetention = 5 * time.Minute
+	// restoredClockFloor is the least time a restored game leaves the
+	// player to move, unless they had less at their opponent's last move.
+	restoredClockFloor = 10 * time.Second
+	cleanupInterval    = time.Minute
+)
+
 type GameManager struct {
-	games    map[string]*Game
-	sessions map[string]*PlayerSession
+	games map[string]*Game
+	// sessions is changed with both mu and sessionsMu held, so either is
+	// enough to read it. Games, which cannot take mu, look sessions up
+	// through session; sessionsMu is a leaf lock.
+	sessions   map[string]*PlayerSession
+	sessionsMu sync.RWMutex
+
+	matchmaker matchmaking.Matchmaker
+	ratings    *rating.Service
+
+	gameEndHooks []func(GameResult)
+
+	// disconnectGrace is how long a player may be gone before their
+	// opponent can claim the game, by time category.
+	disconnectGrace map[TimeCategory]time.Duration
+
+	bots  *Bots
+	users store.UserStore
+
+	// listeners receive the messages sent to a user outside a websocket
+	// connection. They have their own lock so they can be notified while
+	// a game is locked.
+	listeners   map[string]map[chan UserEvent]struct{}
+	listenersMu sync.Mutex
 
-	pendingUser string
+	chatStore  store.ChatStore
+	chatFilter ChatFilter
+	// mutes maps a user to the users whose chat they muted. It and
+	// apiChatLimits are guarded by chatMu, a leaf lock.
+	mutes         map[string]map[string]struct{}
+	apiChatLimits map[string]*chatLimiter
+	chatMu        sync.Mutex
+
+	// profiles caches the players' profiles shown in game_state messages,
+	// so they are not queried with gm.mu held. profilesMu is a leaf lock.
+	profiles   map[profileKey]cachedProfile
+	profilesMu sync.Mutex
 
 	gameStore   store.GameStore
 	redisClient *redis.Client
 
+	// nodeID identifies this replica in cluster mode; see EnableCluster.
+	nodeID string
+
 	pubsubs map[string]*redis.PubSub
+	// spectators maps a game ID to the connections watching it on this
+	// replica.
+	spectators map[string]map[*Conn]*Spectator
 
 	mu sync.RWMutex
 }
 
-func NewGameManager(gameStore store.GameStore, redisClient *redis.Client) *GameManager {
+func NewGameManager(gameStore store.GameStore, redisClient *redis.Client, matchmaker matchmaking.Matchmaker, ratings *rating.Service) *GameManager {
 	return &GameManager{
 		games:       make(map[string]*Game),
 		sessions:    make(map[string]*PlayerSession),
+		matchmaker:  matchmaker,
 		gameStore:   gameStore,
 		redisClient: redisClient,
 		pubsubs:     make(map[string]*redis.PubSub),
+		spectators:  make(map[string]map[*Conn]*Spectator),
+		listeners:   make(map[string]map[chan UserEvent]struct{}),
+
+		disconnectGrace: maps.Clone(defaultDisconnectGrace),
+
+		mutes:         make(map[string]map[string]struct{}),
+		apiChatLimits: make(map[string]*chatLimiter),
+		profiles:      make(map[profileKey]cachedProfile),
 	}
 }
 
@@ -49,105 +119,418 @@ func (gm *GameManager) CanUserConnect(userID string) error {
 	return nil
 }
 
-func (gm *GameManager) AddUser(conn *websocket.Conn, userID string) {
+func (gm *GameManager) AddUser(ws *websocket.Conn, userID string) {
+	conn := newConn(ws)
+	gm.markOnline(userID)
+
+	local, missing := gm.userGames(userID)
+	for _, game := range local {
+		gm.prefetchGame(game)
+	}
+	var restored *restoredGames
+	if len(missing) > 0 {
+		restored = gm.loadGames(userID, missing)
+	}
+
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
 
-	session, exists := gm.sessions[userID]
-	if !exists {
-		session = &PlayerSession{
-			UserID: userID,
+	session := gm.sessionFor(userID)
+	reconnected := !session.Connected()
+	session.addConn(conn)
+	session.LastSeen = time.Now()
+
+	gm.pruneGames(session)
+	if restored != nil {
+		gm.installGames(session, conn, restored)
+	}
+	for gameID := range session.Games {
+		game, exists := gm.games[gameID]
+		if !exists {
+			continue
 		}
-		gm.sessions[userID] = session
+		if reconnected {
+			game.HandleReconnect(userID, gm)
+		}
+		gm.resumeGame(session, conn, game)
+	}
+	if session.active != nil {
+		conn.Send(session.activeDevice(conn))
 	}
 
-	if session.Conn != nil && session.Conn != conn {
-		session.Conn.Close()
+	go gm.AddHandler(session, conn)
+}
+
+// sessionFor returns userID's session, creating it if they have none. It
+// must be called with gm.mu held.
+func (gm *GameManager) sessionFor(userID string) *PlayerSession {
+	if session, ok := gm.sessions[userID]; ok {
+		return session
 	}
+	session := newPlayerSession(userID)
+	gm.sessionsMu.Lock()
+	gm.sessions[userID] = session
+	gm.sessionsMu.Unlock()
+	return session
+}
 
-	session.Conn = conn
-	session.Disconnected = false
-	session.LastSeen = time.Now()
+// session returns userID's session on this replica, if any. Unlike
+// gm.sessions it may be used without gm.mu, so with only a game locked.
+func (gm *GameManager) session(userID string) (*PlayerSession, bool) {
+	gm.sessionsMu.RLock()
+	defer gm.sessionsMu.RUnlock()
+	session, ok := gm.sessions[userID]
+	return session, ok
+}
+
+// userGames splits the games of userID's session into those held in memory
+// and the IDs of those that are not.
+func (gm *GameManager) userGames(userID string) (local []*Game, missing []string) {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
 
-	if session.GameID != "" {
-		// if game, exists := gm.games[session.GameID]; exists && game.IsActive() {
-		//     // Game is in memory, no need to fetch/replay
-		// 	game.mu.RLock()
-		//     boardState := game.board.Position().Board().String()
-		//     game.mu.RUnlock()
-		//     session.Conn.WriteJSON(map[string]interface{}{
-		//         "type": "board_state",
-		//         "board": boardState,
-		//         "game_id": game.ID,
-		//     })
-		//     go gm.AddHandler(session)
-		//     return
-		// }
-
-		dbGame, err := gm.gameStore.GetGameByUserID(context.Background(), userID)
+	session, ok := gm.sessions[userID]
+	if !ok {
+		return nil, nil
+	}
+	for gameID := range session.Games {
+		if game, ok := gm.games[gameID]; ok {
+			local = append(local, game)
+		} else {
+			missing = append(missing, gameID)
+		}
+	}
+	return local, missing
+}
+
+// restoredGames are a player's games that were no longer in memory, as
+// loaded by loadGames.
+type restoredGames struct {
+	// games were rebuilt from the store and are leased to this node.
+	games []*Game
+	// relayed are hosted by another node.
+	relayed []string
+	// failed could not be rebuilt.
+	failed []string
+	// ended are no longer in progress.
+	ended []string
+}
+
+// loadGames rebuilds the games of gameIDs userID still plays, unless
+// another node of the cluster hosts them, from the store. It must be called
+// without gm.mu: installGames registers the result.
+func (gm *GameManager) loadGames(userID string, gameIDs []string) *restoredGames {
+	ctx := context.Background()
+	dbGames, err := gm.gameStore.ListActiveGamesByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to fetch games from store: %v", err)
+		return nil
+	}
+
+	wanted := make(map[string]bool, len(gameIDs))
+	for _, gameID := range gameIDs {
+		wanted[gameID] = true
+	}
+	restored := &restoredGames{}
+	for i := range dbGames {
+		dbGame := &dbGames[i]
+		if !wanted[dbGame.ID] {
+			continue
+		}
+		delete(wanted, dbGame.ID)
+		lease, claimed, err := gm.claimGame(ctx, dbGame.ID)
+		if err != nil || !claimed {
+			restored.relayed = append(restored.relayed, dbGame.ID)
+			continue
+		}
+		game, err := gm.rebuildGame(ctx, dbGame, lease)
 		if err != nil {
-			log.Printf("Failed to fetch game from store: %v", err)
-		} else if dbGame != nil {
-			game := &Game{
-				ID:           dbGame.ID,
-				WhiteUserID:  dbGame.WhiteUserID,
-				BlackUserID:  dbGame.BlackUserID,
-				board:        chess.NewGame(),
-				status:       GameStatusInProgress,
-				startTime:    time.Now(),
-				moveNumber:   0,
-				disconnected: make(map[string]time.Time),
-			}
-			gm.games[dbGame.ID] = game
-			gm.sessions[game.WhiteUserID].GameID = game.ID
-			gm.sessions[game.BlackUserID].GameID = game.ID
+			log.Printf("Failed to restore game %s: %v", dbGame.ID, err)
+			gm.releaseGame(dbGame.ID, lease)
+			restored.failed = append(restored.failed, dbGame.ID)
+			continue
+		}
+		gm.prefetchGame(game)
+		restored.games = append(restored.games, game)
+	}
+	for gameID := range wanted {
+		restored.ended = append(restored.ended, gameID)
+	}
+	return restored
+}
+
+// installGames registers the games loadGames rebuilt, relays those another
+// node hosts and forgets those that ended. A game another caller installed
+// meanwhile is kept. It must be called with gm.mu held.
+func (gm *GameManager) installGames(session *PlayerSession, conn *Conn, restored *restoredGames) {
+	for _, game := range restored.games {
+		if _, local := gm.games[game.ID]; !local {
+			gm.installGame(game)
+		}
+	}
+	for _, gameID := range restored.relayed {
+		gm.subscribe(gameID)
+	}
+	for _, gameID := range restored.failed {
+		conn.Send(OutgoingError{Type: ERROR, GameID: gameID, Message: "failed to restore game"})
+	}
+	for _, gameID := range restored.ended {
+		delete(session.Games, gameID)
+	}
+}
+
+// rebuildGame rebuilds an in-progress game the node holds lease on by
+// replaying its moves from its move log, or from the store for a game
+// without one. It queries the store, so it should be called without gm.mu
+// held; installGame then registers the game.
+func (gm *GameManager) rebuildGame(ctx context.Context, dbGame *store.Game, lease gameLease) (*Game, error) {
+	tc, err := ParseTimeControl(dbGame.TimeControl)
+	if err != nil {
+		log.Printf("Invalid time control %q for game %s: %v", dbGame.TimeControl, dbGame.ID, err)
+	}
+
+	game, err := newGame(dbGame.ID, dbGame.WhiteUserID, dbGame.BlackUserID, GameOptions{
+		TimeControl: tc,
+		Rated:       dbGame.Rated,
+		Variant:     variant.Variant(dbGame.Variant),
+		FEN:         dbGame.InitialFEN,
+	})
+	if err != nil {
+		return nil, err
+	}
+	game.lease = lease
+	if dbGame.MoveDeadline != nil {
+		game.deadline = *dbGame.MoveDeadline
+	}
+
+	// Replay moves
+	moves, err := gm.gameMoves(ctx, dbGame.ID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch moves: %w", err)
+	}
+	gm.mu.RLock()
+	gm.restoreBot(game)
+	gm.mu.RUnlock()
 
-			// Replay moves
-			moves, err := gm.gameStore.GetMovesByGameID(context.Background(), dbGame.ID)
+	// Rebuild the clocks from the time each move was made. Berserk and
+	// Armageddon times are not stored.
+	clockAt, err := time.Parse(time.RFC3339, dbGame.StartedAt)
+	timed := game.clock != nil && err == nil
+	if timed {
+		game.clock.Start(game.board.Turn(), clockAt)
+	}
+	for _, move := range moves {
+		mover := game.board.Turn()
+		if _, err := game.board.Move(move.Move); err != nil {
+			return nil, fmt.Errorf("replay move %s: %w", move.Move, err)
+		}
+		game.moveNumber = move.MoveNumber
+		if timed {
+			sec, frac := math.Modf(move.CreatedAt)
+			clockAt = time.Unix(int64(sec), int64(frac*1e9))
+			game.clock.Press(clockAt)
+			game.moveClocks = append(game.moveClocks, game.clock.Remaining(mover, clockAt))
+		}
+	}
+	if timed {
+		// The player to move is charged for all the time since the last
+		// move, including any the game spent without a server, as a
+		// correspondence deadline runs on through it. They keep
+		// restoredClockFloor though, so a restart cannot flag them before
+		// they had a chance to move.
+		game.clock.Stop(clockAt)
+		game.clock.charge(game.board.Turn(), time.Since(clockAt), restoredClockFloor)
+	}
+	if tc.IsCorrespondence() {
+		lines, err := gm.gameStore.GetConditionalMoves(ctx, dbGame.ID)
+		if err != nil {
+			log.Printf("Failed to load conditional moves of game %s: %v", dbGame.ID, err)
+		} else {
+			game.conditionals = lines
+		}
+	}
+	return game, nil
+}
+
+// gameMoves returns the moves of a game in progress from its move log,
+// which holds those the worker has not written yet. A game without a log
+// gets one started from the store.
+func (gm *GameManager) gameMoves(ctx context.Context, gameID string) ([]queue.MovePayload, error) {
+	moves, logged, err := queue.GameMoves(ctx, gm.redisClient, gameID)
+	if err != nil || logged {
+		return moves, err
+	}
+
+	moves, err = gm.gameStore.GetMovesByGameID(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := gm.gameStore.GetMoveSeq(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if err := queue.SeedMoves(ctx, gm.redisClient, gameID, moves, seq); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// loggedMoves returns the moves of a game hosted anywhere from its move
+// log, or from the store for a game without one.
+func (gm *GameManager) loggedMoves(ctx context.Context, gameID string) ([]queue.MovePayload, error) {
+	moves, logged, err := queue.GameMoves(ctx, gm.redisClient, gameID)
+	if err != nil || logged {
+		return moves, err
+	}
+	return gm.gameStore.GetMovesByGameID(ctx, gameID)
+}
+
+// installGame registers a rebuilt game with its players and restarts its
+// clock. It must be called with gm.mu held.
+func (gm *GameManager) installGame(game *Game) {
+	gm.games[game.ID] = game
+	for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+		if game.isBot(userID) {
+			continue
+		}
+		// Keep the game attached to players who are not connected so
+		// AddUser resumes it.
+		gm.sessionFor(userID).addGame(game.ID)
+	}
+	gm.subscribe(game.ID)
+
+	game.startClock(gm)
+
+	game.mu.Lock()
+	game.maybeBotMove(gm)
+	game.mu.Unlock()
+}
+
+// RecoverGames rebuilds every in-progress game from the store when the
+// server starts, so games survive deploys. Their players all lost their
+// connection: those connected to no node get the disconnection grace period
+// to come back. In cluster mode, games another node holds are left to it.
+// It must be called after SetBots and before connections are accepted.
+func (gm *GameManager) RecoverGames(ctx context.Context) error {
+	dbGames, err := gm.gameStore.ListActiveGames(ctx)
+	if err != nil {
+		return err
+	}
+
+	var games []*Game
+	for i := range dbGames {
+		dbGame := &dbGames[i]
+		gm.mu.RLock()
+		_, local := gm.games[dbGame.ID]
+		gm.mu.RUnlock()
+		if local {
+			continue
+		}
+		lease, claimed, err := gm.claimGame(ctx, dbGame.ID)
+		if err != nil || !claimed {
 			if err != nil {
-				log.Printf("Error fetching moves for game %s: %v", dbGame.ID, err)
-			} else if len(moves) > 0 {
-				if whiteSess, exists := gm.sessions[game.WhiteUserID]; exists && whiteSess.Conn != nil {
-					whiteSess.Conn.WriteJSON(map[string]interface{}{"type": "board_replay", "moves": moves})
-				}
-				if blackSess, exists := gm.sessions[game.BlackUserID]; exists && blackSess.Conn != nil {
-					blackSess.Conn.WriteJSON(map[string]interface{}{"type": "board_replay", "moves": moves})
-				}
+				log.Printf("Failed to claim game %s: %v", dbGame.ID, err)
+			}
+			continue
+		}
+		gm.prefetchStoredGame(dbGame)
+		game, err := gm.rebuildGame(ctx, dbGame, lease)
+		if err != nil {
+			log.Printf("Failed to recover game %s: %v", dbGame.ID, err)
+			gm.releaseGame(dbGame.ID, lease)
+			continue
+		}
+		games = append(games, game)
+	}
 
-				if _, exists := gm.pubsubs[dbGame.ID]; !exists {
-					pubsub := gm.redisClient.Subscribe(context.Background(), "game:"+dbGame.ID)
-					gm.pubsubs[dbGame.ID] = pubsub
-					go gm.listenForMoves(dbGame.ID)
-					log.Printf("Subscribed to game channel: %s", dbGame.ID)
-				}
+	gm.mu.Lock()
+	var recovered []*Game
+	for _, game := range games {
+		if _, local := gm.games[game.ID]; !local {
+			gm.installGame(game)
+			recovered = append(recovered, game)
+		}
+	}
+	gm.mu.Unlock()
+	gm.trackPresence(recovered)
 
-				for _, move := range moves {
-					mv, err := chess.UCINotation{}.Decode(game.board.Position(), move.Move)
-					if err != nil {
-						session.Conn.WriteJSON(OutgoingError{Type: ERROR, Message: "failed to restore game"})
-						log.Printf("Error decoding move %s: %v", move.Move, err)
-						return
-					}
-
-					if err := game.board.Move(mv); err != nil {
-						log.Printf("Error replaying move %s: %v", move.Move, err)
-						session.Conn.WriteJSON(OutgoingError{Type: ERROR, Message: "failed to restore game"})
-						return
-					}
-					game.moveNumber = move.MoveNumber
-				}
+	log.Printf("Recovered %d of %d games in progress", len(recovered), len(dbGames))
+	return nil
+}
+
+// RunCleanup periodically forgets the games that ended a while ago, the
+// sessions of players who left with no game in progress and idle chat
+// state, until ctx is done.
+func (gm *GameManager) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			gm.cleanUp(now)
+		}
+	}
+}
+
+func (gm *GameManager) cleanUp(now time.Time) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	for gameID, game := range gm.games {
+		game.mu.RLock()
+		expired := game.status != GameStatusInProgress && now.Sub(game.endTime) > endedGameRetention
+		game.mu.RUnlock()
+		if !expired {
+			continue
+		}
+		delete(gm.games, gameID)
+		for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+			if session, ok := gm.sessions[userID]; ok {
+				delete(session.Games, gameID)
 			}
 		}
+	}
 
-		if game, exists := gm.games[session.GameID]; !exists || !game.IsActive() {
-			session.GameID = ""
+	gm.sessionsMu.Lock()
+	for userID, session := range gm.sessions {
+		if !session.Connected() && len(session.Games) == 0 {
+			delete(gm.sessions, userID)
 		}
 	}
+	gm.sessionsMu.Unlock()
+	gm.evictChat(now)
+	gm.evictProfiles(now)
+}
 
-	go gm.AddHandler(session)
+// pruneGames forgets the session's games that have ended. It must be called
+// with gm.mu held.
+func (gm *GameManager) pruneGames(session *PlayerSession) {
+	for gameID := range session.Games {
+		if game, exists := gm.games[gameID]; exists && !game.IsActive() {
+			delete(gm.games, gameID)
+			delete(session.Games, gameID)
+		}
+	}
+}
+
+// resumeGame sends a game the player is still playing to one of their
+// connections. It must be called with gm.mu held.
+func (gm *GameManager) resumeGame(session *PlayerSession, conn *Conn, game *Game) {
+	state := gm.localGameState(game, session.UserID)
+
+	game.mu.RLock()
+	defer game.mu.RUnlock()
+
+	conn.Send(game.startMessage(game.colorName(session.UserID), time.Now()))
+	conn.Send(state)
 }
 
-func (gm *GameManager) RemoveUser(userID string) {
+// RemoveConn drops one of a user's connections. The user only counts as
+// disconnected once their last connection is gone.
+func (gm *GameManager) RemoveConn(userID string, conn *Conn) {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
 
@@ -155,43 +538,43 @@ func (gm *GameManager) RemoveUser(userID string) {
 	if !ok {
 		return
 	}
-	session.Conn = nil
-	session.Disconnected = true
+	gm.removeSpectatorConn(conn)
+	session.removeConn(conn)
 	session.LastSeen = time.Now()
+	if session.active == conn {
+		session.active = nil
+		gm.announceActiveDevice(session)
+	}
+	if session.Connected() {
+		return
+	}
 
-	if session.GameID != "" {
-		game := gm.games[session.GameID]
-		if game != nil {
-			game.HandleDisconnect(session.UserID, gm)
+	if err := gm.matchmaker.Cancel(context.Background(), userID); err != nil {
+		log.Printf("Failed to remove %s from matchmaking: %v", userID, err)
+	}
+	gm.markOffline(userID)
 
-			game.mu.RLock()
-			if game.status == GameStatusAbandoned {
-				if pubsub, exists := gm.pubsubs[session.GameID]; exists {
-					pubsub.Close()
-					delete(gm.pubsubs, session.GameID)
-				}
-			}
-			game.mu.RUnlock()
+	for gameID := range session.Games {
+		if game := gm.games[gameID]; game != nil {
+			game.HandleDisconnect(session.UserID, gm)
 		}
 	}
 
 	log.Printf("User %s disconnected", userID)
 }
 
-func (gm *GameManager) AddHandler(session *PlayerSession) {
+// AddHandler reads the messages of one of the session's connections until
+// it closes.
+func (gm *GameManager) AddHandler(session *PlayerSession, conn *Conn) {
 	defer func() {
-		if session.Conn != nil {
-			session.Conn.Close()
-		}
-		gm.RemoveUser(session.UserID)
+		conn.Close()
+		gm.RemoveConn(session.UserID, conn)
 	}()
 
-	for {
-		if session.Conn == nil {
-			return
-		}
+	gm.loadMutes(session.UserID)
 
-		_, rawMsg, err := session.Conn.ReadMessage()
+	for {
+		_, rawMsg, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Read error: %v", err)
 			break
@@ -199,133 +582,405 @@ func (gm *GameManager) AddHandler(session *PlayerSession) {
 
 		var message IncomingMessage
 		if err := json.Unmarshal(rawMsg, &message); err != nil {
-			session.Conn.WriteJSON(OutgoingError{Type: ERROR, Message: "invalid message format"})
+			conn.Send(OutgoingError{Type: ERROR, Message: "invalid message format"})
 			continue
 		}
 
-		gm.handleMessage(session, message)
+		gm.handleMessage(session, conn, message)
 	}
 }
 
-func (gm *GameManager) handleMessage(session *PlayerSession, message IncomingMessage) {
+func (gm *GameManager) handleMessage(session *PlayerSession, conn *Conn, message IncomingMessage) {
+	switch message.Type {
+	case MOVE, PREMOVE, RESIGN, OFFER_DRAW, ACCEPT_DRAW, DECLINE_DRAW, REQUEST_TAKEBACK, ACCEPT_TAKEBACK, DECLINE_TAKEBACK, CLAIM_VICTORY, CLAIM_DRAW, CANCEL_PREMOVE:
+		if !gm.canAct(session, conn) {
+			conn.Send(OutgoingError{Type: ERROR, GameID: message.GameID, Message: ErrInactiveDevice.Error()})
+			return
+		}
+	}
+
 	switch message.Type {
 	case INIT_GAME:
-		gm.handleInitGame(session)
-	case MOVE:
-		gm.handleMove(session, message.Move)
+		gm.handleInitGame(session, conn, message)
+	case CANCEL_SEARCH:
+		gm.handleCancelSearch(session, conn)
+	case SPECTATE:
+		gm.handleSpectate(session, conn, message.GameID)
+	case UNSPECTATE:
+		gm.handleUnspectate(session, conn, message.GameID)
+	case MOVE, PREMOVE, RESIGN, OFFER_DRAW, ACCEPT_DRAW, DECLINE_DRAW, REQUEST_TAKEBACK, ACCEPT_TAKEBACK, DECLINE_TAKEBACK, CLAIM_VICTORY, CLAIM_DRAW, CANCEL_PREMOVE:
+		gm.handleAction(session, conn, message)
+	case CHAT:
+		gm.handleChat(session, conn, message)
+	case MUTE, UNMUTE:
+		gm.handleMute(session, conn, message, message.Type == MUTE)
+	case SET_ACTIVE_DEVICE, CLEAR_ACTIVE_DEVICE:
+		gm.setActiveDevice(session, conn, message.Type == SET_ACTIVE_DEVICE)
 	default:
-		session.Conn.WriteJSON(OutgoingError{Type: ERROR, Message: "unknown message type"})
+		conn.Send(OutgoingError{Type: ERROR, Message: "unknown message type"})
 	}
 }
 
-func (gm *GameManager) handleInitGame(session *PlayerSession) {
+func (gm *GameManager) handleInitGame(session *PlayerSession, conn *Conn, message IncomingMessage) {
+	tc, err := message.TimeControl.ToTimeControl()
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		return
+	}
+
+	color, err := matchmaking.ParseColorPreference(message.Color)
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		return
+	}
+
+	v, err := variant.Parse(message.Variant)
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		return
+	}
+
 	gm.mu.Lock()
-	defer gm.mu.Unlock()
+	gm.pruneGames(session)
+	gm.mu.Unlock()
 
-	if existingGame, exists := gm.games[session.GameID]; exists {
-		if existingGame.IsActive() {
-			session.Conn.WriteJSON(OutgoingError{
-				Type:    ERROR,
-				Message: "you are already in an active game",
-			})
+	if message.Opponent == OpponentBot {
+		if v != variant.Standard {
+			conn.Send(OutgoingError{Type: ERROR, Message: ErrBotVariant.Error()})
 			return
-		} else {
-			delete(gm.games, session.GameID)
-			session.GameID = ""
 		}
+		gm.startBotGame(session, conn, tc, color, message.Level, message.FEN)
+		return
 	}
+	if message.FEN != "" {
+		conn.Send(OutgoingError{Type: ERROR, Message: ErrCustomPositionSeek.Error()})
+		return
+	}
+
+	conn.Send(OutgoingWaiting{
+		Type:    WAITING,
+		Message: "waiting for opponent",
+	})
 
-	if gm.pendingUser == session.UserID {
-		session.Conn.WriteJSON(OutgoingError{
-			Type:    ERROR,
-			Message: "already waiting for opponent",
-		})
+	err = gm.matchmaker.Join(context.Background(), matchmaking.Ticket{
+		UserID:      session.UserID,
+		Pool:        matchPool(v, tc),
+		TimeControl: tc.String(),
+		Variant:     string(v),
+		Rating:      gm.ratingFor(session.UserID, RatingCategory(v, tc.Category())),
+		Color:       color,
+		JoinedAt:    time.Now(),
+	})
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
 		return
 	}
 
-	if gm.pendingUser != "" {
-		if _, exists := gm.sessions[gm.pendingUser]; !exists {
-			gm.pendingUser = ""
-		}
+	log.Printf("Player %s waiting for opponent (time control: %s, variant: %s)", session.UserID, tc, v)
+}
+
+// matchPool keeps each variant's seekers apart. Standard pools are named by
+// time control alone so tickets queued before variants existed still match.
+func matchPool(v variant.Variant, tc TimeControl) string {
+	if v == variant.Standard {
+		return tc.String()
 	}
+	return string(v) + "|" + tc.String()
+}
 
-	currentUserID := session.UserID
+func (gm *GameManager) handleCancelSearch(session *PlayerSession, conn *Conn) {
+	if err := gm.matchmaker.Cancel(context.Background(), session.UserID); err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: "failed to cancel search"})
+		return
+	}
+	conn.Send(OutgoingWaiting{Type: SEARCH_CANCELLED, Message: "search cancelled"})
+}
 
-	if gm.pendingUser != "" {
-		pendingUserID := gm.pendingUser
+// ConsumeMatches starts a game for every pairing the matchmaker produces.
+func (gm *GameManager) ConsumeMatches() {
+	for match := range gm.matchmaker.Matches() {
+		gm.startMatchedGame(match)
+	}
+}
 
-		// Prevent same user from playing against themselves
-		if currentUserID != "" && pendingUserID != "" && currentUserID == pendingUserID {
-			session.Conn.WriteJSON(OutgoingError{
-				Type:    ERROR,
-				Message: "you cannot play against yourself",
-			})
-			return
-		}
+// startMatchedGame starts the game for a pairing involving at least one
+// locally connected player. The game is owned by the replica holding the
+// white player; a replica holding only black relays the game's events to
+// its player over the game channel and forwards their actions to the owner,
+// which is why the shared matchmaker requires cluster mode.
+func (gm *GameManager) startMatchedGame(match matchmaking.Match) {
+	tc, err := ParseTimeControl(match.TimeControl)
+	if err != nil {
+		log.Printf("Invalid time control %q in match %s: %v", match.TimeControl, match.GameID, err)
+		return
+	}
 
-		gm.pendingUser = ""
+	v, err := variant.Parse(match.Variant)
+	if err != nil {
+		log.Printf("Invalid variant %q in match %s: %v", match.Variant, match.GameID, err)
+		return
+	}
+	opts := GameOptions{TimeControl: tc, Rated: true, Variant: v}
+	if v == variant.Chess960 {
+		// Both replicas of a match must start from the same position.
+		opts.FEN = variant.Chess960FEN(int(crc32.ChecksumIEEE([]byte(match.GameID)) % 960))
+	}
 
-		whiteUserID := pendingUserID
-		blackUserID := currentUserID
+	if match.WhiteUserID == match.BlackUserID {
+		return
+	}
 
-		game := StartNewGame(whiteUserID, blackUserID)
-		gm.games[game.ID] = game
-		gm.sessions[whiteUserID].GameID = game.ID
-		gm.sessions[blackUserID].GameID = game.ID
+	game, err := newGame(match.GameID, match.WhiteUserID, match.BlackUserID, opts)
+	if err != nil {
+		log.Printf("Failed to create game for match %s: %v", match.GameID, err)
+		return
+	}
+	gm.prefetchGame(game)
 
-		pubsub := gm.redisClient.Subscribe(context.Background(), "game:"+game.ID)
-		gm.pubsubs[game.ID] = pubsub
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
 
-		go gm.listenForMoves(game.ID)
+	// A session may only be holding on to the player's games while they
+	// are connected elsewhere, so it does not make the player local.
+	if session, ok := gm.sessions[match.WhiteUserID]; ok && session.Connected() {
+		if err := gm.launchGame(game); err != nil {
+			log.Printf("Failed to start game for match %s: %v", match.GameID, err)
+		}
+		return
+	}
+	if session, ok := gm.sessions[match.BlackUserID]; ok && session.Connected() {
+		gm.relayGame(game)
+	}
+}
 
-		_, err := gm.gameStore.CreateGame(context.Background(), &store.Game{
-			ID:          game.ID,
-			WhiteUserID: whiteUserID,
-			BlackUserID: blackUserID,
-			Status:      string(GameStatusInProgress),
-			StartedAt:   game.startTime.Format(time.RFC3339),
-		})
-		if err != nil {
-			log.Printf("Failed to create game in store: %v", err)
+// StartGame starts a game created outside matchmaking, e.g. from an accepted
+// challenge. Players who are not connected pick the game up when they
+// connect. An exclusive game is refused while a player is in a live game.
+func (gm *GameManager) StartGame(game *Game) error {
+	gm.prefetchGame(game)
+
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	if game.exclusive {
+		for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+			if gm.inLiveGame(userID) {
+				return ErrAlreadyInGame
+			}
 		}
+	}
 
-		gm.sessions[whiteUserID].Conn.WriteJSON(map[string]string{"type": "game_start", "color": "white", "game_id": game.ID})
-		gm.sessions[blackUserID].Conn.WriteJSON(map[string]string{"type": "game_start", "color": "black", "game_id": game.ID})
+	return gm.launchGame(game)
+}
 
-		log.Printf("Game started: %s (white: %s, black: %s)", game.ID, whiteUserID, blackUserID)
-	} else {
-		gm.pendingUser = session.UserID
-		session.Conn.WriteJSON(map[string]string{
-			"type":    "waiting",
-			"message": "waiting for opponent",
-		})
-		log.Printf("Player %s waiting for opponent", currentUserID)
+// SendToUser delivers msg to userID if they are connected to this replica or
+// listening for events.
+func (gm *GameManager) SendToUser(userID string, msg interface{}) bool {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	delivered := gm.notifyListeners(userID, "", msg)
+	session, ok := gm.sessions[userID]
+	if !ok || !session.Connected() {
+		return delivered
+	}
+	session.send(msg)
+	return true
+}
+
+// IsConnected reports whether userID has a websocket connection to this
+// replica or, in cluster mode, to any node.
+func (gm *GameManager) IsConnected(userID string) bool {
+	gm.mu.RLock()
+	session, ok := gm.sessions[userID]
+	connected := ok && session.Connected()
+	gm.mu.RUnlock()
+
+	if connected || !gm.clustered() {
+		return connected
 	}
+	return gm.present(onlineKeyPrefix + userID)
 }
 
-func (gm *GameManager) handleMove(session *PlayerSession, move string) {
+// IsPlaying reports whether userID is in an active live game on this
+// replica or, in cluster mode, on any node. Correspondence games leave a
+// player free to start others.
+func (gm *GameManager) IsPlaying(userID string) bool {
 	gm.mu.RLock()
-	game, exists := gm.games[session.GameID]
+	playing := gm.inLiveGame(userID)
 	gm.mu.RUnlock()
 
-	if !exists || game == nil {
-		session.Conn.WriteJSON(OutgoingError{
-			Type:    ERROR,
-			Message: "you are not in a game",
-		})
+	if playing || !gm.clustered() {
+		return playing
+	}
+	return gm.present(playingKeyPrefix + userID)
+}
+
+// inLiveGame must be called with gm.mu held.
+func (gm *GameManager) inLiveGame(userID string) bool {
+	session, ok := gm.sessions[userID]
+	if !ok {
+		return false
+	}
+	for gameID := range session.Games {
+		game, exists := gm.games[gameID]
+		if exists && game.IsActive() && !game.timeControl.IsCorrespondence() {
+			return true
+		}
+	}
+	return false
+}
+
+// launchGame registers a new game on this replica, persists it, starts the
+// clock and sends game_start to both players. A game another replica holds
+// the lease of is relayed from it instead. It must be called with gm.mu held.
+func (gm *GameManager) launchGame(game *Game) error {
+	lease, claimed, err := gm.claimGame(context.Background(), game.ID)
+	if err != nil {
+		return fmt.Errorf("claim game %s: %w", game.ID, err)
+	}
+	if !claimed {
+		gm.relayGame(game)
+		return nil
+	}
+	game.lease = lease
+	gm.games[game.ID] = game
+	for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+		if game.isBot(userID) {
+			continue
+		}
+		// Keep the game attached to players who are not connected yet
+		// so AddUser resumes it.
+		gm.sessionFor(userID).addGame(game.ID)
+	}
+
+	gm.subscribe(game.ID)
+
+	_, err = gm.gameStore.CreateGame(context.Background(), &store.Game{
+		ID:           game.ID,
+		WhiteUserID:  game.WhiteUserID,
+		BlackUserID:  game.BlackUserID,
+		Status:       string(GameStatusInProgress),
+		Rated:        game.rated,
+		TimeControl:  game.timeControl.String(),
+		TimeCategory: string(game.timeControl.Category()),
+		Variant:      string(game.board.Variant()),
+		InitialFEN:   game.board.InitialFEN(),
+		StartedAt:    game.startTime.Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("Failed to create game in store: %v", err)
+	}
+
+	game.startClock(gm)
+
+	now := time.Now()
+	game.sendToUser(gm, game.WhiteUserID, game.startMessage("white", now))
+	game.sendToUser(gm, game.BlackUserID, game.startMessage("black", now))
+	for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+		if !game.isBot(userID) {
+			game.sendToUser(gm, userID, gm.localGameState(game, userID))
+		}
+	}
+
+	game.mu.Lock()
+	game.maybeBotMove(gm)
+	game.mu.Unlock()
+
+	log.Printf("Game started: %s (white: %s, black: %s, time control: %s, variant: %s)", game.ID, game.WhiteUserID, game.BlackUserID, game.timeControl, game.board.Variant())
+	return nil
+}
+
+// relayGame follows a game hosted by another replica for its players
+// connected here: their sessions join it and its events reach them over the
+// game channel, while their actions are forwarded to the host. It must be
+// called with gm.mu held.
+func (gm *GameManager) relayGame(game *Game) {
+	gm.subscribe(game.ID)
+	now := time.Now()
+	for _, userID := range game.humanPlayers() {
+		session, ok := gm.sessions[userID]
+		if !ok || !session.Connected() {
+			continue
+		}
+		session.addGame(game.ID)
+		session.send(game.startMessage(game.colorName(userID), now))
+		session.send(gm.localGameState(game, userID))
+	}
+}
+
+// subscribe starts relaying the game's Redis channel to local sessions. It
+// must be called with gm.mu held.
+func (gm *GameManager) subscribe(gameID string) {
+	if _, exists := gm.pubsubs[gameID]; exists {
 		return
 	}
+	pubsub := gm.redisClient.Subscribe(context.Background(), "game:"+gameID)
+	gm.pubsubs[gameID] = pubsub
+	go gm.listenForMoves(gameID)
+}
+
+// ratingFor returns the rating used to pair userID in a rating category.
+func (gm *GameManager) ratingFor(userID string, category string) int {
+	r, err := gm.ratings.Current(context.Background(), userID, category)
+	if err != nil {
+		log.Printf("Failed to load rating of %s: %v", userID, err)
+	}
+	return int(r.Rating)
+}
+
+// OnGameEnd registers a hook run after every game that ends on this replica.
+// Hooks must be registered before games start.
+func (gm *GameManager) OnGameEnd(hook func(GameResult)) {
+	gm.gameEndHooks = append(gm.gameEndHooks, hook)
+}
+
+func (gm *GameManager) notifyGameEnd(result GameResult) {
+	for _, hook := range gm.gameEndHooks {
+		hook(result)
+	}
+}
+
+// sessionGameID resolves the game a player's message is for: gameID if they
+// play in it, or their only ongoing game when the message names none.
+func (gm *GameManager) sessionGameID(session *PlayerSession, gameID string) (string, error) {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
 
-	if session.GameID == "" {
-		session.Conn.WriteJSON(OutgoingError{Type: ERROR, Message: "no active game"})
+	if gameID != "" {
+		if !session.InGame(gameID) {
+			return "", ErrNotInGame
+		}
+		return gameID, nil
+	}
+
+	var ongoing []string
+	for id := range session.Games {
+		// Games hosted by another replica are relayed until they end.
+		if game, local := gm.games[id]; !local || game.IsActive() {
+			ongoing = append(ongoing, id)
+		}
+	}
+	switch len(ongoing) {
+	case 0:
+		return "", ErrNoActiveGame
+	case 1:
+		return ongoing[0], nil
+	}
+	return "", ErrGameIDRequired
+}
+
+// handleAction performs a player's move or other action in one of their
+// games, wherever it is hosted.
+func (gm *GameManager) handleAction(session *PlayerSession, conn *Conn, message IncomingMessage) {
+	gameID, err := gm.sessionGameID(session, message.GameID)
+	if err != nil {
+		conn.Send(OutgoingError{Type: ERROR, GameID: message.GameID, Message: err.Error()})
 		return
 	}
 
-	if err := game.MakeMove(session, move, gm); err != nil {
-		session.Conn.WriteJSON(OutgoingError{
-			Type:    ERROR,
-			Message: err.Error(),
-		})
+	if err := gm.Play(session.UserID, gameID, message.Type, message.Move); err != nil {
+		conn.Send(OutgoingError{Type: ERROR, GameID: gameID, Message: err.Error()})
 	}
 }
 
@@ -349,24 +1004,41 @@ func (gm *GameManager) GetConnectedUsersCount() int {
 }
 
 func (gm *GameManager) listenForMoves(gameID string) {
+	gm.mu.RLock()
 	pubsub := gm.pubsubs[gameID]
+	gm.mu.RUnlock()
 	defer pubsub.Close()
 
 	ch := pubsub.Channel()
 	for msg := range ch {
-		var moveMsg OutgoingMove
+		var moveMsg json.RawMessage
 		if err := json.Unmarshal([]byte(msg.Payload), &moveMsg); err != nil {
 			log.Printf("Error unmarshaling pubsub message: %v", err)
 			continue
 		}
 
+		gm.mu.RLock()
+		if chat, ok := parseChat(moveMsg); ok {
+			gm.relayChat(gameID, chat, moveMsg)
+			gm.mu.RUnlock()
+			continue
+		}
 		game := gm.games[gameID]
 		if game != nil {
 			game.mu.RLock()
-			game.safeSend(gm.sessions[game.WhiteUserID].Conn, moveMsg)
-			game.safeSend(gm.sessions[game.BlackUserID].Conn, moveMsg)
+			game.sendToPlayers(gm, moveMsg)
 			game.mu.RUnlock()
+		} else {
+			// The game is owned by another replica; relay to local players.
+			for _, session := range gm.sessions {
+				if session.InGame(gameID) {
+					session.send(moveMsg)
+				}
+			}
 		}
+		for conn := range gm.spectators[gameID] {
+			conn.Send(moveMsg)
+		}
+		gm.mu.RUnlock()
 	}
 }
-
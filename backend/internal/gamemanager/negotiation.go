@@ -0,0 +1,278 @@
+package gamemanager
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/notnil/chess"
+)
+
+var (
+	ErrNoDrawOffer          = errors.New("there is no draw offer to answer")
+	ErrDrawAlreadyOffered   = errors.New("a draw offer is already pending")
+	ErrNoTakebackRequest    = errors.New("there is no takeback request to answer")
+	ErrTakebackAlreadyAsked = errors.New("a takeback request is already pending")
+	ErrNothingToTakeBack    = errors.New("you have no move to take back")
+	ErrCannotAnswerOwnOffer = errors.New("you cannot answer your own offer")
+	ErrTooManyDrawOffers    = errors.New("you have already offered a draw too many times")
+	ErrTooManyTakebackAsks  = errors.New("you have already asked for a takeback too many times")
+)
+
+const (
+	MethodResignation = "resignation"
+	MethodAgreement   = "agreement"
+
+	// maxOffersPerPlayer caps draw offers and takeback requests per side so
+	// neither can be used to spam the opponent.
+	maxOffersPerPlayer = 3
+)
+
+// Resign ends the game as a loss for the resigning player.
+func (g *Game) Resign(session *PlayerSession, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	color, err := g.playerColor(session.UserID)
+	if err != nil {
+		return err
+	}
+
+	g.board.Resign(color)
+	g.endGame(gm, GameStatusCompleted, g.board.Outcome().String(), MethodResignation)
+	return nil
+}
+
+// OfferDraw records a draw offer and forwards it to the opponent. Offering a
+// draw while the opponent's offer is pending accepts it.
+func (g *Game) OfferDraw(session *PlayerSession, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.playerColor(session.UserID); err != nil {
+		return err
+	}
+
+	switch g.drawOfferFrom {
+	case session.UserID:
+		return ErrDrawAlreadyOffered
+	case "":
+	default:
+		g.acceptDraw(gm)
+		return nil
+	}
+
+	if g.drawOffers[session.UserID] >= maxOffersPerPlayer {
+		return ErrTooManyDrawOffers
+	}
+	g.drawOffers[session.UserID]++
+
+	// The engine plays on.
+	if g.isBot(g.opponentOf(session.UserID)) {
+		g.sendToUser(gm, session.UserID, OutgoingOffer{Type: DRAW_DECLINED, GameID: g.ID, From: g.colorName(g.opponentOf(session.UserID))})
+		return nil
+	}
+	g.drawOfferFrom = session.UserID
+
+	g.sendToUser(gm, g.opponentOf(session.UserID), OutgoingOffer{Type: DRAW_OFFER, GameID: g.ID, From: g.colorName(session.UserID)})
+	return nil
+}
+
+// RespondDraw accepts or declines the opponent's pending draw offer.
+func (g *Game) RespondDraw(session *PlayerSession, accept bool, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.playerColor(session.UserID); err != nil {
+		return err
+	}
+	if g.drawOfferFrom == "" {
+		return ErrNoDrawOffer
+	}
+	if g.drawOfferFrom == session.UserID {
+		return ErrCannotAnswerOwnOffer
+	}
+
+	if accept {
+		g.acceptDraw(gm)
+		return nil
+	}
+
+	offeredBy := g.drawOfferFrom
+	g.drawOfferFrom = ""
+	g.sendToUser(gm, offeredBy, OutgoingOffer{Type: DRAW_DECLINED, GameID: g.ID, From: g.colorName(session.UserID)})
+	return nil
+}
+
+// acceptDraw must be called with g.mu held.
+func (g *Game) acceptDraw(gm *GameManager) {
+	g.drawOfferFrom = ""
+	g.board.DrawByAgreement()
+	g.endGame(gm, GameStatusCompleted, chess.Draw.String(), MethodAgreement)
+}
+
+// RequestTakeback asks the opponent to undo the requester's last move. If the
+// opponent has already replied, their reply is taken back as well.
+func (g *Game) RequestTakeback(session *PlayerSession, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.playerColor(session.UserID); err != nil {
+		return err
+	}
+
+	if g.takebackFrom != "" {
+		return ErrTakebackAlreadyAsked
+	}
+
+	if g.takebackPlies(session.UserID) == 0 {
+		return ErrNothingToTakeBack
+	}
+	if g.takebackRequests[session.UserID] >= maxOffersPerPlayer {
+		return ErrTooManyTakebackAsks
+	}
+	g.takebackRequests[session.UserID]++
+
+	// The engine grants every takeback.
+	if g.isBot(g.opponentOf(session.UserID)) {
+		return g.undoMoves(g.takebackPlies(session.UserID), gm)
+	}
+	g.takebackFrom = session.UserID
+
+	g.sendToUser(gm, g.opponentOf(session.UserID), OutgoingOffer{Type: TAKEBACK_REQUEST, GameID: g.ID, From: g.colorName(session.UserID)})
+	return nil
+}
+
+// RespondTakeback accepts or declines the opponent's pending takeback request.
+func (g *Game) RespondTakeback(session *PlayerSession, accept bool, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.playerColor(session.UserID); err != nil {
+		return err
+	}
+	if g.takebackFrom == "" {
+		return ErrNoTakebackRequest
+	}
+	if g.takebackFrom == session.UserID {
+		return ErrCannotAnswerOwnOffer
+	}
+
+	requester := g.takebackFrom
+	g.takebackFrom = ""
+
+	if !accept {
+		g.sendToUser(gm, requester, OutgoingOffer{Type: TAKEBACK_DECLINED, GameID: g.ID, From: g.colorName(session.UserID)})
+		return nil
+	}
+
+	plies := g.takebackPlies(requester)
+	if plies == 0 {
+		return ErrNothingToTakeBack
+	}
+	return g.undoMoves(plies, gm)
+}
+
+// takebackPlies returns how many half-moves must be undone to give userID
+// their last move back. It must be called with g.mu held.
+func (g *Game) takebackPlies(userID string) int {
+	played := g.board.Plies()
+	color, _ := g.playerColor(userID)
+
+	plies := 1
+	if g.board.Turn() == color {
+		plies = 2
+	}
+	if plies > played {
+		return 0
+	}
+	return plies
+}
+
+// undoMoves takes the last plies half-moves off the board, rewinds the
+// clock turn and deletes the moves from the store through the move queue so
+// the deletion is ordered after their inserts. It must be called with g.mu
+// held.
+func (g *Game) undoMoves(plies int, gm *GameManager) error {
+	now := time.Now()
+	if g.lease.lapsed(now) {
+		return ErrOwnerUnavailable
+	}
+	payload := queue.MovePayload{
+		GameID:     g.ID,
+		MoveNumber: g.moveNumber - plies + 1,
+		Action:     queue.ActionTakeback,
+		CreatedAt:  float64(now.UnixMicro()) / 1e6,
+	}
+	if err := queue.EnqueueMove(gm.redisClient, payload, g.fence()); err != nil {
+		if errors.Is(err, queue.ErrFenced) {
+			return ErrOwnerUnavailable
+		}
+		log.Printf("Failed to enqueue takeback: %v", err)
+	}
+
+	g.board.Undo(plies)
+	g.moveNumber -= plies
+	if len(g.moveClocks) >= plies {
+		g.moveClocks = g.moveClocks[:len(g.moveClocks)-plies]
+	}
+	g.drawOfferFrom = ""
+	g.clearQueuedMoves(gm)
+
+	if g.clock != nil {
+		g.clock.Stop(now)
+		g.clock.Start(g.board.Turn(), now)
+		g.armFlagTimer(gm)
+	}
+	if g.timeControl.IsCorrespondence() {
+		g.setDeadline(gm, now)
+	}
+
+	g.publish(gm, OutgoingTakeback{
+		Type:     TAKEBACK,
+		GameID:   g.ID,
+		Plies:    plies,
+		FEN:      g.board.FEN(),
+		Clock:    g.clockSnapshot(now),
+		Deadline: g.deadlineSnapshot(),
+	})
+	return nil
+}
+
+// clearOffers drops pending offers after userID has moved: a takeback request
+// no longer refers to the current position and moving counts as declining the
+// opponent's draw offer. It must be called with g.mu held.
+func (g *Game) clearOffers(userID string) {
+	g.takebackFrom = ""
+	if g.drawOfferFrom != "" && g.drawOfferFrom != userID {
+		g.drawOfferFrom = ""
+	}
+}
+
+func (g *Game) playerColor(userID string) (chess.Color, error) {
+	if g.status != GameStatusInProgress {
+		return chess.NoColor, ErrGameEnded
+	}
+	switch userID {
+	case g.WhiteUserID:
+		return chess.White, nil
+	case g.BlackUserID:
+		return chess.Black, nil
+	}
+	return chess.NoColor, ErrNotInGame
+}
+
+func (g *Game) opponentOf(userID string) string {
+	if userID == g.WhiteUserID {
+		return g.BlackUserID
+	}
+	return g.WhiteUserID
+}
+
+func (g *Game) colorName(userID string) string {
+	if userID == g.WhiteUserID {
+		return "white"
+	}
+	return "black"
+}
@@ -1,17 +1,75 @@
 package gamemanager
 
 import (
+	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
+// PlayerSession is a user's presence on this replica: every connection
+// they have open, from any tab or device, and the games they play. A user
+// is connected while any of their connections is. Games and active are
+// guarded by gm.mu. Conns is changed with both gm.mu and connsMu held, so
+// either is enough to read it; games, which cannot take gm.mu, send through
+// connsMu.
 type PlayerSession struct {
 	UserID         string
-	Conn           *websocket.Conn
-	GameID         string
-	Disconnected   bool
+	Conns          map[*Conn]struct{}
+	connsMu        sync.Mutex
+	Games          map[string]struct{}
 	DisconnectedAt time.Time
 	LastSeen       time.Time
+
+	// active is the connection the user chose to move from, if any. Moves
+	// and game actions from their other connections are refused.
+	active *Conn
+
+	chat chatLimiter
+}
+
+func newPlayerSession(userID string) *PlayerSession {
+	return &PlayerSession{
+		UserID: userID,
+		Conns:  make(map[*Conn]struct{}),
+		Games:  make(map[string]struct{}),
+	}
+}
+
+func (s *PlayerSession) Connected() bool {
+	return len(s.Conns) > 0
+}
+
+func (s *PlayerSession) InGame(gameID string) bool {
+	_, ok := s.Games[gameID]
+	return ok
 }
 
+func (s *PlayerSession) addGame(gameID string) {
+	s.Games[gameID] = struct{}{}
+}
+
+func (s *PlayerSession) addConn(conn *Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.Conns[conn] = struct{}{}
+}
+
+func (s *PlayerSession) removeConn(conn *Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.Conns, conn)
+}
+
+// send delivers msg to every connection of the session.
+func (s *PlayerSession) send(msg interface{}) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for conn := range s.Conns {
+		conn.Send(msg)
+	}
+}
+
+// canAct reports whether conn may move and act in games: any connection
+// can unless the user picked an active one.
+func (s *PlayerSession) canAct(conn *Conn) bool {
+	return s.active == nil || s.active == conn
+}
@@ -0,0 +1,230 @@
+package gamemanager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+const (
+	// maxConditionalLines and maxConditionalPlies bound a player's
+	// conditional move tree.
+	maxConditionalLines = 32
+	maxConditionalPlies = 20
+)
+
+var (
+	ErrNotCorrespondence     = errors.New("conditional moves are only available in correspondence games")
+	ErrConditionalOnYourTurn = errors.New("it is your turn: make your move first")
+	ErrTooManyConditionals   = errors.New("too many conditional moves")
+	ErrInvalidConditional    = errors.New("conditional moves must be legal pairs of an opponent move and your reply")
+)
+
+// Premove queues the player's move to be played as soon as their opponent
+// has moved. A premove sent on the player's own turn is played at once. It
+// replaces any earlier premove and is only checked once it is played.
+func (g *Game) Premove(session *PlayerSession, move string, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	color, err := g.playerColor(session.UserID)
+	if err != nil {
+		return err
+	}
+	if move == "" {
+		return ErrEmptyMove
+	}
+	if g.board.Turn() == color {
+		return g.makeMove(session.UserID, move, gm)
+	}
+	g.premoves[session.UserID] = move
+	return nil
+}
+
+func (g *Game) CancelPremove(session *PlayerSession, gm *GameManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.playerColor(session.UserID); err != nil {
+		return err
+	}
+	delete(g.premoves, session.UserID)
+	return nil
+}
+
+// ConditionalMoves returns userID's conditional move lines in a game.
+func (gm *GameManager) ConditionalMoves(gameID string, userID string) ([][]string, error) {
+	lines, err := gm.conditionalMovesLocal(gameID, userID)
+	if errors.Is(err, ErrGameNotOnServer) && gm.clustered() {
+		reply, err := gm.forward(clusterCommand{GameID: gameID, UserID: userID, Action: actionGetConditionals})
+		return reply.Lines, err
+	}
+	return lines, err
+}
+
+func (gm *GameManager) conditionalMovesLocal(gameID string, userID string) ([][]string, error) {
+	game, err := gm.localGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	game.mu.RLock()
+	defer game.mu.RUnlock()
+
+	if _, err := game.playerColor(userID); err != nil {
+		return nil, err
+	}
+	return game.conditionals[userID], nil
+}
+
+// SetConditionalMoves replaces userID's conditional move tree in a
+// correspondence game while waiting for the opponent. Each line alternates
+// the opponent's moves and the replies to play to them, starting with the
+// opponent's next move. It returns the lines in UCI.
+func (gm *GameManager) SetConditionalMoves(gameID string, userID string, lines [][]string) ([][]string, error) {
+	normalized, err := gm.setConditionalMovesLocal(gameID, userID, lines)
+	if errors.Is(err, ErrGameNotOnServer) && gm.clustered() {
+		reply, err := gm.forward(clusterCommand{GameID: gameID, UserID: userID, Action: actionSetConditionals, Lines: lines})
+		return reply.Lines, err
+	}
+	return normalized, err
+}
+
+func (gm *GameManager) setConditionalMovesLocal(gameID string, userID string, lines [][]string) ([][]string, error) {
+	game, err := gm.localGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	return game.setConditionals(userID, lines, gm)
+}
+
+// setConditionals checks every line on the current position and that a
+// position is always answered with the same reply. It must be called with
+// g.mu held.
+func (g *Game) setConditionals(userID string, lines [][]string, gm *GameManager) ([][]string, error) {
+	color, err := g.playerColor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !g.timeControl.IsCorrespondence() {
+		return nil, ErrNotCorrespondence
+	}
+	if g.board.Turn() == color {
+		return nil, ErrConditionalOnYourTurn
+	}
+	if len(lines) > maxConditionalLines {
+		return nil, ErrTooManyConditionals
+	}
+
+	played := g.board.UCIMoves()
+	replies := make(map[string]string)
+	normalized := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		if len(line) == 0 || len(line)%2 == 1 || len(line) > maxConditionalPlies {
+			return nil, ErrInvalidConditional
+		}
+		board, err := variant.Replay(g.board.Variant(), g.board.InitialFEN(), append(played[:len(played):len(played)], line...))
+		if err != nil {
+			return nil, ErrInvalidConditional
+		}
+		line = board.UCIMoves()[len(played):]
+
+		for i := 0; i < len(line); i += 2 {
+			position := strings.Join(line[:i+1], " ")
+			if reply, ok := replies[position]; ok && reply != line[i+1] {
+				return nil, ErrInvalidConditional
+			}
+			replies[position] = line[i+1]
+		}
+		normalized = append(normalized, line)
+	}
+
+	if err := gm.gameStore.SaveConditionalMoves(context.Background(), g.ID, userID, normalized); err != nil {
+		return nil, err
+	}
+	g.setConditionalLines(userID, normalized)
+	return normalized, nil
+}
+
+// answer plays the reply the player to move queued for the opponent's move:
+// their premove, or else what their conditional moves give for it. A reply
+// that cannot be played is dropped. It reports whether a reply was played
+// and must be called with g.mu held.
+func (g *Game) answer(gm *GameManager, opponentMove string) bool {
+	userID := g.userToMove()
+
+	reply, premoved := g.premoves[userID]
+	delete(g.premoves, userID)
+	if !premoved {
+		var ok bool
+		if reply, ok = g.takeConditional(gm, userID, opponentMove); !ok {
+			return false
+		}
+	}
+
+	err := g.makeMove(userID, reply, gm)
+	if err == nil || g.status != GameStatusInProgress {
+		return true
+	}
+	if premoved {
+		g.sendToUser(gm, userID, OutgoingPremoveCancelled{Type: PREMOVE_CANCELLED, GameID: g.ID, Move: reply})
+	} else {
+		g.saveConditionals(gm, userID, nil)
+	}
+	return false
+}
+
+// takeConditional returns userID's reply to opponentMove and keeps the
+// lines that follow it. Any other move by the opponent discards the tree.
+// It must be called with g.mu held.
+func (g *Game) takeConditional(gm *GameManager, userID string, opponentMove string) (string, bool) {
+	lines := g.conditionals[userID]
+	if len(lines) == 0 {
+		return "", false
+	}
+
+	var reply string
+	var rest [][]string
+	for _, line := range lines {
+		if line[0] != opponentMove {
+			continue
+		}
+		reply = line[1]
+		if len(line) > 2 {
+			rest = append(rest, line[2:])
+		}
+	}
+	g.saveConditionals(gm, userID, rest)
+	return reply, reply != ""
+}
+
+// clearQueuedMoves drops every premove and conditional move, e.g. after a
+// takeback. It must be called with g.mu held.
+func (g *Game) clearQueuedMoves(gm *GameManager) {
+	clear(g.premoves)
+	for userID := range g.conditionals {
+		g.saveConditionals(gm, userID, nil)
+	}
+}
+
+// saveConditionals must be called with g.mu held.
+func (g *Game) saveConditionals(gm *GameManager, userID string, lines [][]string) {
+	g.setConditionalLines(userID, lines)
+	if err := gm.gameStore.SaveConditionalMoves(context.Background(), g.ID, userID, lines); err != nil {
+		log.Printf("Failed to store conditional moves of game %s: %v", g.ID, err)
+	}
+}
+
+func (g *Game) setConditionalLines(userID string, lines [][]string) {
+	if len(lines) == 0 {
+		delete(g.conditionals, userID)
+		return
+	}
+	g.conditionals[userID] = lines
+}
@@ -0,0 +1,154 @@
+package gamemanager
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// A user's presence is a hash per user: the nodes they are connected
+	// to, or the live games they play, each mapped to when the entry
+	// expires in Unix milliseconds. Nodes refresh their entries every
+	// leaseRenewInterval, so a node that dies drops out after presenceTTL.
+	onlineKeyPrefix  = "presence:online:"
+	playingKeyPrefix = "presence:playing:"
+	presenceTTL      = leaseTTL
+)
+
+// refreshPresence publishes which users are connected to this node and
+// which play a live game it hosts.
+func (gm *GameManager) refreshPresence(ctx context.Context) {
+	gm.mu.RLock()
+	var online []string
+	for userID, session := range gm.sessions {
+		if session.Connected() {
+			online = append(online, userID)
+		}
+	}
+	playing := make(map[string][]string)
+	for gameID, game := range gm.games {
+		if !game.IsActive() || game.timeControl.IsCorrespondence() {
+			continue
+		}
+		for _, userID := range []string{game.WhiteUserID, game.BlackUserID} {
+			if !game.isBot(userID) {
+				playing[userID] = append(playing[userID], gameID)
+			}
+		}
+	}
+	gm.mu.RUnlock()
+
+	expires := strconv.FormatInt(time.Now().Add(presenceTTL).UnixMilli(), 10)
+	pipe := gm.redisClient.Pipeline()
+	for _, userID := range online {
+		pipe.HSet(ctx, onlineKeyPrefix+userID, gm.nodeID, expires)
+		pipe.PExpire(ctx, onlineKeyPrefix+userID, presenceTTL)
+	}
+	for userID, gameIDs := range playing {
+		for _, gameID := range gameIDs {
+			pipe.HSet(ctx, playingKeyPrefix+userID, gameID, expires)
+		}
+		pipe.PExpire(ctx, playingKeyPrefix+userID, presenceTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to refresh presence: %v", err)
+	}
+}
+
+// markOnline adds the node to userID's presence as soon as they connect,
+// ahead of the next refresh, so the nodes hosting their games do not take
+// them for gone.
+func (gm *GameManager) markOnline(userID string) {
+	if !gm.clustered() {
+		return
+	}
+	ctx := context.Background()
+	expires := strconv.FormatInt(time.Now().Add(presenceTTL).UnixMilli(), 10)
+	pipe := gm.redisClient.Pipeline()
+	pipe.HSet(ctx, onlineKeyPrefix+userID, gm.nodeID, expires)
+	pipe.PExpire(ctx, onlineKeyPrefix+userID, presenceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to publish presence of %s: %v", userID, err)
+	}
+}
+
+// markOffline removes the node from userID's presence once their last
+// connection to it closed.
+func (gm *GameManager) markOffline(userID string) {
+	if !gm.clustered() {
+		return
+	}
+	if err := gm.redisClient.HDel(context.Background(), onlineKeyPrefix+userID, gm.nodeID).Err(); err != nil {
+		log.Printf("Failed to clear presence of %s: %v", userID, err)
+	}
+}
+
+// markGameOver removes an ended game from its players' presence.
+func (gm *GameManager) markGameOver(g *Game) {
+	if !gm.clustered() {
+		return
+	}
+	pipe := gm.redisClient.Pipeline()
+	for _, userID := range []string{g.WhiteUserID, g.BlackUserID} {
+		pipe.HDel(context.Background(), playingKeyPrefix+userID, g.ID)
+	}
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		log.Printf("Failed to clear presence of game %s: %v", g.ID, err)
+	}
+}
+
+// present reports whether the presence hash at key has an entry that has
+// not expired yet.
+func (gm *GameManager) present(key string) bool {
+	entries, err := gm.redisClient.HGetAll(context.Background(), key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Failed to look up presence %s: %v", key, err)
+		}
+		return false
+	}
+	now := time.Now().UnixMilli()
+	for _, value := range entries {
+		if expires, err := strconv.ParseInt(value, 10, 64); err == nil && expires > now {
+			return true
+		}
+	}
+	return false
+}
+
+// trackPresence starts the disconnection grace period of the players of
+// games who are connected to no node and ends it for those who are back on
+// any node. It covers games restored or adopted while their players were
+// away and, in cluster mode, players whose connection to another node
+// dropped. It must be called without gm.mu held.
+func (gm *GameManager) trackPresence(games []*Game) {
+	online := make(map[string]bool)
+	for _, game := range games {
+		for _, userID := range game.humanPlayers() {
+			if _, seen := online[userID]; !seen {
+				online[userID] = gm.IsConnected(userID)
+			}
+		}
+	}
+
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	for _, game := range games {
+		for _, userID := range game.humanPlayers() {
+			game.mu.RLock()
+			_, gone := game.disconnected[userID]
+			game.mu.RUnlock()
+
+			switch {
+			case !online[userID] && !gone:
+				game.HandleDisconnect(userID, gm)
+			case online[userID] && gone:
+				game.HandleReconnect(userID, gm)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package gamemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/Adi-ty/chess/internal/variant"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrGameNotFound = errors.New("game not found")
+)
+
+// spectatorCountTTL bounds how long a spectator count survives a replica
+// that died without decrementing it.
+const spectatorCountTTL = 24 * time.Hour
+
+// Spectator is a read-only connection following a game. UserID is empty for
+// anonymous spectators.
+type Spectator struct {
+	UserID string
+	Conn   *Conn
+
+	chat chatLimiter
+}
+
+// AddSpectator registers conn as a spectator of gameID, sends it the current
+// position and blocks reading from it until it disconnects.
+func (gm *GameManager) AddSpectator(ws *websocket.Conn, userID string, gameID string) {
+	conn := newConn(ws)
+	spectator := &Spectator{UserID: userID, Conn: conn}
+	if err := gm.watch(spectator, gameID); err != nil {
+		conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+		conn.Close()
+		return
+	}
+
+	defer func() {
+		gm.unwatch(spectator, gameID)
+		conn.Close()
+	}()
+
+	gm.loadMutes(userID)
+
+	for {
+		var message IncomingMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			return
+		}
+		switch message.Type {
+		case UNSPECTATE:
+			return
+		case CHAT:
+			if err := gm.spectatorChat(spectator, gameID, message.Text); err != nil {
+				conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+			}
+		case MUTE, UNMUTE:
+			if err := gm.SetMuted(userID, message.UserID, message.Type == MUTE); err != nil {
+				conn.Send(OutgoingError{Type: ERROR, Message: err.Error()})
+			}
+		}
+	}
+}
+
+// handleSpectate lets a connected player follow another game from their own
+// connection.
+func (gm *GameManager) handleSpectate(session *PlayerSession, conn *Conn, gameID string) {
+	if gameID == "" {
+		conn.Send(OutgoingError{Type: ERROR, Message: "game_id is required"})
+		return
+	}
+	if _, err := gm.sessionGameID(session, gameID); err == nil {
+		conn.Send(OutgoingError{Type: ERROR, GameID: gameID, Message: "you are playing this game"})
+		return
+	}
+
+	if err := gm.watch(&Spectator{UserID: session.UserID, Conn: conn}, gameID); err != nil {
+		conn.Send(OutgoingError{Type: ERROR, GameID: gameID, Message: err.Error()})
+	}
+}
+
+func (gm *GameManager) handleUnspectate(session *PlayerSession, conn *Conn, gameID string) {
+	gm.unwatch(&Spectator{UserID: session.UserID, Conn: conn}, gameID)
+}
+
+// watch sends the spectator the current position and subscribes it to the
+// game's events. Moves carry their ply so a client can drop any that were
+// already part of the snapshot.
+func (gm *GameManager) watch(spectator *Spectator, gameID string) error {
+	snapshot, err := gm.spectatorSnapshot(gameID)
+	if err != nil {
+		return err
+	}
+	state, err := gm.GameState(gameID, spectator.UserID)
+	if err != nil {
+		return err
+	}
+
+	gm.mu.Lock()
+	if gm.spectators[gameID] == nil {
+		gm.spectators[gameID] = make(map[*Conn]*Spectator)
+	}
+	if _, watching := gm.spectators[gameID][spectator.Conn]; watching {
+		gm.mu.Unlock()
+		return nil
+	}
+	gm.spectators[gameID][spectator.Conn] = spectator
+	if snapshot.Status == string(GameStatusInProgress) {
+		gm.subscribe(gameID)
+	}
+	spectator.Conn.Send(snapshot)
+	spectator.Conn.Send(state)
+	gm.mu.Unlock()
+
+	gm.changeSpectatorCount(gameID, 1)
+	return nil
+}
+
+func (gm *GameManager) unwatch(spectator *Spectator, gameID string) {
+	gm.mu.Lock()
+	watchers := gm.spectators[gameID]
+	if _, watching := watchers[spectator.Conn]; !watching {
+		gm.mu.Unlock()
+		return
+	}
+	delete(watchers, spectator.Conn)
+	if len(watchers) == 0 {
+		delete(gm.spectators, gameID)
+		gm.maybeUnsubscribe(gameID)
+	}
+	gm.mu.Unlock()
+
+	gm.changeSpectatorCount(gameID, -1)
+}
+
+// removeSpectatorConn drops conn from every game it was watching. It must be
+// called with gm.mu held.
+func (gm *GameManager) removeSpectatorConn(conn *Conn) {
+	for gameID, watchers := range gm.spectators {
+		if _, watching := watchers[conn]; !watching {
+			continue
+		}
+		delete(watchers, conn)
+		if len(watchers) == 0 {
+			delete(gm.spectators, gameID)
+			gm.maybeUnsubscribe(gameID)
+		}
+		go gm.changeSpectatorCount(gameID, -1)
+	}
+}
+
+// changeSpectatorCount adjusts the game's spectator count shared by every
+// replica and announces it on the game channel.
+func (gm *GameManager) changeSpectatorCount(gameID string, delta int64) {
+	ctx := context.Background()
+	key := fmt.Sprintf("game:%s:spectators", gameID)
+
+	pipe := gm.redisClient.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, delta)
+	pipe.Expire(ctx, key, spectatorCountTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to update spectator count for game %s: %v", gameID, err)
+		return
+	}
+
+	publishGameEvent(gm.redisClient, gameID, OutgoingSpectators{Type: SPECTATORS, GameID: gameID, Count: max(incr.Val(), 0)})
+}
+
+// maybeUnsubscribe stops relaying a game channel nobody on this replica needs
+// any more. It must be called with gm.mu held.
+func (gm *GameManager) maybeUnsubscribe(gameID string) {
+	if _, local := gm.games[gameID]; local {
+		return
+	}
+	if len(gm.spectators[gameID]) > 0 {
+		return
+	}
+	for _, session := range gm.sessions {
+		if session.InGame(gameID) {
+			return
+		}
+	}
+	if pubsub, exists := gm.pubsubs[gameID]; exists {
+		pubsub.Close()
+		delete(gm.pubsubs, gameID)
+	}
+}
+
+// spectatorSnapshot describes the current state of a game, from memory if
+// this replica owns it and from the store otherwise.
+func (gm *GameManager) spectatorSnapshot(gameID string) (OutgoingSpectate, error) {
+	gm.mu.RLock()
+	game, local := gm.games[gameID]
+	gm.mu.RUnlock()
+
+	if local {
+		game.mu.RLock()
+		defer game.mu.RUnlock()
+		return game.spectateMessage(time.Now()), nil
+	}
+
+	ctx := context.Background()
+	dbGame, err := gm.gameStore.GetGameByID(ctx, gameID)
+	if err != nil {
+		return OutgoingSpectate{}, err
+	}
+	if dbGame == nil {
+		return OutgoingSpectate{}, ErrGameNotFound
+	}
+
+	moves, err := gm.loggedMoves(ctx, gameID)
+	if err != nil {
+		return OutgoingSpectate{}, err
+	}
+	board, err := replayMoves(variant.Variant(dbGame.Variant), dbGame.InitialFEN, moves)
+	if err != nil {
+		return OutgoingSpectate{}, err
+	}
+
+	return OutgoingSpectate{
+		Type:        SPECTATE,
+		GameID:      dbGame.ID,
+		WhiteUserID: dbGame.WhiteUserID,
+		BlackUserID: dbGame.BlackUserID,
+		TimeControl: dbGame.TimeControl,
+		Variant:     string(board.Variant()),
+		InitialFEN:  board.InitialFEN(),
+		Status:      dbGame.Status,
+		Outcome:     dbGame.Outcome,
+		Method:      dbGame.Method,
+		FEN:         board.FEN(),
+		Moves:       board.UCIMoves(),
+		Ply:         len(moves),
+	}, nil
+}
+
+// spectateMessage must be called with g.mu held.
+func (g *Game) spectateMessage(now time.Time) OutgoingSpectate {
+	return OutgoingSpectate{
+		Type:        SPECTATE,
+		GameID:      g.ID,
+		WhiteUserID: g.WhiteUserID,
+		BlackUserID: g.BlackUserID,
+		TimeControl: g.timeControl.String(),
+		Variant:     string(g.board.Variant()),
+		InitialFEN:  g.board.InitialFEN(),
+		Status:      string(g.status),
+		Outcome:     g.outcome,
+		Method:      g.method,
+		FEN:         g.board.FEN(),
+		Moves:       g.board.UCIMoves(),
+		Ply:         g.moveNumber,
+		Clock:       g.clockSnapshot(now),
+	}
+}
+
+func replayMoves(v variant.Variant, fen string, moves []queue.MovePayload) (*variant.Board, error) {
+	board, err := variant.NewBoard(v, fen)
+	if err != nil {
+		return nil, err
+	}
+	for _, move := range moves {
+		if _, err := board.Move(move.Move); err != nil {
+			return nil, fmt.Errorf("replay move %s: %w", move.Move, err)
+		}
+	}
+	return board, nil
+}
@@ -0,0 +1,226 @@
+package gamemanager
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
+	"github.com/notnil/chess"
+)
+
+// profileTTL is how long a player's name, avatar and rating are reused in
+// game_state messages before they are looked up again.
+const profileTTL = time.Minute
+
+type profileKey struct {
+	userID   string
+	category string
+}
+
+type cachedProfile struct {
+	profile   PlayerProfile
+	fetchedAt time.Time
+}
+
+// SetUsers lets game_state messages show the players' names and avatars.
+// Without it profiles only carry the user ID and rating.
+func (gm *GameManager) SetUsers(users store.UserStore) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.users = users
+}
+
+// GameState describes gameID as seen by userID, whose colour is left empty
+// unless they play in it. It works for games hosted on any replica, though
+// the clocks of a game hosted elsewhere are unknown.
+func (gm *GameManager) GameState(gameID string, userID string) (OutgoingGameState, error) {
+	gm.mu.RLock()
+	game, local := gm.games[gameID]
+	gm.mu.RUnlock()
+
+	if local {
+		return gm.localGameState(game, userID), nil
+	}
+
+	ctx := context.Background()
+	dbGame, err := gm.gameStore.GetGameByID(ctx, gameID)
+	if err != nil {
+		return OutgoingGameState{}, err
+	}
+	if dbGame == nil {
+		return OutgoingGameState{}, ErrGameNotFound
+	}
+	moves, err := gm.loggedMoves(ctx, gameID)
+	if err != nil {
+		return OutgoingGameState{}, err
+	}
+	board, err := replayMoves(variant.Variant(dbGame.Variant), dbGame.InitialFEN, moves)
+	if err != nil {
+		return OutgoingGameState{}, err
+	}
+
+	tc, err := ParseTimeControl(dbGame.TimeControl)
+	if err != nil {
+		log.Printf("Invalid time control %q for game %s: %v", dbGame.TimeControl, dbGame.ID, err)
+	}
+	category := RatingCategory(board.Variant(), tc.Category())
+
+	state := boardState(board)
+	state.GameID = dbGame.ID
+	state.Color = playerColorName(dbGame.WhiteUserID, dbGame.BlackUserID, userID)
+	state.White = gm.playerProfile(dbGame.WhiteUserID, category)
+	state.Black = gm.playerProfile(dbGame.BlackUserID, category)
+	state.TimeControl = dbGame.TimeControl
+	state.Category = dbGame.TimeCategory
+	state.Rated = dbGame.Rated
+	state.Status = dbGame.Status
+	state.Outcome = dbGame.Outcome
+	state.Method = dbGame.Method
+	if dbGame.Status == string(GameStatusInProgress) {
+		state.Deadline = dbGame.MoveDeadline
+	}
+	return state, nil
+}
+
+// localGameState describes a game held in memory. The profiles are looked
+// up before the game is locked. It may be called with gm.mu held, once
+// prefetchProfiles warmed the profile cache for the game so no query runs
+// under the lock.
+func (gm *GameManager) localGameState(game *Game, userID string) OutgoingGameState {
+	category := gameCategory(game)
+	white := gm.playerProfile(game.WhiteUserID, category)
+	black := gm.playerProfile(game.BlackUserID, category)
+
+	game.mu.RLock()
+	defer game.mu.RUnlock()
+
+	state := boardState(game.board)
+	state.GameID = game.ID
+	state.Color = playerColorName(game.WhiteUserID, game.BlackUserID, userID)
+	state.White = white
+	state.Black = black
+	state.TimeControl = game.timeControl.String()
+	state.Category = string(game.timeControl.Category())
+	state.Rated = game.rated
+	state.Clock = game.clockSnapshot(time.Now())
+	state.Deadline = game.deadlineSnapshot()
+	state.Status = string(game.status)
+	state.Outcome = game.outcome
+	state.Method = game.method
+	if game.drawOfferFrom != "" {
+		state.DrawOffer = game.colorName(game.drawOfferFrom)
+	}
+	if game.takebackFrom != "" {
+		state.TakebackRequest = game.colorName(game.takebackFrom)
+	}
+	return state
+}
+
+// boardState fills in the position and moves of a game_state message.
+func boardState(board *variant.Board) OutgoingGameState {
+	moves := board.Moves()
+	sans := make([]string, 0, len(moves))
+	for _, mv := range moves {
+		sans = append(sans, mv.SAN)
+	}
+
+	state := OutgoingGameState{
+		Type:       GAME_STATE,
+		Variant:    board.Variant(),
+		InitialFEN: board.InitialFEN(),
+		FEN:        board.FEN(),
+		Moves:      sans,
+		Ply:        len(moves),
+		Turn:       "white",
+	}
+	if board.Turn() == chess.Black {
+		state.Turn = "black"
+	}
+	if len(moves) > 0 {
+		state.LastMove = moves[len(moves)-1].UCI
+	}
+	return state
+}
+
+// playerProfile returns a player's name and avatar and their rating in the
+// game's rating category, looked up at most once every profileTTL.
+func (gm *GameManager) playerProfile(userID string, category string) PlayerProfile {
+	key := profileKey{userID: userID, category: category}
+	gm.profilesMu.Lock()
+	cached, ok := gm.profiles[key]
+	gm.profilesMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < profileTTL {
+		return cached.profile
+	}
+
+	profile := gm.fetchProfile(userID, category)
+	gm.profilesMu.Lock()
+	gm.profiles[key] = cachedProfile{profile: profile, fetchedAt: time.Now()}
+	gm.profilesMu.Unlock()
+	return profile
+}
+
+// prefetchProfiles warms the profile cache for players about to be sent a
+// game_state with gm.mu held. It must be called without gm.mu.
+func (gm *GameManager) prefetchProfiles(category string, userIDs ...string) {
+	for _, userID := range userIDs {
+		gm.playerProfile(userID, category)
+	}
+}
+
+// prefetchGame warms the profile cache for both players of a game.
+func (gm *GameManager) prefetchGame(game *Game) {
+	gm.prefetchProfiles(gameCategory(game), game.WhiteUserID, game.BlackUserID)
+}
+
+// prefetchStoredGame warms the profile cache for both players of a game
+// about to be restored from the store.
+func (gm *GameManager) prefetchStoredGame(dbGame *store.Game) {
+	tc, _ := ParseTimeControl(dbGame.TimeControl)
+	category := RatingCategory(variant.Variant(dbGame.Variant), tc.Category())
+	gm.prefetchProfiles(category, dbGame.WhiteUserID, dbGame.BlackUserID)
+}
+
+// evictProfiles drops the cached profiles that went stale.
+func (gm *GameManager) evictProfiles(now time.Time) {
+	gm.profilesMu.Lock()
+	defer gm.profilesMu.Unlock()
+	for key, cached := range gm.profiles {
+		if now.Sub(cached.fetchedAt) >= profileTTL {
+			delete(gm.profiles, key)
+		}
+	}
+}
+
+func gameCategory(game *Game) string {
+	return RatingCategory(game.board.Variant(), game.timeControl.Category())
+}
+
+func (gm *GameManager) fetchProfile(userID string, category string) PlayerProfile {
+	profile := PlayerProfile{ID: userID}
+	if gm.users != nil {
+		user, err := gm.users.GetUserByID(context.Background(), userID)
+		if err != nil {
+			log.Printf("Failed to load profile of %s: %v", userID, err)
+		} else if user != nil {
+			profile.DisplayName = user.DisplayName
+			profile.AvatarURL = user.AvatarURL
+		}
+	}
+	if gm.ratings != nil {
+		profile.Rating = gm.ratingFor(userID, category)
+	}
+	return profile
+}
+
+func playerColorName(whiteUserID string, blackUserID string, userID string) string {
+	switch userID {
+	case whiteUserID:
+		return "white"
+	case blackUserID:
+		return "black"
+	}
+	return ""
+}
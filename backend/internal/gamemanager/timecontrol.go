@@ -0,0 +1,212 @@
+package gamemanager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TimeCategory string
+
+const (
+	CategoryBullet    TimeCategory = "bullet"
+	CategoryBlitz     TimeCategory = "blitz"
+	CategoryRapid     TimeCategory = "rapid"
+	CategoryClassical TimeCategory = "classical"
+	CategoryUnlimited TimeCategory = "unlimited"
+	// CategoryCorrespondence is for games played at days per move.
+	CategoryCorrespondence TimeCategory = "correspondence"
+)
+
+const (
+	maxInitialTime = 3 * time.Hour
+	maxDaysPerMove = 14
+)
+
+var (
+	ErrInvalidTimeControl = errors.New("invalid time control")
+)
+
+// TimeControl describes the clock a game is played with. Increment is a
+// Fischer increment added after every move, Delay is a Bronstein delay:
+// the time spent on a move is given back up to the delay. A correspondence
+// game has no clock: instead each move must be made within DaysPerMove days.
+type TimeControl struct {
+	Initial     time.Duration
+	Increment   time.Duration
+	Delay       time.Duration
+	DaysPerMove int
+}
+
+var timeControlPresets = map[string]TimeControl{
+	"bullet":    {Initial: 1 * time.Minute},
+	"blitz":     {Initial: 3 * time.Minute, Increment: 2 * time.Second},
+	"rapid":     {Initial: 10 * time.Minute},
+	"classical": {Initial: 30 * time.Minute, Increment: 20 * time.Second},
+
+	"correspondence": {DaysPerMove: 3},
+}
+
+func (tc TimeControl) IsUnlimited() bool {
+	return tc.Initial == 0 && tc.Increment == 0 && tc.Delay == 0 && tc.DaysPerMove == 0
+}
+
+func (tc TimeControl) IsCorrespondence() bool {
+	return tc.DaysPerMove > 0
+}
+
+// MoveTime is how long a correspondence player has for each move.
+func (tc TimeControl) MoveTime() time.Duration {
+	return time.Duration(tc.DaysPerMove) * 24 * time.Hour
+}
+
+// Category buckets a time control by its estimated game duration
+// (initial time plus 40 moves of increment or delay).
+func (tc TimeControl) Category() TimeCategory {
+	if tc.IsCorrespondence() {
+		return CategoryCorrespondence
+	}
+	if tc.IsUnlimited() {
+		return CategoryUnlimited
+	}
+
+	estimate := tc.Initial + 40*(tc.Increment+tc.Delay)
+	switch {
+	case estimate < 3*time.Minute:
+		return CategoryBullet
+	case estimate < 8*time.Minute:
+		return CategoryBlitz
+	case estimate < 25*time.Minute:
+		return CategoryRapid
+	default:
+		return CategoryClassical
+	}
+}
+
+// String encodes the time control as "<initial>+<increment>" or
+// "<initial>d<delay>" in seconds, "1/<seconds per move>" for correspondence
+// as in the PGN TimeControl tag, and "-" for untimed games.
+func (tc TimeControl) String() string {
+	if tc.IsUnlimited() {
+		return "-"
+	}
+	if tc.IsCorrespondence() {
+		return fmt.Sprintf("1/%d", int(tc.MoveTime()/time.Second))
+	}
+	initial := int(tc.Initial / time.Second)
+	if tc.Delay > 0 {
+		return fmt.Sprintf("%dd%d", initial, int(tc.Delay/time.Second))
+	}
+	return fmt.Sprintf("%d+%d", initial, int(tc.Increment/time.Second))
+}
+
+func (tc TimeControl) Validate() error {
+	if tc.DaysPerMove != 0 {
+		if tc.DaysPerMove < 0 || tc.DaysPerMove > maxDaysPerMove {
+			return ErrInvalidTimeControl
+		}
+		if tc.Initial != 0 || tc.Increment != 0 || tc.Delay != 0 {
+			return ErrInvalidTimeControl
+		}
+		return nil
+	}
+	if tc.Initial < 0 || tc.Increment < 0 || tc.Delay < 0 {
+		return ErrInvalidTimeControl
+	}
+	if tc.Increment > 0 && tc.Delay > 0 {
+		return ErrInvalidTimeControl
+	}
+	if tc.Initial > maxInitialTime || tc.Increment > time.Minute || tc.Delay > time.Minute {
+		return ErrInvalidTimeControl
+	}
+	if tc.Initial == 0 && !tc.IsUnlimited() {
+		return ErrInvalidTimeControl
+	}
+	return nil
+}
+
+func ParseTimeControl(s string) (TimeControl, error) {
+	if s == "" || s == "-" {
+		return TimeControl{}, nil
+	}
+	if preset, ok := timeControlPresets[s]; ok {
+		return preset, nil
+	}
+	if perMove, ok := strings.CutPrefix(s, "1/"); ok {
+		return parseCorrespondence(perMove)
+	}
+
+	sep := "+"
+	if strings.Contains(s, "d") {
+		sep = "d"
+	}
+	parts := strings.SplitN(s, sep, 2)
+	if len(parts) != 2 {
+		return TimeControl{}, ErrInvalidTimeControl
+	}
+
+	initial, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return TimeControl{}, ErrInvalidTimeControl
+	}
+	extra, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return TimeControl{}, ErrInvalidTimeControl
+	}
+
+	tc := TimeControl{Initial: time.Duration(initial) * time.Second}
+	if sep == "d" {
+		tc.Delay = time.Duration(extra) * time.Second
+	} else {
+		tc.Increment = time.Duration(extra) * time.Second
+	}
+
+	if err := tc.Validate(); err != nil {
+		return TimeControl{}, err
+	}
+	return tc, nil
+}
+
+func parseCorrespondence(perMove string) (TimeControl, error) {
+	seconds, err := strconv.Atoi(perMove)
+	if err != nil || seconds%(24*60*60) != 0 {
+		return TimeControl{}, ErrInvalidTimeControl
+	}
+
+	tc := TimeControl{DaysPerMove: seconds / (24 * 60 * 60)}
+	if tc.DaysPerMove == 0 {
+		return TimeControl{}, ErrInvalidTimeControl
+	}
+	if err := tc.Validate(); err != nil {
+		return TimeControl{}, err
+	}
+	return tc, nil
+}
+
+// ToTimeControl resolves the time control requested in an init_game message
+// or a challenge. A preset name takes precedence over explicit values.
+func (itc *IncomingTimeControl) ToTimeControl() (TimeControl, error) {
+	if itc == nil {
+		return TimeControl{}, nil
+	}
+	if itc.Preset != "" {
+		preset, ok := timeControlPresets[itc.Preset]
+		if !ok {
+			return TimeControl{}, ErrInvalidTimeControl
+		}
+		return preset, nil
+	}
+
+	tc := TimeControl{
+		Initial:     time.Duration(itc.Initial) * time.Second,
+		Increment:   time.Duration(itc.Increment) * time.Second,
+		Delay:       time.Duration(itc.Delay) * time.Second,
+		DaysPerMove: itc.Days,
+	}
+	if err := tc.Validate(); err != nil {
+		return TimeControl{}, err
+	}
+	return tc, nil
+}
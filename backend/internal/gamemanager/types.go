@@ -1,35 +1,332 @@
 package gamemanager
 
+import (
+	"time"
+
+	"github.com/Adi-ty/chess/internal/pgn"
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+// GameResult describes a finished game to the hooks registered with
+// GameManager.OnGameEnd.
+type GameResult struct {
+	GameID       string
+	WhiteUserID  string
+	BlackUserID  string
+	Status       GameStatus
+	Outcome      string
+	Method       string
+	TimeCategory TimeCategory
+	Variant      variant.Variant
+	InitialFEN   string
+	Rated        bool
+	Leaver       string
+	Plies        int
+	EndedAt      time.Time
+	// Moves are the moves of the game in UCI notation.
+	Moves []string
+	// PGN is the finished game without player names.
+	PGN pgn.Game
+}
+
+// RatingCategory is the rating pool the game counts towards.
+func (r GameResult) RatingCategory() string {
+	return RatingCategory(r.Variant, r.TimeCategory)
+}
+
+// RatingCategory rates standard games by time category and each variant on
+// its own, whatever the time control.
+func RatingCategory(v variant.Variant, category TimeCategory) string {
+	if v == "" || v == variant.Standard {
+		return string(category)
+	}
+	return string(v)
+}
+
 type IncomingMessage struct {
-	Type string `json:"type"`
-	Move string `json:"move,omitempty"`
+	Type        string               `json:"type"`
+	Move        string               `json:"move,omitempty"`
+	TimeControl *IncomingTimeControl `json:"time_control,omitempty"`
+	Color       string               `json:"color,omitempty"`
+	GameID      string               `json:"game_id,omitempty"`
+	// Opponent is "bot" to play the engine at Level instead of queueing.
+	Opponent string `json:"opponent,omitempty"`
+	Level    int    `json:"level,omitempty"`
+	// Variant selects the rules of the game to seek; empty is standard.
+	Variant string `json:"variant,omitempty"`
+	// FEN is the starting position of a bot game; empty is the standard one.
+	FEN string `json:"fen,omitempty"`
+	// Text is a chat message; UserID the user to mute or unmute.
+	Text   string `json:"text,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// IncomingTimeControl is either a preset name ("bullet", "blitz", "rapid",
+// "classical", "correspondence") or explicit values in seconds. Days asks
+// for a correspondence game with that many days per move.
+type IncomingTimeControl struct {
+	Preset    string `json:"preset,omitempty"`
+	Initial   int    `json:"initial,omitempty"`
+	Increment int    `json:"increment,omitempty"`
+	Delay     int    `json:"delay,omitempty"`
+	Days      int    `json:"days,omitempty"`
+}
+
+type OutgoingGameStart struct {
+	Type        string          `json:"type"`
+	Color       string          `json:"color"`
+	GameID      string          `json:"game_id"`
+	TimeControl string          `json:"time_control"`
+	Category    string          `json:"category"`
+	Variant     variant.Variant `json:"variant"`
+	InitialFEN  string          `json:"initial_fen"`
+	Clock       *OutgoingClock  `json:"clock,omitempty"`
+	Deadline    *time.Time      `json:"deadline,omitempty"`
+}
+
+// PlayerProfile is a player as shown next to the board. Rating is in the
+// game's rating category.
+type PlayerProfile struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Rating      int    `json:"rating,omitempty"`
 }
 
+// OutgoingGameState is everything a client needs to draw a game without
+// replaying its moves. It is sent on game start, on reconnection and to
+// spectators. Color is the receiver's colour, empty for spectators; Moves
+// are in SAN and LastMove in UCI. DrawOffer and TakebackRequest hold the
+// colour of the player with a pending offer.
+type OutgoingGameState struct {
+	Type            string          `json:"type"`
+	GameID          string          `json:"game_id"`
+	Color           string          `json:"color,omitempty"`
+	White           PlayerProfile   `json:"white"`
+	Black           PlayerProfile   `json:"black"`
+	TimeControl     string          `json:"time_control"`
+	Category        string          `json:"category"`
+	Variant         variant.Variant `json:"variant"`
+	Rated           bool            `json:"rated"`
+	InitialFEN      string          `json:"initial_fen"`
+	FEN             string          `json:"fen"`
+	Moves           []string        `json:"moves"`
+	Ply             int             `json:"ply"`
+	LastMove        string          `json:"last_move,omitempty"`
+	Turn            string          `json:"turn"`
+	Clock           *OutgoingClock  `json:"clock,omitempty"`
+	Deadline        *time.Time      `json:"deadline,omitempty"`
+	DrawOffer       string          `json:"draw_offer,omitempty"`
+	TakebackRequest string          `json:"takeback_request,omitempty"`
+	Status          string          `json:"status"`
+	Outcome         string          `json:"outcome,omitempty"`
+	Method          string          `json:"method,omitempty"`
+}
+
+// OutgoingClock holds the remaining time of both sides in milliseconds.
+type OutgoingClock struct {
+	White int64 `json:"white"`
+	Black int64 `json:"black"`
+}
+
+// OutgoingMove carries the clocks after a timed move, or the deadline for
+// the reply in a correspondence game.
 type OutgoingMove struct {
-	Type string `json:"type"`
-	Move string `json:"move"`
+	Type     string         `json:"type"`
+	GameID   string         `json:"game_id"`
+	Move     string         `json:"move"`
+	Ply      int            `json:"ply"`
+	Clock    *OutgoingClock `json:"clock,omitempty"`
+	Deadline *time.Time     `json:"deadline,omitempty"`
+}
+
+// OutgoingSpectate is the snapshot a spectator receives when joining a game.
+type OutgoingSpectate struct {
+	Type        string         `json:"type"`
+	GameID      string         `json:"game_id"`
+	WhiteUserID string         `json:"white_user_id"`
+	BlackUserID string         `json:"black_user_id"`
+	TimeControl string         `json:"time_control"`
+	Variant     string         `json:"variant"`
+	InitialFEN  string         `json:"initial_fen"`
+	Status      string         `json:"status"`
+	Outcome     string         `json:"outcome,omitempty"`
+	Method      string         `json:"method,omitempty"`
+	FEN         string         `json:"fen"`
+	Moves       []string       `json:"moves"`
+	Ply         int            `json:"ply"`
+	Clock       *OutgoingClock `json:"clock,omitempty"`
+}
+
+type OutgoingSpectators struct {
+	Type   string `json:"type"`
+	GameID string `json:"game_id"`
+	Count  int64  `json:"count"`
 }
 
 type OutgoingGameOver struct {
+	Type    string         `json:"type"`
+	GameID  string         `json:"game_id"`
+	Outcome string         `json:"outcome"`
+	Method  string         `json:"method"`
+	Clock   *OutgoingClock `json:"clock,omitempty"`
+}
+
+// OutgoingOffer notifies a player about a draw offer or takeback request and
+// about the answer to their own.
+type OutgoingOffer struct {
+	Type   string `json:"type"`
+	GameID string `json:"game_id"`
+	From   string `json:"from"`
+}
+
+type OutgoingTakeback struct {
+	Type     string         `json:"type"`
+	GameID   string         `json:"game_id"`
+	Plies    int            `json:"plies"`
+	FEN      string         `json:"fen"`
+	Clock    *OutgoingClock `json:"clock,omitempty"`
+	Deadline *time.Time     `json:"deadline,omitempty"`
+}
+
+// OutgoingBerserk tells both players that Color gave up half their time
+// and their increment.
+type OutgoingBerserk struct {
+	Type   string         `json:"type"`
+	GameID string         `json:"game_id"`
+	Color  string         `json:"color"`
+	Clock  *OutgoingClock `json:"clock,omitempty"`
+}
+
+// OutgoingYourTurn tells a correspondence player that the opponent has
+// moved and by when they must reply.
+type OutgoingYourTurn struct {
+	Type     string    `json:"type"`
+	GameID   string    `json:"game_id"`
+	Move     string    `json:"move"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// OutgoingOpponentDisconnected tells a player that their opponent lost
+// their connection. Once Seconds have passed, at ClaimAt, the player may
+// claim the win or a draw.
+type OutgoingOpponentDisconnected struct {
+	Type    string    `json:"type"`
+	GameID  string    `json:"game_id"`
+	Seconds int       `json:"seconds"`
+	ClaimAt time.Time `json:"claim_at"`
+}
+
+type OutgoingOpponentReconnected struct {
+	Type   string `json:"type"`
+	GameID string `json:"game_id"`
+}
+
+// OutgoingPremoveCancelled tells a player their premove was illegal once
+// it was their turn and has been dropped.
+type OutgoingPremoveCancelled struct {
+	Type   string `json:"type"`
+	GameID string `json:"game_id"`
+	Move   string `json:"move"`
+}
+
+// OutgoingActiveDevice tells one of a user's connections whether it is the
+// device they chose to move from. CanMove is false while another one is.
+type OutgoingActiveDevice struct {
 	Type    string `json:"type"`
-	Outcome string `json:"outcome"`
-	Method  string `json:"method"`
+	Active  bool   `json:"active"`
+	CanMove bool   `json:"can_move"`
 }
 
+// OutgoingError names the game a failed action was for, if any.
 type OutgoingError struct {
 	Type    string `json:"type"`
+	GameID  string `json:"game_id,omitempty"`
 	Message string `json:"message"`
 }
 
+type OutgoingChat struct {
+	Type   string `json:"type"`
+	GameID string `json:"game_id"`
+	Room   string `json:"room"`
+	UserID string `json:"user_id"`
+	Text   string `json:"text"`
+}
+
+type OutgoingMuted struct {
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+	Muted  bool   `json:"muted"`
+}
+
 type OutgoingWaiting struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
 }
 
 const (
-	INIT_GAME = "init_game"
-	MOVE      = "move"
-	GAME_OVER = "game_over"
-	ERROR     = "error"
-	WAITING   = "waiting"
+	INIT_GAME  = "init_game"
+	GAME_START = "game_start"
+	MOVE       = "move"
+	GAME_OVER  = "game_over"
+	ERROR      = "error"
+	WAITING    = "waiting"
+
+	SPECTATE   = "spectate"
+	UNSPECTATE = "unspectate"
+	SPECTATORS = "spectators"
+
+	CANCEL_SEARCH    = "cancel_search"
+	SEARCH_CANCELLED = "search_cancelled"
+
+	RESIGN           = "resign"
+	OFFER_DRAW       = "offer_draw"
+	ACCEPT_DRAW      = "accept_draw"
+	DECLINE_DRAW     = "decline_draw"
+	REQUEST_TAKEBACK = "request_takeback"
+	ACCEPT_TAKEBACK  = "accept_takeback"
+	DECLINE_TAKEBACK = "decline_takeback"
+
+	DRAW_OFFER        = "draw_offer"
+	DRAW_DECLINED     = "draw_declined"
+	TAKEBACK_REQUEST  = "takeback_request"
+	TAKEBACK_DECLINED = "takeback_declined"
+	TAKEBACK          = "takeback"
+
+	CHALLENGE           = "challenge"
+	CHALLENGE_ACCEPTED  = "challenge_accepted"
+	CHALLENGE_DECLINED  = "challenge_declined"
+	CHALLENGE_CANCELLED = "challenge_cancelled"
+
+	GAME_FINISH = "game_finish"
+	CHAT        = "chat"
+	MUTE        = "mute"
+	UNMUTE      = "unmute"
+	MUTED       = "muted"
+
+	BERSERK              = "berserk"
+	TOURNAMENT_STANDINGS = "tournament_standings"
+	TOURNAMENT_FINISHED  = "tournament_finished"
+
+	YOUR_TURN = "your_turn"
+
+	OPPONENT_DISCONNECTED = "opponent_disconnected"
+	OPPONENT_RECONNECTED  = "opponent_reconnected"
+	CLAIM_VICTORY         = "claim_victory"
+	CLAIM_DRAW            = "claim_draw"
+
+	PREMOVE           = "premove"
+	CANCEL_PREMOVE    = "cancel_premove"
+	PREMOVE_CANCELLED = "premove_cancelled"
+
+	GAME_STATE = "game_state"
+
+	SET_ACTIVE_DEVICE   = "set_active_device"
+	CLEAR_ACTIVE_DEVICE = "clear_active_device"
+	ACTIVE_DEVICE       = "active_device"
+)
+
+const (
+	MethodTimeout    = "timeout"
+	MethodDisconnect = "disconnect"
 )
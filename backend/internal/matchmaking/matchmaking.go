@@ -0,0 +1,163 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// The acceptable rating gap starts at initialWindow and widens by
+	// windowStep every windowInterval a player waits, up to maxWindow.
+	initialWindow  = 100
+	windowStep     = 50
+	windowInterval = 5 * time.Second
+	maxWindow      = 1000
+
+	tickInterval = time.Second
+)
+
+var (
+	ErrAlreadyQueued = errors.New("already waiting for opponent")
+	ErrInvalidColor  = errors.New("invalid colour preference")
+)
+
+type ColorPreference string
+
+const (
+	ColorRandom ColorPreference = ""
+	ColorWhite  ColorPreference = "white"
+	ColorBlack  ColorPreference = "black"
+)
+
+func ParseColorPreference(s string) (ColorPreference, error) {
+	switch ColorPreference(s) {
+	case ColorRandom, "random":
+		return ColorRandom, nil
+	case ColorWhite:
+		return ColorWhite, nil
+	case ColorBlack:
+		return ColorBlack, nil
+	}
+	return ColorRandom, ErrInvalidColor
+}
+
+// Ticket is a player's request to be paired. Players are only paired with
+// tickets from the same Pool.
+type Ticket struct {
+	UserID      string          `json:"user_id"`
+	Pool        string          `json:"pool"`
+	TimeControl string          `json:"time_control"`
+	Variant     string          `json:"variant,omitempty"`
+	Rating      int             `json:"rating"`
+	Color       ColorPreference `json:"color,omitempty"`
+	JoinedAt    time.Time       `json:"joined_at"`
+}
+
+// Match is a pairing produced by a Matchmaker. GameID is assigned by the
+// matchmaker so every replica agrees on it.
+type Match struct {
+	GameID      string `json:"game_id"`
+	WhiteUserID string `json:"white_user_id"`
+	BlackUserID string `json:"black_user_id"`
+	Pool        string `json:"pool"`
+	TimeControl string `json:"time_control"`
+	Variant     string `json:"variant,omitempty"`
+}
+
+type Matchmaker interface {
+	// Join queues a ticket. Joining a different pool replaces the user's
+	// previous ticket.
+	Join(ctx context.Context, ticket Ticket) error
+	// Cancel removes the user from every pool. It is not an error if the
+	// user is not queued.
+	Cancel(ctx context.Context, userID string) error
+	// Matches delivers pairings that involve at least one player queued
+	// through this matchmaker.
+	Matches() <-chan Match
+	// Run pairs players until ctx is cancelled.
+	Run(ctx context.Context)
+}
+
+// window returns the rating gap a ticket accepts after waiting since JoinedAt.
+func (t Ticket) window(now time.Time) int {
+	steps := int(now.Sub(t.JoinedAt) / windowInterval)
+	return min(initialWindow+steps*windowStep, maxWindow)
+}
+
+func compatible(a, b Ticket, now time.Time) bool {
+	if a.UserID == b.UserID {
+		return false
+	}
+	if a.Color != ColorRandom && a.Color == b.Color {
+		return false
+	}
+	gap := abs(a.Rating - b.Rating)
+	return gap <= a.window(now) && gap <= b.window(now)
+}
+
+// pair greedily matches the longest-waiting tickets of a single pool with
+// the closest-rated compatible opponent.
+func pair(tickets []Ticket, now time.Time) []Match {
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].JoinedAt.Before(tickets[j].JoinedAt)
+	})
+
+	matched := make([]bool, len(tickets))
+	var matches []Match
+
+	for i := range tickets {
+		if matched[i] {
+			continue
+		}
+
+		best := -1
+		for j := i + 1; j < len(tickets); j++ {
+			if matched[j] || !compatible(tickets[i], tickets[j], now) {
+				continue
+			}
+			if best == -1 || abs(tickets[i].Rating-tickets[j].Rating) < abs(tickets[i].Rating-tickets[best].Rating) {
+				best = j
+			}
+		}
+		if best == -1 {
+			continue
+		}
+
+		matched[i], matched[best] = true, true
+		matches = append(matches, newMatch(tickets[i], tickets[best]))
+	}
+
+	return matches
+}
+
+func newMatch(a, b Ticket) Match {
+	white, black := a, b
+	switch {
+	case a.Color == ColorBlack || b.Color == ColorWhite:
+		white, black = b, a
+	case a.Color == ColorWhite || b.Color == ColorBlack:
+	case rand.IntN(2) == 0:
+		white, black = b, a
+	}
+
+	return Match{
+		GameID:      uuid.New().String(),
+		WhiteUserID: white.UserID,
+		BlackUserID: black.UserID,
+		Pool:        a.Pool,
+		TimeControl: a.TimeControl,
+		Variant:     a.Variant,
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
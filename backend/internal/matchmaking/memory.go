@@ -0,0 +1,103 @@
+package matchmaking
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryMatchmaker keeps the pools in process memory. It is only suitable
+// for a single backend replica.
+type MemoryMatchmaker struct {
+	tickets map[string]Ticket // userID -> ticket
+	matches chan Match
+
+	mu sync.Mutex
+}
+
+func NewMemoryMatchmaker() *MemoryMatchmaker {
+	return &MemoryMatchmaker{
+		tickets: make(map[string]Ticket),
+		matches: make(chan Match, 64),
+	}
+}
+
+func (m *MemoryMatchmaker) Join(ctx context.Context, ticket Ticket) error {
+	m.mu.Lock()
+	if existing, ok := m.tickets[ticket.UserID]; ok && existing.Pool == ticket.Pool {
+		m.mu.Unlock()
+		return ErrAlreadyQueued
+	}
+	if ticket.JoinedAt.IsZero() {
+		ticket.JoinedAt = time.Now()
+	}
+	m.tickets[ticket.UserID] = ticket
+	matches := m.pairPool(ticket.Pool, time.Now())
+	m.mu.Unlock()
+
+	m.deliver(matches)
+	return nil
+}
+
+func (m *MemoryMatchmaker) Cancel(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tickets, userID)
+	return nil
+}
+
+func (m *MemoryMatchmaker) Matches() <-chan Match {
+	return m.matches
+}
+
+func (m *MemoryMatchmaker) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			pools := make(map[string]bool)
+			for _, t := range m.tickets {
+				pools[t.Pool] = true
+			}
+			var matches []Match
+			for pool := range pools {
+				matches = append(matches, m.pairPool(pool, now)...)
+			}
+			m.mu.Unlock()
+
+			m.deliver(matches)
+		}
+	}
+}
+
+// pairPool takes the pool's paired tickets out of the queue and returns
+// their matches. It must be called with m.mu held.
+func (m *MemoryMatchmaker) pairPool(pool string, now time.Time) []Match {
+	var tickets []Ticket
+	for _, t := range m.tickets {
+		if t.Pool == pool {
+			tickets = append(tickets, t)
+		}
+	}
+
+	matches := pair(tickets, now)
+	for _, match := range matches {
+		delete(m.tickets, match.WhiteUserID)
+		delete(m.tickets, match.BlackUserID)
+	}
+	return matches
+}
+
+// deliver hands matches to the consumer. It must be called without m.mu
+// held: the consumer may be waiting on Cancel while the channel is full.
+func (m *MemoryMatchmaker) deliver(matches []Match) {
+	for _, match := range matches {
+		m.matches <- match
+	}
+}
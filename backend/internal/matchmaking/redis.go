@@ -0,0 +1,289 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ticketsKey    = "matchmaking:tickets"
+	heartbeatsKey = "matchmaking:heartbeats"
+	poolsKey      = "matchmaking:pools"
+	poolKeyPrefix = "matchmaking:pool:"
+	lockKey       = "matchmaking:lock"
+	matchChannel  = "matchmaking:matches"
+
+	lockTTL = 2 * time.Second
+	// Tickets whose replica stopped refreshing them are dropped, so a crashed
+	// pod does not leave ghost players in the queue.
+	ticketTTL = 15 * time.Second
+)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisMatchmaker shares the pools between every backend replica. Any
+// replica may run the pairing for a tick (guarded by a Redis lock); the
+// resulting matches are published to all replicas, and each one delivers
+// those involving its own players.
+type RedisMatchmaker struct {
+	rdb     *redis.Client
+	matches chan Match
+
+	// local holds the users queued through this replica, whose heartbeats
+	// it keeps fresh.
+	local map[string]Ticket
+	mu    sync.Mutex
+}
+
+func NewRedisMatchmaker(rdb *redis.Client) *RedisMatchmaker {
+	return &RedisMatchmaker{
+		rdb:     rdb,
+		matches: make(chan Match, 64),
+		local:   make(map[string]Ticket),
+	}
+}
+
+func (m *RedisMatchmaker) Join(ctx context.Context, ticket Ticket) error {
+	if ticket.JoinedAt.IsZero() {
+		ticket.JoinedAt = time.Now()
+	}
+
+	existing, err := m.getTicket(ctx, ticket.UserID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Pool == ticket.Pool {
+		return ErrAlreadyQueued
+	}
+
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if existing != nil {
+			pipe.ZRem(ctx, poolKeyPrefix+existing.Pool, ticket.UserID)
+		}
+		pipe.HSet(ctx, ticketsKey, ticket.UserID, data)
+		pipe.ZAdd(ctx, heartbeatsKey, redis.Z{Score: float64(time.Now().Unix()), Member: ticket.UserID})
+		pipe.ZAdd(ctx, poolKeyPrefix+ticket.Pool, redis.Z{Score: float64(ticket.JoinedAt.UnixMilli()), Member: ticket.UserID})
+		pipe.SAdd(ctx, poolsKey, ticket.Pool)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.local[ticket.UserID] = ticket
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *RedisMatchmaker) Cancel(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	delete(m.local, userID)
+	m.mu.Unlock()
+
+	existing, err := m.getTicket(ctx, userID)
+	if err != nil || existing == nil {
+		return err
+	}
+	return m.removeTickets(ctx, existing.Pool, userID)
+}
+
+func (m *RedisMatchmaker) Matches() <-chan Match {
+	return m.matches
+}
+
+func (m *RedisMatchmaker) Run(ctx context.Context) {
+	pubsub := m.rdb.Subscribe(ctx, matchChannel)
+	defer pubsub.Close()
+	go m.deliverMatches(pubsub.Channel())
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.refreshHeartbeats(ctx, now)
+			if err := m.tick(ctx, now); err != nil {
+				log.Printf("Matchmaking tick failed: %v", err)
+			}
+		}
+	}
+}
+
+func (m *RedisMatchmaker) deliverMatches(ch <-chan *redis.Message) {
+	for msg := range ch {
+		var match Match
+		if err := json.Unmarshal([]byte(msg.Payload), &match); err != nil {
+			log.Printf("Error unmarshaling match: %v", err)
+			continue
+		}
+
+		m.mu.Lock()
+		_, whiteLocal := m.local[match.WhiteUserID]
+		_, blackLocal := m.local[match.BlackUserID]
+		delete(m.local, match.WhiteUserID)
+		delete(m.local, match.BlackUserID)
+		m.mu.Unlock()
+
+		if whiteLocal || blackLocal {
+			m.matches <- match
+		}
+	}
+}
+
+func (m *RedisMatchmaker) refreshHeartbeats(ctx context.Context, now time.Time) {
+	m.mu.Lock()
+	members := make([]redis.Z, 0, len(m.local))
+	for userID := range m.local {
+		members = append(members, redis.Z{Score: float64(now.Unix()), Member: userID})
+	}
+	m.mu.Unlock()
+
+	if len(members) == 0 {
+		return
+	}
+	if err := m.rdb.ZAdd(ctx, heartbeatsKey, members...).Err(); err != nil {
+		log.Printf("Failed to refresh matchmaking heartbeats: %v", err)
+	}
+}
+
+// tick runs one pairing round across all pools if this replica wins the lock.
+func (m *RedisMatchmaker) tick(ctx context.Context, now time.Time) error {
+	token := uuid.New().String()
+	acquired, err := m.rdb.SetNX(ctx, lockKey, token, lockTTL).Result()
+	if err != nil || !acquired {
+		return err
+	}
+	defer releaseLockScript.Run(ctx, m.rdb, []string{lockKey}, token)
+
+	if err := m.expireStaleTickets(ctx, now); err != nil {
+		return err
+	}
+
+	pools, err := m.rdb.SMembers(ctx, poolsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range pools {
+		userIDs, err := m.rdb.ZRange(ctx, poolKeyPrefix+pool, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			m.rdb.SRem(ctx, poolsKey, pool)
+			continue
+		}
+		if len(userIDs) < 2 {
+			continue
+		}
+
+		raw, err := m.rdb.HMGet(ctx, ticketsKey, userIDs...).Result()
+		if err != nil {
+			return err
+		}
+
+		var tickets []Ticket
+		for _, r := range raw {
+			s, ok := r.(string)
+			if !ok {
+				continue
+			}
+			var t Ticket
+			if err := json.Unmarshal([]byte(s), &t); err == nil {
+				tickets = append(tickets, t)
+			}
+		}
+
+		for _, match := range pair(tickets, now) {
+			if err := m.removeTickets(ctx, pool, match.WhiteUserID, match.BlackUserID); err != nil {
+				return err
+			}
+			data, err := json.Marshal(match)
+			if err != nil {
+				return err
+			}
+			if err := m.rdb.Publish(ctx, matchChannel, data).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *RedisMatchmaker) expireStaleTickets(ctx context.Context, now time.Time) error {
+	cutoff := now.Add(-ticketTTL).Unix()
+	stale, err := m.rdb.ZRangeByScore(ctx, heartbeatsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff, 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range stale {
+		ticket, err := m.getTicket(ctx, userID)
+		if err != nil {
+			return err
+		}
+		pool := ""
+		if ticket != nil {
+			pool = ticket.Pool
+		}
+		if err := m.removeTickets(ctx, pool, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *RedisMatchmaker) removeTickets(ctx context.Context, pool string, userIDs ...string) error {
+	_, err := m.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, ticketsKey, userIDs...)
+		for _, userID := range userIDs {
+			pipe.ZRem(ctx, heartbeatsKey, userID)
+			if pool != "" {
+				pipe.ZRem(ctx, poolKeyPrefix+pool, userID)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *RedisMatchmaker) getTicket(ctx context.Context, userID string) (*Ticket, error) {
+	data, err := m.rdb.HGet(ctx, ticketsKey, userID).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var t Ticket
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
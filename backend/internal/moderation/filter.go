@@ -0,0 +1,52 @@
+package moderation
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultWords are masked in chat unless the filter is built with another
+// list.
+var DefaultWords = []string{
+	"fuck",
+	"shit",
+	"cunt",
+	"bitch",
+	"asshole",
+	"bastard",
+	"dickhead",
+	"motherfucker",
+}
+
+// WordFilter masks blocked words in chat messages. Words match whole,
+// case-insensitively, including common inflections such as "fucking".
+type WordFilter struct {
+	pattern *regexp.Regexp
+}
+
+func NewWordFilter(words []string) *WordFilter {
+	var quoted []string
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return &WordFilter{}
+	}
+	return &WordFilter{
+		pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\w*`),
+	}
+}
+
+// Filter replaces every blocked word with asterisks. It never rejects a
+// message.
+func (f *WordFilter) Filter(text string) (string, error) {
+	if f.pattern == nil {
+		return text, nil
+	}
+	return f.pattern.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	}), nil
+}
@@ -0,0 +1,200 @@
+package pgn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+const (
+	ResultWhiteWon = "1-0"
+	ResultBlackWon = "0-1"
+	ResultDraw     = "1/2-1/2"
+	ResultOngoing  = "*"
+
+	TerminationNormal       = "Normal"
+	TerminationTimeForfeit  = "Time forfeit"
+	TerminationAbandoned    = "Abandoned"
+	TerminationUnterminated = "Unterminated"
+
+	// lineWidth is the export format's recommended maximum line length.
+	lineWidth = 80
+)
+
+// Game is everything needed to write a game's PGN. White and Black hold the
+// players' display names; the user IDs are used when a name is unknown.
+type Game struct {
+	ID          string
+	WhiteUserID string
+	BlackUserID string
+	White       string
+	Black       string
+	Site        string
+	Rated       bool
+	TimeControl string
+	Category    string
+	// Variant is empty or Standard for standard chess. FEN is the starting
+	// position and is only written when it is not the standard one.
+	Variant     variant.Variant
+	FEN         string
+	Result      string
+	Termination string
+	StartedAt   time.Time
+	Moves       []Move
+}
+
+// Move is a move in SAN. Clock is the mover's remaining time after the move
+// and is omitted when HasClock is false.
+type Move struct {
+	SAN      string
+	Clock    time.Duration
+	HasClock bool
+}
+
+// Encode writes the game in PGN export format: the Seven Tag Roster, a few
+// supplemental tags and the movetext with [%clk] comments.
+func Encode(g Game) string {
+	var b strings.Builder
+
+	result := g.Result
+	if result == "" {
+		result = ResultOngoing
+	}
+
+	writeTag(&b, "Event", event(g))
+	writeTag(&b, "Site", orDefault(g.Site, "?"))
+	writeTag(&b, "Date", pgnDate(g.StartedAt))
+	writeTag(&b, "Round", "-")
+	writeTag(&b, "White", orDefault(g.White, orDefault(g.WhiteUserID, "?")))
+	writeTag(&b, "Black", orDefault(g.Black, orDefault(g.BlackUserID, "?")))
+	writeTag(&b, "Result", result)
+	if !g.StartedAt.IsZero() {
+		writeTag(&b, "UTCDate", pgnDate(g.StartedAt))
+		writeTag(&b, "UTCTime", g.StartedAt.UTC().Format("15:04:05"))
+	}
+	writeTag(&b, "TimeControl", orDefault(g.TimeControl, "-"))
+	writeTag(&b, "Termination", orDefault(g.Termination, TerminationUnterminated))
+	writeTag(&b, "GameId", g.ID)
+	if g.Variant != "" && g.Variant != variant.Standard {
+		writeTag(&b, "Variant", g.Variant.Name())
+	}
+	if g.FEN != "" && g.FEN != variant.StandardFEN {
+		writeTag(&b, "SetUp", "1")
+		writeTag(&b, "FEN", g.FEN)
+	}
+	b.WriteString("\n")
+
+	line := 0
+	writeToken := func(token string) {
+		if line > 0 && line+1+len(token) > lineWidth {
+			b.WriteString("\n")
+			line = 0
+		}
+		if line > 0 {
+			b.WriteString(" ")
+			line++
+		}
+		b.WriteString(token)
+		line += len(token)
+	}
+
+	firstMove, blackFirst := startingMove(g.FEN)
+	for i, mv := range g.Moves {
+		ply := i
+		if blackFirst {
+			ply++
+		}
+		moveNumber := firstMove + ply/2
+		switch {
+		case ply%2 == 0:
+			writeToken(fmt.Sprintf("%d.", moveNumber))
+		case i == 0, g.Moves[i-1].HasClock:
+			// A game starting with black, or a comment interrupting the
+			// move pair, needs a move number before black's move.
+			writeToken(fmt.Sprintf("%d...", moveNumber))
+		}
+		writeToken(mv.SAN)
+		if mv.HasClock {
+			writeToken("{")
+			writeToken("[%clk " + formatClock(mv.Clock) + "]")
+			writeToken("}")
+		}
+	}
+	writeToken(result)
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// Result converts a chess outcome to a PGN result. A game abandoned by a
+// player is a loss for the leaver.
+func Result(outcome string, whiteLeft, blackLeft bool) string {
+	switch {
+	case whiteLeft:
+		return ResultBlackWon
+	case blackLeft:
+		return ResultWhiteWon
+	}
+	switch outcome {
+	case ResultWhiteWon, ResultBlackWon, ResultDraw:
+		return outcome
+	}
+	return ResultOngoing
+}
+
+// startingMove reads the number of the first move and whether black plays it
+// from a starting FEN.
+func startingMove(fen string) (int, bool) {
+	fields := strings.Fields(fen)
+	if len(fields) < 2 {
+		return 1, false
+	}
+	number, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || number < 1 {
+		number = 1
+	}
+	return number, fields[1] == "b"
+}
+
+func event(g Game) string {
+	kind := "Casual"
+	if g.Rated {
+		kind = "Rated"
+	}
+	if g.Category == "" {
+		return kind + " game"
+	}
+	return fmt.Sprintf("%s %s game", kind, strings.ToUpper(g.Category[:1])+g.Category[1:])
+}
+
+func writeTag(b *strings.Builder, name, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	fmt.Fprintf(b, "[%s \"%s\"]\n", name, value)
+}
+
+func pgnDate(t time.Time) string {
+	if t.IsZero() {
+		return "????.??.??"
+	}
+	return t.UTC().Format("2006.01.02")
+}
+
+// formatClock formats d as H:MM:SS, rounded down to the second.
+func formatClock(d time.Duration) string {
+	d = max(d, 0)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package pgn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
+)
+
+// Methods recorded by the game manager that are not normal terminations.
+const (
+	methodTimeout    = "timeout"
+	methodDisconnect = "disconnect"
+)
+
+type Service struct {
+	gameStore store.GameStore
+	userStore store.UserStore
+	siteURL   string
+}
+
+func NewService(gameStore store.GameStore, userStore store.UserStore, siteURL string) *Service {
+	return &Service{
+		gameStore: gameStore,
+		userStore: userStore,
+		siteURL:   strings.TrimRight(siteURL, "/"),
+	}
+}
+
+// Save writes the PGN of a finished game to the store.
+func (s *Service) Save(ctx context.Context, g Game) error {
+	s.fillHeader(ctx, &g)
+	return s.gameStore.UpdateGamePGN(ctx, g.ID, Encode(g))
+}
+
+// GamePGN returns the stored PGN of a game. Games still in progress, or
+// finished before PGNs were stored, are rebuilt from their moves without
+// clock comments.
+func (s *Service) GamePGN(ctx context.Context, gameID string) (string, error) {
+	game, err := s.gameStore.GetGameByID(ctx, gameID)
+	if err != nil {
+		return "", err
+	}
+	if game == nil {
+		return "", store.ErrGameNotFound
+	}
+	return s.pgnFor(ctx, game)
+}
+
+// ExportUserGames streams every finished game of the user to w as one PGN
+// file.
+func (s *Service) ExportUserGames(ctx context.Context, userID string, w io.Writer) error {
+	first := true
+	return s.gameStore.StreamGamesByUserID(ctx, userID, func(game *store.Game) error {
+		text, err := s.pgnFor(ctx, game)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = io.WriteString(w, text)
+		return err
+	})
+}
+
+func (s *Service) pgnFor(ctx context.Context, game *store.Game) (string, error) {
+	if game.PGN != "" {
+		return game.PGN, nil
+	}
+
+	moves, err := s.gameStore.GetMovesByGameID(ctx, game.ID)
+	if err != nil {
+		return "", err
+	}
+
+	board, err := variant.NewBoard(variant.Variant(game.Variant), game.InitialFEN)
+	if err != nil {
+		return "", err
+	}
+	sans := make([]Move, 0, len(moves))
+	for _, m := range moves {
+		mv, err := board.Move(m.Move)
+		if err != nil {
+			return "", fmt.Errorf("replay move %s: %w", m.Move, err)
+		}
+		sans = append(sans, Move{SAN: mv.SAN})
+	}
+
+	startedAt, _ := time.Parse(time.RFC3339Nano, game.StartedAt)
+	g := Game{
+		ID:          game.ID,
+		WhiteUserID: game.WhiteUserID,
+		BlackUserID: game.BlackUserID,
+		Rated:       game.Rated,
+		TimeControl: game.TimeControl,
+		Category:    game.TimeCategory,
+		Variant:     board.Variant(),
+		FEN:         board.InitialFEN(),
+		Result:      Result(game.Outcome, false, false),
+		Termination: Termination(game.Status, game.Method),
+		StartedAt:   startedAt,
+		Moves:       sans,
+	}
+	s.fillHeader(ctx, &g)
+	return Encode(g), nil
+}
+
+// Termination maps how a game ended to the PGN Termination tag.
+func Termination(status string, method string) string {
+	switch {
+	case status == "in_progress":
+		return TerminationUnterminated
+	case method == methodTimeout:
+		return TerminationTimeForfeit
+	case method == methodDisconnect:
+		return TerminationAbandoned
+	}
+	return TerminationNormal
+}
+
+// fillHeader looks up the players' display names and the game's URL.
+func (s *Service) fillHeader(ctx context.Context, g *Game) {
+	if g.White == "" {
+		g.White = s.displayName(ctx, g.WhiteUserID)
+	}
+	if g.Black == "" {
+		g.Black = s.displayName(ctx, g.BlackUserID)
+	}
+	if g.Site == "" && s.siteURL != "" {
+		g.Site = s.siteURL + "/game/" + g.ID
+	}
+}
+
+func (s *Service) displayName(ctx context.Context, userID string) string {
+	user, err := s.userStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	return user.DisplayName
+}
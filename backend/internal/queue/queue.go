@@ -3,24 +3,298 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// ActionTakeback marks a payload that deletes every move of the game from
+// MoveNumber onwards instead of inserting one.
+const ActionTakeback = "takeback"
+
 type MovePayload struct {
 	GameID     string  `json:"game_id"`
 	UserID     string  `json:"user_id"`
 	MoveNumber int     `json:"move_number"`
 	Move       string  `json:"move"`
 	CreatedAt  float64 `json:"created_at"`
+	Action     string  `json:"action,omitempty"`
+	// Seq numbers the writes of a game from 1, in the order they were
+	// queued. It is set by EnqueueMove.
+	Seq int64 `json:"seq,omitempty"`
 }
 
-func EnqueueMove(redisClient *redis.Client, payload MovePayload) error {
+// MoveStream is the Redis stream of moves waiting to be written to the
+// database. Entries are read by the MoveGroup consumer group and deleted once
+// written; those that keep failing are moved to MoveDeadLetterStream.
+const (
+	MoveStream           = "moves_stream"
+	MoveGroup            = "move_workers"
+	MoveDeadLetterStream = "moves_dead_letter"
+
+	// LegacyMoveQueue is the list moves were pushed to before the stream.
+	LegacyMoveQueue = "moves_queue"
+)
+
+var ErrDeadMoveNotFound = errors.New("dead-lettered move not found")
+
+const (
+	// moveSeqKeyPrefix holds the number of the last write queued for a
+	// game.
+	moveSeqKeyPrefix = "moves:seq:"
+	// moveLogKeyPrefix holds the moves of a game in progress, as queued:
+	// unlike the database it never lags behind, so a node taking over the
+	// game rebuilds it from there. Its first element is a marker, so a game
+	// whose moves were all taken back still has a log.
+	moveLogKeyPrefix = "moves:log:"
+
+	// moveLogTTL is how long the write number and log of a finished game
+	// are kept.
+	moveLogTTL = 24 * time.Hour
+)
+
+var ErrFenced = errors.New("write fenced off: the game's lease is held elsewhere")
+
+// Fence makes EnqueueMove fail with ErrFenced unless Key holds Token, so
+// only the holder of a game's lease writes its moves. The zero Fence lets
+// every write through.
+type Fence struct {
+	Key   string
+	Token string
+}
+
+// enqueueMoveScript numbers the payload with the next write of its game,
+// applies it to the game's move log and adds it to the stream in one step,
+// so a game's writes have no gaps. The seq field is spliced in before the
+// payload's closing brace. It returns 0 when the fence is held elsewhere.
+var enqueueMoveScript = redis.NewScript(`
+if ARGV[2] ~= "" and redis.call("GET", KEYS[4]) ~= ARGV[2] then
+	return 0
+end
+local seq = redis.call("INCR", KEYS[1])
+local payload = string.sub(ARGV[1], 1, -2) .. ',"seq":' .. seq .. '}'
+if redis.call("EXISTS", KEYS[3]) == 0 then
+	redis.call("RPUSH", KEYS[3], "")
+end
+if ARGV[3] == "takeback" then
+	redis.call("LTRIM", KEYS[3], 0, tonumber(ARGV[4]) - 1)
+else
+	redis.call("RPUSH", KEYS[3], payload)
+end
+redis.call("XADD", KEYS[2], "*", "payload", payload)
+return seq
+`)
+
+// seedMovesScript starts the move log of a game that has none with the
+// moves read from the database, and its write number with the last one the
+// database applied unless a later one was queued.
+var seedMovesScript = redis.NewScript(`
+redis.call("SET", KEYS[1], ARGV[1], "NX")
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+redis.call("RPUSH", KEYS[2], "", unpack(ARGV, 2))
+return 1
+`)
+
+func EnqueueMove(redisClient *redis.Client, payload MovePayload, fence Fence) error {
+	payload.Seq = 0
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	return redisClient.LPush(context.Background(), "moves_queue", jsonData).Err()
+	keys := []string{moveSeqKeyPrefix + payload.GameID, MoveStream, moveLogKeyPrefix + payload.GameID, fence.Key}
+	if fence.Key == "" {
+		keys[3] = keys[2]
+	}
+	seq, err := enqueueMoveScript.Run(context.Background(), redisClient, keys,
+		string(jsonData), fence.Token, payload.Action, payload.MoveNumber).Int64()
+	if err != nil {
+		return err
+	}
+	if seq == 0 {
+		return ErrFenced
+	}
+	return nil
+}
+
+// GameMoves returns the moves of a game from its move log. It returns false
+// when the game has no log, e.g. because it was started before the log
+// existed: SeedMoves must then start it.
+func GameMoves(ctx context.Context, redisClient *redis.Client, gameID string) ([]MovePayload, bool, error) {
+	entries, err := redisClient.LRange(ctx, moveLogKeyPrefix+gameID, 0, -1).Result()
+	if err != nil || len(entries) == 0 {
+		return nil, false, err
+	}
+	moves, err := decodeMoveLog(entries)
+	if err != nil {
+		return nil, false, err
+	}
+	return moves, true, nil
+}
+
+// decodeMoveLog decodes the entries of a move log, past its marker.
+func decodeMoveLog(entries []string) ([]MovePayload, error) {
+	moves := make([]MovePayload, 0, len(entries)-1)
+	for _, entry := range entries[1:] {
+		var move MovePayload
+		if err := json.Unmarshal([]byte(entry), &move); err != nil {
+			return nil, err
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// MoveLog returns the moves of a game from its move log along with the
+// number of the last write applied to it, read together. It returns false
+// when the game has no log.
+func MoveLog(ctx context.Context, redisClient *redis.Client, gameID string) ([]MovePayload, int64, bool, error) {
+	pipe := redisClient.TxPipeline()
+	seqCmd := pipe.Get(ctx, moveSeqKeyPrefix+gameID)
+	logCmd := pipe.LRange(ctx, moveLogKeyPrefix+gameID, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, false, err
+	}
+	entries := logCmd.Val()
+	if len(entries) == 0 {
+		return nil, 0, false, nil
+	}
+	seq, err := seqCmd.Int64()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	moves, err := decodeMoveLog(entries)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return moves, seq, true, nil
+}
+
+// SeedMoves starts the move log of a game that has none with its moves as
+// written to the database, where seq is the last write applied.
+func SeedMoves(ctx context.Context, redisClient *redis.Client, gameID string, moves []MovePayload, seq int64) error {
+	args := []interface{}{seq}
+	for _, move := range moves {
+		jsonData, err := json.Marshal(move)
+		if err != nil {
+			return err
+		}
+		args = append(args, string(jsonData))
+	}
+	keys := []string{moveSeqKeyPrefix + gameID, moveLogKeyPrefix + gameID}
+	return seedMovesScript.Run(ctx, redisClient, keys, args...).Err()
 }
 
+// EndMoves lets the write number and move log of a finished game expire.
+func EndMoves(ctx context.Context, redisClient *redis.Client, gameID string) error {
+	pipe := redisClient.TxPipeline()
+	pipe.Expire(ctx, moveSeqKeyPrefix+gameID, moveLogTTL)
+	pipe.Expire(ctx, moveLogKeyPrefix+gameID, moveLogTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AddMove appends an encoded MovePayload to the move stream.
+func AddMove(ctx context.Context, redisClient *redis.Client, payload string) error {
+	return redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: MoveStream,
+		Values: map[string]interface{}{"payload": payload},
+	}).Err()
+}
+
+// DeadMove is a move stream entry that could not be written.
+type DeadMove struct {
+	ID       string    `json:"id"`
+	EntryID  string    `json:"entry_id"`
+	Payload  string    `json:"payload"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// AddDeadMove moves a failed entry to the dead-letter stream.
+func AddDeadMove(ctx context.Context, redisClient *redis.Client, move DeadMove) error {
+	return redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: MoveDeadLetterStream,
+		Values: map[string]interface{}{
+			"entry_id":  move.EntryID,
+			"payload":   move.Payload,
+			"error":     move.Error,
+			"attempts":  move.Attempts,
+			"failed_at": move.FailedAt.Unix(),
+		},
+	}).Err()
+}
+
+// ListDeadMoves returns up to count dead-lettered moves, oldest first.
+func ListDeadMoves(ctx context.Context, redisClient *redis.Client, count int64) ([]DeadMove, error) {
+	entries, err := redisClient.XRangeN(ctx, MoveDeadLetterStream, "-", "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make([]DeadMove, 0, len(entries))
+	for _, entry := range entries {
+		moves = append(moves, deadMove(entry))
+	}
+	return moves, nil
+}
+
+// ReplayDeadMove puts a dead-lettered move back on the move stream. It
+// returns ErrDeadMoveNotFound if there is no such entry.
+func ReplayDeadMove(ctx context.Context, redisClient *redis.Client, id string) error {
+	entries, err := redisClient.XRangeN(ctx, MoveDeadLetterStream, id, id, 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return ErrDeadMoveNotFound
+	}
+
+	if err := AddMove(ctx, redisClient, deadMove(entries[0]).Payload); err != nil {
+		return err
+	}
+	return redisClient.XDel(ctx, MoveDeadLetterStream, id).Err()
+}
+
+func deadMove(entry redis.XMessage) DeadMove {
+	field := func(name string) string {
+		value, _ := entry.Values[name].(string)
+		return value
+	}
+	attempts, _ := strconv.Atoi(field("attempts"))
+	failedAt, _ := strconv.ParseInt(field("failed_at"), 10, 64)
+	return DeadMove{
+		ID:       entry.ID,
+		EntryID:  field("entry_id"),
+		Payload:  field("payload"),
+		Error:    field("error"),
+		Attempts: attempts,
+		FailedAt: time.Unix(failedAt, 0).UTC(),
+	}
+}
+
+// AnalysisQueue holds the finished games waiting for engine analysis.
+const AnalysisQueue = "analysis_queue"
+
+// AnalysisPayload carries the game's starting position and moves in UCI
+// notation so the analysis does not depend on the moves having been written
+// to the database yet. FEN is empty for the standard starting position.
+type AnalysisPayload struct {
+	GameID string   `json:"game_id"`
+	FEN    string   `json:"fen,omitempty"`
+	Moves  []string `json:"moves"`
+}
+
+func EnqueueAnalysis(redisClient *redis.Client, payload AnalysisPayload) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return redisClient.LPush(context.Background(), AnalysisQueue, jsonData).Err()
+}
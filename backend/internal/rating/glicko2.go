@@ -0,0 +1,130 @@
+package rating
+
+import "math"
+
+const (
+	DefaultRating     = 1500.0
+	DefaultRD         = 350.0
+	DefaultVolatility = 0.06
+
+	MinRD = 45.0
+	MaxRD = 350.0
+
+	// ProvisionalRD is the deviation above which a rating is shown as
+	// provisional.
+	ProvisionalRD = 110.0
+
+	// tau constrains the change in volatility over time.
+	tau = 0.5
+	// glickoScale converts between the Glicko and Glicko-2 scales.
+	glickoScale = 173.7178
+	convergence = 0.000001
+)
+
+// Rating is a player's Glicko-2 rating on the Glicko scale.
+type Rating struct {
+	Rating     float64
+	RD         float64
+	Volatility float64
+}
+
+func Default() Rating {
+	return Rating{Rating: DefaultRating, RD: DefaultRD, Volatility: DefaultVolatility}
+}
+
+// Result is a single game against Opponent, scored 1, 0.5 or 0.
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// Update returns the player's rating after a rating period containing
+// results, following Glickman's "Example of the Glicko-2 system".
+func Update(player Rating, results []Result) Rating {
+	mu := (player.Rating - DefaultRating) / glickoScale
+	phi := player.RD / glickoScale
+	sigma := player.Volatility
+
+	if len(results) == 0 {
+		phiStar := math.Sqrt(phi*phi + sigma*sigma)
+		return Rating{
+			Rating:     player.Rating,
+			RD:         clampRD(phiStar * glickoScale),
+			Volatility: sigma,
+		}
+	}
+
+	var vInv, deltaSum float64
+	for _, r := range results {
+		muJ := (r.Opponent.Rating - DefaultRating) / glickoScale
+		phiJ := r.Opponent.RD / glickoScale
+		gJ := g(phiJ)
+		e := expected(mu, muJ, gJ)
+
+		vInv += gJ * gJ * e * (1 - e)
+		deltaSum += gJ * (r.Score - e)
+	}
+	v := 1 / vInv
+	delta := v * deltaSum
+
+	newSigma := newVolatility(sigma, phi, v, delta)
+
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*deltaSum
+
+	return Rating{
+		Rating:     newMu*glickoScale + DefaultRating,
+		RD:         clampRD(newPhi * glickoScale),
+		Volatility: newSigma,
+	}
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, gJ float64) float64 {
+	return 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+}
+
+// newVolatility solves for the new volatility with the Illinois algorithm.
+func newVolatility(sigma, phi, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		num := ex * (delta*delta - phi*phi - v - ex)
+		den := 2 * math.Pow(phi*phi+v+ex, 2)
+		return num/den - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > convergence {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
+
+func clampRD(rd float64) float64 {
+	return math.Max(MinRD, math.Min(MaxRD, rd))
+}
@@ -0,0 +1,124 @@
+package rating
+
+import (
+	"context"
+
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+// Unrated categories never change a player's rating.
+const categoryUnlimited = "unlimited"
+
+// Game is the finished game a rating update is computed from.
+type Game struct {
+	ID          string
+	WhiteUserID string
+	BlackUserID string
+	Category    string
+	Outcome     string
+	// Leaver is the player who abandoned the game, if any. The leaver is
+	// scored as having lost regardless of Outcome.
+	Leaver string
+	Rated  bool
+	Plies  int
+}
+
+type Service struct {
+	ratingStore store.RatingStore
+}
+
+func NewService(ratingStore store.RatingStore) *Service {
+	return &Service{ratingStore: ratingStore}
+}
+
+// Current returns the user's rating in category, or the default rating if
+// they have not played a rated game in it yet.
+func (s *Service) Current(ctx context.Context, userID string, category string) (Rating, error) {
+	r, err := s.ratingStore.GetRating(ctx, userID, category)
+	if err != nil {
+		return Default(), err
+	}
+	if r == nil {
+		return Default(), nil
+	}
+	return Rating{Rating: r.Rating, RD: r.RD, Volatility: r.Volatility}, nil
+}
+
+// Ratings returns every category the user has a rating in.
+func (s *Service) Ratings(ctx context.Context, userID string) ([]store.Rating, error) {
+	ratings, err := s.ratingStore.GetRatings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ratings {
+		ratings[i].Provisional = ratings[i].RD > ProvisionalRD
+	}
+	return ratings, nil
+}
+
+func (s *Service) History(ctx context.Context, userID string, category string, limit int) ([]store.RatingHistoryEntry, error) {
+	return s.ratingStore.GetRatingHistory(ctx, userID, category, limit)
+}
+
+// RecordGame updates both players' ratings after a rated game. Games that
+// were aborted before both sides moved are ignored unless someone left.
+func (s *Service) RecordGame(ctx context.Context, game Game) error {
+	if !game.Rated || game.Category == categoryUnlimited || game.WhiteUserID == game.BlackUserID {
+		return nil
+	}
+	if game.Plies < 2 && game.Leaver == "" {
+		return nil
+	}
+
+	whiteScore, ok := whiteScore(game)
+	if !ok {
+		return nil
+	}
+
+	white, err := s.Current(ctx, game.WhiteUserID, game.Category)
+	if err != nil {
+		return err
+	}
+	black, err := s.Current(ctx, game.BlackUserID, game.Category)
+	if err != nil {
+		return err
+	}
+
+	newWhite := Update(white, []Result{{Opponent: black, Score: whiteScore}})
+	newBlack := Update(black, []Result{{Opponent: white, Score: 1 - whiteScore}})
+
+	return s.ratingStore.ApplyRatingUpdates(ctx, game.ID, []store.RatingUpdate{
+		toUpdate(game.WhiteUserID, game.Category, white, newWhite),
+		toUpdate(game.BlackUserID, game.Category, black, newBlack),
+	})
+}
+
+func whiteScore(game Game) (float64, bool) {
+	switch game.Leaver {
+	case game.WhiteUserID:
+		return 0, true
+	case game.BlackUserID:
+		return 1, true
+	}
+
+	switch game.Outcome {
+	case "1-0":
+		return 1, true
+	case "0-1":
+		return 0, true
+	case "1/2-1/2":
+		return 0.5, true
+	}
+	return 0, false
+}
+
+func toUpdate(userID, category string, before, after Rating) store.RatingUpdate {
+	return store.RatingUpdate{
+		UserID:     userID,
+		Category:   category,
+		Rating:     after.Rating,
+		RD:         after.RD,
+		Volatility: after.Volatility,
+		Change:     after.Rating - before.Rating,
+	}
+}
@@ -10,6 +10,7 @@ func SetUpRoutes(app *app.Application) *http.ServeMux {
 	router := http.NewServeMux()
 
 	router.HandleFunc("/ws", app.WebSocketHandler.WsHandler)
+	router.HandleFunc("/ws/watch/{gameID}", app.WebSocketHandler.WatchHandler)
 	router.HandleFunc("GET /auth/google", app.AuthHandler.HandleGoogleLogin)
 	router.HandleFunc("GET /auth/google/callback", app.AuthHandler.HandleGoogleCallback)
 	router.HandleFunc("POST /auth/logout", app.AuthHandler.HandleLogout)
@@ -18,6 +19,107 @@ func SetUpRoutes(app *app.Application) *http.ServeMux {
 		http.HandlerFunc(app.AuthHandler.HandleMe),
 	))
 
+	router.HandleFunc("GET /users/{id}", app.UserHandler.HandleGetProfile)
+	router.HandleFunc("GET /users/{id}/ratings/history", app.UserHandler.HandleGetRatingHistory)
+	router.HandleFunc("GET /users/{id}/games", app.GameHandler.HandleListUserGames)
+	router.HandleFunc("GET /users/{id}/games/pgn", app.GameHandler.HandleExportUserPGN)
+
+	router.HandleFunc("GET /games/{id}", app.GameHandler.HandleGetGame)
+	router.HandleFunc("GET /games/{id}/pgn", app.GameHandler.HandleGetPGN)
+	router.HandleFunc("GET /games/{id}/analysis", app.GameHandler.HandleGetAnalysis)
+	router.Handle("POST /games/{id}/move", app.JWTService.Middleware(
+		http.HandlerFunc(app.GameHandler.HandleMove),
+	))
+	router.Handle("GET /games/{id}/conditional-moves", app.JWTService.Middleware(
+		http.HandlerFunc(app.GameHandler.HandleGetConditionalMoves),
+	))
+	router.Handle("PUT /games/{id}/conditional-moves", app.JWTService.Middleware(
+		http.HandlerFunc(app.GameHandler.HandleSetConditionalMoves),
+	))
+	router.Handle("GET /games/correspondence", app.JWTService.Middleware(
+		http.HandlerFunc(app.GameHandler.HandleListCorrespondence),
+	))
+
+	router.Handle("POST /challenges", app.JWTService.Middleware(
+		http.HandlerFunc(app.ChallengeHandler.HandleCreate),
+	))
+	router.Handle("GET /challenges", app.JWTService.Middleware(
+		http.HandlerFunc(app.ChallengeHandler.HandleList),
+	))
+	router.HandleFunc("GET /challenges/{code}", app.ChallengeHandler.HandleGet)
+	router.Handle("POST /challenges/{code}/accept", app.JWTService.Middleware(
+		http.HandlerFunc(app.ChallengeHandler.HandleAccept),
+	))
+	router.Handle("POST /challenges/{code}/decline", app.JWTService.Middleware(
+		http.HandlerFunc(app.ChallengeHandler.HandleDecline),
+	))
+	router.Handle("POST /challenges/{code}/cancel", app.JWTService.Middleware(
+		http.HandlerFunc(app.ChallengeHandler.HandleCancel),
+	))
+
+	router.Handle("POST /tournaments", app.JWTService.Middleware(
+		http.HandlerFunc(app.TournamentHandler.HandleCreate),
+	))
+	router.HandleFunc("GET /tournaments", app.TournamentHandler.HandleList)
+	router.HandleFunc("GET /tournaments/{id}", app.TournamentHandler.HandleGet)
+	router.HandleFunc("GET /tournaments/{id}/bracket", app.TournamentHandler.HandleGetBracket)
+	router.Handle("POST /tournaments/{id}/join", app.JWTService.Middleware(
+		http.HandlerFunc(app.TournamentHandler.HandleJoin),
+	))
+	router.Handle("POST /tournaments/{id}/withdraw", app.JWTService.Middleware(
+		http.HandlerFunc(app.TournamentHandler.HandleWithdraw),
+	))
+	router.Handle("POST /tournaments/{id}/start", app.JWTService.Middleware(
+		http.HandlerFunc(app.TournamentHandler.HandleStart),
+	))
+	router.Handle("POST /tournaments/{id}/berserk", app.JWTService.Middleware(
+		http.HandlerFunc(app.TournamentHandler.HandleBerserk),
+	))
+
+	router.Handle("POST /bots", app.JWTService.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleCreateBot),
+	))
+	router.Handle("GET /bots", app.JWTService.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleListBots),
+	))
+	router.Handle("POST /bots/{id}/token", app.JWTService.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleRegenerateToken),
+	))
+
+	router.Handle("GET /api/bot/stream/event", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleStreamEvents),
+	))
+	router.Handle("GET /api/bot/game/stream/{gameID}", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleStreamGame),
+	))
+	router.Handle("POST /api/bot/game/{gameID}/move/{move}", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleMove),
+	))
+	router.Handle("POST /api/bot/game/{gameID}/resign", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleResign),
+	))
+	router.Handle("POST /api/bot/game/{gameID}/claim-victory", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleClaimVictory),
+	))
+	router.Handle("POST /api/bot/game/{gameID}/claim-draw", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleClaimDraw),
+	))
+	router.Handle("POST /api/bot/game/{gameID}/chat", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleChat),
+	))
+	router.Handle("POST /api/bot/challenge/{code}/accept", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleAcceptChallenge),
+	))
+	router.Handle("POST /api/bot/challenge/{code}/decline", app.APITokens.Middleware(
+		http.HandlerFunc(app.BotHandler.HandleDeclineChallenge),
+	))
+
+	router.Handle("GET /admin/moves/dead-letters", app.JWTService.Middleware(
+		http.HandlerFunc(app.AdminHandler.HandleListDeadMoves),
+	))
+	router.Handle("POST /admin/moves/dead-letters/{id}/replay", app.JWTService.Middleware(
+		http.HandlerFunc(app.AdminHandler.HandleReplayDeadMove),
+	))
+
 	return router
 }
-
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAnalysisNotFound = errors.New("analysis not found")
+)
+
+const (
+	AnalysisPending   = "pending"
+	AnalysisRunning   = "running"
+	AnalysisCompleted = "completed"
+	AnalysisFailed    = "failed"
+)
+
+// Analysis is the engine review of a finished game. Accuracies are nil
+// until the analysis completes, or when the player made no move.
+type Analysis struct {
+	GameID        string         `json:"game_id"`
+	Status        string         `json:"status"`
+	Depth         int            `json:"depth"`
+	WhiteAccuracy *float64       `json:"white_accuracy"`
+	BlackAccuracy *float64       `json:"black_accuracy"`
+	Error         string         `json:"error,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	CompletedAt   *time.Time     `json:"completed_at,omitempty"`
+	Moves         []MoveAnalysis `json:"moves"`
+}
+
+// MoveAnalysis is the evaluation of the position after a move, from White's
+// point of view, and the engine's preferred move in the position before it.
+// EvalMate is 0 when the move delivered checkmate.
+type MoveAnalysis struct {
+	Ply            int      `json:"ply"`
+	Move           string   `json:"move"`
+	SAN            string   `json:"san"`
+	EvalCP         *int     `json:"eval_cp"`
+	EvalMate       *int     `json:"eval_mate"`
+	BestMove       string   `json:"best_move"`
+	BestLine       []string `json:"best_line"`
+	Classification string   `json:"classification,omitempty"`
+}
+
+type AnalysisStore interface {
+	CreateAnalysis(ctx context.Context, gameID string) (bool, error)
+	UpdateAnalysisStatus(ctx context.Context, gameID string, status string, message string) error
+	SaveAnalysis(ctx context.Context, analysis *Analysis) error
+	GetAnalysis(ctx context.Context, gameID string) (*Analysis, error)
+	ResetStaleAnalyses(ctx context.Context, startedBefore time.Time) ([]string, error)
+}
+
+type PostgresAnalysisStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAnalysisStore(db *sql.DB) *PostgresAnalysisStore {
+	return &PostgresAnalysisStore{db: db}
+}
+
+// CreateAnalysis adds a pending analysis for the game. It reports false if
+// the game already has one, so a game is never queued twice.
+func (s *PostgresAnalysisStore) CreateAnalysis(ctx context.Context, gameID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO game_analysis (game_id, status)
+		VALUES ($1, $2)
+		ON CONFLICT (game_id) DO NOTHING
+	`, gameID, AnalysisPending)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UpdateAnalysisStatus sets the analysis status. Marking it running also
+// records when it started, so a worker that died mid-job can be detected.
+func (s *PostgresAnalysisStore) UpdateAnalysisStatus(ctx context.Context, gameID string, status string, message string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE game_analysis
+		SET status = $2, error = $3, started_at = CASE WHEN $4 THEN NOW() ELSE started_at END
+		WHERE game_id = $1
+	`, gameID, status, message, status == AnalysisRunning)
+	return err
+}
+
+// ResetStaleAnalyses sets the analyses running since before startedBefore
+// back to pending and returns their games. Each is returned to one caller
+// only, so replicas do not queue it twice.
+func (s *PostgresAnalysisStore) ResetStaleAnalyses(ctx context.Context, startedBefore time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE game_analysis
+		SET status = $1, started_at = NULL
+		WHERE status = $2 AND (started_at IS NULL OR started_at < $3)
+		RETURNING game_id
+	`, AnalysisPending, AnalysisRunning, startedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gameIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		gameIDs = append(gameIDs, id)
+	}
+	return gameIDs, rows.Err()
+}
+
+// SaveAnalysis replaces the game's move evaluations and marks its analysis
+// completed in one transaction.
+func (s *PostgresAnalysisStore) SaveAnalysis(ctx context.Context, analysis *Analysis) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE game_analysis
+		SET status = $2, depth = $3, white_accuracy = $4, black_accuracy = $5, error = '', completed_at = NOW()
+		WHERE game_id = $1
+	`, analysis.GameID, AnalysisCompleted, analysis.Depth, analysis.WhiteAccuracy, analysis.BlackAccuracy)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM move_analysis WHERE game_id = $1`, analysis.GameID); err != nil {
+		return err
+	}
+
+	for _, m := range analysis.Moves {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO move_analysis (game_id, ply, move, san, eval_cp, eval_mate, best_move, best_line, classification)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, analysis.GameID, m.Ply, m.Move, m.SAN, m.EvalCP, m.EvalMate, m.BestMove, strings.Join(m.BestLine, " "), m.Classification)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresAnalysisStore) GetAnalysis(ctx context.Context, gameID string) (*Analysis, error) {
+	var a Analysis
+	var whiteAccuracy, blackAccuracy sql.NullFloat64
+	var completedAt sql.NullTime
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT game_id, status, depth, white_accuracy, black_accuracy, error, created_at, completed_at
+		FROM game_analysis
+		WHERE game_id = $1
+	`, gameID).Scan(&a.GameID, &a.Status, &a.Depth, &whiteAccuracy, &blackAccuracy, &a.Error, &a.CreatedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAnalysisNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if whiteAccuracy.Valid {
+		a.WhiteAccuracy = &whiteAccuracy.Float64
+	}
+	if blackAccuracy.Valid {
+		a.BlackAccuracy = &blackAccuracy.Float64
+	}
+	if completedAt.Valid {
+		a.CompletedAt = &completedAt.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ply, move, san, eval_cp, eval_mate, best_move, best_line, classification
+		FROM move_analysis
+		WHERE game_id = $1
+		ORDER BY ply
+	`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	a.Moves = []MoveAnalysis{}
+	for rows.Next() {
+		var m MoveAnalysis
+		var evalCP, evalMate sql.NullInt64
+		var bestLine string
+		if err := rows.Scan(&m.Ply, &m.Move, &m.SAN, &evalCP, &evalMate, &m.BestMove, &bestLine, &m.Classification); err != nil {
+			return nil, err
+		}
+		if evalCP.Valid {
+			cp := int(evalCP.Int64)
+			m.EvalCP = &cp
+		}
+		if evalMate.Valid {
+			mate := int(evalMate.Int64)
+			m.EvalMate = &mate
+		}
+		m.BestLine = strings.Fields(bestLine)
+		a.Moves = append(a.Moves, m)
+	}
+	return &a, rows.Err()
+}
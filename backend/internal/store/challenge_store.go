@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrChallengeNotFound    = errors.New("challenge not found")
+	ErrChallengeUnavailable = errors.New("challenge is no longer available")
+)
+
+const (
+	ChallengeOpen      = "open"
+	ChallengeAccepted  = "accepted"
+	ChallengeDeclined  = "declined"
+	ChallengeCancelled = "cancelled"
+	// ChallengeExpired is never stored; it is reported for open challenges
+	// past their expiry.
+	ChallengeExpired = "expired"
+)
+
+type Challenge struct {
+	ID           string         `json:"id"`
+	Code         string         `json:"code"`
+	ChallengerID string         `json:"challenger_id"`
+	DestUserID   sql.NullString `json:"dest_user_id"`
+	AcceptedBy   sql.NullString `json:"accepted_by"`
+	TimeControl  string         `json:"time_control"`
+	Variant      string         `json:"variant"`
+	InitialFEN   string         `json:"initial_fen,omitempty"`
+	Color        string         `json:"color"`
+	Rated        bool           `json:"rated"`
+	Status       string         `json:"status"`
+	GameID       sql.NullString `json:"game_id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+}
+
+type ChallengeStore interface {
+	CreateChallenge(ctx context.Context, challenge *Challenge) (*Challenge, error)
+	GetChallengeByCode(ctx context.Context, code string) (*Challenge, error)
+	ListChallengesForUser(ctx context.Context, userID string) ([]Challenge, error)
+	AcceptChallenge(ctx context.Context, code string, userID string, gameID string) (*Challenge, error)
+	ReopenChallenge(ctx context.Context, code string) error
+	DeclineChallenge(ctx context.Context, code string, userID string) (*Challenge, error)
+	CancelChallenge(ctx context.Context, code string, userID string) (*Challenge, error)
+}
+
+type PostgresChallengeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChallengeStore(db *sql.DB) *PostgresChallengeStore {
+	return &PostgresChallengeStore{db: db}
+}
+
+const challengeColumns = `id, code, challenger_id, dest_user_id, accepted_by, time_control, variant, initial_fen, color, rated, status, game_id, created_at, expires_at`
+
+func scanChallenge(row interface{ Scan(...any) error }) (*Challenge, error) {
+	var c Challenge
+	err := row.Scan(&c.ID, &c.Code, &c.ChallengerID, &c.DestUserID, &c.AcceptedBy, &c.TimeControl, &c.Variant, &c.InitialFEN, &c.Color, &c.Rated, &c.Status, &c.GameID, &c.CreatedAt, &c.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == ChallengeOpen && time.Now().After(c.ExpiresAt) {
+		c.Status = ChallengeExpired
+	}
+	return &c, nil
+}
+
+func (s *PostgresChallengeStore) CreateChallenge(ctx context.Context, challenge *Challenge) (*Challenge, error) {
+	query := `
+		INSERT INTO challenges (code, challenger_id, dest_user_id, time_control, variant, initial_fen, color, rated, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + challengeColumns
+
+	return scanChallenge(s.db.QueryRowContext(ctx, query,
+		challenge.Code,
+		challenge.ChallengerID,
+		challenge.DestUserID,
+		challenge.TimeControl,
+		challenge.Variant,
+		challenge.InitialFEN,
+		challenge.Color,
+		challenge.Rated,
+		challenge.ExpiresAt,
+	))
+}
+
+func (s *PostgresChallengeStore) GetChallengeByCode(ctx context.Context, code string) (*Challenge, error) {
+	query := `SELECT ` + challengeColumns + ` FROM challenges WHERE code = $1`
+
+	c, err := scanChallenge(s.db.QueryRowContext(ctx, query, code))
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeNotFound
+	}
+	return c, err
+}
+
+// ListChallengesForUser returns the open challenges the user created or
+// received, newest first.
+func (s *PostgresChallengeStore) ListChallengesForUser(ctx context.Context, userID string) ([]Challenge, error) {
+	var challenges []Challenge
+
+	query := `
+		SELECT ` + challengeColumns + `
+		FROM challenges
+		WHERE (challenger_id = $1 OR dest_user_id = $1)
+			AND status = 'open' AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanChallenge(rows)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, *c)
+	}
+	return challenges, rows.Err()
+}
+
+// AcceptChallenge atomically claims an open, unexpired challenge for userID
+// so that only the first acceptor gets the game. It returns
+// ErrChallengeUnavailable if the challenge cannot be accepted by userID.
+func (s *PostgresChallengeStore) AcceptChallenge(ctx context.Context, code string, userID string, gameID string) (*Challenge, error) {
+	query := `
+		UPDATE challenges
+		SET status = 'accepted', accepted_by = $2, game_id = $3
+		WHERE code = $1
+			AND status = 'open'
+			AND expires_at > NOW()
+			AND challenger_id <> $2
+			AND (dest_user_id IS NULL OR dest_user_id = $2)
+		RETURNING ` + challengeColumns
+
+	c, err := scanChallenge(s.db.QueryRowContext(ctx, query, code, userID, gameID))
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeUnavailable
+	}
+	return c, err
+}
+
+// ReopenChallenge undoes an acceptance whose game could not be started.
+func (s *PostgresChallengeStore) ReopenChallenge(ctx context.Context, code string) error {
+	query := `
+		UPDATE challenges
+		SET status = 'open', accepted_by = NULL, game_id = NULL
+		WHERE code = $1 AND status = 'accepted'
+	`
+
+	_, err := s.db.ExecContext(ctx, query, code)
+	return err
+}
+
+// DeclineChallenge closes a challenge addressed to userID.
+func (s *PostgresChallengeStore) DeclineChallenge(ctx context.Context, code string, userID string) (*Challenge, error) {
+	return s.closeChallenge(ctx, code, "dest_user_id", userID, ChallengeDeclined)
+}
+
+// CancelChallenge closes a challenge created by userID.
+func (s *PostgresChallengeStore) CancelChallenge(ctx context.Context, code string, userID string) (*Challenge, error) {
+	return s.closeChallenge(ctx, code, "challenger_id", userID, ChallengeCancelled)
+}
+
+func (s *PostgresChallengeStore) closeChallenge(ctx context.Context, code string, ownerColumn string, userID string, status string) (*Challenge, error) {
+	query := `
+		UPDATE challenges
+		SET status = $3
+		WHERE code = $1 AND ` + ownerColumn + ` = $2 AND status = 'open'
+		RETURNING ` + challengeColumns
+
+	c, err := scanChallenge(s.db.QueryRowContext(ctx, query, code, userID, status))
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeUnavailable
+	}
+	return c, err
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ChatMessage struct {
+	ID        int64     `json:"id"`
+	GameID    string    `json:"game_id"`
+	UserID    string    `json:"user_id"`
+	Room      string    `json:"room"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ChatStore interface {
+	InsertChatMessage(ctx context.Context, msg *ChatMessage) error
+	GetChatMessages(ctx context.Context, gameID string, room string) ([]ChatMessage, error)
+	MuteUser(ctx context.Context, userID string, mutedUserID string) error
+	UnmuteUser(ctx context.Context, userID string, mutedUserID string) error
+	GetMutedUserIDs(ctx context.Context, userID string) ([]string, error)
+}
+
+type PostgresChatStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChatStore(db *sql.DB) *PostgresChatStore {
+	return &PostgresChatStore{db: db}
+}
+
+// InsertChatMessage stores msg and sets its ID and creation time.
+func (s *PostgresChatStore) InsertChatMessage(ctx context.Context, msg *ChatMessage) error {
+	query := `
+		INSERT INTO chat_messages (game_id, user_id, room, text)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	return s.db.QueryRowContext(ctx, query, msg.GameID, msg.UserID, msg.Room, msg.Text).Scan(&msg.ID, &msg.CreatedAt)
+}
+
+func (s *PostgresChatStore) GetChatMessages(ctx context.Context, gameID string, room string) ([]ChatMessage, error) {
+	var messages []ChatMessage
+
+	query := `
+		SELECT id, game_id, user_id, room, text, created_at
+		FROM chat_messages
+		WHERE game_id = $1 AND room = $2
+		ORDER BY created_at, id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, gameID, room)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m ChatMessage
+		if err := rows.Scan(&m.ID, &m.GameID, &m.UserID, &m.Room, &m.Text, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *PostgresChatStore) MuteUser(ctx context.Context, userID string, mutedUserID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO chat_mutes (user_id, muted_user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, mutedUserID)
+	return err
+}
+
+func (s *PostgresChatStore) UnmuteUser(ctx context.Context, userID string, mutedUserID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM chat_mutes WHERE user_id = $1 AND muted_user_id = $2`, userID, mutedUserID)
+	return err
+}
+
+func (s *PostgresChatStore) GetMutedUserIDs(ctx context.Context, userID string) ([]string, error) {
+	var ids []string
+
+	rows, err := s.db.QueryContext(ctx, `SELECT muted_user_id FROM chat_mutes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
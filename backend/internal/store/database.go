@@ -73,4 +73,3 @@ func Migrate(db *sql.DB, dir string) error {
 
 	return nil
 }
-
@@ -3,27 +3,76 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/Adi-ty/chess/internal/queue"
 )
 
+var (
+	ErrGameNotFound = errors.New("game not found")
+	// ErrMoveOutOfOrder is returned by ApplyMove for a write whose game is
+	// still waiting for an earlier one.
+	ErrMoveOutOfOrder = errors.New("an earlier move of the game is not written yet")
+)
+
 type Game struct {
-	ID          string         `json:"id"`
-	WhiteUserID string         `json:"white_user_id"`
-	BlackUserID string         `json:"black_user_id"`
-	Status      string         `json:"status"`
-	Outcome     string         `json:"outcome,omitempty"`
-	Method      string         `json:"method,omitempty"`
-	StartedAt   string         `json:"started_at"`
-	EndedAt     sql.NullString `json:"ended_at,omitempty"`
+	ID           string         `json:"id"`
+	WhiteUserID  string         `json:"white_user_id"`
+	BlackUserID  string         `json:"black_user_id"`
+	Status       string         `json:"status"`
+	Outcome      string         `json:"outcome,omitempty"`
+	Method       string         `json:"method,omitempty"`
+	Rated        bool           `json:"rated"`
+	TimeControl  string         `json:"time_control"`
+	TimeCategory string         `json:"time_category"`
+	Variant      string         `json:"variant"`
+	InitialFEN   string         `json:"initial_fen,omitempty"`
+	PGN          string         `json:"-"`
+	StartedAt    string         `json:"started_at"`
+	EndedAt      sql.NullString `json:"ended_at,omitempty"`
+	// ToMoveUserID and MoveDeadline are set for in-progress correspondence
+	// games: the player to move must do so before the deadline.
+	ToMoveUserID string     `json:"to_move_user_id,omitempty"`
+	MoveDeadline *time.Time `json:"move_deadline,omitempty"`
+	// WhiteName and BlackName are only filled by queries that join users.
+	WhiteName string `json:"white_name,omitempty"`
+	BlackName string `json:"black_name,omitempty"`
 }
 
 type GameStore interface {
 	CreateGame(ctx context.Context, game *Game) (*Game, error)
-	GetGameByUserID(ctx context.Context, id string) (*Game, error)
+	GetGameByID(ctx context.Context, id string) (*Game, error)
+	ListActiveGamesByUserID(ctx context.Context, userID string) ([]Game, error)
+	ListActiveGames(ctx context.Context) ([]Game, error)
+	ListOverdueGames(ctx context.Context, now time.Time) ([]Game, error)
 	UpdateGameStatus(ctx context.Context, id string, status string, outcome string, method string, endedAt string) error
-	InsertMove(ctx context.Context, payload queue.MovePayload) error
+	ApplyMove(ctx context.Context, payload queue.MovePayload) error
 	GetMovesByGameID(ctx context.Context, gameID string) ([]queue.MovePayload, error)
+	GetMoveSeq(ctx context.Context, gameID string) (int64, error)
+	ResetMoves(ctx context.Context, gameID string, moves []queue.MovePayload, seq int64) error
+	UpdateGamePGN(ctx context.Context, id string, pgn string) error
+	StreamGamesByUserID(ctx context.Context, userID string, fn func(*Game) error) error
+	ListGamesByUserID(ctx context.Context, userID string, filter GameFilter) ([]Game, error)
+	UpdateMoveDeadline(ctx context.Context, id string, toMoveUserID string, deadline time.Time) error
+	ListCorrespondenceGames(ctx context.Context, userID string) ([]Game, error)
+	SaveConditionalMoves(ctx context.Context, gameID string, userID string, lines [][]string) error
+	GetConditionalMoves(ctx context.Context, gameID string) (map[string][][]string, error)
+}
+
+// GameFilter narrows a user's game history. Empty fields match every game.
+// Result and Color are relative to the user whose games are listed.
+type GameFilter struct {
+	Result       string // "win", "loss" or "draw"
+	Color        string // "white" or "black"
+	TimeControl  string
+	TimeCategory string
+	OpponentID   string
+	From         time.Time
+	To           time.Time
+	Limit        int
+	Offset       int
 }
 
 type PostgresGameStore struct {
@@ -38,9 +87,9 @@ func (s *PostgresGameStore) CreateGame(ctx context.Context, game *Game) (*Game,
 	var g Game
 
 	query := `
-		INSERT INTO games (id, white_user_id, black_user_id, status, started_at, ended_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, white_user_id, black_user_id, status, started_at, ended_at
+		INSERT INTO games (id, white_user_id, black_user_id, status, rated, time_control, time_category, variant, initial_fen, started_at, ended_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING id, white_user_id, black_user_id, status, rated, time_control, time_category, variant, initial_fen, started_at, ended_at
 	`
 
 	err := s.db.QueryRowContext(ctx, query,
@@ -48,9 +97,14 @@ func (s *PostgresGameStore) CreateGame(ctx context.Context, game *Game) (*Game,
 		game.WhiteUserID,
 		game.BlackUserID,
 		game.Status,
+		game.Rated,
+		game.TimeControl,
+		game.TimeCategory,
+		game.Variant,
+		game.InitialFEN,
 		game.StartedAt,
 		game.EndedAt,
-	).Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.StartedAt, &g.EndedAt)
+	).Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.StartedAt, &g.EndedAt)
 
 	if err != nil {
 		return nil, err
@@ -59,29 +113,133 @@ func (s *PostgresGameStore) CreateGame(ctx context.Context, game *Game) (*Game,
 	return &g, nil
 }
 
-func (s *PostgresGameStore) GetGameByUserID(ctx context.Context, id string) (*Game, error) {
+func (s *PostgresGameStore) GetGameByID(ctx context.Context, id string) (*Game, error) {
 	var g Game
 
 	query := `
-        SELECT id, white_user_id, black_user_id, status, started_at, ended_at
+        SELECT id, white_user_id, black_user_id, status, COALESCE(outcome, ''), COALESCE(method, ''), rated, time_control, time_category, variant, initial_fen, pgn, started_at, ended_at,
+            COALESCE(to_move_user_id::text, ''), move_deadline
         FROM games
-        WHERE (white_user_id = $1 OR black_user_id = $1) AND status = 'in_progress'
-        ORDER BY started_at DESC
-        LIMIT 1
+        WHERE id = $1
     `
 
-	row := s.db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.StartedAt, &g.EndedAt)
+	var deadline sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Outcome, &g.Method, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.PGN, &g.StartedAt, &g.EndedAt,
+		&g.ToMoveUserID, &deadline)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if deadline.Valid {
+		g.MoveDeadline = &deadline.Time
+	}
 
 	return &g, nil
 }
 
+// ListActiveGamesByUserID returns every in-progress game the user plays in,
+// the most recent first.
+func (s *PostgresGameStore) ListActiveGamesByUserID(ctx context.Context, userID string) ([]Game, error) {
+	var games []Game
+
+	query := `
+        SELECT id, white_user_id, black_user_id, status, rated, time_control, time_category, variant, initial_fen, started_at, ended_at,
+            COALESCE(to_move_user_id::text, ''), move_deadline
+        FROM games
+        WHERE (white_user_id = $1 OR black_user_id = $1) AND status = 'in_progress'
+        ORDER BY started_at DESC
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Game
+		var deadline sql.NullTime
+		if err := rows.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.StartedAt, &g.EndedAt,
+			&g.ToMoveUserID, &deadline); err != nil {
+			return nil, err
+		}
+		if deadline.Valid {
+			g.MoveDeadline = &deadline.Time
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// ListActiveGames returns every in-progress game, oldest first.
+func (s *PostgresGameStore) ListActiveGames(ctx context.Context) ([]Game, error) {
+	var games []Game
+
+	query := `
+        SELECT id, white_user_id, black_user_id, status, rated, time_control, time_category, variant, initial_fen, started_at, ended_at,
+            COALESCE(to_move_user_id::text, ''), move_deadline
+        FROM games
+        WHERE status = 'in_progress'
+        ORDER BY started_at
+    `
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Game
+		var deadline sql.NullTime
+		if err := rows.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.StartedAt, &g.EndedAt,
+			&g.ToMoveUserID, &deadline); err != nil {
+			return nil, err
+		}
+		if deadline.Valid {
+			g.MoveDeadline = &deadline.Time
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// ListOverdueGames returns the in-progress correspondence games whose player
+// to move missed their deadline before now, most overdue first.
+func (s *PostgresGameStore) ListOverdueGames(ctx context.Context, now time.Time) ([]Game, error) {
+	var games []Game
+
+	query := `
+        SELECT id, white_user_id, black_user_id, status, rated, time_control, time_category, variant, initial_fen, started_at, ended_at,
+            COALESCE(to_move_user_id::text, ''), move_deadline
+        FROM games
+        WHERE status = 'in_progress' AND move_deadline < $1
+        ORDER BY move_deadline
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Game
+		var deadline sql.NullTime
+		if err := rows.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.StartedAt, &g.EndedAt,
+			&g.ToMoveUserID, &deadline); err != nil {
+			return nil, err
+		}
+		if deadline.Valid {
+			g.MoveDeadline = &deadline.Time
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
 func (s *PostgresGameStore) UpdateGameStatus(ctx context.Context, id string, status string, outcome string, method string, endedAt string) error {
 	query := `
 		UPDATE games
@@ -115,12 +273,306 @@ func (s *PostgresGameStore) GetMovesByGameID(ctx context.Context, gameID string)
 	return moves, nil
 }
 
-func (s *PostgresGameStore) InsertMove(ctx context.Context, payload queue.MovePayload) error {
+// ApplyMove writes a queued move, or deletes the moves a takeback undid.
+// Writes numbered with Seq are applied once each and in order: one already
+// applied is ignored, and one whose game is still waiting for an earlier
+// write returns ErrMoveOutOfOrder, so a late takeback cannot delete the move
+// that replaced the one it undid.
+func (s *PostgresGameStore) ApplyMove(ctx context.Context, payload queue.MovePayload) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if payload.Seq > 0 {
+		var applied int64
+		err := tx.QueryRowContext(ctx, `SELECT move_seq FROM games WHERE id = $1 FOR UPDATE`, payload.GameID).Scan(&applied)
+		if err == sql.ErrNoRows {
+			return ErrGameNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if payload.Seq <= applied {
+			return nil
+		}
+		if payload.Seq > applied+1 {
+			return ErrMoveOutOfOrder
+		}
+	}
+
+	if payload.Action == queue.ActionTakeback {
+		query := `DELETE FROM moves WHERE game_id = $1 AND move_number >= $2`
+		_, err = tx.ExecContext(ctx, query, payload.GameID, payload.MoveNumber)
+	} else {
+		query := `
+			INSERT INTO moves (game_id, user_id, move_number, move, created_at)
+			VALUES ($1, $2, $3, $4, to_timestamp($5))
+			ON CONFLICT (game_id, move_number) DO UPDATE
+			SET user_id = EXCLUDED.user_id, move = EXCLUDED.move, created_at = EXCLUDED.created_at
+		`
+		_, err = tx.ExecContext(ctx, query, payload.GameID, payload.UserID, payload.MoveNumber, payload.Move, payload.CreatedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	if payload.Seq > 0 {
+		query := `UPDATE games SET move_seq = $2 WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, query, payload.GameID, payload.Seq); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetMoveSeq returns the number of the last queued write ApplyMove applied
+// to the game.
+func (s *PostgresGameStore) GetMoveSeq(ctx context.Context, gameID string) (int64, error) {
+	var seq int64
+	err := s.db.QueryRowContext(ctx, `SELECT move_seq FROM games WHERE id = $1`, gameID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, ErrGameNotFound
+	}
+	return seq, err
+}
+
+// ResetMoves replaces the moves of a game with moves, the game's moves
+// after its seq-th queued write, unless a later write was applied already.
+// A game whose write was dead-lettered is brought up to date this way, as
+// its later writes would otherwise wait for it forever.
+func (s *PostgresGameStore) ResetMoves(ctx context.Context, gameID string, moves []queue.MovePayload, seq int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied int64
+	err = tx.QueryRowContext(ctx, `SELECT move_seq FROM games WHERE id = $1 FOR UPDATE`, gameID).Scan(&applied)
+	if err == sql.ErrNoRows {
+		return ErrGameNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if seq <= applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM moves WHERE game_id = $1`, gameID); err != nil {
+		return err
+	}
 	query := `
 		INSERT INTO moves (game_id, user_id, move_number, move, created_at)
 		VALUES ($1, $2, $3, $4, to_timestamp($5))
 	`
-	_, err := s.db.ExecContext(ctx, query, payload.GameID, payload.UserID, payload.MoveNumber, payload.Move, payload.CreatedAt)
+	for _, move := range moves {
+		if _, err := tx.ExecContext(ctx, query, gameID, move.UserID, move.MoveNumber, move.Move, move.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE games SET move_seq = $2 WHERE id = $1`, gameID, seq); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresGameStore) UpdateGamePGN(ctx context.Context, id string, pgn string) error {
+	query := `UPDATE games SET pgn = $1 WHERE id = $2`
+	_, err := s.db.ExecContext(ctx, query, pgn, id)
+	return err
+}
+
+// StreamGamesByUserID calls fn for each finished game of the user, oldest
+// first, without loading them all into memory. It stops at the first error
+// returned by fn.
+func (s *PostgresGameStore) StreamGamesByUserID(ctx context.Context, userID string, fn func(*Game) error) error {
+	query := `
+        SELECT id, white_user_id, black_user_id, status, COALESCE(outcome, ''), COALESCE(method, ''), rated, time_control, time_category, variant, initial_fen, pgn, started_at, ended_at
+        FROM games
+        WHERE (white_user_id = $1 OR black_user_id = $1) AND status <> 'in_progress'
+        ORDER BY started_at
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Game
+		if err := rows.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Outcome, &g.Method, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.PGN, &g.StartedAt, &g.EndedAt); err != nil {
+			return err
+		}
+		if err := fn(&g); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ListGamesByUserID returns a page of the user's games, newest first, with
+// the players' display names.
+func (s *PostgresGameStore) ListGamesByUserID(ctx context.Context, userID string, filter GameFilter) ([]Game, error) {
+	var games []Game
+
+	query := `
+        SELECT g.id, g.white_user_id, g.black_user_id, g.status, COALESCE(g.outcome, ''), COALESCE(g.method, ''),
+            g.rated, g.time_control, g.time_category, g.variant, g.initial_fen, g.started_at, g.ended_at,
+            COALESCE(w.display_name, ''), COALESCE(b.display_name, '')
+        FROM games g
+        LEFT JOIN users w ON w.id = g.white_user_id
+        LEFT JOIN users b ON b.id = g.black_user_id
+        WHERE (g.white_user_id = $1 OR g.black_user_id = $1)
+            AND ($2 = ''
+                OR ($2 = 'white' AND g.white_user_id = $1)
+                OR ($2 = 'black' AND g.black_user_id = $1))
+            AND ($3 = ''
+                OR ($3 = 'win' AND ((g.white_user_id = $1 AND g.outcome = '1-0') OR (g.black_user_id = $1 AND g.outcome = '0-1')))
+                OR ($3 = 'loss' AND ((g.white_user_id = $1 AND g.outcome = '0-1') OR (g.black_user_id = $1 AND g.outcome = '1-0')))
+                OR ($3 = 'draw' AND g.outcome = '1/2-1/2'))
+            AND ($4 = '' OR g.time_control = $4)
+            AND ($5 = '' OR g.time_category = $5)
+            AND ($6::uuid IS NULL OR g.white_user_id = $6::uuid OR g.black_user_id = $6::uuid)
+            AND ($7::timestamptz IS NULL OR g.started_at >= $7::timestamptz)
+            AND ($8::timestamptz IS NULL OR g.started_at < $8::timestamptz)
+        ORDER BY g.started_at DESC, g.id
+        LIMIT $9 OFFSET $10
+    `
+
+	rows, err := s.db.QueryContext(ctx, query,
+		userID,
+		filter.Color,
+		filter.Result,
+		filter.TimeControl,
+		filter.TimeCategory,
+		nullString(filter.OpponentID),
+		nullTime(filter.From),
+		nullTime(filter.To),
+		filter.Limit,
+		filter.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Game
+		err := rows.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Outcome, &g.Method,
+			&g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN, &g.StartedAt, &g.EndedAt,
+			&g.WhiteName, &g.BlackName)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// UpdateMoveDeadline records who is to move in a correspondence game and by
+// when.
+func (s *PostgresGameStore) UpdateMoveDeadline(ctx context.Context, id string, toMoveUserID string, deadline time.Time) error {
+	query := `UPDATE games SET to_move_user_id = $1, move_deadline = $2 WHERE id = $3`
+	_, err := s.db.ExecContext(ctx, query, nullString(toMoveUserID), deadline, id)
 	return err
 }
 
+// ListCorrespondenceGames returns the user's in-progress correspondence
+// games with the players' display names, the most urgent first.
+func (s *PostgresGameStore) ListCorrespondenceGames(ctx context.Context, userID string) ([]Game, error) {
+	var games []Game
+
+	query := `
+        SELECT g.id, g.white_user_id, g.black_user_id, g.status, g.rated, g.time_control, g.time_category, g.variant, g.initial_fen,
+            g.started_at, COALESCE(g.to_move_user_id::text, ''), g.move_deadline,
+            COALESCE(w.display_name, ''), COALESCE(b.display_name, '')
+        FROM games g
+        LEFT JOIN users w ON w.id = g.white_user_id
+        LEFT JOIN users b ON b.id = g.black_user_id
+        WHERE (g.white_user_id = $1 OR g.black_user_id = $1)
+            AND g.status = 'in_progress'
+            AND g.move_deadline IS NOT NULL
+        ORDER BY g.move_deadline, g.id
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Game
+		var deadline sql.NullTime
+		err := rows.Scan(&g.ID, &g.WhiteUserID, &g.BlackUserID, &g.Status, &g.Rated, &g.TimeControl, &g.TimeCategory, &g.Variant, &g.InitialFEN,
+			&g.StartedAt, &g.ToMoveUserID, &deadline,
+			&g.WhiteName, &g.BlackName)
+		if err != nil {
+			return nil, err
+		}
+		if deadline.Valid {
+			g.MoveDeadline = &deadline.Time
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// SaveConditionalMoves replaces the user's conditional move lines in a game.
+// Each line alternates the opponent's moves and the user's replies in UCI.
+func (s *PostgresGameStore) SaveConditionalMoves(ctx context.Context, gameID string, userID string, lines [][]string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM conditional_moves WHERE game_id = $1 AND user_id = $2`, gameID, userID)
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO conditional_moves (game_id, user_id, line, moves)
+			VALUES ($1, $2, $3, $4)
+		`, gameID, userID, i, strings.Join(line, " "))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetConditionalMoves returns the conditional move lines of both players of
+// a game by user.
+func (s *PostgresGameStore) GetConditionalMoves(ctx context.Context, gameID string) (map[string][][]string, error) {
+	query := `SELECT user_id, moves FROM conditional_moves WHERE game_id = $1 ORDER BY user_id, line`
+
+	rows, err := s.db.QueryContext(ctx, query, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[string][][]string)
+	for rows.Next() {
+		var userID, moves string
+		if err := rows.Scan(&userID, &moves); err != nil {
+			return nil, err
+		}
+		lines[userID] = append(lines[userID], strings.Fields(moves))
+	}
+	return lines, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Rating struct {
+	UserID      string    `json:"-"`
+	Category    string    `json:"category"`
+	Rating      float64   `json:"rating"`
+	RD          float64   `json:"rd"`
+	Volatility  float64   `json:"volatility"`
+	Games       int       `json:"games"`
+	Provisional bool      `json:"provisional"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type RatingHistoryEntry struct {
+	GameID    sql.NullString `json:"game_id"`
+	Category  string         `json:"category"`
+	Rating    float64        `json:"rating"`
+	RD        float64        `json:"rd"`
+	Change    float64        `json:"change"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// RatingUpdate is the new rating of one player after a game.
+type RatingUpdate struct {
+	UserID     string
+	Category   string
+	Rating     float64
+	RD         float64
+	Volatility float64
+	Change     float64
+}
+
+type RatingStore interface {
+	GetRatings(ctx context.Context, userID string) ([]Rating, error)
+	GetRating(ctx context.Context, userID string, category string) (*Rating, error)
+	ApplyRatingUpdates(ctx context.Context, gameID string, updates []RatingUpdate) error
+	GetRatingHistory(ctx context.Context, userID string, category string, limit int) ([]RatingHistoryEntry, error)
+}
+
+type PostgresRatingStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRatingStore(db *sql.DB) *PostgresRatingStore {
+	return &PostgresRatingStore{db: db}
+}
+
+func (s *PostgresRatingStore) GetRatings(ctx context.Context, userID string) ([]Rating, error) {
+	var ratings []Rating
+
+	query := `
+		SELECT user_id, category, rating, rd, volatility, games, updated_at
+		FROM ratings
+		WHERE user_id = $1
+		ORDER BY category
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Rating
+		if err := rows.Scan(&r.UserID, &r.Category, &r.Rating, &r.RD, &r.Volatility, &r.Games, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, r)
+	}
+	return ratings, rows.Err()
+}
+
+// GetRating returns nil without an error if the user has no rating in the
+// category yet.
+func (s *PostgresRatingStore) GetRating(ctx context.Context, userID string, category string) (*Rating, error) {
+	var r Rating
+
+	query := `
+		SELECT user_id, category, rating, rd, volatility, games, updated_at
+		FROM ratings
+		WHERE user_id = $1 AND category = $2
+	`
+
+	err := s.db.QueryRowContext(ctx, query, userID, category).Scan(&r.UserID, &r.Category, &r.Rating, &r.RD, &r.Volatility, &r.Games, &r.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ApplyRatingUpdates stores the new ratings of a game's players and their
+// history entries in one transaction. A game already recorded in the history
+// is skipped so a result is never applied twice.
+func (s *PostgresRatingStore) ApplyRatingUpdates(ctx context.Context, gameID string, updates []RatingUpdate) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM rating_history WHERE game_id = $1)`, gameID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	for _, u := range updates {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ratings (user_id, category, rating, rd, volatility, games, updated_at)
+			VALUES ($1, $2, $3, $4, $5, 1, NOW())
+			ON CONFLICT (user_id, category) DO UPDATE SET
+				rating = EXCLUDED.rating,
+				rd = EXCLUDED.rd,
+				volatility = EXCLUDED.volatility,
+				games = ratings.games + 1,
+				updated_at = NOW()
+		`, u.UserID, u.Category, u.Rating, u.RD, u.Volatility)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO rating_history (user_id, category, game_id, rating, rd, volatility, change)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, u.UserID, u.Category, gameID, u.Rating, u.RD, u.Volatility, u.Change)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresRatingStore) GetRatingHistory(ctx context.Context, userID string, category string, limit int) ([]RatingHistoryEntry, error) {
+	var history []RatingHistoryEntry
+
+	query := `
+		SELECT game_id, category, rating, rd, change, created_at
+		FROM rating_history
+		WHERE user_id = $1 AND ($2 = '' OR category = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, category, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h RatingHistoryEntry
+		if err := rows.Scan(&h.GameID, &h.Category, &h.Rating, &h.RD, &h.Change, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
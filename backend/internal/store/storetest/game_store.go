@@ -0,0 +1,217 @@
+// Package storetest provides in-memory stores that stand in for Postgres in
+// tests. Like replicas sharing the database, every component of a test may
+// share one.
+package storetest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+var _ store.GameStore = (*MemoryGameStore)(nil)
+
+// MemoryGameStore is an in-memory store.GameStore.
+type MemoryGameStore struct {
+	games        map[string]store.Game
+	moves        map[string][]queue.MovePayload
+	applied      map[string]int64
+	conditionals map[string]map[string][][]string
+	mu           sync.Mutex
+}
+
+func NewMemoryGameStore() *MemoryGameStore {
+	return &MemoryGameStore{
+		games:        make(map[string]store.Game),
+		moves:        make(map[string][]queue.MovePayload),
+		applied:      make(map[string]int64),
+		conditionals: make(map[string]map[string][][]string),
+	}
+}
+
+func (s *MemoryGameStore) CreateGame(ctx context.Context, game *store.Game) (*store.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.games[game.ID] = *game
+	return game, nil
+}
+
+func (s *MemoryGameStore) GetGameByID(ctx context.Context, id string) (*store.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game, ok := s.games[id]
+	if !ok {
+		return nil, nil
+	}
+	return &game, nil
+}
+
+func (s *MemoryGameStore) ListActiveGamesByUserID(ctx context.Context, userID string) ([]store.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var games []store.Game
+	for _, game := range s.games {
+		if (game.WhiteUserID == userID || game.BlackUserID == userID) && game.Status == "in_progress" {
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
+
+func (s *MemoryGameStore) ListActiveGames(ctx context.Context) ([]store.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var games []store.Game
+	for _, game := range s.games {
+		if game.Status == "in_progress" {
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
+
+func (s *MemoryGameStore) ListOverdueGames(ctx context.Context, now time.Time) ([]store.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var games []store.Game
+	for _, game := range s.games {
+		if game.Status == "in_progress" && game.MoveDeadline != nil && game.MoveDeadline.Before(now) {
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
+
+func (s *MemoryGameStore) UpdateGameStatus(ctx context.Context, id string, status string, outcome string, method string, endedAt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game := s.games[id]
+	game.Status, game.Outcome, game.Method = status, outcome, method
+	game.EndedAt.String, game.EndedAt.Valid = endedAt, true
+	s.games[id] = game
+	return nil
+}
+
+func (s *MemoryGameStore) ApplyMove(ctx context.Context, payload queue.MovePayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if payload.Seq > 0 {
+		applied := s.applied[payload.GameID]
+		if payload.Seq <= applied {
+			return nil
+		}
+		if payload.Seq > applied+1 {
+			return store.ErrMoveOutOfOrder
+		}
+		s.applied[payload.GameID] = payload.Seq
+	}
+
+	var kept []queue.MovePayload
+	for _, m := range s.moves[payload.GameID] {
+		if payload.Action == queue.ActionTakeback && m.MoveNumber >= payload.MoveNumber {
+			continue
+		}
+		if m.MoveNumber != payload.MoveNumber {
+			kept = append(kept, m)
+		}
+	}
+	if payload.Action != queue.ActionTakeback {
+		kept = append(kept, payload)
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].MoveNumber < kept[j].MoveNumber })
+	s.moves[payload.GameID] = kept
+	return nil
+}
+
+func (s *MemoryGameStore) GetMovesByGameID(ctx context.Context, gameID string) ([]queue.MovePayload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]queue.MovePayload(nil), s.moves[gameID]...), nil
+}
+
+func (s *MemoryGameStore) GetMoveSeq(ctx context.Context, gameID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied[gameID], nil
+}
+
+func (s *MemoryGameStore) ResetMoves(ctx context.Context, gameID string, moves []queue.MovePayload, seq int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq <= s.applied[gameID] {
+		return nil
+	}
+	s.moves[gameID] = append([]queue.MovePayload(nil), moves...)
+	s.applied[gameID] = seq
+	return nil
+}
+
+func (s *MemoryGameStore) UpdateGamePGN(ctx context.Context, id string, pgn string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game := s.games[id]
+	game.PGN = pgn
+	s.games[id] = game
+	return nil
+}
+
+func (s *MemoryGameStore) StreamGamesByUserID(ctx context.Context, userID string, fn func(*store.Game) error) error {
+	return nil
+}
+
+func (s *MemoryGameStore) ListGamesByUserID(ctx context.Context, userID string, filter store.GameFilter) ([]store.Game, error) {
+	return nil, nil
+}
+
+func (s *MemoryGameStore) UpdateMoveDeadline(ctx context.Context, id string, toMoveUserID string, deadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game := s.games[id]
+	game.ToMoveUserID, game.MoveDeadline = toMoveUserID, &deadline
+	s.games[id] = game
+	return nil
+}
+
+func (s *MemoryGameStore) ListCorrespondenceGames(ctx context.Context, userID string) ([]store.Game, error) {
+	return nil, nil
+}
+
+func (s *MemoryGameStore) SaveConditionalMoves(ctx context.Context, gameID string, userID string, lines [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conditionals[gameID] == nil {
+		s.conditionals[gameID] = make(map[string][][]string)
+	}
+	s.conditionals[gameID][userID] = lines
+	return nil
+}
+
+func (s *MemoryGameStore) GetConditionalMoves(ctx context.Context, gameID string) (map[string][][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := make(map[string][][]string)
+	for userID, l := range s.conditionals[gameID] {
+		lines[userID] = l
+	}
+	return lines, nil
+}
+
+// HasGame reports whether the game was created, as the foreign keys to the
+// games table require.
+func (s *MemoryGameStore) HasGame(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.games[id]
+	return ok
+}
+
+// MoveCount is how many moves of a game the move worker has written.
+func (s *MemoryGameStore) MoveCount(gameID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.moves[gameID])
+}
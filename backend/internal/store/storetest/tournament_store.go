@@ -0,0 +1,303 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+var _ store.TournamentStore = (*MemoryTournamentStore)(nil)
+
+// MemoryTournamentStore is an in-memory store.TournamentStore. Pairings
+// must refer to games created in its game store, as the foreign key of
+// tournament_pairings.game_id requires.
+type MemoryTournamentStore struct {
+	games       *MemoryGameStore
+	tournaments map[string]store.Tournament
+	players     map[string][]store.TournamentPlayer
+	pairings    []store.TournamentPairing
+	rounds      map[string][]store.TournamentRound
+	matches     []store.TournamentMatch
+	nextID      int64
+	mu          sync.Mutex
+}
+
+func NewMemoryTournamentStore(games *MemoryGameStore) *MemoryTournamentStore {
+	return &MemoryTournamentStore{
+		games:       games,
+		tournaments: make(map[string]store.Tournament),
+		players:     make(map[string][]store.TournamentPlayer),
+		rounds:      make(map[string][]store.TournamentRound),
+	}
+}
+
+func (s *MemoryTournamentStore) CreateTournament(ctx context.Context, t *store.Tournament) (*store.Tournament, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	created := *t
+	if created.ID == "" {
+		s.nextID++
+		created.ID = fmt.Sprintf("tournament-%d", s.nextID)
+	}
+	if created.Status == "" {
+		created.Status = store.TournamentCreated
+	}
+	created.CreatedAt = time.Now()
+	s.tournaments[created.ID] = created
+	return &created, nil
+}
+
+func (s *MemoryTournamentStore) GetTournament(ctx context.Context, id string) (*store.Tournament, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tournaments[id]
+	if !ok {
+		return nil, store.ErrTournamentNotFound
+	}
+	return &t, nil
+}
+
+func (s *MemoryTournamentStore) ListTournaments(ctx context.Context, status string) ([]store.Tournament, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tournaments []store.Tournament
+	for _, t := range s.tournaments {
+		if status == "" || t.Status == status {
+			tournaments = append(tournaments, t)
+		}
+	}
+	sort.Slice(tournaments, func(i, j int) bool { return tournaments[i].StartsAt.Before(tournaments[j].StartsAt) })
+	return tournaments, nil
+}
+
+func (s *MemoryTournamentStore) UpdateTournamentStatus(ctx context.Context, id string, status string, currentRound int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tournaments[id]
+	if !ok {
+		return store.ErrTournamentNotFound
+	}
+	t.Status, t.CurrentRound = status, currentRound
+	s.tournaments[id] = t
+	return nil
+}
+
+func (s *MemoryTournamentStore) StartTournament(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tournaments[id]
+	if !ok || t.Status != store.TournamentCreated {
+		return false, nil
+	}
+	now := time.Now()
+	t.Status, t.CurrentRound, t.StartedAt = store.TournamentRunning, 0, &now
+	s.tournaments[id] = t
+	return true, nil
+}
+
+func (s *MemoryTournamentStore) AdvanceTournamentRound(ctx context.Context, id string, from int, to int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tournaments[id]
+	if !ok || t.Status != store.TournamentRunning || t.CurrentRound != from {
+		return false, nil
+	}
+	t.CurrentRound = to
+	s.tournaments[id] = t
+	return true, nil
+}
+
+func (s *MemoryTournamentStore) AddTournamentPlayer(ctx context.Context, tournamentID string, userID string, rating int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	players := s.players[tournamentID]
+	for i := range players {
+		if players[i].UserID == userID {
+			players[i].Withdrawn = false
+			return nil
+		}
+	}
+	s.players[tournamentID] = append(players, store.TournamentPlayer{
+		TournamentID: tournamentID,
+		UserID:       userID,
+		Rating:       rating,
+		JoinedAt:     time.Now(),
+	})
+	return nil
+}
+
+func (s *MemoryTournamentStore) SetTournamentPlayerWithdrawn(ctx context.Context, tournamentID string, userID string, withdrawn bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.players[tournamentID] {
+		if s.players[tournamentID][i].UserID == userID {
+			s.players[tournamentID][i].Withdrawn = withdrawn
+		}
+	}
+	return nil
+}
+
+func (s *MemoryTournamentStore) GetTournamentPlayers(ctx context.Context, tournamentID string) ([]store.TournamentPlayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]store.TournamentPlayer(nil), s.players[tournamentID]...), nil
+}
+
+func (s *MemoryTournamentStore) SaveTournamentStandings(ctx context.Context, tournamentID string, players []store.TournamentPlayer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range players {
+		for i := range s.players[tournamentID] {
+			saved := &s.players[tournamentID][i]
+			if saved.UserID == p.UserID {
+				saved.Score, saved.Buchholz, saved.SonnebornBerger, saved.Rank = p.Score, p.Buchholz, p.SonnebornBerger, p.Rank
+			}
+		}
+	}
+	return nil
+}
+
+// checkGame fails like the foreign key on tournament_pairings.game_id.
+func (s *MemoryTournamentStore) checkGame(gameID string) error {
+	if gameID != "" && !s.games.HasGame(gameID) {
+		return fmt.Errorf("pairing refers to game %s, which does not exist", gameID)
+	}
+	return nil
+}
+
+func (s *MemoryTournamentStore) CreateTournamentPairing(ctx context.Context, p *store.TournamentPairing) (*store.TournamentPairing, error) {
+	if err := s.checkGame(p.GameID); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	created := *p
+	created.ID = s.nextID
+	created.CreatedAt = time.Now()
+	if created.Result != "" {
+		created.FinishedAt = &created.CreatedAt
+	}
+	s.pairings = append(s.pairings, created)
+	return &created, nil
+}
+
+func (s *MemoryTournamentStore) UpdateTournamentPairing(ctx context.Context, p *store.TournamentPairing) error {
+	if err := s.checkGame(p.GameID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.pairings {
+		saved := &s.pairings[i]
+		if saved.ID != p.ID {
+			continue
+		}
+		saved.GameID, saved.Result = p.GameID, p.Result
+		saved.WhitePoints, saved.BlackPoints = p.WhitePoints, p.BlackPoints
+		saved.WhiteBerserk, saved.BlackBerserk = p.WhiteBerserk, p.BlackBerserk
+		if saved.Result == "" {
+			saved.FinishedAt = nil
+		} else if saved.FinishedAt == nil {
+			now := time.Now()
+			saved.FinishedAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *MemoryTournamentStore) GetTournamentPairings(ctx context.Context, tournamentID string) ([]store.TournamentPairing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pairings []store.TournamentPairing
+	for _, p := range s.pairings {
+		if p.TournamentID == tournamentID {
+			pairings = append(pairings, p)
+		}
+	}
+	return pairings, nil
+}
+
+func (s *MemoryTournamentStore) GetTournamentPairingByGame(ctx context.Context, gameID string) (*store.TournamentPairing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pairings {
+		if p.GameID == gameID {
+			return &p, nil
+		}
+	}
+	return nil, store.ErrPairingNotFound
+}
+
+func (s *MemoryTournamentStore) ScheduleTournament(ctx context.Context, tournamentID string, rounds []store.TournamentRound) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rounds[tournamentID] = append([]store.TournamentRound(nil), rounds...)
+	t := s.tournaments[tournamentID]
+	t.Rounds = len(rounds)
+	s.tournaments[tournamentID] = t
+	return nil
+}
+
+func (s *MemoryTournamentStore) GetTournamentRounds(ctx context.Context, tournamentID string) ([]store.TournamentRound, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]store.TournamentRound(nil), s.rounds[tournamentID]...), nil
+}
+
+func (s *MemoryTournamentStore) StartTournamentRound(ctx context.Context, tournamentID string, round int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.rounds[tournamentID] {
+		r := &s.rounds[tournamentID][i]
+		if r.Round == round && r.StartedAt == nil {
+			r.StartedAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *MemoryTournamentStore) CreateTournamentMatches(ctx context.Context, matches []store.TournamentMatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range matches {
+		s.nextID++
+		m.ID = s.nextID
+		m.CreatedAt = time.Now()
+		s.matches = append(s.matches, m)
+	}
+	return nil
+}
+
+func (s *MemoryTournamentStore) GetTournamentMatches(ctx context.Context, tournamentID string) ([]store.TournamentMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matches []store.TournamentMatch
+	for _, m := range s.matches {
+		if m.TournamentID == tournamentID {
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Round != matches[j].Round {
+			return matches[i].Round < matches[j].Round
+		}
+		return matches[i].Slot < matches[j].Slot
+	})
+	return matches, nil
+}
+
+func (s *MemoryTournamentStore) UpdateTournamentMatch(ctx context.Context, m *store.TournamentMatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.matches {
+		if s.matches[i].ID == m.ID {
+			s.matches[i] = *m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// TokenStore keeps long-lived API tokens. Only a hash of each token is
+// stored.
+type TokenStore interface {
+	CreateToken(ctx context.Context, userID string, tokenHash string) error
+	GetUserIDByTokenHash(ctx context.Context, tokenHash string) (string, error)
+	RevokeTokens(ctx context.Context, userID string) error
+}
+
+type PostgresTokenStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+	return &PostgresTokenStore{db: db}
+}
+
+func (s *PostgresTokenStore) CreateToken(ctx context.Context, userID string, tokenHash string) error {
+	query := `INSERT INTO api_tokens (user_id, token_hash) VALUES ($1, $2)`
+	_, err := s.db.ExecContext(ctx, query, userID, tokenHash)
+	return err
+}
+
+// GetUserIDByTokenHash returns the owner of an unrevoked token and records
+// that the token was used.
+func (s *PostgresTokenStore) GetUserIDByTokenHash(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+
+	query := `
+		UPDATE api_tokens
+		SET last_used_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL
+		RETURNING user_id
+	`
+
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrTokenNotFound
+	}
+	return userID, err
+}
+
+func (s *PostgresTokenStore) RevokeTokens(ctx context.Context, userID string) error {
+	query := `UPDATE api_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,574 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTournamentNotFound = errors.New("tournament not found")
+	ErrPairingNotFound    = errors.New("tournament pairing not found")
+)
+
+// Knockout match statuses. A match waits for both players, is scheduled
+// until its round starts, plays its games and an Armageddon game if they
+// are tied, and finishes with a winner.
+const (
+	MatchWaiting    = "waiting"
+	MatchScheduled  = "scheduled"
+	MatchPlaying    = "playing"
+	MatchArmageddon = "armageddon"
+	MatchFinished   = "finished"
+)
+
+const (
+	TournamentCreated   = "created"
+	TournamentRunning   = "running"
+	TournamentFinished  = "finished"
+	TournamentCancelled = "cancelled"
+)
+
+// Tournament is an event whose games are paired by the server. Rounds only
+// applies to formats played in rounds and DurationSeconds to timed formats.
+// RoundIntervalSeconds spaces out the scheduled rounds of fixed-schedule
+// formats, ForfeitAfterSeconds is how long they wait for a player to turn up
+// and MatchGames is the length of a knockout match.
+type Tournament struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Format          string     `json:"format"`
+	Status          string     `json:"status"`
+	CreatedBy       string     `json:"created_by"`
+	TimeControl     string     `json:"time_control"`
+	Variant         string     `json:"variant"`
+	Rated           bool       `json:"rated"`
+	Rounds          int        `json:"rounds,omitempty"`
+	DurationSeconds int        `json:"duration_seconds,omitempty"`
+	CurrentRound    int        `json:"current_round"`
+	StartsAt        time.Time  `json:"starts_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	RoundIntervalSeconds int `json:"round_interval_seconds,omitempty"`
+	ForfeitAfterSeconds  int `json:"forfeit_after_seconds,omitempty"`
+	MatchGames           int `json:"match_games,omitempty"`
+}
+
+// TournamentPlayer is a player's entry in a tournament. Score, the tiebreaks
+// and Rank are the standings as last saved. Rating is the rating the player
+// joined with, used to seed pairings.
+type TournamentPlayer struct {
+	TournamentID    string    `json:"tournament_id"`
+	UserID          string    `json:"user_id"`
+	DisplayName     string    `json:"display_name,omitempty"`
+	Rating          int       `json:"rating"`
+	Score           float64   `json:"score"`
+	Buchholz        float64   `json:"buchholz"`
+	SonnebornBerger float64   `json:"sonneborn_berger"`
+	Rank            int       `json:"rank"`
+	Withdrawn       bool      `json:"withdrawn"`
+	JoinedAt        time.Time `json:"joined_at"`
+}
+
+// TournamentPairing is one game of a tournament. BlackUserID is empty for a
+// bye and GameID is empty for byes and forfeits. Result is empty while the
+// game is being played, or while a scheduled game waits for its players
+// when GameID is empty too. Knockout games belong to a match.
+type TournamentPairing struct {
+	ID           int64      `json:"id"`
+	TournamentID string     `json:"tournament_id"`
+	Round        int        `json:"round"`
+	GameID       string     `json:"game_id,omitempty"`
+	WhiteUserID  string     `json:"white_user_id"`
+	BlackUserID  string     `json:"black_user_id,omitempty"`
+	Result       string     `json:"result,omitempty"`
+	WhitePoints  float64    `json:"white_points"`
+	BlackPoints  float64    `json:"black_points"`
+	WhiteBerserk bool       `json:"white_berserk,omitempty"`
+	BlackBerserk bool       `json:"black_berserk,omitempty"`
+	MatchID      int64      `json:"match_id,omitempty"`
+	Armageddon   bool       `json:"armageddon,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// TournamentRound is a round of a fixed-schedule tournament. It starts at
+// ScheduledAt, or later if the previous round is still being played.
+type TournamentRound struct {
+	TournamentID string     `json:"tournament_id"`
+	Round        int        `json:"round"`
+	ScheduledAt  time.Time  `json:"scheduled_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+}
+
+// TournamentMatch is a knockout match. Slot is its position in the round;
+// its winner takes slot Slot/2 of the next round. Player2UserID stays empty
+// for a bye.
+type TournamentMatch struct {
+	ID            int64     `json:"id"`
+	TournamentID  string    `json:"tournament_id"`
+	Round         int       `json:"round"`
+	Slot          int       `json:"slot"`
+	Player1UserID string    `json:"player1_user_id,omitempty"`
+	Player2UserID string    `json:"player2_user_id,omitempty"`
+	Player1Score  float64   `json:"player1_score"`
+	Player2Score  float64   `json:"player2_score"`
+	WinnerUserID  string    `json:"winner_user_id,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type TournamentStore interface {
+	CreateTournament(ctx context.Context, t *Tournament) (*Tournament, error)
+	GetTournament(ctx context.Context, id string) (*Tournament, error)
+	ListTournaments(ctx context.Context, status string) ([]Tournament, error)
+	UpdateTournamentStatus(ctx context.Context, id string, status string, currentRound int) error
+	StartTournament(ctx context.Context, id string) (bool, error)
+	AdvanceTournamentRound(ctx context.Context, id string, from int, to int) (bool, error)
+	AddTournamentPlayer(ctx context.Context, tournamentID string, userID string, rating int) error
+	SetTournamentPlayerWithdrawn(ctx context.Context, tournamentID string, userID string, withdrawn bool) error
+	GetTournamentPlayers(ctx context.Context, tournamentID string) ([]TournamentPlayer, error)
+	SaveTournamentStandings(ctx context.Context, tournamentID string, players []TournamentPlayer) error
+	CreateTournamentPairing(ctx context.Context, p *TournamentPairing) (*TournamentPairing, error)
+	UpdateTournamentPairing(ctx context.Context, p *TournamentPairing) error
+	GetTournamentPairings(ctx context.Context, tournamentID string) ([]TournamentPairing, error)
+	GetTournamentPairingByGame(ctx context.Context, gameID string) (*TournamentPairing, error)
+	ScheduleTournament(ctx context.Context, tournamentID string, rounds []TournamentRound) error
+	GetTournamentRounds(ctx context.Context, tournamentID string) ([]TournamentRound, error)
+	StartTournamentRound(ctx context.Context, tournamentID string, round int, at time.Time) error
+	CreateTournamentMatches(ctx context.Context, matches []TournamentMatch) error
+	GetTournamentMatches(ctx context.Context, tournamentID string) ([]TournamentMatch, error)
+	UpdateTournamentMatch(ctx context.Context, m *TournamentMatch) error
+}
+
+type PostgresTournamentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTournamentStore(db *sql.DB) *PostgresTournamentStore {
+	return &PostgresTournamentStore{db: db}
+}
+
+const tournamentColumns = `id, name, format, status, created_by, time_control, variant, rated, rounds, duration_seconds,
+	current_round, starts_at, started_at, finished_at, created_at, round_interval_seconds, forfeit_after_seconds, match_games`
+
+func scanTournament(row interface{ Scan(...any) error }) (*Tournament, error) {
+	var t Tournament
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.Name, &t.Format, &t.Status, &t.CreatedBy, &t.TimeControl, &t.Variant, &t.Rated, &t.Rounds,
+		&t.DurationSeconds, &t.CurrentRound, &t.StartsAt, &startedAt, &finishedAt, &t.CreatedAt, &t.RoundIntervalSeconds,
+		&t.ForfeitAfterSeconds, &t.MatchGames)
+	if err != nil {
+		return nil, err
+	}
+	if startedAt.Valid {
+		t.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		t.FinishedAt = &finishedAt.Time
+	}
+	return &t, nil
+}
+
+func (s *PostgresTournamentStore) CreateTournament(ctx context.Context, t *Tournament) (*Tournament, error) {
+	query := `
+		INSERT INTO tournaments (name, format, created_by, time_control, variant, rated, rounds, duration_seconds, starts_at,
+			round_interval_seconds, forfeit_after_seconds, match_games)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING ` + tournamentColumns
+
+	return scanTournament(s.db.QueryRowContext(ctx, query,
+		t.Name,
+		t.Format,
+		t.CreatedBy,
+		t.TimeControl,
+		t.Variant,
+		t.Rated,
+		t.Rounds,
+		t.DurationSeconds,
+		t.StartsAt,
+		t.RoundIntervalSeconds,
+		t.ForfeitAfterSeconds,
+		t.MatchGames,
+	))
+}
+
+func (s *PostgresTournamentStore) GetTournament(ctx context.Context, id string) (*Tournament, error) {
+	query := `SELECT ` + tournamentColumns + ` FROM tournaments WHERE id = $1`
+
+	t, err := scanTournament(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrTournamentNotFound
+	}
+	return t, err
+}
+
+// ListTournaments returns the tournaments with the given status, or every
+// tournament when status is empty, soonest first.
+func (s *PostgresTournamentStore) ListTournaments(ctx context.Context, status string) ([]Tournament, error) {
+	query := `
+		SELECT ` + tournamentColumns + `
+		FROM tournaments
+		WHERE $1::text = '' OR status = $1
+		ORDER BY starts_at, id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tournaments []Tournament
+	for rows.Next() {
+		t, err := scanTournament(rows)
+		if err != nil {
+			return nil, err
+		}
+		tournaments = append(tournaments, *t)
+	}
+	return tournaments, rows.Err()
+}
+
+// UpdateTournamentStatus records the tournament's progress. The start and
+// finish times are set the first time it enters the matching status.
+func (s *PostgresTournamentStore) UpdateTournamentStatus(ctx context.Context, id string, status string, currentRound int) error {
+	query := `
+		UPDATE tournaments
+		SET status = $2,
+			current_round = $3,
+			started_at = CASE WHEN $2::text = 'running' AND started_at IS NULL THEN NOW() ELSE started_at END,
+			finished_at = CASE WHEN $2::text IN ('finished', 'cancelled') AND finished_at IS NULL THEN NOW() ELSE finished_at END
+		WHERE id = $1
+	`
+	result, err := s.db.ExecContext(ctx, query, id, status, currentRound)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTournamentNotFound
+	}
+	return nil
+}
+
+// StartTournament moves a tournament that has not started yet to running.
+// It reports false when the tournament was already started, so only one
+// caller sets it up.
+func (s *PostgresTournamentStore) StartTournament(ctx context.Context, id string) (bool, error) {
+	query := `
+		UPDATE tournaments
+		SET status = 'running',
+			current_round = 0,
+			started_at = COALESCE(started_at, NOW())
+		WHERE id = $1 AND status = 'created'
+	`
+	result, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// AdvanceTournamentRound moves a running tournament from round from to round
+// to. It reports false when the tournament is no longer at round from, so
+// only one caller pairs the round.
+func (s *PostgresTournamentStore) AdvanceTournamentRound(ctx context.Context, id string, from int, to int) (bool, error) {
+	query := `
+		UPDATE tournaments
+		SET current_round = $3
+		WHERE id = $1 AND status = 'running' AND current_round = $2
+	`
+	result, err := s.db.ExecContext(ctx, query, id, from, to)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// AddTournamentPlayer enters the user, or re-enters a player who withdrew.
+func (s *PostgresTournamentStore) AddTournamentPlayer(ctx context.Context, tournamentID string, userID string, rating int) error {
+	query := `
+		INSERT INTO tournament_players (tournament_id, user_id, rating)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tournament_id, user_id) DO UPDATE SET withdrawn = FALSE
+	`
+	_, err := s.db.ExecContext(ctx, query, tournamentID, userID, rating)
+	return err
+}
+
+func (s *PostgresTournamentStore) SetTournamentPlayerWithdrawn(ctx context.Context, tournamentID string, userID string, withdrawn bool) error {
+	query := `UPDATE tournament_players SET withdrawn = $3 WHERE tournament_id = $1 AND user_id = $2`
+	_, err := s.db.ExecContext(ctx, query, tournamentID, userID, withdrawn)
+	return err
+}
+
+// GetTournamentPlayers returns the tournament's players with their display
+// names, in the order they joined.
+func (s *PostgresTournamentStore) GetTournamentPlayers(ctx context.Context, tournamentID string) ([]TournamentPlayer, error) {
+	query := `
+		SELECT p.tournament_id, p.user_id, COALESCE(u.display_name, ''), p.rating, p.score, p.buchholz,
+			p.sonneborn_berger, p.rank, p.withdrawn, p.joined_at
+		FROM tournament_players p
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.tournament_id = $1
+		ORDER BY p.joined_at, p.user_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []TournamentPlayer
+	for rows.Next() {
+		var p TournamentPlayer
+		err := rows.Scan(&p.TournamentID, &p.UserID, &p.DisplayName, &p.Rating, &p.Score, &p.Buchholz,
+			&p.SonnebornBerger, &p.Rank, &p.Withdrawn, &p.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// SaveTournamentStandings stores the players' scores, tiebreaks and ranks in
+// one transaction.
+func (s *PostgresTournamentStore) SaveTournamentStandings(ctx context.Context, tournamentID string, players []TournamentPlayer) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range players {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE tournament_players
+			SET score = $3, buchholz = $4, sonneborn_berger = $5, rank = $6
+			WHERE tournament_id = $1 AND user_id = $2
+		`, tournamentID, p.UserID, p.Score, p.Buchholz, p.SonnebornBerger, p.Rank)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const pairingColumns = `id, tournament_id, round, COALESCE(game_id::text, ''), white_user_id, COALESCE(black_user_id::text, ''),
+	result, white_points, black_points, white_berserk, black_berserk, COALESCE(match_id, 0), armageddon, created_at, finished_at`
+
+func scanPairing(row interface{ Scan(...any) error }) (*TournamentPairing, error) {
+	var p TournamentPairing
+	err := row.Scan(&p.ID, &p.TournamentID, &p.Round, &p.GameID, &p.WhiteUserID, &p.BlackUserID,
+		&p.Result, &p.WhitePoints, &p.BlackPoints, &p.WhiteBerserk, &p.BlackBerserk, &p.MatchID, &p.Armageddon, &p.CreatedAt, &p.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *PostgresTournamentStore) CreateTournamentPairing(ctx context.Context, p *TournamentPairing) (*TournamentPairing, error) {
+	query := `
+		INSERT INTO tournament_pairings (tournament_id, round, game_id, white_user_id, black_user_id, result, white_points, black_points,
+			match_id, armageddon, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CASE WHEN $6::text <> '' THEN NOW() END)
+		RETURNING ` + pairingColumns
+
+	return scanPairing(s.db.QueryRowContext(ctx, query,
+		p.TournamentID,
+		p.Round,
+		nullString(p.GameID),
+		p.WhiteUserID,
+		nullString(p.BlackUserID),
+		p.Result,
+		p.WhitePoints,
+		p.BlackPoints,
+		sql.NullInt64{Int64: p.MatchID, Valid: p.MatchID != 0},
+		p.Armageddon,
+	))
+}
+
+func (s *PostgresTournamentStore) UpdateTournamentPairing(ctx context.Context, p *TournamentPairing) error {
+	query := `
+		UPDATE tournament_pairings
+		SET game_id = $2, result = $3, white_points = $4, black_points = $5, white_berserk = $6, black_berserk = $7,
+			finished_at = CASE WHEN $3::text <> '' THEN COALESCE(finished_at, NOW()) END
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, p.ID, nullString(p.GameID), p.Result, p.WhitePoints, p.BlackPoints, p.WhiteBerserk, p.BlackBerserk)
+	return err
+}
+
+// GetTournamentPairings returns every pairing of the tournament in the order
+// they were made.
+func (s *PostgresTournamentStore) GetTournamentPairings(ctx context.Context, tournamentID string) ([]TournamentPairing, error) {
+	query := `SELECT ` + pairingColumns + ` FROM tournament_pairings WHERE tournament_id = $1 ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairings []TournamentPairing
+	for rows.Next() {
+		p, err := scanPairing(rows)
+		if err != nil {
+			return nil, err
+		}
+		pairings = append(pairings, *p)
+	}
+	return pairings, rows.Err()
+}
+
+func (s *PostgresTournamentStore) GetTournamentPairingByGame(ctx context.Context, gameID string) (*TournamentPairing, error) {
+	query := `SELECT ` + pairingColumns + ` FROM tournament_pairings WHERE game_id = $1`
+
+	p, err := scanPairing(s.db.QueryRowContext(ctx, query, gameID))
+	if err == sql.ErrNoRows {
+		return nil, ErrPairingNotFound
+	}
+	return p, err
+}
+
+// ScheduleTournament stores the rounds of a fixed-schedule tournament and
+// sets its number of rounds.
+func (s *PostgresTournamentStore) ScheduleTournament(ctx context.Context, tournamentID string, rounds []TournamentRound) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range rounds {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tournament_rounds (tournament_id, round, scheduled_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (tournament_id, round) DO UPDATE SET scheduled_at = EXCLUDED.scheduled_at
+		`, tournamentID, r.Round, r.ScheduledAt)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE tournaments SET rounds = $2 WHERE id = $1`, tournamentID, len(rounds)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresTournamentStore) GetTournamentRounds(ctx context.Context, tournamentID string) ([]TournamentRound, error) {
+	query := `
+		SELECT tournament_id, round, scheduled_at, started_at
+		FROM tournament_rounds
+		WHERE tournament_id = $1
+		ORDER BY round
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rounds []TournamentRound
+	for rows.Next() {
+		var r TournamentRound
+		var startedAt sql.NullTime
+		if err := rows.Scan(&r.TournamentID, &r.Round, &r.ScheduledAt, &startedAt); err != nil {
+			return nil, err
+		}
+		if startedAt.Valid {
+			r.StartedAt = &startedAt.Time
+		}
+		rounds = append(rounds, r)
+	}
+	return rounds, rows.Err()
+}
+
+// StartTournamentRound records when a round actually started. A round
+// already started keeps its original time.
+func (s *PostgresTournamentStore) StartTournamentRound(ctx context.Context, tournamentID string, round int, at time.Time) error {
+	query := `
+		UPDATE tournament_rounds
+		SET started_at = COALESCE(started_at, $3)
+		WHERE tournament_id = $1 AND round = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, tournamentID, round, at)
+	return err
+}
+
+// CreateTournamentMatches stores a whole knockout bracket in one transaction.
+func (s *PostgresTournamentStore) CreateTournamentMatches(ctx context.Context, matches []TournamentMatch) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range matches {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tournament_matches (tournament_id, round, slot, player1_user_id, player2_user_id, winner_user_id, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, m.TournamentID, m.Round, m.Slot, nullString(m.Player1UserID), nullString(m.Player2UserID), nullString(m.WinnerUserID), m.Status)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTournamentMatches returns the bracket round by round.
+func (s *PostgresTournamentStore) GetTournamentMatches(ctx context.Context, tournamentID string) ([]TournamentMatch, error) {
+	query := `
+		SELECT id, tournament_id, round, slot, COALESCE(player1_user_id::text, ''), COALESCE(player2_user_id::text, ''),
+			player1_score, player2_score, COALESCE(winner_user_id::text, ''), status, created_at
+		FROM tournament_matches
+		WHERE tournament_id = $1
+		ORDER BY round, slot
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []TournamentMatch
+	for rows.Next() {
+		var m TournamentMatch
+		err := rows.Scan(&m.ID, &m.TournamentID, &m.Round, &m.Slot, &m.Player1UserID, &m.Player2UserID,
+			&m.Player1Score, &m.Player2Score, &m.WinnerUserID, &m.Status, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+func (s *PostgresTournamentStore) UpdateTournamentMatch(ctx context.Context, m *TournamentMatch) error {
+	query := `
+		UPDATE tournament_matches
+		SET player1_user_id = $2, player2_user_id = $3, player1_score = $4, player2_score = $5, winner_user_id = $6, status = $7
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, m.ID, nullString(m.Player1UserID), nullString(m.Player2UserID),
+		m.Player1Score, m.Player2Score, nullString(m.WinnerUserID), m.Status)
+	return err
+}
@@ -26,9 +26,14 @@ type PostgresUserStore struct {
 	db *sql.DB
 }
 
+// ProviderBot marks accounts played by programs rather than people.
+const ProviderBot = "bot"
+
 type UserStore interface {
 	CreateOrUpdate(ctx context.Context, user *User) (*User, error)
 	GetUserByID(ctx context.Context, id string) (*User, error)
+	CreateBotUser(ctx context.Context, ownerID string, displayName string) (*User, error)
+	GetBotsByOwner(ctx context.Context, ownerID string) ([]User, error)
 }
 
 func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
@@ -101,3 +106,56 @@ func (s *PostgresUserStore) GetUserByID(ctx context.Context, id string) (*User,
 	return &u, nil
 }
 
+// CreateBotUser creates a bot account owned by ownerID. Bot accounts have no
+// login of their own; they authenticate with API tokens.
+func (s *PostgresUserStore) CreateBotUser(ctx context.Context, ownerID string, displayName string) (*User, error) {
+	query := `
+        INSERT INTO users (email, display_name, avatar_url, provider, provider_id, owner_id)
+        SELECT id::text || '@bots.local', $1, '', 'bot', id::text, $2
+        FROM (SELECT gen_random_uuid() AS id) AS bot
+        RETURNING id, email, display_name, avatar_url, provider, provider_id, created_at, updated_at
+    `
+
+	var u User
+	err := s.db.QueryRowContext(ctx, query, displayName, ownerID).Scan(
+		&u.ID,
+		&u.Email,
+		&u.DisplayName,
+		&u.AvatarURL,
+		&u.Provider,
+		&u.ProviderID,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (s *PostgresUserStore) GetBotsByOwner(ctx context.Context, ownerID string) ([]User, error) {
+	var users []User
+
+	query := `
+        SELECT id, email, display_name, avatar_url, provider, provider_id, created_at, updated_at
+        FROM users
+        WHERE owner_id = $1 AND provider = 'bot'
+        ORDER BY created_at
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Email, &u.DisplayName, &u.AvatarURL, &u.Provider, &u.ProviderID, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
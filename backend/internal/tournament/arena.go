@@ -0,0 +1,187 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/notnil/chess"
+)
+
+const (
+	// arenaPairingInterval is how often idle Arena players are paired.
+	arenaPairingInterval = 5 * time.Second
+	// berserkMinPlies is how long a berserk win must last to earn its bonus
+	// point, so quick resignations do not pay.
+	berserkMinPlies = 14
+	// fireStreak is the number of wins in a row after which a player scores
+	// double points.
+	fireStreak = 2
+)
+
+func arenaEnd(t *store.Tournament) time.Time {
+	start := t.StartsAt
+	if t.StartedAt != nil {
+		start = *t.StartedAt
+	}
+	return start.Add(time.Duration(t.DurationSeconds) * time.Second)
+}
+
+// advanceArena pairs the connected players who are not playing, until the
+// Arena's time is up. It finishes once the last game is over. It must be
+// called with s.mu held.
+func (s *Service) advanceArena(ctx context.Context, t *store.Tournament, now time.Time) error {
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	records := buildRecords(players, pairings)
+
+	if !now.Before(arenaEnd(t)) {
+		for _, rec := range records {
+			if rec.pending {
+				return nil
+			}
+		}
+		return s.finish(ctx, t)
+	}
+
+	if now.Sub(s.lastPaired[t.ID]) < arenaPairingInterval {
+		return nil
+	}
+	s.lastPaired[t.ID] = now
+
+	var idle []*record
+	for _, p := range active(players) {
+		rec := records[p.UserID]
+		if rec.pending || !s.gm.IsConnected(p.UserID) || s.gm.IsPlaying(p.UserID) {
+			continue
+		}
+		idle = append(idle, rec)
+	}
+
+	started := 0
+	for _, g := range pairArena(idle) {
+		err := s.startGame(ctx, t, 0, g.white, g.black)
+		if errors.Is(err, gamemanager.ErrAlreadyInGame) {
+			// One of them started another game; try again next time.
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to start game %s vs %s in tournament %s: %v", g.white, g.black, t.ID, err)
+			continue
+		}
+		started++
+	}
+	if started == 0 {
+		return nil
+	}
+	return s.publishStandings(ctx, t, gamemanager.TOURNAMENT_STANDINGS)
+}
+
+// pairArena pairs idle players of similar score, avoiding an immediate
+// rematch when someone else is waiting. The player who has had White more
+// often gets Black.
+func pairArena(idle []*record) []pairing {
+	sort.SliceStable(idle, func(i, j int) bool {
+		if idle[i].points != idle[j].points {
+			return idle[i].points > idle[j].points
+		}
+		return idle[i].rating > idle[j].rating
+	})
+
+	var games []pairing
+	paired := make([]bool, len(idle))
+	for i, player := range idle {
+		if paired[i] {
+			continue
+		}
+		opponent := -1
+		for j := i + 1; j < len(idle); j++ {
+			if paired[j] {
+				continue
+			}
+			if opponent < 0 {
+				opponent = j
+			}
+			if !isLastOpponent(player, idle[j]) {
+				opponent = j
+				break
+			}
+		}
+		if opponent < 0 {
+			break
+		}
+		paired[i], paired[opponent] = true, true
+
+		white, black := player, idle[opponent]
+		if wantsBlack(white, black) {
+			white, black = black, white
+		}
+		games = append(games, pairing{white: white.userID, black: black.userID})
+	}
+	return games
+}
+
+func isLastOpponent(a, b *record) bool {
+	return len(a.games) > 0 && a.games[len(a.games)-1].opponent == b.userID
+}
+
+// wantsBlack reports whether a should have Black against b.
+func wantsBlack(a, b *record) bool {
+	if balanceA, balanceB := a.colorBalance(), b.colorBalance(); balanceA != balanceB {
+		return balanceA > balanceB
+	}
+	lastA, lastB := a.lastColors(1), b.lastColors(1)
+	return len(lastA) > 0 && lastA[0] == chess.White && (len(lastB) == 0 || lastB[0] == chess.Black)
+}
+
+// arenaPoints scores a finished Arena game for userID: 2 points for a win
+// and 1 for a draw, doubled while the player is on fire after fireStreak
+// wins in a row, plus 1 for a berserk win of at least berserkMinPlies.
+// pairings are the tournament's pairings before this game was scored.
+func arenaPoints(pairings []store.TournamentPairing, userID string, score float64, berserk bool, plies int) float64 {
+	points := 2 * score
+	if onFire(pairings, userID) {
+		points *= 2
+	}
+	if berserk && score == 1 && plies >= berserkMinPlies {
+		points++
+	}
+	return points
+}
+
+// onFire reports whether userID won each of their last fireStreak finished
+// games. Games are taken in the order they finished, not the order they
+// were paired.
+func onFire(pairings []store.TournamentPairing, userID string) bool {
+	var finished []store.TournamentPairing
+	for _, p := range pairings {
+		if p.Result != "" && p.FinishedAt != nil && (p.WhiteUserID == userID || p.BlackUserID == userID) {
+			finished = append(finished, p)
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(*finished[j].FinishedAt)
+	})
+
+	streak := 0
+	for i := len(finished) - 1; i >= 0 && streak < fireStreak; i-- {
+		p := finished[i]
+		won := (p.WhiteUserID == userID && p.Result == ResultWhiteWins) ||
+			(p.BlackUserID == userID && p.Result == ResultBlackWins)
+		if !won {
+			return false
+		}
+		streak++
+	}
+	return streak >= fireStreak
+}
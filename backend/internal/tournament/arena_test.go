@@ -0,0 +1,106 @@
+package tournament
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+// finished returns a pairing of white and black that ended with result
+// minute minutes into the tournament.
+func finished(white, black, result string, minute int) store.TournamentPairing {
+	at := time.Date(2026, 1, 1, 0, minute, 0, 0, time.UTC)
+	return store.TournamentPairing{WhiteUserID: white, BlackUserID: black, Result: result, FinishedAt: &at}
+}
+
+func TestOnFire(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairings []store.TournamentPairing
+		want     bool
+	}{
+		{name: "no games", want: false},
+		{
+			name:     "one win",
+			pairings: []store.TournamentPairing{finished("a", "b", ResultWhiteWins, 1)},
+			want:     false,
+		},
+		{
+			name: "two wins with either colour",
+			pairings: []store.TournamentPairing{
+				finished("a", "b", ResultWhiteWins, 1), finished("c", "a", ResultBlackWins, 2),
+			},
+			want: true,
+		},
+		{
+			name: "streak broken by a draw",
+			pairings: []store.TournamentPairing{
+				finished("a", "b", ResultWhiteWins, 1), finished("a", "c", ResultDraw, 2), finished("a", "d", ResultWhiteWins, 3),
+			},
+			want: false,
+		},
+		{
+			name: "streak after a loss",
+			pairings: []store.TournamentPairing{
+				finished("a", "b", ResultBlackWins, 1), finished("a", "c", ResultWhiteWins, 2), finished("d", "a", ResultBlackWins, 3),
+			},
+			want: true,
+		},
+		{
+			name: "games in the order they finished",
+			pairings: []store.TournamentPairing{
+				finished("a", "b", ResultWhiteWins, 3), finished("a", "c", ResultWhiteWins, 1), finished("a", "d", ResultBlackWins, 2),
+			},
+			want: false,
+		},
+		{
+			name: "games in progress and others' games ignored",
+			pairings: []store.TournamentPairing{
+				finished("a", "b", ResultWhiteWins, 1), finished("b", "c", ResultWhiteWins, 2),
+				finished("a", "c", ResultWhiteWins, 3), {WhiteUserID: "a", BlackUserID: "d"},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onFire(tt.pairings, "a"); got != tt.want {
+				t.Errorf("onFire = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArenaPoints(t *testing.T) {
+	cold := []store.TournamentPairing{finished("a", "b", ResultBlackWins, 1)}
+	onFire := []store.TournamentPairing{finished("a", "b", ResultWhiteWins, 1), finished("a", "c", ResultWhiteWins, 2)}
+
+	tests := []struct {
+		name     string
+		pairings []store.TournamentPairing
+		score    float64
+		berserk  bool
+		plies    int
+		want     float64
+	}{
+		{name: "win", pairings: cold, score: 1, plies: 40, want: 2},
+		{name: "draw", pairings: cold, score: 0.5, plies: 40, want: 1},
+		{name: "loss", pairings: cold, score: 0, plies: 40, want: 0},
+		{name: "win on fire", pairings: onFire, score: 1, plies: 40, want: 4},
+		{name: "draw on fire", pairings: onFire, score: 0.5, plies: 40, want: 2},
+		{name: "berserk win", pairings: cold, score: 1, berserk: true, plies: berserkMinPlies, want: 3},
+		{name: "berserk win on fire", pairings: onFire, score: 1, berserk: true, plies: 40, want: 5},
+		{name: "short berserk win", pairings: cold, score: 1, berserk: true, plies: berserkMinPlies - 1, want: 2},
+		{name: "berserk draw", pairings: cold, score: 0.5, berserk: true, plies: 40, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := arenaPoints(tt.pairings, "a", tt.score, tt.berserk, tt.plies); got != tt.want {
+				t.Errorf("arenaPoints = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
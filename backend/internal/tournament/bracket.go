@@ -0,0 +1,86 @@
+package tournament
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+// Bracket is the round-by-round view of a tournament: the schedule and
+// pairings of a round robin or Swiss, or the matches of a knockout.
+type Bracket struct {
+	TournamentID string         `json:"tournament_id"`
+	Format       string         `json:"format"`
+	Status       string         `json:"status"`
+	CurrentRound int            `json:"current_round"`
+	Rounds       []BracketRound `json:"rounds"`
+}
+
+type BracketRound struct {
+	Round       int                       `json:"round"`
+	ScheduledAt *time.Time                `json:"scheduled_at,omitempty"`
+	StartedAt   *time.Time                `json:"started_at,omitempty"`
+	Matches     []BracketMatch            `json:"matches,omitempty"`
+	Pairings    []store.TournamentPairing `json:"pairings,omitempty"`
+}
+
+// BracketMatch is a knockout match with the games played in it so far.
+type BracketMatch struct {
+	store.TournamentMatch
+	Games []store.TournamentPairing `json:"games"`
+}
+
+func (s *Service) Bracket(ctx context.Context, id string) (*Bracket, error) {
+	t, err := s.tournamentStore.GetTournament(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Format == FormatArena {
+		return nil, ErrNoBracket
+	}
+
+	schedule, err := s.tournamentStore.GetTournamentRounds(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := s.tournamentStore.GetTournamentMatches(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	bracket := &Bracket{TournamentID: t.ID, Format: t.Format, Status: t.Status, CurrentRound: t.CurrentRound}
+	rounds := max(t.Rounds, len(schedule))
+	for r := 1; r <= rounds; r++ {
+		br := BracketRound{Round: r}
+		if r <= len(schedule) {
+			br.ScheduledAt = &schedule[r-1].ScheduledAt
+			br.StartedAt = schedule[r-1].StartedAt
+		}
+		for _, m := range matches {
+			if m.Round != r {
+				continue
+			}
+			bm := BracketMatch{TournamentMatch: m, Games: []store.TournamentPairing{}}
+			for _, p := range pairings {
+				if p.MatchID == m.ID {
+					bm.Games = append(bm.Games, p)
+				}
+			}
+			br.Matches = append(br.Matches, bm)
+		}
+		if t.Format != FormatKnockout {
+			for _, p := range pairings {
+				if p.Round == r {
+					br.Pairings = append(br.Pairings, p)
+				}
+			}
+		}
+		bracket.Rounds = append(bracket.Rounds, br)
+	}
+	return bracket, nil
+}
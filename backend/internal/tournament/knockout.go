@@ -0,0 +1,254 @@
+package tournament
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+// bracketOrder returns the seeds, numbered from 1, in bracket order for a
+// bracket of size players: 1 v size, then so on, with the top two seeds
+// only able to meet in the final.
+func bracketOrder(size int) []int {
+	order := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// setUpKnockout seeds the players by rating into a bracket padded to a power
+// of two, the top seeds getting the byes, and schedules its rounds. It must
+// be called with s.mu held.
+func (s *Service) setUpKnockout(ctx context.Context, t *store.Tournament, players []store.TournamentPlayer, now time.Time) error {
+	seeds := seedOrder(players)
+	size, rounds := 1, 0
+	for size < len(seeds) {
+		size *= 2
+		rounds++
+	}
+
+	var matches []store.TournamentMatch
+	slots := size / 2
+	for r := 1; r <= rounds; r++ {
+		for slot := range slots {
+			matches = append(matches, store.TournamentMatch{TournamentID: t.ID, Round: r, Slot: slot, Status: store.MatchWaiting})
+		}
+		slots /= 2
+	}
+
+	order := bracketOrder(size)
+	for slot := range size / 2 {
+		m := &matches[slot]
+		m.Player1UserID = seeds[order[2*slot]-1]
+		if seed := order[2*slot+1]; seed <= len(seeds) {
+			m.Player2UserID = seeds[seed-1]
+			m.Status = store.MatchScheduled
+			continue
+		}
+		m.WinnerUserID = m.Player1UserID
+		m.Status = store.MatchFinished
+		if rounds > 1 {
+			advanceWinner(matches, m)
+		}
+	}
+
+	if err := s.tournamentStore.ScheduleTournament(ctx, t.ID, roundSchedule(t, rounds, now)); err != nil {
+		return err
+	}
+	t.Rounds = rounds
+	return s.tournamentStore.CreateTournamentMatches(ctx, matches)
+}
+
+// advanceWinner puts the winner of m into its next-round match and returns
+// that match, or nil after the final.
+func advanceWinner(matches []store.TournamentMatch, m *store.TournamentMatch) *store.TournamentMatch {
+	for i := range matches {
+		next := &matches[i]
+		if next.Round != m.Round+1 || next.Slot != m.Slot/2 {
+			continue
+		}
+		if m.Slot%2 == 0 {
+			next.Player1UserID = m.WinnerUserID
+		} else {
+			next.Player2UserID = m.WinnerUserID
+		}
+		if next.Player1UserID != "" && next.Player2UserID != "" {
+			next.Status = store.MatchScheduled
+		}
+		return next
+	}
+	return nil
+}
+
+// advanceKnockout moves every match of the bracket along: a scheduled match
+// starts when its round is due, a match in play gets its next game, and a
+// decided match sends its winner on. The tournament finishes with the
+// final. It must be called with s.mu held.
+func (s *Service) advanceKnockout(ctx context.Context, t *store.Tournament, now time.Time) error {
+	matches, err := s.tournamentStore.GetTournamentMatches(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	rounds, err := s.tournamentStore.GetTournamentRounds(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 || len(rounds) == 0 {
+		return s.finish(ctx, t)
+	}
+	withdrawn := withdrawnPlayers(players)
+
+	for i := range matches {
+		m := &matches[i]
+		switch m.Status {
+		case store.MatchScheduled:
+			round := rounds[m.Round-1]
+			if now.Before(round.ScheduledAt) {
+				continue
+			}
+			if err := s.tournamentStore.StartTournamentRound(ctx, t.ID, m.Round, now); err != nil {
+				return err
+			}
+			if m.Round > t.CurrentRound {
+				advanced, err := s.tournamentStore.AdvanceTournamentRound(ctx, t.ID, t.CurrentRound, m.Round)
+				if err != nil {
+					return err
+				}
+				if !advanced {
+					// Another node started the round.
+					return nil
+				}
+				t.CurrentRound = m.Round
+			}
+			m.Status = store.MatchPlaying
+			if err := s.tournamentStore.UpdateTournamentMatch(ctx, m); err != nil {
+				return err
+			}
+			fallthrough
+		case store.MatchPlaying, store.MatchArmageddon:
+			if err := s.advanceMatch(ctx, t, matches, m, pairings, withdrawn, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	if final := matches[len(matches)-1]; final.Status == store.MatchFinished {
+		return s.finish(ctx, t)
+	}
+	return nil
+}
+
+// advanceMatch plays a match's games in turn, the players swapping colours,
+// then an Armageddon game if the match is tied. When Armageddon also ends
+// without a winner because both players forfeited, the higher seed goes
+// through. It must be called with s.mu held.
+func (s *Service) advanceMatch(ctx context.Context, t *store.Tournament, matches []store.TournamentMatch, m *store.TournamentMatch, pairings []store.TournamentPairing, withdrawn map[string]bool, now time.Time) error {
+	var games []store.TournamentPairing
+	for _, p := range pairings {
+		if p.MatchID == m.ID {
+			games = append(games, p)
+		}
+	}
+
+	if len(games) > 0 {
+		last := &games[len(games)-1]
+		if last.Result == "" {
+			if last.GameID != "" {
+				return nil
+			}
+			if err := s.playScheduled(ctx, t, last, withdrawn, last.CreatedAt, now); err != nil || last.Result == "" {
+				return err
+			}
+		}
+	}
+
+	m.Player1Score, m.Player2Score = 0, 0
+	var armageddon *store.TournamentPairing
+	for i, p := range games {
+		if p.Armageddon {
+			armageddon = &games[i]
+			continue
+		}
+		m.Player1Score += pointsOf(p, m.Player1UserID)
+		m.Player2Score += pointsOf(p, m.Player2UserID)
+	}
+
+	next := &store.TournamentPairing{TournamentID: t.ID, Round: m.Round, MatchID: m.ID}
+	switch {
+	case armageddon != nil:
+		m.WinnerUserID = m.Player1UserID
+		if pointsOf(*armageddon, m.Player2UserID) > pointsOf(*armageddon, m.Player1UserID) {
+			m.WinnerUserID = m.Player2UserID
+		}
+	case len(games) < t.MatchGames:
+		next.WhiteUserID, next.BlackUserID = m.Player1UserID, m.Player2UserID
+		if len(games)%2 == 1 {
+			next.WhiteUserID, next.BlackUserID = next.BlackUserID, next.WhiteUserID
+		}
+	case m.Player1Score > m.Player2Score:
+		m.WinnerUserID = m.Player1UserID
+	case m.Player2Score > m.Player1Score:
+		m.WinnerUserID = m.Player2UserID
+	default:
+		m.Status = store.MatchArmageddon
+		next.Armageddon = true
+		next.WhiteUserID, next.BlackUserID = m.Player1UserID, m.Player2UserID
+		if rand.IntN(2) == 0 {
+			next.WhiteUserID, next.BlackUserID = next.BlackUserID, next.WhiteUserID
+		}
+	}
+
+	if m.WinnerUserID == "" {
+		if err := s.tournamentStore.UpdateTournamentMatch(ctx, m); err != nil {
+			return err
+		}
+		_, err := s.tournamentStore.CreateTournamentPairing(ctx, next)
+		return err
+	}
+
+	m.Status = store.MatchFinished
+	if err := s.tournamentStore.UpdateTournamentMatch(ctx, m); err != nil {
+		return err
+	}
+	if following := advanceWinner(matches, m); following != nil {
+		if err := s.tournamentStore.UpdateTournamentMatch(ctx, following); err != nil {
+			return err
+		}
+	}
+	return s.publishStandings(ctx, t, gamemanager.TOURNAMENT_STANDINGS)
+}
+
+// bracketProgress ranks knockout players by the furthest round they reached,
+// the champion one past the final.
+func bracketProgress(matches []store.TournamentMatch) map[string]int {
+	reached := make(map[string]int)
+	for _, m := range matches {
+		for _, userID := range []string{m.Player1UserID, m.Player2UserID} {
+			if userID != "" {
+				reached[userID] = max(reached[userID], m.Round)
+			}
+		}
+	}
+	if len(matches) > 0 {
+		if final := matches[len(matches)-1]; final.WinnerUserID != "" {
+			reached[final.WinnerUserID] = final.Round + 1
+		}
+	}
+	return reached
+}
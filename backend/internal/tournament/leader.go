@@ -0,0 +1,53 @@
+package tournament
+
+import (
+	"context"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	leaderKey = "tournament:leader"
+	// leaderTTL is how long the pairing loop stays with a node that stopped
+	// renewing its lease before another node takes over.
+	leaderTTL = 5 * tickInterval
+)
+
+// acquireLeaderScript extends the node's lease on the pairing loop, taking
+// it if no node holds it. It returns 0 when another node does.
+var acquireLeaderScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if not owner then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// lead reports whether the node runs the pairing loop. In a cluster only
+// the node holding the leader lease does, so rounds are paired and
+// tournaments started once; the lease is renewed on every call, and tick
+// calls it before each tournament so a node whose lease lapsed stops
+// halfway. A single node always leads. It must be called with s.mu held.
+func (s *Service) lead(ctx context.Context) bool {
+	nodeID := s.gm.NodeID()
+	if nodeID == "" {
+		return true
+	}
+	held, err := acquireLeaderScript.Run(ctx, s.redisClient, []string{leaderKey}, nodeID, leaderTTL.Milliseconds()).Int()
+	if err != nil {
+		log.Printf("Failed to renew tournament leader lease: %v", err)
+		held = 0
+	}
+	if leader := held == 1; leader != s.leader {
+		s.leader = leader
+		if leader {
+			log.Printf("Node %s now pairs tournaments", nodeID)
+		}
+	}
+	return s.leader
+}
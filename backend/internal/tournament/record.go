@@ -0,0 +1,127 @@
+package tournament
+
+import (
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/notnil/chess"
+)
+
+// record is a player's history in a tournament, as the pairing rules and
+// tiebreaks see it.
+type record struct {
+	userID    string
+	rating    int
+	withdrawn bool
+	// points is the tournament score: the game score in Swiss, the Arena
+	// points otherwise.
+	points float64
+	// games are the games actually played, in order. Byes and forfeits
+	// count for points only.
+	games     []playedGame
+	opponents map[string]bool
+	hadBye    bool
+	// pending is set while the player has a game in progress.
+	pending bool
+}
+
+type playedGame struct {
+	opponent string
+	color    chess.Color
+	// score is 1, 0.5 or 0.
+	score float64
+}
+
+// buildRecords replays the pairings, in the order they were made, into one
+// record per player.
+func buildRecords(players []store.TournamentPlayer, pairings []store.TournamentPairing) map[string]*record {
+	records := make(map[string]*record, len(players))
+	for _, p := range players {
+		records[p.UserID] = &record{
+			userID:    p.UserID,
+			rating:    p.Rating,
+			withdrawn: p.Withdrawn,
+			opponents: make(map[string]bool),
+		}
+	}
+	get := func(userID string) *record {
+		if rec, ok := records[userID]; ok {
+			return rec
+		}
+		rec := &record{userID: userID, opponents: make(map[string]bool)}
+		records[userID] = rec
+		return rec
+	}
+
+	for _, p := range pairings {
+		white := get(p.WhiteUserID)
+		if p.Result == ResultBye {
+			white.hadBye = true
+			white.points += p.WhitePoints
+			continue
+		}
+		black := get(p.BlackUserID)
+		if p.Result == "" {
+			white.pending = true
+			black.pending = true
+			continue
+		}
+		white.points += p.WhitePoints
+		black.points += p.BlackPoints
+		if p.GameID == "" {
+			continue
+		}
+
+		whiteScore := gameScoreOf(p.Result)
+		white.games = append(white.games, playedGame{opponent: black.userID, color: chess.White, score: whiteScore})
+		black.games = append(black.games, playedGame{opponent: white.userID, color: chess.Black, score: 1 - whiteScore})
+		white.opponents[black.userID] = true
+		black.opponents[white.userID] = true
+	}
+	return records
+}
+
+// gameScoreOf is White's score in a played game's result.
+func gameScoreOf(result string) float64 {
+	switch result {
+	case ResultWhiteWins:
+		return 1
+	case ResultBlackWins:
+		return 0
+	}
+	return 0.5
+}
+
+// tiebreaks computes the Buchholz score, the sum of the opponents' scores,
+// and the Sonneborn-Berger score, the sum of the scores of beaten opponents
+// plus half those of drawn ones. Only games played over the board count.
+func tiebreaks(rec *record, records map[string]*record) (buchholz float64, sonnebornBerger float64) {
+	for _, g := range rec.games {
+		opponent := records[g.opponent].points
+		buchholz += opponent
+		sonnebornBerger += opponent * g.score
+	}
+	return buchholz, sonnebornBerger
+}
+
+// colorBalance is how many more games the player had with White than with
+// Black.
+func (r *record) colorBalance() int {
+	balance := 0
+	for _, g := range r.games {
+		if g.color == chess.White {
+			balance++
+		} else {
+			balance--
+		}
+	}
+	return balance
+}
+
+// lastColors returns the colours of the player's last n games, most recent
+// last.
+func (r *record) lastColors(n int) []chess.Color {
+	var colors []chess.Color
+	for _, g := range r.games[max(0, len(r.games)-n):] {
+		colors = append(colors, g.color)
+	}
+	return colors
+}
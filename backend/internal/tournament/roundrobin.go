@@ -0,0 +1,158 @@
+package tournament
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+// bergerTable returns the rounds of a round robin between n seeds, n even,
+// as pairs of seed indexes with White first. Seed n-1 keeps its place and
+// alternates colours; the others rotate by n/2 places every round, as in
+// the FIDE Berger tables.
+func bergerTable(n int) [][][2]int {
+	m := n - 1
+	rounds := make([][][2]int, 0, m)
+	for r := range m {
+		a := r * (n / 2) % m
+		games := make([][2]int, 0, n/2)
+		if r%2 == 0 {
+			games = append(games, [2]int{a, m})
+		} else {
+			games = append(games, [2]int{m, a})
+		}
+		for i := 1; i < n/2; i++ {
+			games = append(games, [2]int{(a + i) % m, (a - i + m) % m})
+		}
+		rounds = append(rounds, games)
+	}
+	return rounds
+}
+
+// setUpRoundRobin seeds the players by rating and schedules every round of
+// the Berger table up front. With an odd field, the player drawn against
+// the missing seed rests that round. It must be called with s.mu held.
+func (s *Service) setUpRoundRobin(ctx context.Context, t *store.Tournament, players []store.TournamentPlayer, now time.Time) error {
+	seeds := seedOrder(players)
+	if len(seeds)%2 == 1 {
+		seeds = append(seeds, "")
+	}
+	table := bergerTable(len(seeds))
+
+	if err := s.tournamentStore.ScheduleTournament(ctx, t.ID, roundSchedule(t, len(table), now)); err != nil {
+		return err
+	}
+	t.Rounds = len(table)
+
+	for r, games := range table {
+		for _, g := range games {
+			p := &store.TournamentPairing{
+				TournamentID: t.ID,
+				Round:        r + 1,
+				WhiteUserID:  seeds[g[0]],
+				BlackUserID:  seeds[g[1]],
+			}
+			switch {
+			case p.WhiteUserID == "":
+				p.WhiteUserID, p.BlackUserID, p.Result = p.BlackUserID, "", ResultBye
+			case p.BlackUserID == "":
+				p.Result = ResultBye
+			}
+			if _, err := s.tournamentStore.CreateTournamentPairing(ctx, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// advanceRoundRobin starts each round at its scheduled time, or as soon as
+// the previous one is over if that is later, and plays its games. It must be
+// called with s.mu held.
+func (s *Service) advanceRoundRobin(ctx context.Context, t *store.Tournament, now time.Time) error {
+	rounds, err := s.tournamentStore.GetTournamentRounds(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+
+	if t.CurrentRound == 0 || roundOver(pairings, t.CurrentRound) {
+		if t.CurrentRound >= len(rounds) {
+			return s.finish(ctx, t)
+		}
+		next := &rounds[t.CurrentRound]
+		if now.Before(next.ScheduledAt) {
+			return nil
+		}
+		advanced, err := s.tournamentStore.AdvanceTournamentRound(ctx, t.ID, t.CurrentRound, next.Round)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			// Another node started the round.
+			return nil
+		}
+		if err := s.tournamentStore.StartTournamentRound(ctx, t.ID, next.Round, now); err != nil {
+			return err
+		}
+		next.StartedAt = &now
+		t.CurrentRound = next.Round
+		if err := s.publishStandings(ctx, t, gamemanager.TOURNAMENT_STANDINGS); err != nil {
+			return err
+		}
+	}
+
+	round := rounds[t.CurrentRound-1]
+	since := round.ScheduledAt
+	if round.StartedAt != nil {
+		since = *round.StartedAt
+	}
+	withdrawn := withdrawnPlayers(players)
+	for i := range pairings {
+		p := &pairings[i]
+		if p.Round != t.CurrentRound || p.Result != "" || p.GameID != "" {
+			continue
+		}
+		if err := s.playScheduled(ctx, t, p, withdrawn, since, now); err != nil {
+			return err
+		}
+		if p.Result != "" {
+			if err := s.publishStandings(ctx, t, gamemanager.TOURNAMENT_STANDINGS); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func roundOver(pairings []store.TournamentPairing, round int) bool {
+	for _, p := range pairings {
+		if p.Round == round && p.Result == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// seedOrder lists the players from the highest rated down.
+func seedOrder(players []store.TournamentPlayer) []string {
+	sorted := append([]store.TournamentPlayer(nil), players...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Rating > sorted[j].Rating
+	})
+	seeds := make([]string, 0, len(sorted))
+	for _, p := range sorted {
+		seeds = append(seeds, p.UserID)
+	}
+	return seeds
+}
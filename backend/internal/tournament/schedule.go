@@ -0,0 +1,101 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+)
+
+// armageddonBlackTime is Black's share of the initial time in an Armageddon
+// game, in percent.
+const armageddonBlackTime = 80
+
+// roundSchedule spaces n rounds by the tournament's round interval from
+// start.
+func roundSchedule(t *store.Tournament, n int, start time.Time) []store.TournamentRound {
+	interval := time.Duration(t.RoundIntervalSeconds) * time.Second
+	rounds := make([]store.TournamentRound, 0, n)
+	for i := range n {
+		rounds = append(rounds, store.TournamentRound{
+			TournamentID: t.ID,
+			Round:        i + 1,
+			ScheduledAt:  start.Add(time.Duration(i) * interval),
+		})
+	}
+	return rounds
+}
+
+func forfeitAfter(t *store.Tournament) time.Duration {
+	if t.ForfeitAfterSeconds == 0 {
+		return DefaultForfeitAfter
+	}
+	return time.Duration(t.ForfeitAfterSeconds) * time.Second
+}
+
+func withdrawnPlayers(players []store.TournamentPlayer) map[string]bool {
+	withdrawn := make(map[string]bool)
+	for _, p := range players {
+		if p.Withdrawn {
+			withdrawn[p.UserID] = true
+		}
+	}
+	return withdrawn
+}
+
+// playScheduled starts the game of a pairing that is due once both players
+// are connected and free. A withdrawn player forfeits at once; otherwise
+// whoever is still missing forfeits when forfeitAfter has passed since. It
+// must be called with s.mu held.
+func (s *Service) playScheduled(ctx context.Context, t *store.Tournament, p *store.TournamentPairing, withdrawn map[string]bool, since time.Time, now time.Time) error {
+	ready := func(userID string) bool {
+		return !withdrawn[userID] && s.gm.IsConnected(userID) && !s.gm.IsPlaying(userID)
+	}
+	whiteReady, blackReady := ready(p.WhiteUserID), ready(p.BlackUserID)
+
+	if whiteReady && blackReady {
+		game, err := s.newGame(t, p.WhiteUserID, p.BlackUserID, p.Armageddon)
+		if err != nil {
+			return err
+		}
+		// The pairing refers to the game's row, which starting the game
+		// creates; HandleGameEnd waits for s.mu, so it finds the pairing.
+		err = s.gm.StartGame(game)
+		if errors.Is(err, gamemanager.ErrAlreadyInGame) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p.GameID = game.ID
+		return s.tournamentStore.UpdateTournamentPairing(ctx, p)
+	}
+
+	whiteGone, blackGone := withdrawn[p.WhiteUserID], withdrawn[p.BlackUserID]
+	if !whiteGone && !blackGone {
+		if now.Sub(since) < forfeitAfter(t) {
+			return nil
+		}
+		whiteGone, blackGone = !whiteReady, !blackReady
+	}
+
+	switch {
+	case whiteGone && blackGone:
+		p.Result = ResultDoubleForfeit
+	case whiteGone:
+		p.Result, p.BlackPoints = ResultBlackByForfeit, 1
+	default:
+		p.Result, p.WhitePoints = ResultWhiteByForfeit, 1
+	}
+	return s.tournamentStore.UpdateTournamentPairing(ctx, p)
+}
+
+// pointsOf is userID's points from a pairing.
+func pointsOf(p store.TournamentPairing, userID string) float64 {
+	if p.WhiteUserID == userID {
+		return p.WhitePoints
+	}
+	return p.BlackPoints
+}
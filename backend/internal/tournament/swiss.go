@@ -0,0 +1,328 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/notnil/chess"
+)
+
+// maxPairingSteps bounds the backtracking search for one set of pairing
+// rules before the next, looser set is tried.
+const maxPairingSteps = 20000
+
+// Pairing rules are relaxed in this order when a round cannot be paired.
+const (
+	rulesStrict = iota
+	rulesIgnoreColors
+	rulesAllowRematches
+)
+
+type pairing struct {
+	white string
+	black string
+}
+
+// advanceSwiss pairs the next round once every game of the current one is
+// over and roundInterval has passed, and finishes the tournament after its
+// last round. It must be called with s.mu held.
+func (s *Service) advanceSwiss(ctx context.Context, t *store.Tournament, now time.Time) error {
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pairings {
+		if p.Result == "" {
+			return nil
+		}
+	}
+	if t.CurrentRound > 0 {
+		ended, ok := s.roundEnded[t.ID]
+		if !ok {
+			// The round ended before a restart, on another node, or
+			// without any game.
+			ended = now
+			s.roundEnded[t.ID] = ended
+		}
+		if now.Sub(ended) < roundInterval {
+			return nil
+		}
+	}
+
+	records := buildRecords(players, pairings)
+	var field []*record
+	for _, p := range active(players) {
+		field = append(field, records[p.UserID])
+	}
+	if t.CurrentRound >= t.Rounds || len(field) < 2 {
+		return s.finish(ctx, t)
+	}
+
+	round := t.CurrentRound + 1
+	advanced, err := s.tournamentStore.AdvanceTournamentRound(ctx, t.ID, t.CurrentRound, round)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		// Another node paired the round.
+		return nil
+	}
+	t.CurrentRound = round
+	delete(s.roundEnded, t.ID)
+
+	games, bye := pairSwiss(field)
+	if bye != "" {
+		_, err := s.tournamentStore.CreateTournamentPairing(ctx, &store.TournamentPairing{
+			TournamentID: t.ID,
+			Round:        round,
+			WhiteUserID:  bye,
+			Result:       ResultBye,
+			WhitePoints:  1,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, g := range games {
+		if err := s.startSwissGame(ctx, t, round, g); err != nil {
+			log.Printf("Failed to start game %s vs %s in tournament %s: %v", g.white, g.black, t.ID, err)
+		}
+	}
+	log.Printf("Tournament %s round %d paired: %d games", t.ID, round, len(games))
+
+	return s.publishStandings(ctx, t, gamemanager.TOURNAMENT_STANDINGS)
+}
+
+// startSwissGame starts a paired game. A player still busy in another game
+// forfeits; players who are not connected get the game when they connect,
+// or lose it on time. It must be called with s.mu held.
+func (s *Service) startSwissGame(ctx context.Context, t *store.Tournament, round int, g pairing) error {
+	whiteBusy, blackBusy := s.gm.IsPlaying(g.white), s.gm.IsPlaying(g.black)
+	if !whiteBusy && !blackBusy {
+		err := s.startGame(ctx, t, round, g.white, g.black)
+		if !errors.Is(err, gamemanager.ErrAlreadyInGame) {
+			return err
+		}
+		whiteBusy, blackBusy = s.gm.IsPlaying(g.white), s.gm.IsPlaying(g.black)
+	}
+
+	forfeit := &store.TournamentPairing{
+		TournamentID: t.ID,
+		Round:        round,
+		WhiteUserID:  g.white,
+		BlackUserID:  g.black,
+		Result:       ResultDoubleForfeit,
+	}
+	switch {
+	case whiteBusy && !blackBusy:
+		forfeit.Result, forfeit.BlackPoints = ResultBlackByForfeit, 1
+	case blackBusy && !whiteBusy:
+		forfeit.Result, forfeit.WhitePoints = ResultWhiteByForfeit, 1
+	}
+	_, err := s.tournamentStore.CreateTournamentPairing(ctx, forfeit)
+	return err
+}
+
+// pairSwiss pairs a round. field holds the players to pair; the lowest
+// ranked player who has not had a bye sits out an odd field with a point.
+// Players meet opponents from their own score group where possible, the top
+// half of the group against the bottom half, never play anyone twice, and
+// never have the same colour three times in a row or more than two more
+// games with one colour than the other. The rules are relaxed in turn when
+// no pairing satisfies them.
+func pairSwiss(field []*record) ([]pairing, string) {
+	sorted := append([]*record(nil), field...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.points != b.points {
+			return a.points > b.points
+		}
+		if a.rating != b.rating {
+			return a.rating > b.rating
+		}
+		return a.userID < b.userID
+	})
+
+	for rules := rulesStrict; rules <= rulesAllowRematches; rules++ {
+		if len(sorted)%2 == 0 {
+			if games, ok := pairField(sorted, rules); ok {
+				return games, ""
+			}
+			continue
+		}
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if sorted[i].hadBye && rules < rulesAllowRematches {
+				continue
+			}
+			rest := append(append([]*record(nil), sorted[:i]...), sorted[i+1:]...)
+			if games, ok := pairField(rest, rules); ok {
+				return games, sorted[i].userID
+			}
+		}
+	}
+	return nil, ""
+}
+
+type swissPairer struct {
+	field []*record
+	rules int
+	used  []bool
+	games []pairing
+	steps int
+}
+
+func pairField(field []*record, rules int) ([]pairing, bool) {
+	p := &swissPairer{field: field, rules: rules, used: make([]bool, len(field))}
+	if !p.solve() {
+		return nil, false
+	}
+	return p.games, true
+}
+
+// solve pairs the highest ranked unpaired player with each acceptable
+// opponent in turn, backtracking when the rest of the field cannot be
+// paired.
+func (p *swissPairer) solve() bool {
+	p.steps++
+	if p.steps > maxPairingSteps {
+		return false
+	}
+
+	first := -1
+	for i, used := range p.used {
+		if !used {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return true
+	}
+
+	p.used[first] = true
+	for _, j := range p.candidates(first) {
+		white, black, ok := allocateColors(p.field[first], p.field[j], p.rules >= rulesIgnoreColors)
+		if !ok {
+			continue
+		}
+		p.used[j] = true
+		p.games = append(p.games, pairing{white: white.userID, black: black.userID})
+		if p.solve() {
+			return true
+		}
+		p.used[j] = false
+		p.games = p.games[:len(p.games)-1]
+	}
+	p.used[first] = false
+	return false
+}
+
+// candidates orders the opponents for field[i]: its own score group first,
+// starting from the player half a group below it, then the groups below.
+func (p *swissPairer) candidates(i int) []int {
+	player := p.field[i]
+
+	var unpaired []int
+	groupSize := 1
+	for j, used := range p.used {
+		if used {
+			continue
+		}
+		unpaired = append(unpaired, j)
+		if p.field[j].points == player.points {
+			groupSize++
+		}
+	}
+
+	type candidate struct {
+		index    int
+		distance float64
+		offset   int
+	}
+	var candidates []candidate
+	for k, j := range unpaired {
+		opponent := p.field[j]
+		if p.rules < rulesAllowRematches && player.opponents[opponent.userID] {
+			continue
+		}
+		distance := player.points - opponent.points
+		if distance < 0 {
+			distance = -distance
+		}
+		offset := k + 1 - groupSize/2
+		if offset < 0 {
+			offset = -offset
+		}
+		candidates = append(candidates, candidate{index: j, distance: distance, offset: offset})
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].distance != candidates[b].distance {
+			return candidates[a].distance < candidates[b].distance
+		}
+		return candidates[a].offset < candidates[b].offset
+	})
+
+	indexes := make([]int, 0, len(candidates))
+	for _, c := range candidates {
+		indexes = append(indexes, c.index)
+	}
+	return indexes
+}
+
+// colorPreference is the colour a player should get next and how strongly:
+// 2 when any other colour would break the colour rules, 1 to even out or
+// alternate their colours, 0 before their first game.
+func colorPreference(r *record) (chess.Color, int) {
+	balance := r.colorBalance()
+	last := r.lastColors(2)
+	switch {
+	case balance <= -2 || (len(last) == 2 && last[0] == chess.Black && last[1] == chess.Black):
+		return chess.White, 2
+	case balance >= 2 || (len(last) == 2 && last[0] == chess.White && last[1] == chess.White):
+		return chess.Black, 2
+	case balance < 0:
+		return chess.White, 1
+	case balance > 0:
+		return chess.Black, 1
+	case len(last) > 0:
+		return last[len(last)-1].Other(), 1
+	}
+	return chess.NoColor, 0
+}
+
+// allocateColors decides who plays White between a and its lower ranked
+// opponent b. The stronger preference wins and a wins ties. ok is false
+// when both players must have the same colour, unless colour rules are
+// ignored.
+func allocateColors(a, b *record, ignoreRules bool) (white, black *record, ok bool) {
+	wantA, strengthA := colorPreference(a)
+	wantB, strengthB := colorPreference(b)
+
+	if wantA == wantB && strengthA == 2 && strengthB == 2 && !ignoreRules {
+		return nil, nil, false
+	}
+
+	aWhite := true
+	switch {
+	case wantA != wantB:
+		aWhite = wantA == chess.White || wantB == chess.Black
+	case strengthB > strengthA:
+		aWhite = wantB != chess.White
+	default:
+		aWhite = wantA != chess.Black
+	}
+	if aWhite {
+		return a, b, true
+	}
+	return b, a, true
+}
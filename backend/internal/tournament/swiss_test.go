@@ -0,0 +1,150 @@
+package tournament
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// player builds the record of a player with the given points whose games,
+// oldest first, were played with colors ('w' or 'b') against opponents.
+func player(userID string, points float64, colors string, opponents ...string) *record {
+	r := &record{userID: userID, rating: 1500, points: points, opponents: make(map[string]bool)}
+	for i, c := range colors {
+		color := chess.White
+		if c == 'b' {
+			color = chess.Black
+		}
+		g := playedGame{color: color}
+		if i < len(opponents) {
+			g.opponent = opponents[i]
+		}
+		r.games = append(r.games, g)
+	}
+	for _, opponent := range opponents {
+		r.opponents[opponent] = true
+	}
+	return r
+}
+
+func withBye(r *record) *record {
+	r.hadBye = true
+	return r
+}
+
+func TestPairSwiss(t *testing.T) {
+	tests := []struct {
+		name  string
+		field []*record
+		// games are the expected pairings, as white and black.
+		games [][2]string
+		bye   string
+	}{
+		{
+			name:  "even field pairs top half against bottom half",
+			field: []*record{player("a", 0, ""), player("b", 0, ""), player("c", 0, ""), player("d", 0, "")},
+			games: [][2]string{{"a", "c"}, {"b", "d"}},
+		},
+		{
+			name: "odd field gives the lowest ranked player a bye",
+			field: []*record{
+				player("a", 2, ""), player("b", 1.5, ""), player("c", 1, ""), player("d", 0.5, ""), player("e", 0, ""),
+			},
+			games: [][2]string{{"a", "b"}, {"c", "d"}},
+			bye:   "e",
+		},
+		{
+			name: "no player gets a second bye",
+			field: []*record{
+				player("a", 2, ""), player("b", 1.5, ""), player("c", 1, ""), player("d", 0.5, ""), withBye(player("e", 0, "")),
+			},
+			games: [][2]string{{"a", "b"}, {"c", "e"}},
+			bye:   "d",
+		},
+		{
+			name: "no rematches",
+			field: []*record{
+				player("a", 0, "", "c"), player("b", 0, "", "d"), player("c", 0, "", "a"), player("d", 0, "", "b"),
+			},
+			games: [][2]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name: "colours give way before rematches",
+			field: []*record{
+				player("a", 1, "bb", "c", "d"), player("b", 1, "bb", "c", "d"),
+				player("c", 1, "ww", "a", "b"), player("d", 1, "ww", "a", "b"),
+			},
+			games: [][2]string{{"a", "b"}, {"d", "c"}},
+		},
+		{
+			name:  "rematch when nothing else is possible",
+			field: []*record{player("a", 1, "w", "b"), player("b", 0, "b", "a")},
+			games: [][2]string{{"b", "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			games, bye := pairSwiss(tt.field)
+			if bye != tt.bye {
+				t.Errorf("bye = %q, want %q", bye, tt.bye)
+			}
+			if len(games) != len(tt.games) {
+				t.Fatalf("got %d games %v, want %v", len(games), games, tt.games)
+			}
+			for i, g := range games {
+				if want := tt.games[i]; g.white != want[0] || g.black != want[1] {
+					t.Errorf("game %d = %s vs %s, want %s vs %s", i, g.white, g.black, want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+func TestPairSwissRelaxesRulesInOrder(t *testing.T) {
+	field := []*record{
+		player("a", 1, "bb", "c", "d"), player("b", 1, "bb", "c", "d"),
+		player("c", 1, "ww", "a", "b"), player("d", 1, "ww", "a", "b"),
+	}
+	for rules, wantOK := range map[int]bool{rulesStrict: false, rulesIgnoreColors: true, rulesAllowRematches: true} {
+		if _, ok := pairField(field, rules); ok != wantOK {
+			t.Errorf("pairField with rules %d: ok = %v, want %v", rules, ok, wantOK)
+		}
+	}
+}
+
+func TestAllocateColors(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        string
+		ignoreRules bool
+		aWhite      bool
+		ok          bool
+	}{
+		{name: "higher ranked player has White in the first game", a: "", b: "", aWhite: true, ok: true},
+		{name: "alternate colours", a: "w", b: "b", aWhite: false, ok: true},
+		{name: "even out colours", a: "wbw", b: "", aWhite: false, ok: true},
+		{name: "stronger preference wins", a: "b", b: "bb", aWhite: false, ok: true},
+		{name: "higher ranked player wins ties", a: "b", b: "b", aWhite: true, ok: true},
+		{name: "both due black", a: "ww", b: "w", aWhite: false, ok: true},
+		{name: "both must have white", a: "bb", b: "wbb", ok: false},
+		{name: "both must have white, rules ignored", a: "bb", b: "wbb", ignoreRules: true, aWhite: true, ok: true},
+		{name: "colour balance rule", a: "wwbw", b: "", aWhite: false, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := player("a", 0, tt.a), player("b", 0, tt.b)
+			white, black, ok := allocateColors(a, b, tt.ignoreRules)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if aWhite := white == a && black == b; aWhite != tt.aWhite {
+				t.Errorf("a has White: %v, want %v", aWhite, tt.aWhite)
+			}
+		})
+	}
+}
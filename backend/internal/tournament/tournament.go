@@ -0,0 +1,754 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/rating"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/variant"
+	"github.com/notnil/chess"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	FormatSwiss      = "swiss"
+	FormatArena      = "arena"
+	FormatRoundRobin = "round_robin"
+	FormatKnockout   = "knockout"
+
+	MaxNameLength        = 100
+	MaxSwissRounds       = 20
+	MinArenaDuration     = 10 * time.Minute
+	MaxArenaDuration     = 6 * time.Hour
+	MaxRoundRobinPlayers = 20
+	MaxRoundInterval     = 7 * 24 * time.Hour
+	DefaultForfeitAfter  = 5 * time.Minute
+	MaxForfeitAfter      = time.Hour
+	DefaultMatchGames    = 2
+	MaxMatchGames        = 10
+	// DefaultStartDelay is how long after creation a tournament starts when
+	// no start time is given, leaving time for players to join.
+	DefaultStartDelay = 5 * time.Minute
+
+	tickInterval = 2 * time.Second
+	// roundInterval is the pause between the last game of a Swiss round
+	// and the pairings of the next.
+	roundInterval = 10 * time.Second
+)
+
+// Results of a pairing. Byes and forfeits have no game.
+const (
+	ResultWhiteWins      = "1-0"
+	ResultBlackWins      = "0-1"
+	ResultDraw           = "1/2-1/2"
+	ResultBye            = "bye"
+	ResultWhiteByForfeit = "+/-"
+	ResultBlackByForfeit = "-/+"
+	ResultDoubleForfeit  = "-/-"
+)
+
+var (
+	ErrInvalidName       = errors.New("tournament name must be between 1 and 100 characters")
+	ErrUnknownFormat     = errors.New("unknown tournament format")
+	ErrUntimed           = errors.New("tournaments must be played with a clock")
+	ErrInvalidRounds     = errors.New("invalid number of rounds")
+	ErrInvalidDuration   = errors.New("invalid tournament duration")
+	ErrNotCreator        = errors.New("only the creator can start the tournament")
+	ErrAlreadyStarted    = errors.New("tournament has already started")
+	ErrNotEnoughPlayers  = errors.New("a tournament needs at least two players")
+	ErrRegistrationEnded = errors.New("tournament is no longer open to new players")
+	ErrTournamentOver    = errors.New("tournament is over")
+	ErrNotPlaying        = errors.New("you have no tournament game in progress")
+	ErrBerserkNotAllowed = errors.New("berserk is only available in arena tournaments")
+	ErrInvalidSchedule   = errors.New("invalid round interval or forfeit time")
+	ErrInvalidMatchGames = errors.New("invalid number of games per match")
+	ErrTournamentFull    = errors.New("tournament is full")
+	ErrNoBracket         = errors.New("arena tournaments have no bracket")
+)
+
+// Request describes a tournament to be created. Rounds applies to Swiss and
+// DurationMinutes to Arena tournaments. Round-robin and knockout rounds are
+// scheduled RoundIntervalMinutes apart, and a player who has not turned up
+// ForfeitAfterMinutes after their game was due forfeits it. MatchGames is
+// the length of a knockout match. StartsAt defaults to DefaultStartDelay
+// from now.
+type Request struct {
+	Name                 string                           `json:"name"`
+	Format               string                           `json:"format"`
+	TimeControl          *gamemanager.IncomingTimeControl `json:"time_control,omitempty"`
+	Variant              string                           `json:"variant,omitempty"`
+	Rated                bool                             `json:"rated"`
+	Rounds               int                              `json:"rounds,omitempty"`
+	DurationMinutes      int                              `json:"duration_minutes,omitempty"`
+	RoundIntervalMinutes int                              `json:"round_interval_minutes,omitempty"`
+	ForfeitAfterMinutes  int                              `json:"forfeit_after_minutes,omitempty"`
+	MatchGames           int                              `json:"match_games,omitempty"`
+	StartsAt             *time.Time                       `json:"starts_at,omitempty"`
+}
+
+// Details is a tournament with its current standings and every pairing made
+// so far.
+type Details struct {
+	*store.Tournament
+	Standings []store.TournamentPlayer  `json:"standings"`
+	Pairings  []store.TournamentPairing `json:"pairings"`
+}
+
+// Notification is pushed over the websocket to a tournament's players
+// whenever its standings change, and once more when it finishes.
+type Notification struct {
+	Type         string                   `json:"type"`
+	TournamentID string                   `json:"tournament_id"`
+	Status       string                   `json:"status"`
+	Round        int                      `json:"round"`
+	Standings    []store.TournamentPlayer `json:"standings"`
+}
+
+// Service runs tournaments: it starts them when they are due, pairs their
+// games through the game manager and scores the games as they end.
+type Service struct {
+	tournamentStore store.TournamentStore
+	ratings         *rating.Service
+	gm              *gamemanager.GameManager
+
+	// mu serialises every change to a tournament's pairings so the pairing
+	// loop and finishing games never race.
+	mu sync.Mutex
+	// roundEnded is when the last game of a Swiss tournament's current
+	// round finished. lastPaired is when an Arena was last paired.
+	roundEnded map[string]time.Time
+	lastPaired map[string]time.Time
+
+	// redisClient holds the leader lease of the pairing loop in a cluster;
+	// leader is whether this node held it at the last renewal.
+	redisClient *redis.Client
+	leader      bool
+}
+
+func NewService(tournamentStore store.TournamentStore, ratings *rating.Service, gm *gamemanager.GameManager, redisClient *redis.Client) *Service {
+	return &Service{
+		tournamentStore: tournamentStore,
+		ratings:         ratings,
+		gm:              gm,
+		redisClient:     redisClient,
+		roundEnded:      make(map[string]time.Time),
+		lastPaired:      make(map[string]time.Time),
+	}
+}
+
+func (s *Service) Create(ctx context.Context, creatorID string, req Request) (*store.Tournament, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > MaxNameLength {
+		return nil, ErrInvalidName
+	}
+
+	tc, err := req.TimeControl.ToTimeControl()
+	if err != nil {
+		return nil, err
+	}
+	if tc.IsUnlimited() || tc.IsCorrespondence() {
+		return nil, ErrUntimed
+	}
+
+	v, err := variant.Parse(req.Variant)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &store.Tournament{
+		Name:        name,
+		Format:      req.Format,
+		CreatedBy:   creatorID,
+		TimeControl: tc.String(),
+		Variant:     string(v),
+		Rated:       req.Rated,
+		StartsAt:    time.Now().Add(DefaultStartDelay),
+	}
+	if req.StartsAt != nil {
+		t.StartsAt = *req.StartsAt
+	}
+
+	switch req.Format {
+	case FormatSwiss:
+		if req.Rounds < 1 || req.Rounds > MaxSwissRounds {
+			return nil, ErrInvalidRounds
+		}
+		t.Rounds = req.Rounds
+	case FormatArena:
+		duration := time.Duration(req.DurationMinutes) * time.Minute
+		if duration < MinArenaDuration || duration > MaxArenaDuration {
+			return nil, ErrInvalidDuration
+		}
+		t.DurationSeconds = int(duration.Seconds())
+	case FormatRoundRobin, FormatKnockout:
+		interval := time.Duration(req.RoundIntervalMinutes) * time.Minute
+		forfeitAfter := time.Duration(req.ForfeitAfterMinutes) * time.Minute
+		if forfeitAfter == 0 {
+			forfeitAfter = DefaultForfeitAfter
+		}
+		if interval < 0 || interval > MaxRoundInterval || forfeitAfter < 0 || forfeitAfter > MaxForfeitAfter {
+			return nil, ErrInvalidSchedule
+		}
+		t.RoundIntervalSeconds = int(interval.Seconds())
+		t.ForfeitAfterSeconds = int(forfeitAfter.Seconds())
+		if req.Format == FormatKnockout {
+			t.MatchGames = req.MatchGames
+			if t.MatchGames == 0 {
+				t.MatchGames = DefaultMatchGames
+			}
+			if t.MatchGames < 1 || t.MatchGames > MaxMatchGames {
+				return nil, ErrInvalidMatchGames
+			}
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	return s.tournamentStore.CreateTournament(ctx, t)
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*Details, error) {
+	t, err := s.tournamentStore.GetTournament(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if pairings == nil {
+		pairings = []store.TournamentPairing{}
+	}
+	matches, err := s.tournamentStore.GetTournamentMatches(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Details{Tournament: t, Standings: standings(t, players, pairings, matches), Pairings: pairings}, nil
+}
+
+// List returns the tournaments with the given status, or all of them when
+// status is empty.
+func (s *Service) List(ctx context.Context, status string) ([]store.Tournament, error) {
+	return s.tournamentStore.ListTournaments(ctx, status)
+}
+
+// Join enters userID into a tournament that has not started, or a Swiss or
+// Arena still pairing new games. Players joining a Swiss late score nothing
+// for the rounds they missed.
+func (s *Service) Join(ctx context.Context, id string, userID string) (*Details, error) {
+	s.mu.Lock()
+	err := s.join(ctx, id, userID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *Service) join(ctx context.Context, id string, userID string) error {
+	t, err := s.tournamentStore.GetTournament(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case t.Status == store.TournamentFinished || t.Status == store.TournamentCancelled:
+		return ErrTournamentOver
+	case t.Status != store.TournamentRunning:
+	case t.Format == FormatRoundRobin || t.Format == FormatKnockout:
+		return ErrRegistrationEnded
+	case t.Format == FormatSwiss && t.CurrentRound >= t.Rounds:
+		return ErrRegistrationEnded
+	case t.Format == FormatArena && !time.Now().Before(arenaEnd(t)):
+		return ErrRegistrationEnded
+	}
+
+	tc, err := gamemanager.ParseTimeControl(t.TimeControl)
+	if err != nil {
+		return err
+	}
+	r, err := s.ratings.Current(ctx, userID, gamemanager.RatingCategory(variant.Variant(t.Variant), tc.Category()))
+	if err != nil {
+		return err
+	}
+
+	if t.Format == FormatRoundRobin {
+		players, err := s.tournamentStore.GetTournamentPlayers(ctx, id)
+		if err != nil {
+			return err
+		}
+		entered := false
+		for _, p := range players {
+			entered = entered || p.UserID == userID
+		}
+		if !entered && len(players) >= MaxRoundRobinPlayers {
+			return ErrTournamentFull
+		}
+	}
+	return s.tournamentStore.AddTournamentPlayer(ctx, id, userID, int(r.Rating))
+}
+
+// Withdraw takes userID out of future pairings. A game in progress is still
+// played out, and the player's results so far stay in the standings.
+func (s *Service) Withdraw(ctx context.Context, id string, userID string) (*Details, error) {
+	s.mu.Lock()
+	err := s.withdraw(ctx, id, userID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *Service) withdraw(ctx context.Context, id string, userID string) error {
+	t, err := s.tournamentStore.GetTournament(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t.Status == store.TournamentFinished || t.Status == store.TournamentCancelled {
+		return ErrTournamentOver
+	}
+	return s.tournamentStore.SetTournamentPlayerWithdrawn(ctx, id, userID, true)
+}
+
+// Start starts the tournament before its scheduled time. Only its creator
+// may do so.
+func (s *Service) Start(ctx context.Context, id string, userID string) (*Details, error) {
+	s.mu.Lock()
+	err := s.startEarly(ctx, id, userID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *Service) startEarly(ctx context.Context, id string, userID string) error {
+	t, err := s.tournamentStore.GetTournament(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t.CreatedBy != userID {
+		return ErrNotCreator
+	}
+	if t.Status != store.TournamentCreated {
+		return ErrAlreadyStarted
+	}
+
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(active(players)) < 2 {
+		return ErrNotEnoughPlayers
+	}
+	return s.start(ctx, t, time.Now())
+}
+
+// Berserk halves userID's clock in their current Arena game for a bonus
+// point if they win it.
+func (s *Service) Berserk(ctx context.Context, id string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.tournamentStore.GetTournament(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t.Format != FormatArena {
+		return ErrBerserkNotAllowed
+	}
+	if t.Status != store.TournamentRunning {
+		return ErrNotPlaying
+	}
+
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, id)
+	if err != nil {
+		return err
+	}
+	for i := range pairings {
+		p := &pairings[i]
+		if p.Result != "" || p.GameID == "" || (p.WhiteUserID != userID && p.BlackUserID != userID) {
+			continue
+		}
+		if err := s.gm.Berserk(p.GameID, userID); err != nil {
+			return err
+		}
+		if p.WhiteUserID == userID {
+			p.WhiteBerserk = true
+		} else {
+			p.BlackBerserk = true
+		}
+		return s.tournamentStore.UpdateTournamentPairing(ctx, p)
+	}
+	return ErrNotPlaying
+}
+
+// Run starts due tournaments and pairs running ones until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			s.tick(ctx, now)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// tick must be called with s.mu held.
+func (s *Service) tick(ctx context.Context, now time.Time) {
+	created, err := s.tournamentStore.ListTournaments(ctx, store.TournamentCreated)
+	if err != nil {
+		log.Printf("Failed to list tournaments: %v", err)
+		return
+	}
+	for i := range created {
+		if created[i].StartsAt.After(now) {
+			continue
+		}
+		if !s.lead(ctx) {
+			return
+		}
+		if err := s.start(ctx, &created[i], now); err != nil {
+			log.Printf("Failed to start tournament %s: %v", created[i].ID, err)
+		}
+	}
+
+	running, err := s.tournamentStore.ListTournaments(ctx, store.TournamentRunning)
+	if err != nil {
+		log.Printf("Failed to list tournaments: %v", err)
+		return
+	}
+	for i := range running {
+		if !s.lead(ctx) {
+			return
+		}
+		if err := s.advance(ctx, &running[i], now); err != nil {
+			log.Printf("Failed to advance tournament %s: %v", running[i].ID, err)
+		}
+	}
+}
+
+// start begins a tournament, or cancels it when fewer than two players
+// turned up. The tournament is claimed in the database first, so a creator
+// starting it early on another node and the pairing loop never both set it
+// up. It must be called with s.mu held.
+func (s *Service) start(ctx context.Context, t *store.Tournament, now time.Time) error {
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	if len(active(players)) < 2 {
+		log.Printf("Cancelling tournament %s: not enough players", t.ID)
+		return s.close(ctx, t, store.TournamentCancelled)
+	}
+
+	started, err := s.tournamentStore.StartTournament(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return nil
+	}
+
+	switch t.Format {
+	case FormatRoundRobin:
+		err = s.setUpRoundRobin(ctx, t, active(players), now)
+	case FormatKnockout:
+		err = s.setUpKnockout(ctx, t, active(players), now)
+	}
+	if err != nil {
+		// Leave it to be set up again on the next tick.
+		if resetErr := s.tournamentStore.UpdateTournamentStatus(ctx, t.ID, store.TournamentCreated, 0); resetErr != nil {
+			log.Printf("Failed to reset tournament %s: %v", t.ID, resetErr)
+		}
+		return err
+	}
+	t.Status = store.TournamentRunning
+	t.StartedAt = &now
+	log.Printf("Tournament %s started with %d players", t.ID, len(players))
+
+	if !s.lead(ctx) {
+		// The leader pairs it on its next tick.
+		return nil
+	}
+	return s.advance(ctx, t, now)
+}
+
+// advance makes the pairings a running tournament is due and finishes it
+// once its last game is over. It must be called with s.mu held.
+func (s *Service) advance(ctx context.Context, t *store.Tournament, now time.Time) error {
+	switch t.Format {
+	case FormatSwiss:
+		return s.advanceSwiss(ctx, t, now)
+	case FormatArena:
+		return s.advanceArena(ctx, t, now)
+	case FormatRoundRobin:
+		return s.advanceRoundRobin(ctx, t, now)
+	case FormatKnockout:
+		return s.advanceKnockout(ctx, t, now)
+	}
+	return ErrUnknownFormat
+}
+
+// startGame starts a tournament game between white and black and records
+// its pairing. The pairing is recorded first so the game's end, on
+// whichever node it is played, always finds it. It must be called with s.mu
+// held.
+func (s *Service) startGame(ctx context.Context, t *store.Tournament, round int, white, black string) error {
+	game, err := s.newGame(t, white, black, false)
+	if err != nil {
+		return err
+	}
+	// The pairing refers to the game's row, which starting the game
+	// creates. The game cannot end before the pairing is recorded:
+	// HandleGameEnd waits for s.mu.
+	if err := s.gm.StartGame(game); err != nil {
+		return err
+	}
+
+	_, err = s.tournamentStore.CreateTournamentPairing(ctx, &store.TournamentPairing{
+		TournamentID: t.ID,
+		Round:        round,
+		GameID:       game.ID,
+		WhiteUserID:  white,
+		BlackUserID:  black,
+	})
+	return err
+}
+
+// newGame creates a game with the tournament's settings, to be started
+// before its pairing is recorded. An Armageddon game gives Black less time in
+// exchange for draw odds.
+func (s *Service) newGame(t *store.Tournament, white, black string, armageddon bool) (*gamemanager.Game, error) {
+	tc, err := gamemanager.ParseTimeControl(t.TimeControl)
+	if err != nil {
+		return nil, err
+	}
+	opts := gamemanager.GameOptions{
+		TimeControl: tc,
+		Rated:       t.Rated,
+		Variant:     variant.Variant(t.Variant),
+		Exclusive:   true,
+	}
+	if armageddon {
+		opts.BlackTime = tc.Initial * armageddonBlackTime / 100
+	}
+	return gamemanager.StartNewGame(white, black, opts)
+}
+
+// HandleGameEnd scores a finished tournament game. It is registered with
+// GameManager.OnGameEnd and ignores games outside tournaments.
+func (s *Service) HandleGameEnd(result gamemanager.GameResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx := context.Background()
+	p, err := s.tournamentStore.GetTournamentPairingByGame(ctx, result.GameID)
+	if errors.Is(err, store.ErrPairingNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up tournament game %s: %v", result.GameID, err)
+		return
+	}
+	if p.Result != "" {
+		return
+	}
+
+	t, err := s.tournamentStore.GetTournament(ctx, p.TournamentID)
+	if err != nil {
+		log.Printf("Failed to load tournament %s: %v", p.TournamentID, err)
+		return
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, t.ID)
+	if err != nil {
+		log.Printf("Failed to load pairings of tournament %s: %v", t.ID, err)
+		return
+	}
+
+	white, black := gameScore(result)
+	p.Result = resultString(white, black)
+	switch t.Format {
+	case FormatArena:
+		p.WhitePoints = arenaPoints(pairings, p.WhiteUserID, white, p.WhiteBerserk, result.Plies)
+		p.BlackPoints = arenaPoints(pairings, p.BlackUserID, black, p.BlackBerserk, result.Plies)
+	default:
+		p.WhitePoints, p.BlackPoints = white, black
+		if p.Armageddon && white == black {
+			// Black has draw odds.
+			p.WhitePoints, p.BlackPoints = 0, 1
+		}
+	}
+	if err := s.tournamentStore.UpdateTournamentPairing(ctx, p); err != nil {
+		log.Printf("Failed to record tournament game %s: %v", result.GameID, err)
+		return
+	}
+
+	if t.Format == FormatSwiss && roundComplete(pairings, p) {
+		s.roundEnded[t.ID] = time.Now()
+	}
+	if err := s.publishStandings(ctx, t, gamemanager.TOURNAMENT_STANDINGS); err != nil {
+		log.Printf("Failed to update standings of tournament %s: %v", t.ID, err)
+	}
+}
+
+// roundComplete reports whether every other pairing of p's round has a
+// result, using pairings as loaded before p was scored.
+func roundComplete(pairings []store.TournamentPairing, p *store.TournamentPairing) bool {
+	for _, other := range pairings {
+		if other.Round == p.Round && other.ID != p.ID && other.Result == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// finish closes a tournament whose games are all over. It must be called
+// with s.mu held.
+func (s *Service) finish(ctx context.Context, t *store.Tournament) error {
+	log.Printf("Tournament %s finished", t.ID)
+	return s.close(ctx, t, store.TournamentFinished)
+}
+
+// close persists the final standings, moves the tournament to status and
+// tells its players. It must be called with s.mu held.
+func (s *Service) close(ctx context.Context, t *store.Tournament, status string) error {
+	if err := s.tournamentStore.UpdateTournamentStatus(ctx, t.ID, status, t.CurrentRound); err != nil {
+		return err
+	}
+	t.Status = status
+	delete(s.roundEnded, t.ID)
+	delete(s.lastPaired, t.ID)
+	return s.publishStandings(ctx, t, gamemanager.TOURNAMENT_FINISHED)
+}
+
+// publishStandings recomputes and saves the standings and pushes them to
+// every player of the tournament. It must be called with s.mu held.
+func (s *Service) publishStandings(ctx context.Context, t *store.Tournament, msgType string) error {
+	players, err := s.tournamentStore.GetTournamentPlayers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	pairings, err := s.tournamentStore.GetTournamentPairings(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	matches, err := s.tournamentStore.GetTournamentMatches(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+
+	table := standings(t, players, pairings, matches)
+	if err := s.tournamentStore.SaveTournamentStandings(ctx, t.ID, table); err != nil {
+		return err
+	}
+
+	msg := Notification{Type: msgType, TournamentID: t.ID, Status: t.Status, Round: t.CurrentRound, Standings: table}
+	for _, p := range table {
+		s.gm.SendToUser(p.UserID, msg)
+	}
+	return nil
+}
+
+// gameScore is each side's share of the point. A player who abandoned the
+// game loses it whatever the board says.
+func gameScore(result gamemanager.GameResult) (white, black float64) {
+	switch {
+	case result.Leaver == result.WhiteUserID:
+		return 0, 1
+	case result.Leaver == result.BlackUserID:
+		return 1, 0
+	}
+	switch result.Outcome {
+	case chess.WhiteWon.String():
+		return 1, 0
+	case chess.BlackWon.String():
+		return 0, 1
+	}
+	return 0.5, 0.5
+}
+
+func resultString(white, black float64) string {
+	switch {
+	case white > black:
+		return ResultWhiteWins
+	case black > white:
+		return ResultBlackWins
+	}
+	return ResultDraw
+}
+
+// active returns the players who have not withdrawn.
+func active(players []store.TournamentPlayer) []store.TournamentPlayer {
+	var out []store.TournamentPlayer
+	for _, p := range players {
+		if !p.Withdrawn {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// standings ranks the players by score and the format's tiebreaks. Knockout
+// players are ranked by how far they got in the bracket first. Buchholz is
+// left out of round robins, where everyone has the same opponents.
+func standings(t *store.Tournament, players []store.TournamentPlayer, pairings []store.TournamentPairing, matches []store.TournamentMatch) []store.TournamentPlayer {
+	records := buildRecords(players, pairings)
+	var reached map[string]int
+	if t.Format == FormatKnockout {
+		reached = bracketProgress(matches)
+	}
+
+	table := make([]store.TournamentPlayer, 0, len(players))
+	for _, p := range players {
+		rec := records[p.UserID]
+		p.Score = rec.points
+		p.Buchholz, p.SonnebornBerger = 0, 0
+		switch t.Format {
+		case FormatSwiss:
+			p.Buchholz, p.SonnebornBerger = tiebreaks(rec, records)
+		case FormatRoundRobin:
+			_, p.SonnebornBerger = tiebreaks(rec, records)
+		}
+		table = append(table, p)
+	}
+
+	sort.SliceStable(table, func(i, j int) bool {
+		a, b := table[i], table[j]
+		if reached[a.UserID] != reached[b.UserID] {
+			return reached[a.UserID] > reached[b.UserID]
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		if a.SonnebornBerger != b.SonnebornBerger {
+			return a.SonnebornBerger > b.SonnebornBerger
+		}
+		return a.Rating > b.Rating
+	})
+	for i := range table {
+		table[i].Rank = i + 1
+	}
+	return table
+}
@@ -0,0 +1,82 @@
+package tournament
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/gamemanager"
+	"github.com/Adi-ty/chess/internal/matchmaking"
+	"github.com/Adi-ty/chess/internal/store"
+	"github.com/Adi-ty/chess/internal/store/storetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStartSwissRound(t *testing.T) {
+	ctx := context.Background()
+	games := storetest.NewMemoryGameStore()
+	tournaments := storetest.NewMemoryTournamentStore(games)
+	// Nothing here needs Redis: game channels are subscribed to lazily.
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	t.Cleanup(func() { rdb.Close() })
+	gm := gamemanager.NewGameManager(games, rdb, matchmaking.NewMemoryMatchmaker(), nil)
+	s := NewService(tournaments, nil, gm, rdb)
+
+	tour, err := tournaments.CreateTournament(ctx, &store.Tournament{
+		Name:        "Test Swiss",
+		Format:      FormatSwiss,
+		TimeControl: "300+0",
+		Variant:     "standard",
+		Rounds:      3,
+		StartsAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("create tournament: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := tournaments.AddTournamentPlayer(ctx, tour.ID, fmt.Sprintf("player-%d", i), 1500+100*i); err != nil {
+			t.Fatalf("add player: %v", err)
+		}
+	}
+	if started, err := tournaments.StartTournament(ctx, tour.ID); err != nil || !started {
+		t.Fatalf("start tournament: %v, %v", started, err)
+	}
+	tour, _ = tournaments.GetTournament(ctx, tour.ID)
+
+	s.mu.Lock()
+	err = s.advanceSwiss(ctx, tour, time.Now())
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatalf("advanceSwiss: %v", err)
+	}
+
+	pairings, err := tournaments.GetTournamentPairings(ctx, tour.ID)
+	if err != nil {
+		t.Fatalf("get pairings: %v", err)
+	}
+	var played, byes int
+	for _, p := range pairings {
+		if p.Round != 1 {
+			t.Errorf("pairing %d is in round %d, want 1", p.ID, p.Round)
+		}
+		switch {
+		case p.Result == ResultBye:
+			byes++
+		case p.Result != "":
+			t.Errorf("pairing %s vs %s ended with %q before being played", p.WhiteUserID, p.BlackUserID, p.Result)
+		case p.GameID == "":
+			t.Errorf("pairing %s vs %s has no game", p.WhiteUserID, p.BlackUserID)
+		case !games.HasGame(p.GameID):
+			t.Errorf("game %s of pairing %s vs %s was not created", p.GameID, p.WhiteUserID, p.BlackUserID)
+		default:
+			played++
+		}
+	}
+	if played != 2 || byes != 1 {
+		t.Errorf("round 1 has %d games and %d byes, want 2 and 1", played, byes)
+	}
+	if tour.CurrentRound != 1 {
+		t.Errorf("tournament is at round %d, want 1", tour.CurrentRound)
+	}
+}
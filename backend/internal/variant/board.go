@@ -0,0 +1,347 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+var (
+	ErrIllegalMove = errors.New("illegal move")
+	ErrGameOver    = errors.New("game is over")
+)
+
+// Move is a move played on a Board, in UCI and in SAN. Drops are written
+// "N@f3" in both; Chess960 castles are king-takes-rook in UCI.
+type Move struct {
+	UCI string `json:"uci"`
+	SAN string `json:"san"`
+}
+
+// Board plays a game of any variant: it validates moves, tracks the
+// position and decides when the game is over.
+type Board struct {
+	variant    Variant
+	initialFEN string
+	states     []*state
+	moves      []Move
+	outcome    chess.Outcome
+	method     string
+}
+
+// NewBoard starts a board from fen, or from the variant's starting position
+// when fen is empty. The position must be legal and have a move to play.
+func NewBoard(v Variant, fen string) (*Board, error) {
+	if v == "" {
+		v = Standard
+	}
+	if fen == "" {
+		fen = v.StartingFEN()
+	}
+	st, err := v.parseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validate(st); err != nil {
+		return nil, err
+	}
+	return &Board{
+		variant:    v,
+		initialFEN: v.fen(st),
+		states:     []*state{st},
+		outcome:    chess.NoOutcome,
+	}, nil
+}
+
+// Replay rebuilds a board from its starting position and UCI moves.
+func Replay(v Variant, fen string, moves []string) (*Board, error) {
+	b, err := NewBoard(v, fen)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range moves {
+		if _, err := b.Move(m); err != nil {
+			return nil, fmt.Errorf("replay move %s: %w", m, err)
+		}
+	}
+	return b, nil
+}
+
+func (b *Board) Variant() Variant {
+	return b.variant
+}
+
+// InitialFEN is the position the game started from.
+func (b *Board) InitialFEN() string {
+	return b.initialFEN
+}
+
+func (b *Board) current() *state {
+	return b.states[len(b.states)-1]
+}
+
+func (b *Board) FEN() string {
+	return b.variant.fen(b.current())
+}
+
+func (b *Board) Turn() chess.Color {
+	return b.current().pos.Turn()
+}
+
+// Plies is the number of half-moves played.
+func (b *Board) Plies() int {
+	return len(b.moves)
+}
+
+func (b *Board) Moves() []Move {
+	return append([]Move(nil), b.moves...)
+}
+
+func (b *Board) UCIMoves() []string {
+	moves := make([]string, 0, len(b.moves))
+	for _, m := range b.moves {
+		moves = append(moves, m.UCI)
+	}
+	return moves
+}
+
+// ValidMoves lists the legal moves of the side to move in UCI.
+func (b *Board) ValidMoves() []string {
+	if b.outcome != chess.NoOutcome {
+		return nil
+	}
+	legal := b.variant.legalMoves(b.current())
+	moves := make([]string, 0, len(legal))
+	for _, mv := range legal {
+		moves = append(moves, mv.uci)
+	}
+	return moves
+}
+
+// Checks returns how many checks each side has given, for Three-check.
+func (b *Board) Checks() (white int, black int) {
+	st := b.current()
+	return st.checks[0], st.checks[1]
+}
+
+func (b *Board) Outcome() chess.Outcome {
+	return b.outcome
+}
+
+// Method is how the game ended, empty while it is in progress.
+func (b *Board) Method() string {
+	return b.method
+}
+
+// Move plays a move given in UCI. In Chess960 a castle may also be given as
+// the king's move to its destination square when that is unambiguous.
+func (b *Board) Move(uci string) (Move, error) {
+	if b.outcome != chess.NoOutcome {
+		return Move{}, ErrGameOver
+	}
+	if strings.Contains(uci, "@") {
+		uci = strings.ToUpper(uci[:1]) + strings.ToLower(uci[1:])
+	} else {
+		uci = strings.ToLower(uci)
+	}
+
+	st := b.current()
+	legal := b.variant.legalMoves(st)
+	for _, mv := range legal {
+		if mv.uci == uci {
+			return b.play(st, mv), nil
+		}
+	}
+	if b.variant == Chess960 && len(uci) == 4 {
+		for _, mv := range legal {
+			if mv.castle < 0 {
+				continue
+			}
+			kingTo, _ := castleSquares(mv.castle, backRank(st.pos.Turn()))
+			if uci == mv.uci[:2]+kingTo.String() {
+				return b.play(st, mv), nil
+			}
+		}
+	}
+	return Move{}, ErrIllegalMove
+}
+
+func (b *Board) play(st *state, mv move) Move {
+	next := b.variant.play(st, mv)
+	played := Move{UCI: mv.uci, SAN: san(st, mv)}
+	b.states = append(b.states, next)
+	b.settle()
+
+	if b.method == chess.Checkmate.String() {
+		played.SAN += "#"
+	} else if inCheck(next.pos.Board(), next.pos.Turn()) {
+		played.SAN += "+"
+	}
+	b.moves = append(b.moves, played)
+	return played
+}
+
+// san writes mv in SAN without the check suffix, which depends on the
+// variant's rules.
+func san(st *state, mv move) string {
+	switch {
+	case mv.drop != chess.NoPieceType:
+		return mv.uci
+	case mv.castle == kingSide:
+		return "O-O"
+	case mv.castle == queenSide:
+		return "O-O-O"
+	}
+	return strings.TrimRight(chess.AlgebraicNotation{}.Encode(st.pos, mv.lib), "+#")
+}
+
+// Undo takes back the last plies half-moves.
+func (b *Board) Undo(plies int) {
+	plies = min(plies, len(b.moves))
+	b.states = b.states[:len(b.states)-plies]
+	b.moves = b.moves[:len(b.moves)-plies]
+	b.outcome = chess.NoOutcome
+	b.method = ""
+}
+
+// Resign ends the game as a loss for color.
+func (b *Board) Resign(color chess.Color) {
+	b.outcome = chess.WhiteWon
+	if color == chess.White {
+		b.outcome = chess.BlackWon
+	}
+	b.method = chess.Resignation.String()
+}
+
+func (b *Board) DrawByAgreement() {
+	b.outcome = chess.Draw
+	b.method = chess.DrawOffer.String()
+}
+
+var hill = []chess.Square{chess.D4, chess.E4, chess.D5, chess.E5}
+
+// settle ends the game if the last move finished it.
+func (b *Board) settle() {
+	st := b.current()
+	board := st.pos.Board()
+	turn := st.pos.Turn()
+	mover := turn.Other()
+
+	win := chess.WhiteWon
+	if mover == chess.Black {
+		win = chess.BlackWon
+	}
+
+	switch {
+	case b.variant == KingOfTheHill && onHill(kingSquare(board, mover)):
+		b.outcome, b.method = win, MethodKingOfTheHill
+	case b.variant == ThreeCheck && st.checks[side(mover)] >= 3:
+		b.outcome, b.method = win, MethodThreeCheck
+	case len(b.variant.legalMoves(st)) == 0:
+		if inCheck(board, turn) {
+			b.outcome, b.method = win, chess.Checkmate.String()
+		} else {
+			b.outcome, b.method = chess.Draw, chess.Stalemate.String()
+		}
+	case b.repetitions() >= 5:
+		b.outcome, b.method = chess.Draw, chess.FivefoldRepetition.String()
+	case st.pos.HalfMoveClock() >= 150:
+		b.outcome, b.method = chess.Draw, chess.SeventyFiveMoveRule.String()
+	case b.insufficientMaterial():
+		b.outcome, b.method = chess.Draw, chess.InsufficientMaterial.String()
+	}
+}
+
+func onHill(sq chess.Square) bool {
+	for _, h := range hill {
+		if sq == h {
+			return true
+		}
+	}
+	return false
+}
+
+// repetitions counts how often the current position has occurred.
+func (b *Board) repetitions() int {
+	key := func(st *state) string {
+		fields := strings.Fields(b.variant.fen(st))
+		return strings.Join(fields[:len(fields)-2], " ")
+	}
+	current := key(b.current())
+	count := 0
+	for _, st := range b.states {
+		if key(st) == current {
+			count++
+		}
+	}
+	return count
+}
+
+// insufficientMaterial reports whether neither side can ever win. Pieces in
+// hand and the hill keep every Crazyhouse and King of the Hill game alive, and
+// in Three-check any piece can still give check.
+func (b *Board) insufficientMaterial() bool {
+	switch b.variant {
+	case KingOfTheHill, Crazyhouse:
+		return false
+	case ThreeCheck:
+		return len(b.current().pos.Board().SquareMap()) == 2
+	}
+
+	var minors []chess.Square
+	var bishopColors [2]int
+	for sq, piece := range b.current().pos.Board().SquareMap() {
+		switch piece.Type() {
+		case chess.King:
+		case chess.Bishop:
+			bishopColors[(int(sq.File())+int(sq.Rank()))%2]++
+			minors = append(minors, sq)
+		case chess.Knight:
+			minors = append(minors, sq)
+		default:
+			return false
+		}
+	}
+	if len(minors) <= 1 {
+		return true
+	}
+	// Bishops all on one square colour can never mate.
+	return len(minors) == bishopColors[0] || len(minors) == bishopColors[1]
+}
+
+// HasMatingMaterial reports whether color could still win the game, which
+// decides whether running out of time against it is a loss or a draw.
+func (b *Board) HasMatingMaterial(color chess.Color) bool {
+	st := b.current()
+	switch b.variant {
+	case KingOfTheHill, Crazyhouse:
+		return true
+	case ThreeCheck:
+		for _, piece := range st.pos.Board().SquareMap() {
+			if piece.Color() == color && piece.Type() != chess.King {
+				return true
+			}
+		}
+		return false
+	}
+
+	minors := 0
+	opponentPieces := 0
+	for _, piece := range st.pos.Board().SquareMap() {
+		if piece.Color() != color {
+			if piece.Type() != chess.King {
+				opponentPieces++
+			}
+			continue
+		}
+		switch piece.Type() {
+		case chess.Pawn, chess.Rook, chess.Queen:
+			return true
+		case chess.Bishop, chess.Knight:
+			minors++
+		}
+	}
+	return minors >= 2 || (minors == 1 && opponentPieces > 0)
+}
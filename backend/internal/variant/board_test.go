@@ -0,0 +1,216 @@
+package variant
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestChess960Castling(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		move string
+		// want is the position after the castle, empty if it is illegal.
+		want string
+	}{
+		{
+			name: "king crosses the rook's square",
+			fen:  "1k6/8/8/8/8/8/8/1KR5 w C - 0 1",
+			move: "b1c1",
+			want: "1k6/8/8/8/8/8/8/5RK1 b - - 1 1",
+		},
+		{
+			name: "king stays put",
+			fen:  "6k1/8/8/8/8/8/8/6KR w H - 0 1",
+			move: "g1h1",
+			want: "6k1/8/8/8/8/8/8/5RK1 b - - 1 1",
+		},
+		{
+			name: "king to its destination square",
+			fen:  "1k6/8/8/8/8/8/8/1KR5 w C - 0 1",
+			move: "b1g1",
+			want: "1k6/8/8/8/8/8/8/5RK1 b - - 1 1",
+		},
+		{
+			name: "rook hides an attack on the king's destination",
+			fen:  "6k1/8/8/8/8/8/8/rR4K1 w B - 0 1",
+			move: "g1b1",
+		},
+		{
+			name: "destination attacked",
+			fen:  "1k4r1/8/8/8/8/8/8/1KR5 w C - 0 1",
+			move: "b1c1",
+		},
+		{
+			name: "path blocked",
+			fen:  "1k6/8/8/8/8/8/8/1KRN4 w C - 0 1",
+			move: "b1c1",
+		},
+		{
+			name: "right lost",
+			fen:  "1k6/8/8/8/8/8/8/1KR5 w - - 0 1",
+			move: "b1c1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBoard(Chess960, tt.fen)
+			if err != nil {
+				t.Fatalf("NewBoard: %v", err)
+			}
+			played, err := b.Move(tt.move)
+			if tt.want == "" {
+				if !errors.Is(err, ErrIllegalMove) {
+					t.Fatalf("Move(%s) = %v, want %v", tt.move, err, ErrIllegalMove)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Move(%s): %v", tt.move, err)
+			}
+			if got := b.FEN(); got != tt.want {
+				t.Errorf("FEN = %s, want %s", got, tt.want)
+			}
+			if !strings.HasPrefix(played.SAN, "O-O") {
+				t.Errorf("SAN = %s, want a castle", played.SAN)
+			}
+		})
+	}
+}
+
+func TestCrazyhouseDrops(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		moves int
+	}{
+		// Five king moves and a knight drop on each of the 62 empty squares.
+		{"knight", "4k3/8/8/8/8/8/8/4K3[N] w - - 0 1", 67},
+		// Pawns cannot be dropped on the first or last rank.
+		{"pawn", "4k3/8/8/8/8/8/8/4K3[P] w - - 0 1", 53},
+		// In check, a drop must block it: three king moves and three drops.
+		{"in check", "4k3/8/8/8/8/8/8/r3K3[N] w - - 0 1", 6},
+		// Black's pieces in hand are not White's to drop.
+		{"opponent's pocket", "4k3/8/8/8/8/8/8/4K3[n] w - - 0 1", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBoard(Crazyhouse, tt.fen)
+			if err != nil {
+				t.Fatalf("NewBoard: %v", err)
+			}
+			if got := len(b.ValidMoves()); got != tt.moves {
+				t.Errorf("%d legal moves, want %d: %v", got, tt.moves, b.ValidMoves())
+			}
+		})
+	}
+
+	b, err := NewBoard(Crazyhouse, "4k3/8/8/8/8/8/8/4K3[P] w - - 0 1")
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	for _, move := range []string{"P@a1", "P@h8", "P@e1", "N@e4"} {
+		if _, err := b.Move(move); !errors.Is(err, ErrIllegalMove) {
+			t.Errorf("Move(%s) = %v, want %v", move, err, ErrIllegalMove)
+		}
+	}
+	if _, err := b.Move("p@e4"); err != nil {
+		t.Fatalf("Move(p@e4): %v", err)
+	}
+	if got, want := b.FEN(), "4k3/8/8/8/4P3/8/8/4K3[] b - - 0 1"; got != want {
+		t.Errorf("FEN = %s, want %s", got, want)
+	}
+}
+
+func TestCrazyhouseCaptures(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		move   string
+		pocket string
+	}{
+		{"piece", "4k3/8/8/3Q4/8/8/3r4/7K b - - 0 1", "d2d5", "[q]"},
+		{"promoted piece", "4k3/8/8/3Q~4/8/8/3r4/7K b - - 0 1", "d2d5", "[p]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBoard(Crazyhouse, tt.fen)
+			if err != nil {
+				t.Fatalf("NewBoard: %v", err)
+			}
+			if _, err := b.Move(tt.move); err != nil {
+				t.Fatalf("Move(%s): %v", tt.move, err)
+			}
+			if !strings.Contains(b.FEN(), tt.pocket) {
+				t.Errorf("FEN = %s, want pocket %s", b.FEN(), tt.pocket)
+			}
+		})
+	}
+
+	// A promoted piece keeps its mark when it moves.
+	b, err := NewBoard(Crazyhouse, "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	for _, move := range []string{"b7b8q", "e8e7", "b8b4"} {
+		if _, err := b.Move(move); err != nil {
+			t.Fatalf("Move(%s): %v", move, err)
+		}
+	}
+	if !strings.Contains(b.FEN(), "Q~") {
+		t.Errorf("FEN = %s, want the queen marked as promoted", b.FEN())
+	}
+}
+
+func TestThreeCheck(t *testing.T) {
+	b, err := NewBoard(ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 2+3 0 1")
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	if _, err := b.Move("a1a8"); err != nil {
+		t.Fatalf("Move(a1a8): %v", err)
+	}
+	if white, black := b.Checks(); white != 2 || black != 0 {
+		t.Errorf("Checks() = %d, %d, want 2, 0", white, black)
+	}
+	if b.Outcome() != chess.NoOutcome {
+		t.Fatalf("game ended after the second check: %s by %s", b.Outcome(), b.Method())
+	}
+
+	b, err = NewBoard(ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 1+3 0 1")
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	if _, err := b.Move("a1a8"); err != nil {
+		t.Fatalf("Move(a1a8): %v", err)
+	}
+	if b.Outcome() != chess.WhiteWon || b.Method() != MethodThreeCheck {
+		t.Errorf("game ended %s by %q, want %s by %q", b.Outcome(), b.Method(), chess.WhiteWon, MethodThreeCheck)
+	}
+	if _, err := b.Move("e8d7"); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Move after the third check = %v, want %v", err, ErrGameOver)
+	}
+}
+
+func TestKingOfTheHill(t *testing.T) {
+	b, err := NewBoard(KingOfTheHill, "k7/8/8/8/8/4K3/8/8 w - - 0 1")
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	if !slices.Contains(b.ValidMoves(), "e3e4") {
+		t.Fatalf("e3e4 is not legal: %v", b.ValidMoves())
+	}
+	if _, err := b.Move("e3e4"); err != nil {
+		t.Fatalf("Move(e3e4): %v", err)
+	}
+	if b.Outcome() != chess.WhiteWon || b.Method() != MethodKingOfTheHill {
+		t.Errorf("game ended %s by %q, want %s by %q", b.Outcome(), b.Method(), chess.WhiteWon, MethodKingOfTheHill)
+	}
+}
@@ -0,0 +1,352 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+var (
+	ErrInvalidFEN      = errors.New("invalid FEN")
+	ErrIllegalPosition = errors.New("illegal position")
+)
+
+func decodePosition(fen string) (*chess.Position, error) {
+	opt, err := chess.FEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(opt).Position(), nil
+}
+
+func fullMoveNumber(pos *chess.Position) int {
+	fields := strings.Fields(pos.String())
+	n, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
+
+// parseFEN reads a position of the variant. Besides standard FEN it accepts
+// X-FEN and Shredder-FEN castling in Chess960, the remaining checks field
+// ("3+3") in Three-check, and pockets ("[Qn]") and promoted pieces ("Q~")
+// in Crazyhouse.
+func (v Variant) parseFEN(fen string) (*state, error) {
+	fields := strings.Fields(fen)
+	st := &state{rooks: [2][2]chess.File{{noRook, noRook}, {noRook, noRook}}}
+
+	if v == ThreeCheck && len(fields) == 7 {
+		remaining := strings.Split(fields[4], "+")
+		if len(remaining) != 2 {
+			return nil, fmt.Errorf("%w: bad remaining checks %q", ErrInvalidFEN, fields[4])
+		}
+		for i, r := range remaining {
+			n, err := strconv.Atoi(r)
+			if err != nil || n < 0 || n > 3 {
+				return nil, fmt.Errorf("%w: bad remaining checks %q", ErrInvalidFEN, fields[4])
+			}
+			st.checks[i] = 3 - n
+		}
+		fields = append(fields[:4], fields[5:]...)
+	}
+	if len(fields) == 4 {
+		fields = append(fields, "0", "1")
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: expected 6 fields", ErrInvalidFEN)
+	}
+
+	placement := fields[0]
+	if open := strings.IndexByte(placement, '['); open >= 0 {
+		if v != Crazyhouse || !strings.HasSuffix(placement, "]") {
+			return nil, fmt.Errorf("%w: unexpected pocket", ErrInvalidFEN)
+		}
+		for _, r := range placement[open+1 : len(placement)-1] {
+			pt, color, ok := pieceFromChar(r)
+			if !ok || pocketIndex(pt) < 0 {
+				return nil, fmt.Errorf("%w: bad pocket piece %q", ErrInvalidFEN, r)
+			}
+			st.pockets[side(color)][pocketIndex(pt)]++
+		}
+		placement = placement[:open]
+	}
+	if strings.Contains(placement, "~") {
+		if v != Crazyhouse {
+			return nil, fmt.Errorf("%w: unexpected promoted piece", ErrInvalidFEN)
+		}
+		promoted, err := promotedSquares(placement)
+		if err != nil {
+			return nil, err
+		}
+		st.promoted = promoted
+		placement = strings.ReplaceAll(placement, "~", "")
+	}
+
+	castling := fields[2]
+	if v == Chess960 {
+		fields[2] = "-"
+	}
+	pos, err := decodePosition(strings.Join(append([]string{placement}, fields[1:]...), " "))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFEN, err)
+	}
+	st.pos = pos
+
+	if v == Chess960 {
+		if err := st.parseCastling(castling); err != nil {
+			return nil, err
+		}
+	} else if err := checkCastling(pos); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// promotedSquares finds the pieces marked with "~" in a FEN placement.
+func promotedSquares(placement string) (uint64, error) {
+	var promoted uint64
+	rank, file := 7, 0
+	for _, r := range placement {
+		switch {
+		case r == '/':
+			rank, file = rank-1, 0
+		case r == '~':
+			if file == 0 || rank < 0 {
+				return 0, fmt.Errorf("%w: misplaced '~'", ErrInvalidFEN)
+			}
+			promoted |= bit(chess.NewSquare(chess.File(file-1), chess.Rank(rank)))
+		case r >= '1' && r <= '8':
+			file += int(r - '0')
+		default:
+			file++
+		}
+	}
+	return promoted, nil
+}
+
+// parseCastling reads Chess960 castling rights. K and Q stand for the
+// outermost rook on that side of the king, file letters for the rook on that
+// file.
+func (st *state) parseCastling(castling string) error {
+	if castling == "-" {
+		return nil
+	}
+	board := st.pos.Board()
+	for _, r := range castling {
+		color := chess.White
+		if r >= 'a' && r <= 'z' {
+			color = chess.Black
+		}
+		rank := backRank(color)
+		king := kingSquare(board, color)
+		if king == chess.NoSquare || king.Rank() != rank {
+			return fmt.Errorf("%w: castling without a king on the back rank", ErrIllegalPosition)
+		}
+		rook := chess.NewPiece(chess.Rook, color)
+
+		file := noRook
+		switch upper := r &^ 0x20; {
+		case upper == 'K':
+			for f := chess.FileH; f > king.File(); f-- {
+				if board.Piece(chess.NewSquare(f, rank)) == rook {
+					file = f
+					break
+				}
+			}
+		case upper == 'Q':
+			for f := chess.FileA; f < king.File(); f++ {
+				if board.Piece(chess.NewSquare(f, rank)) == rook {
+					file = f
+					break
+				}
+			}
+		case upper >= 'A' && upper <= 'H':
+			if f := chess.File(upper - 'A'); board.Piece(chess.NewSquare(f, rank)) == rook {
+				file = f
+			}
+		default:
+			return fmt.Errorf("%w: bad castling %q", ErrInvalidFEN, castling)
+		}
+		if file == noRook {
+			return fmt.Errorf("%w: castling without a rook", ErrIllegalPosition)
+		}
+
+		castleSide := queenSide
+		if file > king.File() {
+			castleSide = kingSide
+		}
+		st.rooks[side(color)][castleSide] = file
+	}
+	return nil
+}
+
+// checkCastling makes sure standard castling rights match the king and rook
+// placement, since the chess package assumes they do.
+func checkCastling(pos *chess.Position) error {
+	rights := pos.CastleRights()
+	board := pos.Board()
+	for _, color := range []chess.Color{chess.White, chess.Black} {
+		rank := backRank(color)
+		for _, castle := range []struct {
+			side chess.Side
+			file chess.File
+		}{{chess.KingSide, chess.FileH}, {chess.QueenSide, chess.FileA}} {
+			if !rights.CanCastle(color, castle.side) {
+				continue
+			}
+			if board.Piece(chess.NewSquare(chess.FileE, rank)) != chess.NewPiece(chess.King, color) ||
+				board.Piece(chess.NewSquare(castle.file, rank)) != chess.NewPiece(chess.Rook, color) {
+				return fmt.Errorf("%w: castling rights do not match the position", ErrIllegalPosition)
+			}
+		}
+	}
+	return nil
+}
+
+// validate rejects positions that cannot arise in a game.
+func (v Variant) validate(st *state) error {
+	board := st.pos.Board()
+	kings := [2]int{}
+	for sq, piece := range board.SquareMap() {
+		switch piece.Type() {
+		case chess.King:
+			kings[side(piece.Color())]++
+		case chess.Pawn:
+			if sq.Rank() == chess.Rank1 || sq.Rank() == chess.Rank8 {
+				return fmt.Errorf("%w: pawn on the first or last rank", ErrIllegalPosition)
+			}
+		}
+	}
+	if kings != [2]int{1, 1} {
+		return fmt.Errorf("%w: each side needs exactly one king", ErrIllegalPosition)
+	}
+	if inCheck(board, st.pos.Turn().Other()) {
+		return fmt.Errorf("%w: the side not to move is in check", ErrIllegalPosition)
+	}
+	if len(v.legalMoves(st)) == 0 {
+		return fmt.Errorf("%w: the side to move has no legal moves", ErrIllegalPosition)
+	}
+	return nil
+}
+
+// fen writes the position in the notation parseFEN reads.
+func (v Variant) fen(st *state) string {
+	fields := strings.Fields(st.pos.String())
+
+	if v == Crazyhouse {
+		fields[0] = st.placement() + "[" + st.pocketString() + "]"
+	}
+	if v == Chess960 {
+		fields[2] = st.castlingString()
+	}
+	if v == ThreeCheck {
+		remaining := fmt.Sprintf("%d+%d", 3-st.checks[0], 3-st.checks[1])
+		fields = append(fields[:4], append([]string{remaining}, fields[4:]...)...)
+	}
+	return strings.Join(fields, " ")
+}
+
+// placement writes the board with promoted pieces marked.
+func (st *state) placement() string {
+	board := st.pos.Board()
+	var b strings.Builder
+	for rank := chess.Rank8; rank >= chess.Rank1; rank-- {
+		empty := 0
+		for file := chess.FileA; file <= chess.FileH; file++ {
+			sq := chess.NewSquare(file, rank)
+			piece := board.Piece(sq)
+			if piece == chess.NoPiece {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				b.WriteString(itoa(empty))
+				empty = 0
+			}
+			b.WriteString(pieceChar(piece))
+			if st.promoted&bit(sq) != 0 {
+				b.WriteByte('~')
+			}
+		}
+		if empty > 0 {
+			b.WriteString(itoa(empty))
+		}
+		if rank > chess.Rank1 {
+			b.WriteByte('/')
+		}
+	}
+	return b.String()
+}
+
+func (st *state) pocketString() string {
+	var b strings.Builder
+	for _, color := range []chess.Color{chess.White, chess.Black} {
+		for i := len(pocketTypes) - 1; i >= 0; i-- {
+			char := pieceChar(chess.NewPiece(pocketTypes[i], color))
+			b.WriteString(strings.Repeat(char, st.pockets[side(color)][i]))
+		}
+	}
+	return b.String()
+}
+
+// castlingString writes Chess960 castling rights as X-FEN: K and Q for the
+// outermost rook on a side, the rook's file otherwise.
+func (st *state) castlingString() string {
+	board := st.pos.Board()
+	var b strings.Builder
+	for _, color := range []chess.Color{chess.White, chess.Black} {
+		for castleSide, letter := range []byte{'K', 'Q'} {
+			file := st.rooks[side(color)][castleSide]
+			if file == noRook {
+				continue
+			}
+			outermost := true
+			rook := chess.NewPiece(chess.Rook, color)
+			for f := file + 1; castleSide == kingSide && f <= chess.FileH; f++ {
+				outermost = outermost && board.Piece(chess.NewSquare(f, backRank(color))) != rook
+			}
+			for f := file - 1; castleSide == queenSide && f >= chess.FileA; f-- {
+				outermost = outermost && board.Piece(chess.NewSquare(f, backRank(color))) != rook
+			}
+			if !outermost {
+				letter = 'A' + byte(file)
+			}
+			if color == chess.Black {
+				letter |= 0x20
+			}
+			b.WriteByte(letter)
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+func pieceChar(p chess.Piece) string {
+	if p.Color() == chess.White {
+		return strings.ToUpper(p.Type().String())
+	}
+	return p.Type().String()
+}
+
+func pieceFromChar(r rune) (chess.PieceType, chess.Color, bool) {
+	color := chess.White
+	if r >= 'a' && r <= 'z' {
+		color = chess.Black
+	}
+	for _, pt := range chess.PieceTypes() {
+		if pt.String() == strings.ToLower(string(r)) {
+			return pt, color, true
+		}
+	}
+	return chess.NoPieceType, chess.NoColor, false
+}
@@ -0,0 +1,85 @@
+package variant
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFENRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		fen     string
+		want    string
+	}{
+		{"standard", Standard, StandardFEN, StandardFEN},
+		{"960 outermost rooks", Chess960, "1r1k1r1r/8/8/8/8/8/8/1R1K1R1R w BFbf - 0 1", "1r1k1r1r/8/8/8/8/8/8/1R1K1R1R w FQfq - 0 1"},
+		{"960 inner rook", Chess960, "1r1k1r1r/8/8/8/8/8/8/1R1K1R1R w Ff - 0 1", "1r1k1r1r/8/8/8/8/8/8/1R1K1R1R w Ff - 0 1"},
+		{"960 no castling", Chess960, "1r1k1r1r/8/8/8/8/8/8/1R1K1R1R w - - 0 1", "1r1k1r1r/8/8/8/8/8/8/1R1K1R1R w - - 0 1"},
+		{"crazyhouse", Crazyhouse, "r~3k3/8/8/8/8/8/8/4K3[QNpp] w - - 0 1", "r~3k3/8/8/8/8/8/8/4K3[QNpp] w - - 0 1"},
+		{"crazyhouse without pocket", Crazyhouse, "4k3/8/8/8/8/8/8/4K3 w - - 0 1", "4k3/8/8/8/8/8/8/4K3[] w - - 0 1"},
+		{"three-check", ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 1+2 0 1", "4k3/8/8/8/8/8/8/R3K3 w - - 1+2 0 1"},
+		{"three-check without counts", ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "4k3/8/8/8/8/8/8/R3K3 w - - 3+3 0 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBoard(tt.variant, tt.fen)
+			if err != nil {
+				t.Fatalf("NewBoard: %v", err)
+			}
+			if got := b.FEN(); got != tt.want {
+				t.Errorf("FEN = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFENRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		fen     string
+		err     error
+	}{
+		{"pocket outside crazyhouse", Standard, "4k3/8/8/8/8/8/8/4K3[N] w - - 0 1", ErrInvalidFEN},
+		{"promoted piece outside crazyhouse", Standard, "4k3/8/8/8/8/8/8/Q~3K3 w - - 0 1", ErrInvalidFEN},
+		{"king in pocket", Crazyhouse, "4k3/8/8/8/8/8/8/4K3[K] w - - 0 1", ErrInvalidFEN},
+		{"bad check count", ThreeCheck, "4k3/8/8/8/8/8/8/R3K3 w - - 4+3 0 1", ErrInvalidFEN},
+		{"castling without a rook", Standard, "4k3/8/8/8/8/8/8/4K3 w K - 0 1", ErrIllegalPosition},
+		{"960 castling without a rook", Chess960, "4k3/8/8/8/8/8/8/4K3 w K - 0 1", ErrIllegalPosition},
+		{"missing king", Standard, "8/8/8/8/8/8/8/4K3 w - - 0 1", ErrIllegalPosition},
+		{"pawn on the last rank", Standard, "P3k3/8/8/8/8/8/8/4K3 w - - 0 1", ErrIllegalPosition},
+		{"side not to move in check", Standard, "4k2R/8/8/8/8/8/8/4K3 w - - 0 1", ErrIllegalPosition},
+		{"no legal move", Standard, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", ErrIllegalPosition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewBoard(tt.variant, tt.fen); !errors.Is(err, tt.err) {
+				t.Errorf("NewBoard = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestChess960FEN(t *testing.T) {
+	if got := Chess960FEN(518); got != StandardFEN {
+		t.Errorf("Chess960FEN(518) = %s, want the standard position", got)
+	}
+	if got, want := Chess960FEN(0), "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"; got != want {
+		t.Errorf("Chess960FEN(0) = %s, want %s", got, want)
+	}
+
+	seen := make(map[string]bool)
+	for n := range 960 {
+		fen := Chess960FEN(n)
+		if seen[fen] {
+			t.Fatalf("Chess960FEN(%d) repeats %s", n, fen)
+		}
+		seen[fen] = true
+		if _, err := NewBoard(Chess960, fen); err != nil {
+			t.Fatalf("NewBoard(Chess960FEN(%d)): %v", n, err)
+		}
+	}
+}
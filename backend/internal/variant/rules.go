@@ -0,0 +1,348 @@
+package variant
+
+import (
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// noRook marks a side a player can no longer castle to in Chess960.
+const noRook chess.File = -1
+
+const (
+	kingSide  = 0
+	queenSide = 1
+)
+
+// pocketTypes are the pieces a Crazyhouse player can hold in hand.
+var pocketTypes = [5]chess.PieceType{chess.Pawn, chess.Knight, chess.Bishop, chess.Rook, chess.Queen}
+
+// pocket counts the pieces in hand, indexed like pocketTypes.
+type pocket [5]int
+
+func pocketIndex(pt chess.PieceType) int {
+	for i, t := range pocketTypes {
+		if t == pt {
+			return i
+		}
+	}
+	return -1
+}
+
+// state is a position with everything the variants track beyond what the
+// chess package does. The chess package handles castling except in Chess960,
+// where its castling rights are always cleared and rooks are tracked here.
+type state struct {
+	pos *chess.Position
+	// rooks are the files of the rooks each colour can still castle with,
+	// by side, in Chess960.
+	rooks [2][2]chess.File
+	// checks counts the checks given by each colour in Three-check.
+	checks [2]int
+	// pockets and promoted are the pieces in hand and the squares holding
+	// promoted pieces in Crazyhouse. A captured promoted piece goes to the
+	// pocket as a pawn.
+	pockets  [2]pocket
+	promoted uint64
+}
+
+// move is a legal move in a state. Drops and Chess960 castles are not
+// expressible as chess.Move and are handled here.
+type move struct {
+	uci    string
+	lib    *chess.Move
+	drop   chess.PieceType
+	to     chess.Square
+	castle int
+}
+
+func side(c chess.Color) int {
+	if c == chess.White {
+		return 0
+	}
+	return 1
+}
+
+func backRank(c chess.Color) chess.Rank {
+	if c == chess.White {
+		return chess.Rank1
+	}
+	return chess.Rank8
+}
+
+func bit(sq chess.Square) uint64 {
+	return 1 << uint(sq)
+}
+
+// legalMoves generates the moves of the side to move.
+func (v Variant) legalMoves(st *state) []move {
+	board := st.pos.Board()
+	turn := st.pos.Turn()
+	checked := inCheck(board, turn)
+
+	var moves []move
+	for _, m := range st.pos.ValidMoves() {
+		// Positions decoded from a FEN do not know they are in check, so the
+		// chess package may offer castling out of check.
+		castles := m.HasTag(chess.KingSideCastle) || m.HasTag(chess.QueenSideCastle)
+		if castles && checked {
+			continue
+		}
+		moves = append(moves, move{uci: chess.UCINotation{}.Encode(st.pos, m), lib: m, castle: -1})
+	}
+
+	if v == Chess960 && !checked {
+		for castleSide := range 2 {
+			if to, ok := st.castleTarget(castleSide); ok {
+				moves = append(moves, move{uci: to, castle: castleSide})
+			}
+		}
+	}
+
+	if v == Crazyhouse {
+		for i, pt := range pocketTypes {
+			if st.pockets[side(turn)][i] == 0 {
+				continue
+			}
+			for sq := chess.A1; sq <= chess.H8; sq++ {
+				if board.Piece(sq) != chess.NoPiece {
+					continue
+				}
+				if pt == chess.Pawn && (sq.Rank() == chess.Rank1 || sq.Rank() == chess.Rank8) {
+					continue
+				}
+				// A drop can only resolve a check by blocking it.
+				if checked {
+					pieces := board.SquareMap()
+					pieces[sq] = chess.NewPiece(pt, turn)
+					if inCheck(chess.NewBoard(pieces), turn) {
+						continue
+					}
+				}
+				moves = append(moves, move{
+					uci:    strings.ToUpper(pt.String()) + "@" + sq.String(),
+					drop:   pt,
+					to:     sq,
+					castle: -1,
+				})
+			}
+		}
+	}
+	return moves
+}
+
+// castleTarget reports whether the side to move can castle to castleSide in
+// Chess960 and returns the move in king-takes-rook notation.
+func (st *state) castleTarget(castleSide int) (string, bool) {
+	turn := st.pos.Turn()
+	rookFile := st.rooks[side(turn)][castleSide]
+	if rookFile == noRook {
+		return "", false
+	}
+	board := st.pos.Board()
+	rank := backRank(turn)
+	king := kingSquare(board, turn)
+	rook := chess.NewSquare(rookFile, rank)
+	if king == chess.NoSquare || king.Rank() != rank || board.Piece(rook) != chess.NewPiece(chess.Rook, turn) {
+		return "", false
+	}
+
+	kingTo, rookTo := castleSquares(castleSide, rank)
+	// Every square either piece crosses must be empty apart from the king
+	// and the rook themselves.
+	for _, path := range [][2]chess.Square{{king, kingTo}, {rook, rookTo}} {
+		lo, hi := min(path[0].File(), path[1].File()), max(path[0].File(), path[1].File())
+		for f := lo; f <= hi; f++ {
+			sq := chess.NewSquare(f, rank)
+			if sq != king && sq != rook && board.Piece(sq) != chess.NoPiece {
+				return "", false
+			}
+		}
+	}
+	// The king may not pass through or land on an attacked square. The
+	// castling pieces are lifted first: the rook may be shielding a square
+	// from an attack along the rank.
+	pieces := board.SquareMap()
+	delete(pieces, king)
+	delete(pieces, rook)
+	lifted := chess.NewBoard(pieces)
+	lo, hi := min(king.File(), kingTo.File()), max(king.File(), kingTo.File())
+	for f := lo; f <= hi; f++ {
+		if attacked(lifted, chess.NewSquare(f, rank), turn.Other()) {
+			return "", false
+		}
+	}
+	return king.String() + rook.String(), true
+}
+
+func castleSquares(castleSide int, rank chess.Rank) (kingTo, rookTo chess.Square) {
+	if castleSide == kingSide {
+		return chess.NewSquare(chess.FileG, rank), chess.NewSquare(chess.FileF, rank)
+	}
+	return chess.NewSquare(chess.FileC, rank), chess.NewSquare(chess.FileD, rank)
+}
+
+// play returns the state after mv, which must be legal.
+func (v Variant) play(st *state, mv move) *state {
+	next := &state{rooks: st.rooks, checks: st.checks, pockets: st.pockets, promoted: st.promoted}
+	turn := st.pos.Turn()
+	board := st.pos.Board()
+	halfMove := st.pos.HalfMoveClock() + 1
+	fullMove := fullMoveNumber(st.pos)
+	if turn == chess.Black {
+		fullMove++
+	}
+
+	switch {
+	case mv.drop != chess.NoPieceType:
+		pieces := board.SquareMap()
+		pieces[mv.to] = chess.NewPiece(mv.drop, turn)
+		next.pockets[side(turn)][pocketIndex(mv.drop)]--
+		if mv.drop == chess.Pawn {
+			halfMove = 0
+		}
+		next.pos = position(pieces, turn.Other(), st.pos.CastleRights().String(), halfMove, fullMove)
+
+	case mv.castle >= 0:
+		rank := backRank(turn)
+		king := kingSquare(board, turn)
+		rook := chess.NewSquare(st.rooks[side(turn)][mv.castle], rank)
+		kingTo, rookTo := castleSquares(mv.castle, rank)
+
+		pieces := board.SquareMap()
+		delete(pieces, king)
+		delete(pieces, rook)
+		pieces[kingTo] = chess.NewPiece(chess.King, turn)
+		pieces[rookTo] = chess.NewPiece(chess.Rook, turn)
+		next.rooks[side(turn)] = [2]chess.File{noRook, noRook}
+		next.pos = position(pieces, turn.Other(), "-", halfMove, fullMove)
+
+	default:
+		from, to := mv.lib.S1(), mv.lib.S2()
+		captured := board.Piece(to)
+		capturedOn := to
+		if mv.lib.HasTag(chess.EnPassant) {
+			capturedOn = chess.NewSquare(to.File(), from.Rank())
+			captured = board.Piece(capturedOn)
+		}
+		next.pos = st.pos.Update(mv.lib)
+
+		if v == Crazyhouse {
+			if captured != chess.NoPiece {
+				pt := captured.Type()
+				if st.promoted&bit(capturedOn) != 0 {
+					pt = chess.Pawn
+				}
+				next.pockets[side(turn)][pocketIndex(pt)]++
+			}
+			next.promoted &^= bit(capturedOn) | bit(to)
+			if st.promoted&bit(from) != 0 || mv.lib.Promo() != chess.NoPieceType {
+				next.promoted |= bit(to)
+			}
+			next.promoted &^= bit(from)
+		}
+
+		if v == Chess960 {
+			if board.Piece(from).Type() == chess.King {
+				next.rooks[side(turn)] = [2]chess.File{noRook, noRook}
+			}
+			for c, color := range []chess.Color{chess.White, chess.Black} {
+				for s, file := range next.rooks[c] {
+					if file == noRook {
+						continue
+					}
+					sq := chess.NewSquare(file, backRank(color))
+					if sq == from || sq == to {
+						next.rooks[c][s] = noRook
+					}
+				}
+			}
+		}
+	}
+
+	if v == ThreeCheck && inCheck(next.pos.Board(), turn.Other()) {
+		next.checks[side(turn)]++
+	}
+	return next
+}
+
+// position builds a chess.Position from a board after a move the chess
+// package cannot play itself.
+func position(pieces map[chess.Square]chess.Piece, turn chess.Color, castling string, halfMove int, fullMove int) *chess.Position {
+	fen := chess.NewBoard(pieces).String() + " " + turn.String() + " " + castling + " - " +
+		itoa(halfMove) + " " + itoa(fullMove)
+	pos, err := decodePosition(fen)
+	if err != nil {
+		// The board was derived from a valid position, so this cannot
+		// happen.
+		panic(err)
+	}
+	return pos
+}
+
+func kingSquare(board *chess.Board, c chess.Color) chess.Square {
+	king := chess.NewPiece(chess.King, c)
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		if board.Piece(sq) == king {
+			return sq
+		}
+	}
+	return chess.NoSquare
+}
+
+func inCheck(board *chess.Board, c chess.Color) bool {
+	king := kingSquare(board, c)
+	return king != chess.NoSquare && attacked(board, king, c.Other())
+}
+
+var (
+	knightSteps   = [8][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps     = [8][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookRays      = [4][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	bishopRays    = [4][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+	pawnAttackers = map[chess.Color]int{chess.White: -1, chess.Black: 1}
+)
+
+// attacked reports whether any piece of colour by attacks sq.
+func attacked(board *chess.Board, sq chess.Square, by chess.Color) bool {
+	file, rank := int(sq.File()), int(sq.Rank())
+	pieceAt := func(f, r int) chess.Piece {
+		if f < 0 || f > 7 || r < 0 || r > 7 {
+			return chess.NoPiece
+		}
+		return board.Piece(chess.NewSquare(chess.File(f), chess.Rank(r)))
+	}
+
+	for _, df := range []int{-1, 1} {
+		if pieceAt(file+df, rank+pawnAttackers[by]) == chess.NewPiece(chess.Pawn, by) {
+			return true
+		}
+	}
+	for _, step := range knightSteps {
+		if pieceAt(file+step[0], rank+step[1]) == chess.NewPiece(chess.Knight, by) {
+			return true
+		}
+	}
+	for _, step := range kingSteps {
+		if pieceAt(file+step[0], rank+step[1]) == chess.NewPiece(chess.King, by) {
+			return true
+		}
+	}
+
+	slides := func(rays [4][2]int, slider chess.PieceType) bool {
+		for _, ray := range rays {
+			for f, r := file+ray[0], rank+ray[1]; f >= 0 && f <= 7 && r >= 0 && r <= 7; f, r = f+ray[0], r+ray[1] {
+				p := pieceAt(f, r)
+				if p == chess.NoPiece {
+					continue
+				}
+				if p.Color() == by && (p.Type() == slider || p.Type() == chess.Queen) {
+					return true
+				}
+				break
+			}
+		}
+		return false
+	}
+	return slides(rookRays, chess.Rook) || slides(bishopRays, chess.Bishop)
+}
@@ -0,0 +1,61 @@
+package variant
+
+import (
+	"testing"
+)
+
+// perft counts the leaf nodes of the move tree depth plies deep.
+func perft(v Variant, st *state, depth int) int {
+	moves := v.legalMoves(st)
+	if depth == 1 {
+		return len(moves)
+	}
+	nodes := 0
+	for _, mv := range moves {
+		nodes += perft(v, v.play(st, mv), depth-1)
+	}
+	return nodes
+}
+
+func TestPerft(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		fen     string
+		nodes   []int
+	}{
+		{"start", Standard, StandardFEN, []int{20, 400, 8902}},
+		{"kiwipete", Standard, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862}},
+		{"endgame", Standard, "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812}},
+		{"promotions", Standard, "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467}},
+		{"castling rights", Standard, "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379}},
+
+		// Chess960 castling is generated by this package rather than the
+		// chess package, so positions with standard counts exercise it.
+		{"960 standard start", Chess960, StandardFEN, []int{20, 400, 8902}},
+		{"960 kiwipete", Chess960, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862}},
+		{"960 kiwipete shredder", Chess960, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w HAha - 0 1", []int{48, 2039, 97862}},
+		{"960 #1", Chess960, "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", []int{21, 528, 12189}},
+		{"960 #2", Chess960, "2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9", []int{21, 807, 18002}},
+		{"960 #3", Chess960, "b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9", []int{20, 479, 10471}},
+		{"960 #4", Chess960, "qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9", []int{22, 593, 13440}},
+		{"960 #5", Chess960, "1nbbnrkr/p1p1ppp1/3p4/1p3P1p/3Pq2P/8/PPP1P1P1/QNBBNRKR w HFhf - 0 9", []int{28, 1120, 31058}},
+
+		// No piece can be captured and dropped again within three plies.
+		{"crazyhouse start", Crazyhouse, StandardFEN, []int{20, 400, 8902}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := tt.variant.parseFEN(tt.fen)
+			if err != nil {
+				t.Fatalf("parseFEN: %v", err)
+			}
+			for i, want := range tt.nodes {
+				if got := perft(tt.variant, st, i+1); got != want {
+					t.Errorf("perft(%d) = %d, want %d", i+1, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package variant
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+var (
+	ErrUnknownVariant = errors.New("unknown variant")
+)
+
+// Variant selects the rules a game is played by.
+type Variant string
+
+const (
+	Standard      Variant = "standard"
+	Chess960      Variant = "chess960"
+	KingOfTheHill Variant = "kingOfTheHill"
+	ThreeCheck    Variant = "threeCheck"
+	Crazyhouse    Variant = "crazyhouse"
+)
+
+// Methods by which variant games end besides the standard ones.
+const (
+	MethodKingOfTheHill = "KingOfTheHill"
+	MethodThreeCheck    = "ThreeCheck"
+)
+
+// StandardFEN is the starting position of every variant except Chess960.
+const StandardFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// Parse returns the variant named s. An empty name is Standard.
+func Parse(s string) (Variant, error) {
+	switch Variant(s) {
+	case "", Standard:
+		return Standard, nil
+	case Chess960, KingOfTheHill, ThreeCheck, Crazyhouse:
+		return Variant(s), nil
+	}
+	return "", ErrUnknownVariant
+}
+
+// Name is the variant's name as used in PGN.
+func (v Variant) Name() string {
+	switch v {
+	case Chess960:
+		return "Chess960"
+	case KingOfTheHill:
+		return "King of the Hill"
+	case ThreeCheck:
+		return "Three-check"
+	case Crazyhouse:
+		return "Crazyhouse"
+	}
+	return "Standard"
+}
+
+// StartingFEN returns a starting position for a new game: a random one of
+// the 960 for Chess960 and the standard one otherwise.
+func (v Variant) StartingFEN() string {
+	if v == Chess960 {
+		return Chess960FEN(rand.IntN(960))
+	}
+	return StandardFEN
+}
+
+// knightPlacements places the two knights on the five squares left after the
+// bishops and the queen, indexed as in the Scharnagl numbering.
+var knightPlacements = [10][2]int{
+	{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2},
+	{1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4},
+}
+
+// Chess960FEN returns Chess960 starting position n, from 0 to 959, in the
+// Scharnagl numbering; position 518 is the standard one.
+func Chess960FEN(n int) string {
+	var rank [8]chess.PieceType
+
+	rank[2*(n%4)+1] = chess.Bishop
+	n /= 4
+	rank[2*(n%4)] = chess.Bishop
+	n /= 4
+	placeOnEmpty(&rank, n%6, chess.Queen)
+	n /= 6
+	knights := knightPlacements[n]
+	placeOnEmpty(&rank, knights[1], chess.Knight)
+	placeOnEmpty(&rank, knights[0], chess.Knight)
+	placeOnEmpty(&rank, 0, chess.Rook)
+	placeOnEmpty(&rank, 0, chess.King)
+	placeOnEmpty(&rank, 0, chess.Rook)
+
+	var back strings.Builder
+	for _, pt := range rank {
+		back.WriteString(pt.String())
+	}
+	black := back.String()
+	return black + "/pppppppp/8/8/8/8/PPPPPPPP/" + strings.ToUpper(black) + " w KQkq - 0 1"
+}
+
+// placeOnEmpty puts pt on the i-th empty square of the rank.
+func placeOnEmpty(rank *[8]chess.PieceType, i int, pt chess.PieceType) {
+	for file := range rank {
+		if rank[file] != chess.NoPieceType {
+			continue
+		}
+		if i == 0 {
+			rank[file] = pt
+			return
+		}
+		i--
+	}
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Adi-ty/chess/internal/analysis"
+	"github.com/Adi-ty/chess/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// analysisTimeout bounds the analysis of a single game.
+	analysisTimeout = 10 * time.Minute
+	// staleAnalysisAfter is how long an analysis may stay running before
+	// its worker is assumed dead and it is queued again.
+	staleAnalysisAfter = analysisTimeout + time.Minute
+)
+
+// AnalysisWorker runs the engine analysis of finished games, one at a time.
+type AnalysisWorker struct {
+	rdb      *redis.Client
+	analyses *analysis.Service
+}
+
+func NewAnalysisWorker(rdb *redis.Client, analyses *analysis.Service) *AnalysisWorker {
+	return &AnalysisWorker{
+		rdb:      rdb,
+		analyses: analyses,
+	}
+}
+
+func (w *AnalysisWorker) Start() {
+	go w.requeueStale()
+
+	for {
+		result, err := w.rdb.BRPop(context.Background(), 0, queue.AnalysisQueue).Result()
+		if err != nil {
+			log.Printf("Analysis worker dequeue error: %v", err)
+			time.Sleep(1 * time.Second) // Retry delay
+			continue
+		}
+
+		var payload queue.AnalysisPayload
+		if err := json.Unmarshal([]byte(result[1]), &payload); err != nil {
+			log.Printf("Analysis worker unmarshal error: %v", err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), analysisTimeout)
+		if err := w.analyses.Analyze(ctx, payload); err != nil {
+			log.Printf("Analysis of game %s failed: %v", payload.GameID, err)
+		}
+		cancel()
+	}
+}
+
+// requeueStale queues again, now and then periodically, the analyses of
+// workers that died mid-job.
+func (w *AnalysisWorker) requeueStale() {
+	ticker := time.NewTicker(staleAnalysisAfter)
+	defer ticker.Stop()
+
+	for {
+		if err := w.analyses.RequeueStale(context.Background(), time.Now().Add(-staleAnalysisAfter)); err != nil {
+			log.Printf("Failed to requeue stale analyses: %v", err)
+		}
+		<-ticker.C
+	}
+}
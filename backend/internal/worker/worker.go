@@ -3,7 +3,10 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/Adi-ty/chess/internal/queue"
@@ -11,38 +14,238 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// moveBatchSize is how many entries are read from the stream at once.
+	moveBatchSize = 10
+	// maxMoveAttempts is how many times an entry is written before it is
+	// dead-lettered.
+	maxMoveAttempts = 5
+	// retryDelay is how long a failed entry waits before it is retried,
+	// doubling with each attempt. Entries held that long by a worker that
+	// died are taken over the same way.
+	retryDelay = 5 * time.Second
+	// retryInterval is how often pending entries are checked.
+	retryInterval = time.Second
+	// orderRetries is how many times an entry that must wait for an earlier
+	// one of its game is tried again before it is left for retryPending.
+	orderRetries = 3
+	// orderDelay is how long such an entry waits between tries.
+	orderDelay = 100 * time.Millisecond
+)
+
+var errMalformedMove = errors.New("malformed move payload")
+
+// Worker writes the moves of the move stream to the database. Entries are
+// acknowledged once written, so those of a worker that crashes are retried
+// by another. The store applies each game's writes once and in order, so an
+// entry retried late waits for the earlier ones of its game instead of
+// overtaking them.
 type Worker struct {
 	rdb       *redis.Client
 	gameStore store.GameStore
+	consumer  string
 }
 
-func NewWorker(rdb *redis.Client, gameStore store.GameStore) *Worker {
+// NewWorker returns a worker reading the stream as consumer, which must be
+// unique among the replicas.
+func NewWorker(rdb *redis.Client, gameStore store.GameStore, consumer string) *Worker {
 	return &Worker{
 		rdb:       rdb,
 		gameStore: gameStore,
+		consumer:  consumer,
 	}
 }
 
 func (w *Worker) Start() {
+	ctx := context.Background()
+	w.createGroup(ctx)
+	w.migrateLegacyQueue(ctx)
+	go w.retryPending(ctx)
+
 	for {
-		// Dequeue and process moves
-		result, err := w.rdb.BRPop(context.Background(), 0, "moves_queue").Result()
+		streams, err := w.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    queue.MoveGroup,
+			Consumer: w.consumer,
+			Streams:  []string{queue.MoveStream, ">"},
+			Count:    moveBatchSize,
+			Block:    0,
+		}).Result()
 		if err != nil {
 			log.Printf("Worker dequeue error: %v", err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				w.createGroup(ctx)
+			}
 			time.Sleep(1 * time.Second) // Retry delay
 			continue
 		}
 
-		var payload queue.MovePayload
-		if err := json.Unmarshal([]byte(result[1]), &payload); err != nil {
-			log.Printf("Worker unmarshal error: %v", err)
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				w.process(ctx, msg, 1)
+			}
+		}
+	}
+}
+
+func (w *Worker) createGroup(ctx context.Context) {
+	err := w.rdb.XGroupCreateMkStream(ctx, queue.MoveStream, queue.MoveGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Worker group creation error: %v", err)
+	}
+}
+
+// migrateLegacyQueue moves the entries left in the list used before the
+// stream, oldest first.
+func (w *Worker) migrateLegacyQueue(ctx context.Context) {
+	for {
+		payload, err := w.rdb.RPop(ctx, queue.LegacyMoveQueue).Result()
+		if err == redis.Nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Worker legacy queue error: %v", err)
+			return
+		}
+		if err := queue.AddMove(ctx, w.rdb, payload); err != nil {
+			log.Printf("Worker legacy queue error: %v", err)
+			w.rdb.RPush(ctx, queue.LegacyMoveQueue, payload)
+			return
+		}
+	}
+}
+
+// process writes the entry on its attempt-th delivery. A failed entry stays
+// pending for retryPending, unless it was the last attempt or the payload
+// cannot be decoded: it is then dead-lettered, and its game resynced.
+func (w *Worker) process(ctx context.Context, msg redis.XMessage, attempt int64) {
+	payload, _ := msg.Values["payload"].(string)
+	err := w.write(ctx, payload)
+	// An earlier write of the game is usually being handled by another
+	// worker right now.
+	for try := 0; errors.Is(err, store.ErrMoveOutOfOrder) && try < orderRetries; try++ {
+		time.Sleep(orderDelay)
+		err = w.write(ctx, payload)
+	}
+	if err == nil {
+		w.ack(ctx, msg.ID)
+		return
+	}
+
+	log.Printf("Worker write error for entry %s (attempt %d): %v", msg.ID, attempt, err)
+	if attempt < maxMoveAttempts && !errors.Is(err, errMalformedMove) {
+		return
+	}
+
+	err = queue.AddDeadMove(ctx, w.rdb, queue.DeadMove{
+		EntryID:  msg.ID,
+		Payload:  payload,
+		Error:    err.Error(),
+		Attempts: int(attempt),
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Worker dead-letter error for entry %s: %v", msg.ID, err)
+		return
+	}
+	w.ack(ctx, msg.ID)
+	w.resync(ctx, payload)
+}
+
+// resync brings the stored moves of the game of a dead-lettered entry up to
+// date from its move log. Its later writes would otherwise wait for the
+// entry forever, and be dead-lettered in turn.
+func (w *Worker) resync(ctx context.Context, data string) {
+	var payload queue.MovePayload
+	if err := json.Unmarshal([]byte(data), &payload); err != nil || payload.Seq == 0 {
+		return
+	}
+
+	moves, seq, ok, err := queue.MoveLog(ctx, w.rdb, payload.GameID)
+	if err != nil {
+		log.Printf("Worker failed to read the move log of game %s: %v", payload.GameID, err)
+		return
+	}
+	if !ok {
+		log.Printf("Worker cannot resync game %s: its move log expired", payload.GameID)
+		return
+	}
+	if err := w.gameStore.ResetMoves(ctx, payload.GameID, moves, seq); err != nil {
+		log.Printf("Worker failed to resync the moves of game %s: %v", payload.GameID, err)
+		return
+	}
+	log.Printf("Worker resynced game %s from its move log up to write %d", payload.GameID, seq)
+}
+
+func (w *Worker) write(ctx context.Context, data string) error {
+	var payload queue.MovePayload
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedMove, err)
+	}
+
+	return w.gameStore.ApplyMove(ctx, payload)
+}
+
+// ack removes a handled entry from the stream.
+func (w *Worker) ack(ctx context.Context, id string) {
+	pipe := w.rdb.TxPipeline()
+	pipe.XAck(ctx, queue.MoveStream, queue.MoveGroup, id)
+	pipe.XDel(ctx, queue.MoveStream, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Worker ack error for entry %s: %v", id, err)
+	}
+}
+
+// retryPending claims the entries left unacknowledged for longer than their
+// backoff, whichever worker they were delivered to, and writes them again.
+func (w *Worker) retryPending(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pending, err := w.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: queue.MoveStream,
+			Group:  queue.MoveGroup,
+			Idle:   retryDelay,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			log.Printf("Worker pending error: %v", err)
 			continue
 		}
 
-		if err := w.gameStore.InsertMove(context.Background(), payload); err != nil {
-			log.Printf("Worker insert error: %v", err)
-			// TODO: re-enqueue or handle failure
+		for _, entry := range pending {
+			backoff := retryBackoff(entry.RetryCount)
+			if entry.Idle < backoff {
+				continue
+			}
+			// XCLAIM checks the idle time again, so only one worker
+			// gets the entry.
+			msgs, err := w.rdb.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   queue.MoveStream,
+				Group:    queue.MoveGroup,
+				Consumer: w.consumer,
+				MinIdle:  backoff,
+				Messages: []string{entry.ID},
+			}).Result()
+			if err != nil {
+				log.Printf("Worker claim error for entry %s: %v", entry.ID, err)
+				continue
+			}
+			for _, msg := range msgs {
+				w.process(ctx, msg, entry.RetryCount+1)
+			}
 		}
 	}
 }
 
+// retryBackoff is how long an entry delivered deliveries times waits before
+// its next attempt.
+func retryBackoff(deliveries int64) time.Duration {
+	backoff := retryDelay
+	for i := int64(1); i < deliveries && i < maxMoveAttempts; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS time_control VARCHAR(32) NOT NULL DEFAULT '-',
+    ADD COLUMN IF NOT EXISTS time_category VARCHAR(20) NOT NULL DEFAULT 'unlimited';
+
+CREATE INDEX idx_games_time_category ON games(time_category);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_games_time_category;
+ALTER TABLE games
+    DROP COLUMN IF EXISTS time_control,
+    DROP COLUMN IF EXISTS time_category;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(16) NOT NULL UNIQUE,
+    challenger_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dest_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    time_control VARCHAR(32) NOT NULL DEFAULT '-',
+    color VARCHAR(10) NOT NULL DEFAULT 'random',
+    rated BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    game_id UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    CHECK (status IN ('open', 'accepted', 'declined', 'cancelled'))
+);
+
+CREATE INDEX idx_challenges_challenger ON challenges(challenger_id, status);
+CREATE INDEX idx_challenges_dest_user ON challenges(dest_user_id, status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS challenges;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_games_white_user_started ON games(white_user_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_games_black_user_started ON games(black_user_id, started_at DESC);
+DROP INDEX IF EXISTS idx_games_white_user;
+DROP INDEX IF EXISTS idx_games_black_user;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_games_white_user ON games(white_user_id);
+CREATE INDEX IF NOT EXISTS idx_games_black_user ON games(black_user_id);
+DROP INDEX IF EXISTS idx_games_white_user_started;
+DROP INDEX IF EXISTS idx_games_black_user_started;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS game_analysis (
+    game_id UUID PRIMARY KEY REFERENCES games(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    depth INT NOT NULL DEFAULT 0,
+    white_accuracy DOUBLE PRECISION,
+    black_accuracy DOUBLE PRECISION,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS move_analysis (
+    game_id UUID NOT NULL REFERENCES game_analysis(game_id) ON DELETE CASCADE,
+    ply INT NOT NULL,
+    move VARCHAR(10) NOT NULL,
+    san VARCHAR(10) NOT NULL,
+    eval_cp INT,
+    eval_mate INT,
+    best_move VARCHAR(10) NOT NULL DEFAULT '',
+    best_line TEXT NOT NULL DEFAULT '',
+    classification VARCHAR(20) NOT NULL DEFAULT '',
+    PRIMARY KEY (game_id, ply)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS move_analysis;
+DROP TABLE IF EXISTS game_analysis;
+-- +goose StatementEnd
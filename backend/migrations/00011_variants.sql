@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS variant VARCHAR(20) NOT NULL DEFAULT 'standard',
+    ADD COLUMN IF NOT EXISTS initial_fen TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE challenges
+    ADD COLUMN IF NOT EXISTS variant VARCHAR(20) NOT NULL DEFAULT 'standard';
+
+CREATE INDEX idx_games_variant ON games(variant);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_games_variant;
+ALTER TABLE challenges
+    DROP COLUMN IF EXISTS variant;
+ALTER TABLE games
+    DROP COLUMN IF EXISTS variant,
+    DROP COLUMN IF EXISTS initial_fen;
+-- +goose StatementEnd
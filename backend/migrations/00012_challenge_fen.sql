@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE challenges
+    ADD COLUMN IF NOT EXISTS initial_fen TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE challenges
+    DROP COLUMN IF EXISTS initial_fen;
+-- +goose StatementEnd
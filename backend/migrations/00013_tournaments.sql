@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tournaments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'created',
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    time_control VARCHAR(32) NOT NULL,
+    variant VARCHAR(20) NOT NULL DEFAULT 'standard',
+    rated BOOLEAN NOT NULL DEFAULT TRUE,
+    rounds INT NOT NULL DEFAULT 0,
+    duration_seconds INT NOT NULL DEFAULT 0,
+    current_round INT NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CHECK (format IN ('swiss', 'arena')),
+    CHECK (status IN ('created', 'running', 'finished', 'cancelled'))
+);
+
+CREATE INDEX idx_tournaments_status ON tournaments(status, starts_at);
+
+CREATE TABLE IF NOT EXISTS tournament_players (
+    tournament_id UUID NOT NULL REFERENCES tournaments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating INT NOT NULL,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    buchholz DOUBLE PRECISION NOT NULL DEFAULT 0,
+    sonneborn_berger DOUBLE PRECISION NOT NULL DEFAULT 0,
+    rank INT NOT NULL DEFAULT 0,
+    withdrawn BOOLEAN NOT NULL DEFAULT FALSE,
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (tournament_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS tournament_pairings (
+    id BIGSERIAL PRIMARY KEY,
+    tournament_id UUID NOT NULL REFERENCES tournaments(id) ON DELETE CASCADE,
+    round INT NOT NULL,
+    game_id UUID REFERENCES games(id) ON DELETE SET NULL,
+    white_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    black_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    result VARCHAR(10) NOT NULL DEFAULT '',
+    white_points DOUBLE PRECISION NOT NULL DEFAULT 0,
+    black_points DOUBLE PRECISION NOT NULL DEFAULT 0,
+    white_berserk BOOLEAN NOT NULL DEFAULT FALSE,
+    black_berserk BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_tournament_pairings_tournament ON tournament_pairings(tournament_id, round);
+CREATE INDEX idx_tournament_pairings_game ON tournament_pairings(game_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS tournament_pairings;
+DROP TABLE IF EXISTS tournament_players;
+DROP TABLE IF EXISTS tournaments;
+-- +goose StatementEnd
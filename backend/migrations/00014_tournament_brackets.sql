@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tournaments
+    DROP CONSTRAINT IF EXISTS tournaments_format_check,
+    ADD CONSTRAINT tournaments_format_check CHECK (format IN ('swiss', 'arena', 'round_robin', 'knockout')),
+    ADD COLUMN IF NOT EXISTS round_interval_seconds INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS forfeit_after_seconds INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS match_games INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS tournament_rounds (
+    tournament_id UUID NOT NULL REFERENCES tournaments(id) ON DELETE CASCADE,
+    round INT NOT NULL,
+    scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE,
+
+    PRIMARY KEY (tournament_id, round)
+);
+
+CREATE TABLE IF NOT EXISTS tournament_matches (
+    id BIGSERIAL PRIMARY KEY,
+    tournament_id UUID NOT NULL REFERENCES tournaments(id) ON DELETE CASCADE,
+    round INT NOT NULL,
+    slot INT NOT NULL,
+    player1_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    player2_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    player1_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    player2_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    winner_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    UNIQUE (tournament_id, round, slot),
+    CHECK (status IN ('waiting', 'scheduled', 'playing', 'armageddon', 'finished'))
+);
+
+ALTER TABLE tournament_pairings
+    ADD COLUMN IF NOT EXISTS match_id BIGINT REFERENCES tournament_matches(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS armageddon BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tournament_pairings
+    DROP COLUMN IF EXISTS armageddon,
+    DROP COLUMN IF EXISTS match_id;
+
+DROP TABLE IF EXISTS tournament_matches;
+DROP TABLE IF EXISTS tournament_rounds;
+
+DELETE FROM tournaments WHERE format IN ('round_robin', 'knockout');
+ALTER TABLE tournaments
+    DROP COLUMN IF EXISTS match_games,
+    DROP COLUMN IF EXISTS forfeit_after_seconds,
+    DROP COLUMN IF EXISTS round_interval_seconds,
+    DROP CONSTRAINT IF EXISTS tournaments_format_check,
+    ADD CONSTRAINT tournaments_format_check CHECK (format IN ('swiss', 'arena'));
+-- +goose StatementEnd
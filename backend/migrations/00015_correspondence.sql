@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS to_move_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS move_deadline TIMESTAMPTZ;
+
+CREATE INDEX idx_games_move_deadline ON games(move_deadline) WHERE status = 'in_progress';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_games_move_deadline;
+
+ALTER TABLE games
+    DROP COLUMN IF EXISTS move_deadline,
+    DROP COLUMN IF EXISTS to_move_user_id;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE game_analysis
+    ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+
+CREATE INDEX idx_game_analysis_running ON game_analysis(started_at) WHERE status = 'running';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_game_analysis_running;
+
+ALTER TABLE game_analysis
+    DROP COLUMN IF EXISTS started_at;
+-- +goose StatementEnd
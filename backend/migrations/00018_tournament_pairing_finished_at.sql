@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tournament_pairings
+    ADD COLUMN IF NOT EXISTS finished_at TIMESTAMPTZ;
+
+UPDATE tournament_pairings SET finished_at = created_at WHERE result <> '' AND finished_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tournament_pairings
+    DROP COLUMN IF EXISTS finished_at;
+-- +goose StatementEnd
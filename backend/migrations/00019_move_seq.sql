@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS move_seq BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE games
+    DROP COLUMN IF EXISTS move_seq;
+-- +goose StatementEnd